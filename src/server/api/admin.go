@@ -0,0 +1,157 @@
+package api
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"ds_project/src/server/paxos"
+	"ds_project/src/server/recovery"
+)
+
+func (api *API) SetAcceptor(acceptor *paxos.Acceptor) {
+	api.acceptor = acceptor
+}
+
+func (api *API) SetRecoverer(recoverer *recovery.Recoverer) {
+	api.recoverer = recoverer
+}
+
+func (api *API) RecoverFromPeer(context *gin.Context) {
+	var body struct {
+		Peer string `json:"peer"`
+	}
+	if !bindBody(context, &body) {
+		return
+	}
+	if body.Peer == "" {
+		context.JSON(http.StatusBadRequest, gin.H{"error": "A peer address is required"})
+		return
+	}
+
+	if api.recoverer == nil {
+		context.JSON(http.StatusServiceUnavailable, gin.H{"error": "Recovery is not configured"})
+		return
+	}
+
+	done := api.recovering()
+	applied, err := api.recoverer.RecoverFrom(body.Peer)
+	done()
+	var diverged *recovery.ErrApplyDiverged
+	if errors.As(err, &diverged) {
+		context.JSON(http.StatusConflict, gin.H{
+			"error":            err.Error(),
+			"entries_applied":  applied,
+			"diverged_indices": diverged.Indices(),
+		})
+		return
+	}
+	if err != nil {
+		context.JSON(http.StatusBadGateway, gin.H{"error": "Recovery from " + body.Peer + " failed: " + err.Error()})
+		return
+	}
+	context.JSON(http.StatusOK, gin.H{
+		"peer":            body.Peer,
+		"entries_applied": applied,
+		"commit_index":    api.log.GetCommitIndex(),
+	})
+}
+
+// GetPendingInstances lists instances the local acceptor has accepted but not
+// seen committed, which is where a stuck instance shows up.
+func (api *API) GetPendingInstances(context *gin.Context) {
+	if api.acceptor == nil {
+		context.JSON(http.StatusServiceUnavailable, gin.H{"error": "Acceptor is not configured"})
+		return
+	}
+	pending := api.acceptor.PendingInstances()
+	context.JSON(http.StatusOK, gin.H{
+		"count":     len(pending),
+		"instances": pending,
+	})
+}
+
+// GetInstance handles GET /paxos/instances/:id: the local acceptor's state
+// for one instance, next to the round this node's proposer is on. The
+// proposer keeps one round for every instance, so that is the latest it has
+// tried anywhere.
+func (api *API) GetInstance(context *gin.Context) {
+	instanceId, err := strconv.ParseInt(context.Param("id"), 10, 64)
+	if err != nil {
+		context.JSON(http.StatusBadRequest, gin.H{"error": "Instance ID must be an integer"})
+		return
+	}
+	if api.acceptor == nil {
+		context.JSON(http.StatusServiceUnavailable, gin.H{"error": "Acceptor is not configured"})
+		return
+	}
+	state, known := api.acceptor.Instance(instanceId)
+	if !known {
+		context.JSON(http.StatusNotFound, gin.H{"error": fmt.Sprintf("Instance %d is unknown to this node", instanceId)})
+		return
+	}
+	context.JSON(http.StatusOK, gin.H{
+		"instance_id":     state.InstanceId,
+		"proposer_round":  api.proposer.Round().Proto(),
+		"last_round":      state.LastRound,
+		"last_good_round": state.LastGoodRound,
+		"value":           state.Value,
+		"decided":         state.Decided,
+		"decided_value":   state.DecidedValue,
+	})
+}
+
+// GetConfig reports the settings this node is running with right now, after
+// any updates from the cluster config in etcd.
+func (api *API) GetConfig(context *gin.Context) {
+	config := gin.H{
+		"proposer_timeout_ms": api.proposer.RPCTimeout().Milliseconds(),
+		"reservation_quota":   api.ReservationQuota(),
+		"max_speed_kmh":       api.MaxSpeedKmh(),
+		"apply_error_policy":  api.stateMachine.ApplyErrorPolicy(),
+		"command_ttl_ms":      api.CommandTTL().Milliseconds(),
+		"snapshot_retention":  api.stateMachine.SnapshotRetention(),
+		"require_signatures":  api.stateMachine.SigningKeys().Required,
+	}
+	if api.recoverer != nil {
+		config["recovery_strategy"] = api.recoverer.Strategy()
+	}
+	if api.membership != nil {
+		auth := api.membership.Auth()
+		config["etcd_username"] = auth.Username
+		config["etcd_tls"] = auth.UsesTLS()
+	}
+	context.JSON(http.StatusOK, config)
+}
+
+// GetBreakers shows which peers the proposer is currently skipping
+func (api *API) GetBreakers(context *gin.Context) {
+	context.JSON(http.StatusOK, gin.H{
+		"peers": api.proposer.PeerHealth(),
+	})
+}
+
+// GetPeers lists the peers the proposer sends to next to the members etcd
+// currently knows, so an operator can spot the two disagreeing.
+func (api *API) GetPeers(context *gin.Context) {
+	members := make([]string, 0)
+	if api.membership != nil {
+		for _, member := range api.membership.GetMembers() {
+			members = append(members, member.Address)
+		}
+	}
+	sort.Strings(members)
+	context.JSON(http.StatusOK, gin.H{
+		"peers":   api.proposer.Servers(),
+		"members": members,
+	})
+}
+
+// GetProposerStats reports how often this node's proposals ran into another
+// node's, which shows whether writes are really funneled through the leader.
+func (api *API) GetProposerStats(context *gin.Context) {
+	context.JSON(http.StatusOK, api.proposer.Stats())
+}
@@ -0,0 +1,32 @@
+package api
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// ErrEncodeCommand means the server couldn't encode a command it built. The
+// client's input was already accepted by then, so it is a server error.
+type ErrEncodeCommand struct {
+	Err error
+}
+
+func (e *ErrEncodeCommand) Error() string {
+	return "could not encode command: " + e.Err.Error()
+}
+
+func (e *ErrEncodeCommand) Unwrap() error {
+	return e.Err
+}
+
+// bindBody decodes the JSON request body into body. A missing or malformed
+// body gets a 400 here, so handlers never build a command from zero values
+// the client didn't send.
+func bindBody(context *gin.Context, body interface{}) bool {
+	if err := context.ShouldBindJSON(body); err != nil {
+		context.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request body: " + err.Error()})
+		return false
+	}
+	return true
+}
@@ -0,0 +1,40 @@
+package api
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// checkDistanceSplit turns away a split whose shares don't add up to the
+// released distance before it is proposed. Apply checks it again.
+func checkDistanceSplit(split map[string]int64, distance int64) error {
+	if len(split) == 0 {
+		return nil
+	}
+	var sum int64
+	for clientID, share := range split {
+		if clientID == "" {
+			return fmt.Errorf("distance_split has a share without a client ID")
+		}
+		if share < 0 {
+			return fmt.Errorf("distance_split gives client %s a negative share", clientID)
+		}
+		sum += share
+	}
+	if sum != distance {
+		return fmt.Errorf("distance_split sums to %d, the distance is %d", sum, distance)
+	}
+	return nil
+}
+
+// GetClientDistance handles GET /clients/:client_id/distance, the distance
+// split releases have attributed to the client for billing
+func (api *API) GetClientDistance(context *gin.Context) {
+	if !api.ensureConsistency(context) {
+		return
+	}
+	clientID := context.Param("client_id")
+	context.JSON(http.StatusOK, gin.H{"client_id": clientID, "distance": api.stateMachine.ClientDistance(clientID)})
+}
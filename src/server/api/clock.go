@@ -0,0 +1,21 @@
+package api
+
+import (
+	"time"
+)
+
+// Clock is the only place the API reads the time from. Commands are stamped
+// with it before proposing, so every replica applies the same timestamp.
+type Clock interface {
+	Now() time.Time
+}
+
+type SystemClock struct{}
+
+func (SystemClock) Now() time.Time {
+	return time.Now()
+}
+
+func (api *API) SetClock(clock Clock) {
+	api.clock = clock
+}
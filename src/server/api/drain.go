@@ -0,0 +1,83 @@
+package api
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+)
+
+const drainRetryAfterSeconds = 5
+
+// ErrDraining is returned for a write that arrives while the node drains
+type ErrDraining struct{}
+
+func (e *ErrDraining) Error() string {
+	return "Node is draining, retry against another node"
+}
+
+// Drain stops this node from accepting new writes. Reads and writes that
+// were already admitted keep going; WaitForWrites blocks until those finish.
+func (api *API) Drain() {
+	api.drainMutex.Lock()
+	api.draining = true
+	api.drainMutex.Unlock()
+	api.updateServing()
+}
+
+func (api *API) IsDraining() bool {
+	api.drainMutex.Lock()
+	defer api.drainMutex.Unlock()
+	return api.draining
+}
+
+func (api *API) WaitForWrites() {
+	api.inFlightWrites.Wait()
+}
+
+// SetReadOnly turns this node into a read-only replica that refuses every
+// write with 405. Set it before serving.
+func (api *API) SetReadOnly(readOnly bool) {
+	api.readOnly = readOnly
+}
+
+func (api *API) IsReadOnly() bool {
+	return api.readOnly
+}
+
+// admitWrite is the middleware in front of every write route. Admission and
+// the draining check happen under the same lock, so once Drain returns no
+// new write can be added to inFlightWrites.
+func (api *API) admitWrite(context *gin.Context) {
+	if api.readOnly {
+		context.AbortWithStatusJSON(http.StatusMethodNotAllowed, gin.H{"error": "Node is a read-only replica, send writes to another node"})
+		return
+	}
+
+	done, err := api.startWrite()
+	if err != nil {
+		context.Header("Retry-After", strconv.Itoa(drainRetryAfterSeconds))
+		context.AbortWithStatusJSON(http.StatusServiceUnavailable, gin.H{"error": err.Error()})
+		return
+	}
+	defer done()
+	context.Next()
+}
+
+// startWrite admits a write unless the node is draining, for admitWrite and
+// for writes that arrive other than through a write route. Call the returned
+// func once the write is finished.
+func (api *API) startWrite() (func(), error) {
+	api.drainMutex.Lock()
+	defer api.drainMutex.Unlock()
+	if api.draining {
+		return nil, &ErrDraining{}
+	}
+	api.inFlightWrites.Add(1)
+	return api.inFlightWrites.Done, nil
+}
+
+func (api *API) DrainHandler(context *gin.Context) {
+	api.Drain()
+	context.JSON(http.StatusOK, gin.H{"status": "Draining"})
+}
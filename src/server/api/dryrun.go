@@ -0,0 +1,53 @@
+package api
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"ds_project/src/server/statemachine"
+)
+
+// DryRun handles POST /debug/dryrun. It applies the command in the body to
+// a copy of the current state and reports how scooter_id would end up and
+// whether the command would be rejected, without proposing anything. The
+// command's scooter_id defaults to the target's.
+func (api *API) DryRun(context *gin.Context) {
+	var body struct {
+		ScooterID string                       `json:"scooter_id"`
+		Command   *statemachine.ScooterCommand `json:"command"`
+	}
+	if !bindBody(context, &body) {
+		return
+	}
+	if body.Command == nil {
+		context.JSON(http.StatusBadRequest, gin.H{"error": "command is required"})
+		return
+	}
+	if err := statemachine.ValidateScooterID(body.ScooterID); err != nil {
+		context.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	cmd := *body.Command
+	if cmd.ScooterID == "" {
+		cmd.ScooterID = body.ScooterID
+	}
+	if cmd.Timestamp == 0 {
+		cmd.Timestamp = api.clock.Now().UnixMilli()
+	}
+	if err := cmd.Validate(); err != nil {
+		context.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if !api.ensureConsistency(context) {
+		return
+	}
+
+	scooters, err := api.stateMachine.DryRun(cmd)
+	response := withScooter(gin.H{"scooter_id": body.ScooterID, "scooters": scooters, "applied": err == nil}, scooters, body.ScooterID)
+	if err != nil {
+		response["error"] = err.Error()
+	}
+	context.JSON(http.StatusOK, response)
+}
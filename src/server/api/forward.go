@@ -0,0 +1,155 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	"ds_project/src/server/connections"
+	"ds_project/src/server/paxos"
+	pb "ds_project/src/server/proto"
+	"ds_project/src/server/statemachine"
+)
+
+// ErrForwarded carries the leader's verdict on a forwarded write back to the
+// follower's client, keeping the status the leader would have answered with.
+type ErrForwarded struct {
+	Leader  string
+	Status  int
+	Message string
+}
+
+func (e *ErrForwarded) Error() string {
+	return "leader " + e.Leader + ": " + e.Message
+}
+
+// ErrForwardNotApplied means the leader committed a forwarded write but this
+// node didn't apply it in time to answer with its result. The write still
+// takes effect, so the client shouldn't simply send it again.
+type ErrForwardNotApplied struct {
+	Leader     string
+	InstanceId int64
+}
+
+func (e *ErrForwardNotApplied) Error() string {
+	return fmt.Sprintf("leader %s committed the write at instance %d, but it wasn't applied here in time", e.Leader, e.InstanceId)
+}
+
+// ErrNoLeader is returned for writes while membership knows of no leader,
+// rather than proposing into an election that is still settling.
+type ErrNoLeader struct{}
+
+func (e *ErrNoLeader) Error() string {
+	return "no leader available, retry"
+}
+
+// SetPeerConnections lets the API reach other nodes over conns. With it set,
+// followers hand writes to the leader instead of proposing them locally.
+func (api *API) SetPeerConnections(conns *connections.Manager) {
+	api.peerConns = conns
+}
+
+// forwardTarget returns the leader's address if writes on this node should
+// be forwarded there.
+func (api *API) forwardTarget() (string, bool) {
+	if api.peerConns == nil || api.membership == nil || api.isLeader() {
+		return "", false
+	}
+	return api.membership.LeaderAddress()
+}
+
+// forward proposes cmdBytes through the leader, then waits for the result to
+// be applied here so the client can read its own write from this node. The
+// result is the one this node's apply produced, which every replica agrees
+// on. If the apply doesn't happen in time it returns ErrForwardNotApplied.
+func (api *API) forward(ctx context.Context, leader string, cmdBytes []byte) (statemachine.Result, error) {
+	conn, err := api.peerConns.Get(leader)
+	if err != nil {
+		return nil, &ErrForwarded{Leader: leader, Status: http.StatusServiceUnavailable, Message: err.Error()}
+	}
+
+	resp, err := pb.NewForwardingClient(conn).ForwardPropose(ctx, &pb.ForwardProposeRequest{
+		Command: cmdBytes,
+	})
+	if err != nil {
+		return nil, &ErrForwarded{Leader: leader, Status: http.StatusServiceUnavailable, Message: err.Error()}
+	}
+	if resp.Status != http.StatusOK {
+		return nil, &ErrForwarded{Leader: leader, Status: int(resp.Status), Message: resp.Error}
+	}
+
+	if !api.waitForApplied(resp.InstanceId, boundedReadTimeout) {
+		return nil, &ErrForwardNotApplied{Leader: leader, InstanceId: resp.InstanceId}
+	}
+	if api.acceptor == nil {
+		return nil, nil
+	}
+	result, _ := api.acceptor.Result(resp.InstanceId)
+	return result, nil
+}
+
+// ForwardServer runs writes forwarded by followers through the local proposer.
+type ForwardServer struct {
+	pb.UnimplementedForwardingServer
+
+	api *API
+}
+
+func NewForwardServer(api *API) *ForwardServer {
+	return &ForwardServer{api: api}
+}
+
+// ForwardPropose holds a forwarded write to what a write route would: it is
+// refused while this node drains, counts as in flight until it finishes, and
+// must fit the size limit. The follower checked the command's TTL already,
+// but it may have taken a while to get here, so the leader checks again
+// before proposing.
+func (s *ForwardServer) ForwardPropose(ctx context.Context, req *pb.ForwardProposeRequest) (*pb.ForwardProposeResponse, error) {
+	if s.api.readOnly {
+		return &pb.ForwardProposeResponse{
+			InstanceId: -1,
+			Status:     http.StatusMethodNotAllowed,
+			Error:      "read-only replica does not propose",
+		}, nil
+	}
+
+	done, err := s.api.startWrite()
+	if err != nil {
+		return refusedForward(err), nil
+	}
+	defer done()
+
+	if err := s.api.checkCommandSize(req.Command); err != nil {
+		return refusedForward(err), nil
+	}
+
+	var cmd statemachine.ScooterCommand
+	if err := json.Unmarshal(req.Command, &cmd); err == nil {
+		if err := s.api.checkExpired(cmd); err != nil {
+			return refusedForward(err), nil
+		}
+	}
+
+	index, _, err := s.api.proposeBytes(ctx, req.Command, paxos.WriteProposal)
+	if err != nil {
+		return &pb.ForwardProposeResponse{
+			InstanceId: index,
+			Status:     int32(proposeErrorStatus(err)),
+			Error:      err.Error(),
+		}, nil
+	}
+	return &pb.ForwardProposeResponse{
+		InstanceId: index,
+		Status:     http.StatusOK,
+	}, nil
+}
+
+// refusedForward answers a forwarded write turned away before it was proposed
+func refusedForward(err error) *pb.ForwardProposeResponse {
+	return &pb.ForwardProposeResponse{
+		InstanceId: -1,
+		Status:     int32(proposeErrorStatus(err)),
+		Error:      err.Error(),
+	}
+}
@@ -0,0 +1,133 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net"
+	"net/http"
+	"strings"
+	"testing"
+
+	"google.golang.org/grpc"
+
+	"ds_project/src/server/connections"
+	pb "ds_project/src/server/proto"
+	"ds_project/src/server/statemachine"
+)
+
+func forwardedCreate(t *testing.T, scooterID string) *pb.ForwardProposeRequest {
+	t.Helper()
+	command, err := json.Marshal(statemachine.ScooterCommand{CommandType: statemachine.Create, ScooterID: scooterID})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &pb.ForwardProposeRequest{Command: command}
+}
+
+func TestForwardProposeProposesOnTheLeader(t *testing.T) {
+	leader := newSingleNode(t)
+	response, err := NewForwardServer(leader.api).ForwardPropose(context.Background(), forwardedCreate(t, "s"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if response.Status != http.StatusOK || response.InstanceId != 0 {
+		t.Fatalf("got %v, want 200 at instance 0", response)
+	}
+	if _, exists := leader.scooters.GetScooter("s"); !exists {
+		t.Fatal("the forwarded create wasn't applied on the leader")
+	}
+}
+
+func TestForwardProposeRefusedWhileDraining(t *testing.T) {
+	leader := newSingleNode(t)
+	leader.api.Drain()
+
+	response, err := NewForwardServer(leader.api).ForwardPropose(context.Background(), forwardedCreate(t, "s"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if response.Status != http.StatusServiceUnavailable || !strings.Contains(response.Error, "draining") {
+		t.Fatalf("got %v, want 503 for a draining leader", response)
+	}
+	if next := leader.log.PeekNextIndex(); next != 0 {
+		t.Fatalf("a draining leader allocated up to %d", next)
+	}
+	// Nothing was left counted as in flight
+	leader.api.WaitForWrites()
+}
+
+func TestForwardProposeRefusesOversizedCommands(t *testing.T) {
+	leader := newSingleNode(t)
+	leader.api.SetMaxCommandSize(64)
+
+	response, err := NewForwardServer(leader.api).ForwardPropose(context.Background(), forwardedCreate(t, strings.Repeat("s", 100)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if response.Status != http.StatusRequestEntityTooLarge {
+		t.Fatalf("got %v, want 413", response)
+	}
+	if next := leader.log.PeekNextIndex(); next != 0 {
+		t.Fatalf("an oversized command was allocated up to %d", next)
+	}
+}
+
+// serveLeader serves node's ForwardServer on localhost and returns its
+// address
+func serveLeader(t *testing.T, node *singleNode) string {
+	t.Helper()
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Skipf("can't listen on localhost: %v", err)
+	}
+	server := grpc.NewServer()
+	pb.RegisterForwardingServer(server, NewForwardServer(node.api))
+	go server.Serve(listener)
+	t.Cleanup(server.Stop)
+	return listener.Addr().String()
+}
+
+// The leader commits the write, but this follower never learns it, so it
+// can't answer with the write's result and says so instead of succeeding
+func TestForwardReportsWriteNotAppliedHere(t *testing.T) {
+	leader := newSingleNode(t)
+	address := serveLeader(t, leader)
+
+	follower := newSingleNode(t)
+	conns := connections.NewManager([]string{address})
+	defer conns.Close()
+	follower.api.SetPeerConnections(conns)
+
+	command := forwardedCreate(t, "s").Command
+	_, err := follower.api.forward(context.Background(), address, command)
+	var notApplied *ErrForwardNotApplied
+	if !errors.As(err, &notApplied) || notApplied.InstanceId != 0 || notApplied.Leader != address {
+		t.Fatalf("got %v, want ErrForwardNotApplied for instance 0 on %s", err, address)
+	}
+	if status := proposeErrorStatus(err); status != http.StatusGatewayTimeout {
+		t.Fatalf("status %d, want 504", status)
+	}
+	if _, exists := leader.scooters.GetScooter("s"); !exists {
+		t.Fatal("the leader didn't commit the write")
+	}
+
+	// An entry applied past the write's instance doesn't count while the
+	// write itself is missing here
+	noop, _ := json.Marshal(statemachine.ScooterCommand{CommandType: statemachine.Noop})
+	if _, err := follower.scooters.Apply(1, noop); err != nil {
+		t.Fatal(err)
+	}
+	if follower.api.waitForApplied(0, 0) {
+		t.Fatal("instance 0 counted as applied with only instance 1 applied")
+	}
+
+	// Once this node has applied everything up to the next write's
+	// instance, forwarding succeeds
+	if _, err := follower.scooters.Apply(0, noop); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := follower.api.forward(context.Background(), address, forwardedCreate(t, "t").Command); err != nil {
+		t.Fatalf("forwarding with the follower caught up: %v", err)
+	}
+}
@@ -1,19 +1,83 @@
 package api
 
 import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
 	"net/http"
 	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
 
 	"github.com/gin-gonic/gin"
+	"google.golang.org/grpc/health"
 	"ds_project/src/server/statemachine"
     "ds_project/src/server/paxos"
+    "ds_project/src/server/connections"
     "ds_project/src/server/log"
+    "ds_project/src/server/membership"
+    "ds_project/src/server/recovery"
 )
 
+const DefaultMaxCommandSize = 1 << 20
+
+const (
+	DefaultProposeTimeout = 5 * time.Second
+
+	proposeRetryAfterSeconds = 1
+)
+
+type ErrCommandTooLarge struct {
+	Size int
+	Max  int
+}
+
+func (e *ErrCommandTooLarge) Error() string {
+	return fmt.Sprintf("command is %d bytes, maximum is %d bytes", e.Size, e.Max)
+}
+
 type API struct {
 	stateMachine *statemachine.ScooterStateMachine
 	proposer     *paxos.Proposer
+	acceptor     *paxos.Acceptor
 	log          *log.ReplicatedLog
+
+	maxCommandSize int
+	proposeTimeout time.Duration
+	clock          Clock
+	ids            IDSource
+	reservationQuota int
+	maxSpeedKmh      float64
+	commandTTL       time.Duration
+	settingsMutex    sync.Mutex
+	recoverer        *recovery.Recoverer
+	membership       *membership.Membership
+	peerConns     *connections.Manager
+	leader        *atomic.Bool
+
+	readOnly       bool
+	allowSetState  bool
+	scooterLocks   scooterLocks
+	draining       bool
+	drainMutex     sync.Mutex
+	inFlightWrites sync.WaitGroup
+
+	healthServer *health.Server
+	ready        bool
+	recoveries   int
+	servingMutex sync.Mutex
+
+	heartbeat heartbeat
+	requests  requestMetrics
+	namespaceRoutes map[string]NamespaceRoutes
+	// snapshotMutex makes each POST /snapshot's check, snapshot and
+	// compaction one step
+	snapshotMutex sync.Mutex
 }
 
 func NewAPI(stateMachine *statemachine.ScooterStateMachine, proposer *paxos.Proposer, log *log.ReplicatedLog) *API {
@@ -21,70 +85,480 @@ func NewAPI(stateMachine *statemachine.ScooterStateMachine, proposer *paxos.Prop
 		stateMachine: stateMachine,
 		proposer:     proposer,
 		log:          log,
+		maxCommandSize: DefaultMaxCommandSize,
+		proposeTimeout: DefaultProposeTimeout,
+		clock:          SystemClock{},
+		ids:            RandomIDs{},
+		commandTTL:     DefaultCommandTTL,
 	}
 }
 
-func (api *API) GetScooters(context *gin.Context) {
-	if context.Query("linearizable") == "true" {
-		cmd := statemachine.ScooterCommand{
-			CommandType: statemachine.Noop,
+func (api *API) SetMaxCommandSize(size int) {
+	api.maxCommandSize = size
+}
+
+// SetProposeTimeout bounds how long a request may spend getting its command
+// chosen, 0 for no limit.
+func (api *API) SetProposeTimeout(timeout time.Duration) {
+	api.proposeTimeout = timeout
+}
+
+func (api *API) SetMembership(m *membership.Membership) {
+	api.membership = m
+}
+
+// SetReservationQuota is safe to call while serving; the etcd config watcher
+// uses it to change the quota at runtime.
+func (api *API) SetReservationQuota(quota int) {
+	api.settingsMutex.Lock()
+	defer api.settingsMutex.Unlock()
+	api.reservationQuota = quota
+}
+
+func (api *API) ReservationQuota() int {
+	api.settingsMutex.Lock()
+	defer api.settingsMutex.Unlock()
+	return api.reservationQuota
+}
+
+// SetMaxSpeedKmh sets the fastest average speed a release may imply, 0 to
+// accept any distance.
+func (api *API) SetMaxSpeedKmh(maxSpeed float64) {
+	api.settingsMutex.Lock()
+	defer api.settingsMutex.Unlock()
+	api.maxSpeedKmh = maxSpeed
+}
+
+func (api *API) MaxSpeedKmh() float64 {
+	api.settingsMutex.Lock()
+	defer api.settingsMutex.Unlock()
+	return api.maxSpeedKmh
+}
+
+// propose encodes cmd and runs it through Paxos at the next free instance.
+// Oversized commands are rejected here so they never reach the log. parent
+// only lends its values, such as the request ID; a client hanging up doesn't
+// cancel the proposal.
+func (api *API) propose(parent context.Context, cmd statemachine.ScooterCommand) error {
+	_, err := api.proposeResult(parent, cmd)
+	return err
+}
+
+// proposeResult is propose for handlers that answer with what the command
+// actually did: the state machine's result from applying it on this node.
+func (api *API) proposeResult(parent context.Context, cmd statemachine.ScooterCommand) (statemachine.Result, error) {
+	if cmd.Timestamp == 0 {
+		cmd.Timestamp = api.clock.Now().UnixMilli()
+	}
+	if err := cmd.Validate(); err != nil {
+		return nil, err
+	}
+	if cmd.CommandType != statemachine.Noop {
+		api.stampTTL(parent, &cmd)
+		if err := api.checkExpired(cmd); err != nil {
+			return nil, err
 		}
-		cmdBytes, _ := json.Marshal(cmd)
-		index := api.log.GetNextIndex()
-		_, err := api.proposer.Propose(int64(index), int64(index), cmdBytes)
+	}
+
+	cmdBytes, err := json.Marshal(cmd)
+	if err != nil {
+		return nil, &ErrEncodeCommand{Err: err}
+	}
+
+	class := paxos.WriteProposal
+	if cmd.CommandType == statemachine.Noop {
+		class = paxos.ReadProposal
+	}
+	return api.proposeEncoded(parent, cmdBytes, class)
+}
+
+// proposeEncoded is the part of proposeResult that doesn't depend on the
+// command's format: the size limit, the timeout and, for writes, leader
+// forwarding.
+func (api *API) proposeEncoded(parent context.Context, cmdBytes []byte, class paxos.ProposalClass) (statemachine.Result, error) {
+	if err := api.checkCommandSize(cmdBytes); err != nil {
+		return nil, err
+	}
+
+	ctx := context.WithoutCancel(parent)
+	if api.proposeTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, api.proposeTimeout)
+		defer cancel()
+	}
+
+	if class == paxos.WriteProposal {
+		if api.membership != nil && !api.membership.HasLeader() {
+			return nil, &ErrNoLeader{}
+		}
+		if leader, ok := api.forwardTarget(); ok {
+			return api.forward(ctx, leader, cmdBytes)
+		}
+	}
+
+	_, result, err := api.proposeBytes(ctx, cmdBytes, class)
+	return result, err
+}
+
+func (api *API) checkCommandSize(cmdBytes []byte) error {
+	if api.maxCommandSize > 0 && len(cmdBytes) > api.maxCommandSize {
+		return &ErrCommandTooLarge{Size: len(cmdBytes), Max: api.maxCommandSize}
+	}
+	return nil
+}
+
+// maxDecidedRetries bounds how many already-decided instances proposeBytes
+// skips before giving up
+const maxDecidedRetries = 10
+
+// proposeBytes runs an already encoded command through Paxos at the next
+// free instance and returns the instance it was proposed at along with the
+// local apply result. If recovery filled the allocated instance in the
+// meantime it moves on to a fresh one. It waits for a proposer slot in
+// class's queue first.
+func (api *API) proposeBytes(ctx context.Context, cmdBytes []byte, class paxos.ProposalClass) (int64, statemachine.Result, error) {
+	release, err := api.proposer.Admit(ctx, class)
+	if err != nil {
+		return -1, nil, err
+	}
+	defer release()
+
+	for attempt := 0; ; attempt++ {
+		index, err := api.log.AllocateIndex()
 		if err != nil {
-			context.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to ensure linearizability: " + err.Error()})
+			return index, nil, err
+		}
+		outcome, err := api.proposer.Propose(ctx, index, index, cmdBytes)
+
+		var decided *paxos.ErrInstanceDecided
+		if errors.As(err, &decided) && attempt < maxDecidedRetries {
+			continue
+		}
+		if err != nil && api.log.Abandon(index) {
+			go api.fillGap(index)
+		}
+		return index, outcome.Result, err
+	}
+}
+
+// fillGapBackoff caps the wait between fillGap's attempts
+const fillGapBackoff = 5 * time.Second
+
+// fillGap proposes a Noop at index, which this node abandoned with later
+// indexes already in use, until something is chosen there. Entries after a
+// gap aren't applied until it is filled.
+func (api *API) fillGap(index int64) {
+	noop, err := json.Marshal(statemachine.ScooterCommand{
+		CommandType: statemachine.Noop,
+		Timestamp:   api.clock.Now().UnixMilli(),
+	})
+	if err != nil {
+		fmt.Printf("Filling gap at %d: %v\n", index, err)
+		return
+	}
+
+	backoff := 100 * time.Millisecond
+	for api.log.GetEntry(index) == nil && api.stateMachine.AppliedIndex() < index {
+		err := api.proposeNoopAt(index, noop)
+		var decided *paxos.ErrInstanceDecided
+		if err == nil || errors.As(err, &decided) {
 			return
 		}
+		fmt.Printf("Filling gap at %d: %v\n", index, err)
+		time.Sleep(backoff)
+		backoff = min(2*backoff, fillGapBackoff)
 	}
+}
 
-	scooters := api.stateMachine.GetScooters()
-	context.JSON(http.StatusOK, scooters)
+func (api *API) proposeNoopAt(index int64, noop []byte) error {
+	ctx := context.Background()
+	if api.proposeTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, api.proposeTimeout)
+		defer cancel()
+	}
+	release, err := api.proposer.Admit(ctx, paxos.ReadProposal)
+	if err != nil {
+		return err
+	}
+	defer release()
+	_, err = api.proposer.Propose(ctx, index, index, noop)
+	return err
 }
 
-func (api *API) GetScooter(context *gin.Context) {
+// withScooter adds the scooter id as applying the command left it to a
+// write's response. It is left out when the result is unknown, e.g. a
+// forwarded write this node hadn't applied in time.
+func withScooter(response gin.H, result statemachine.Result, id string) gin.H {
+	scooters, _ := result.([]statemachine.Scooter)
+	for _, scooter := range scooters {
+		if scooter.ID == id {
+			response["scooter"] = scooter
+		}
+	}
+	return response
+}
+
+// waitForApplied polls until the state machine has applied every entry up
+// to index, giving up after timeout. An entry applied past a gap below it
+// doesn't count, since reads then would miss the missing commit.
+func (api *API) waitForApplied(index int64, timeout time.Duration) bool {
+	deadline := time.Now().Add(timeout)
+	for api.stateMachine.AppliedIndex() < index {
+		if time.Now().After(deadline) {
+			return false
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	return true
+}
+
+// proposeErrorStatus maps a proposer error to an HTTP status: losing to a
+// competing proposer is a conflict, not hearing back from enough nodes means
+// the cluster is unavailable for now.
+func proposeErrorStatus(err error) int {
+	var encodeErr *ErrEncodeCommand
+	var invalidID *statemachine.ErrInvalidScooterID
+	var forwarded *ErrForwarded
+	var notApplied *ErrForwardNotApplied
+	var noLeader *ErrNoLeader
+	var draining *ErrDraining
+	var tooFarAhead *log.ErrTooFarAhead
+	var deadline *paxos.ErrDeadline
+	var decided *paxos.ErrInstanceDecided
+	var tooLarge *ErrCommandTooLarge
+	var expired *ErrCommandExpired
+	var halted *statemachine.ErrHalted
+	var applyErr *paxos.ErrApply
+	var noQuorum *paxos.ErrNoQuorum
+	var prepareErr *paxos.ErrPreparePhase
+	var acceptErr *paxos.ErrAcceptPhase
+	var commitErr *paxos.ErrCommitPhase
+	var readIndexErr *paxos.ErrReadIndex
+
+	switch {
+	case errors.As(err, &encodeErr):
+		return http.StatusInternalServerError
+	case errors.As(err, &invalidID):
+		return http.StatusBadRequest
+	case errors.As(err, &forwarded):
+		return forwarded.Status
+	case errors.As(err, &notApplied):
+		return http.StatusGatewayTimeout
+	case errors.As(err, &noLeader):
+		return http.StatusServiceUnavailable
+	case errors.As(err, &draining):
+		return http.StatusServiceUnavailable
+	case errors.As(err, &tooFarAhead):
+		return http.StatusServiceUnavailable
+	case errors.As(err, &deadline), errors.Is(err, context.DeadlineExceeded):
+		return http.StatusServiceUnavailable
+	case errors.As(err, &decided):
+		return http.StatusServiceUnavailable
+	case errors.As(err, &tooLarge):
+		return http.StatusRequestEntityTooLarge
+	case errors.As(err, &expired):
+		return http.StatusConflict
+	case errors.As(err, &halted):
+		return http.StatusServiceUnavailable
+	case errors.As(err, &applyErr):
+		return http.StatusConflict
+	case errors.As(err, &noQuorum):
+		return http.StatusServiceUnavailable
+	case errors.As(err, &prepareErr):
+		if prepareErr.Rejected > 0 {
+			return http.StatusConflict
+		}
+		return http.StatusServiceUnavailable
+	case errors.As(err, &acceptErr):
+		if acceptErr.Rejected > 0 {
+			return http.StatusConflict
+		}
+		return http.StatusServiceUnavailable
+	case errors.As(err, &commitErr):
+		return http.StatusServiceUnavailable
+	case errors.As(err, &readIndexErr):
+		return http.StatusServiceUnavailable
+	}
+	return http.StatusInternalServerError
+}
+
+// respondProposeError answers with the status proposeErrorStatus picks for
+// err. A 503 means the cluster can't take the write right now, so it tells
+// the client when to come back.
+func respondProposeError(context *gin.Context, message string, err error) {
+	status := proposeErrorStatus(err)
+	if status == http.StatusServiceUnavailable {
+		context.Header("Retry-After", strconv.Itoa(proposeRetryAfterSeconds))
+	}
+	context.JSON(status, gin.H{"error": message + err.Error()})
+}
+
+const (
+	Linearizable = "linearizable"
+	Bounded      = "bounded"
+	Eventual     = "eventual"
+
+	boundedReadTimeout = 2 * time.Second
+	// readIndexWait is how long a linearizable read waits to apply up to
+	// the read index before falling back to a Noop round
+	readIndexWait = 500 * time.Millisecond
+)
+
+// ensureConsistency brings this node up to the freshness the client asked
+// for before a read. linearizable runs a Noop round, bounded waits for the
+// state machine to catch up with the locally known commit index, and
+// eventual serves whatever is applied. It writes the error response itself
+// and returns false if the read can't be served.
+func (api *API) ensureConsistency(context *gin.Context) bool {
+	mode := context.DefaultQuery("consistency", Eventual)
 	if context.Query("linearizable") == "true" {
-		cmd := statemachine.ScooterCommand{
-			CommandType: statemachine.Noop,
+		mode = Linearizable
+	}
+
+	switch mode {
+	case Linearizable:
+		// It takes a Paxos round, and read-only replicas never propose
+		if api.readOnly {
+			context.JSON(http.StatusMethodNotAllowed, gin.H{"error": "Linearizable reads need a voting node, this is a read-only replica"})
+			return false
 		}
-		cmdBytes, _ := json.Marshal(cmd)
-		index := api.log.GetNextIndex()
-		_, err := api.proposer.Propose(int64(index), int64(index), cmdBytes)
-		if err != nil {
-			context.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to ensure linearizability: " + err.Error()})
-			return
+		if err := api.confirmReadIndex(context.Request.Context()); err != nil {
+			respondProposeError(context, "Failed to ensure linearizability: ", err)
+			return false
+		}
+	case Bounded:
+		if !api.waitForApplied(api.log.GetCommitIndex(), boundedReadTimeout) {
+			context.JSON(http.StatusServiceUnavailable, gin.H{"error": "Timed out waiting for state to catch up with commit index"})
+			return false
+		}
+	case Eventual:
+	default:
+		context.JSON(http.StatusBadRequest, gin.H{"error": "Unknown consistency mode " + mode})
+		return false
+	}
+	return true
+}
+
+// confirmReadIndex makes sure this node has applied everything chosen before
+// the read started. It asks a majority for the highest instance they have
+// accepted and waits to apply that far, which takes no instance. If that
+// doesn't happen in time, e.g. an instance below the index was accepted by a
+// minority and never chosen, it falls back to proposing a Noop.
+func (api *API) confirmReadIndex(parent context.Context) error {
+	ctx := context.WithoutCancel(parent)
+	if api.proposeTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, api.proposeTimeout)
+		defer cancel()
+	}
+
+	index, err := api.proposer.ReadIndex(ctx)
+	if err != nil {
+		return err
+	}
+	if api.waitForApplied(index, readIndexWait) {
+		return nil
+	}
+	return api.propose(parent, statemachine.ScooterCommand{
+		CommandType: statemachine.Noop,
+	})
+}
+
+func (api *API) GetScooters(context *gin.Context) {
+	if !api.ensureConsistency(context) {
+		return
+	}
+
+	if ids, batch := context.GetQuery("ids"); batch {
+		api.getScootersByID(context, ids)
+		return
+	}
+
+	scooters := api.stateMachine.GetScooters()
+	public := make([]statemachine.Scooter, 0, len(scooters))
+	for _, scooter := range scooters {
+		public = append(public, scooter.Public())
+	}
+	context.JSON(http.StatusOK, public)
+}
+
+// getScootersByID answers GET /scooters?ids=a,b,c with just those scooters,
+// listing the IDs that don't exist under not_found. The caller has already
+// applied the requested consistency, so one round covers the whole batch.
+func (api *API) getScootersByID(context *gin.Context, ids string) {
+	scooters := make([]statemachine.Scooter, 0)
+	notFound := make([]string, 0)
+	seen := make(map[string]bool)
+
+	for _, id := range strings.Split(ids, ",") {
+		if id == "" || seen[id] {
+			continue
+		}
+		seen[id] = true
+
+		if scooter, exists := api.stateMachine.GetScooter(id); exists {
+			scooters = append(scooters, scooter.Public())
+		} else {
+			notFound = append(notFound, id)
 		}
 	}
 
+	context.JSON(http.StatusOK, gin.H{"scooters": scooters, "not_found": notFound})
+}
+
+func (api *API) GetScooter(context *gin.Context) {
+	if !api.ensureConsistency(context) {
+		return
+	}
+
 	scooter, exists := api.stateMachine.GetScooter(context.Param("id"))
 	if !exists {
 		context.JSON(http.StatusNotFound, gin.H{"error": "Scooter not found"})
 		return
 	}
-	context.JSON(http.StatusOK, scooter)
+	context.JSON(http.StatusOK, scooter.Public())
+}
+
+func (api *API) GetStats(context *gin.Context) {
+	if !api.ensureConsistency(context) {
+		return
+	}
+
+	context.JSON(http.StatusOK, api.stateMachine.GetStats())
 }
 
 func (api *API) CreateScooter(context *gin.Context) {
 	scooterID := context.Param("id")
 
-	_, exists := api.stateMachine.GetScooter(scooterID)
+	cmd := statemachine.ScooterCommand{
+		CommandType: statemachine.Create,
+		ScooterID: scooterID,
+	}
+	if err := cmd.Validate(); err != nil {
+		context.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	unlock := api.scooterLocks.lock(scooterID)
+	defer unlock()
+
+	scooter, exists := api.stateMachine.GetScooter(scooterID)
 	if exists {
+		if scooter.MatchesCreate(cmd) {
+			context.JSON(http.StatusOK, gin.H{"status": "Scooter already created", "id": scooterID})
+			return
+		}
 		context.JSON(http.StatusConflict, gin.H{"error": "Scooter already exists"})
 		return
 	}
 
-	cmd := statemachine.ScooterCommand{
-		CommandType: statemachine.Create,
-		ScooterID: scooterID,
-	}
-	cmdBytes, _ :=json.Marshal(cmd)
-	index := api.log.GetNextIndex()
-	_, err := api.proposer.Propose(int64(index), int64(index), cmdBytes)
+	result, err := api.proposeResult(context.Request.Context(), cmd)
 	if err != nil {
-		context.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		respondProposeError(context, "", err)
 		return
 	}
-	context.JSON(http.StatusOK, gin.H{"status": "Scooter created", "id": scooterID})
+	context.JSON(http.StatusOK, withScooter(gin.H{"status": "Scooter created", "id": scooterID}, result, scooterID))
 }
 
 func (api *API) ReserveScooter(context *gin.Context) {
@@ -92,8 +566,24 @@ func (api *API) ReserveScooter(context *gin.Context) {
 
 	var body struct {
 		ReservationID string `json:"reservation_id"`
+		Version       *int64 `json:"version"`
+		ClientID      string `json:"client_id"`
+		Signature     string `json:"signature"`
+	}
+	if !bindBody(context, &body) {
+		return
+	}
+
+	// A malformed ID can't name any scooter, so say why rather than 404
+	if err := statemachine.ValidateScooterID(scooterID); err != nil {
+		context.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
 	}
-	context.BindJSON(&body)
+
+	// Held until the proposal is decided, so a concurrent write to this
+	// scooter sees the outcome in its own checks instead of racing them
+	unlock := api.scooterLocks.lock(scooterID)
+	defer unlock()
 
 	scooter, exists := api.stateMachine.GetScooter(scooterID)
 	if !exists {
@@ -106,19 +596,48 @@ func (api *API) ReserveScooter(context *gin.Context) {
 		return
 	}
 
+	if scooter.OutOfService {
+		context.JSON(http.StatusConflict, gin.H{"error": "Scooter is out of service"})
+		return
+	}
+
+	if body.Version != nil && *body.Version != scooter.Version {
+		context.JSON(http.StatusConflict, gin.H{"error": "Scooter was modified", "version": scooter.Version})
+		return
+	}
+
+	quota := api.ReservationQuota()
+	if body.ClientID != "" && quota > 0 && api.stateMachine.ActiveReservations(body.ClientID) >= quota {
+		context.JSON(http.StatusTooManyRequests, gin.H{"error": "Client has reached its reservation quota"})
+		return
+	}
+
+	token, err := api.ids.NewID()
+	if err != nil {
+		context.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate a reservation token"})
+		return
+	}
+
 	cmd := statemachine.ScooterCommand{
 		CommandType: statemachine.Reserve,
 		ScooterID: scooterID,
 		ReservationID: body.ReservationID,
+		ExpectedVersion: body.Version,
+		ClientID: body.ClientID,
+		ReservationQuota: quota,
+		ReservationToken: token,
+		Signature: body.Signature,
 	}
-	cmdBytes, _ :=json.Marshal(cmd)
-	index := api.log.GetNextIndex()
-	_, err := api.proposer.Propose(int64(index), int64(index), cmdBytes)
+	if err := api.stateMachine.SigningKeys().Verify(cmd, body.ClientID); err != nil {
+		context.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+		return
+	}
+	result, err := api.proposeResult(context.Request.Context(), cmd)
 	if err != nil {
-		context.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		respondProposeError(context, "", err)
 		return
 	}
-	context.JSON(http.StatusOK, gin.H{"status": "Scooter reserved", "id": scooterID})
+	context.JSON(http.StatusOK, withScooter(gin.H{"status": "Scooter reserved", "id": scooterID, "reservation_token": token}, result, scooterID))
 }
 
 func (api *API) ReleaseScooter(context *gin.Context) {
@@ -126,13 +645,26 @@ func (api *API) ReleaseScooter(context *gin.Context) {
 
 	var body struct {
 		Distance int64 `json:"distance"`
+		ReservationToken string `json:"reservation_token"`
+		// DistanceSplit attributes shares of the distance to co-riders
+		DistanceSplit map[string]int64 `json:"distance_split"`
+		Signature string `json:"signature"`
+	}
+	if !bindBody(context, &body) {
+		return
 	}
-	context.BindJSON(&body)
 
 	if body.Distance < 0 {
 		context.JSON(http.StatusBadRequest, gin.H{"error": "Distance cannot be negative"})
 		return
 	}
+	if err := checkDistanceSplit(body.DistanceSplit, body.Distance); err != nil {
+		context.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	unlock := api.scooterLocks.lock(scooterID)
+	defer unlock()
 
 	scooter, exists := api.stateMachine.GetScooter(scooterID)
 	if !exists {
@@ -145,42 +677,407 @@ func (api *API) ReleaseScooter(context *gin.Context) {
 		return
 	}
 
+	if !scooter.HeldBy(body.ReservationToken) {
+		context.JSON(http.StatusForbidden, gin.H{"error": "Reservation token does not match"})
+		return
+	}
+
+	// The check and the command share a timestamp so every replica reaches
+	// the same verdict as this one
+	now := api.clock.Now().UnixMilli()
+	maxSpeed := api.MaxSpeedKmh()
+	if !scooter.PlausibleRelease(body.Distance, now, maxSpeed) {
+		context.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("Distance implies more than %.0f km/h", maxSpeed)})
+		return
+	}
+
 	cmd := statemachine.ScooterCommand{
 		CommandType: statemachine.Release,
 		ScooterID: scooterID,
 		Distance: body.Distance,
+		Timestamp: now,
+		MaxSpeedKmh: maxSpeed,
+		ReservationToken: body.ReservationToken,
+		DistanceSplit: body.DistanceSplit,
+		Signature: body.Signature,
+	}
+	// Only the rider holding the reservation may sign its release
+	if err := api.stateMachine.SigningKeys().Verify(cmd, scooter.ClientID); err != nil {
+		context.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+		return
 	}
 
-	cmdBytes, _ :=json.Marshal(cmd)
+	result, err := api.proposeResult(context.Request.Context(), cmd)
+	if err != nil {
+		respondProposeError(context, "", err)
+		return
+	}
+	context.JSON(http.StatusOK, withScooter(gin.H{"status": "Scooter released", "id": scooterID}, result, scooterID))
+}
 
-	index := api.log.GetNextIndex()
-	_, err := api.proposer.Propose(int64(index), int64(index), cmdBytes)
+func (api *API) RelabelScooter(context *gin.Context) {
+	scooterID := context.Param("id")
+
+	var body struct {
+		NewID string `json:"new_id"`
+	}
+	if !bindBody(context, &body) {
+		return
+	}
+
+	if body.NewID == "" {
+		context.JSON(http.StatusBadRequest, gin.H{"error": "new_id is required"})
+		return
+	}
+	if err := statemachine.ValidateScooterID(body.NewID); err != nil {
+		context.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	unlock := api.scooterLocks.lock(scooterID, body.NewID)
+	defer unlock()
+
+	if _, exists := api.stateMachine.GetScooter(scooterID); !exists {
+		context.JSON(http.StatusNotFound, gin.H{"error": "Scooter not found"})
+		return
+	}
+
+	if _, exists := api.stateMachine.GetScooter(body.NewID); exists {
+		context.JSON(http.StatusConflict, gin.H{"error": "A scooter with the new ID already exists"})
+		return
+	}
+
+	cmd := statemachine.ScooterCommand{
+		CommandType: statemachine.Relabel,
+		ScooterID: scooterID,
+		NewScooterID: body.NewID,
+	}
+	result, err := api.proposeResult(context.Request.Context(), cmd)
 	if err != nil {
-		context.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		respondProposeError(context, "", err)
 		return
 	}
-	context.JSON(http.StatusOK, gin.H{"status": "Scooter released", "id": scooterID})
+	context.JSON(http.StatusOK, withScooter(gin.H{"status": "Scooter relabeled", "id": body.NewID, "old_id": scooterID}, result, body.NewID))
 }
 
+// MergeScooter folds the scooter named by source_id into this one, adding
+// its distance and deleting it. Both must be available.
+func (api *API) MergeScooter(context *gin.Context) {
+	scooterID := context.Param("id")
+
+	var body struct {
+		SourceID string `json:"source_id"`
+	}
+	if !bindBody(context, &body) {
+		return
+	}
+
+	if body.SourceID == "" {
+		context.JSON(http.StatusBadRequest, gin.H{"error": "source_id is required"})
+		return
+	}
+	if body.SourceID == scooterID {
+		context.JSON(http.StatusBadRequest, gin.H{"error": "A scooter can't be merged into itself"})
+		return
+	}
+
+	unlock := api.scooterLocks.lock(scooterID, body.SourceID)
+	defer unlock()
+
+	for _, id := range []string{scooterID, body.SourceID} {
+		scooter, exists := api.stateMachine.GetScooter(id)
+		if !exists {
+			context.JSON(http.StatusNotFound, gin.H{"error": "Scooter " + id + " not found"})
+			return
+		}
+		if !scooter.IsAvailable {
+			context.JSON(http.StatusConflict, gin.H{"error": "Scooter " + id + " is reserved"})
+			return
+		}
+	}
+
+	cmd := statemachine.ScooterCommand{
+		CommandType: statemachine.Merge,
+		ScooterID: scooterID,
+		SourceScooterID: body.SourceID,
+	}
+	result, err := api.proposeResult(context.Request.Context(), cmd)
+	if err != nil {
+		respondProposeError(context, "", err)
+		return
+	}
+	context.JSON(http.StatusOK, withScooter(gin.H{"status": "Scooters merged", "id": scooterID, "source_id": body.SourceID}, result, scooterID))
+}
+
+// SetServiceState takes a scooter out of service or returns it. An
+// out-of-service scooter keeps its history but can't be reserved.
+func (api *API) SetServiceState(context *gin.Context) {
+	scooterID := context.Param("id")
+
+	var body struct {
+		OutOfService *bool `json:"out_of_service"`
+	}
+	if !bindBody(context, &body) {
+		return
+	}
+
+	if body.OutOfService == nil {
+		context.JSON(http.StatusBadRequest, gin.H{"error": "out_of_service is required"})
+		return
+	}
+
+	unlock := api.scooterLocks.lock(scooterID)
+	defer unlock()
+
+	if _, exists := api.stateMachine.GetScooter(scooterID); !exists {
+		context.JSON(http.StatusNotFound, gin.H{"error": "Scooter not found"})
+		return
+	}
+
+	cmd := statemachine.ScooterCommand{
+		CommandType: statemachine.SetServiceState,
+		ScooterID: scooterID,
+		OutOfService: *body.OutOfService,
+	}
+	result, err := api.proposeResult(context.Request.Context(), cmd)
+	if err != nil {
+		respondProposeError(context, "", err)
+		return
+	}
+	context.JSON(http.StatusOK, withScooter(gin.H{"status": "Service state updated", "id": scooterID, "out_of_service": *body.OutOfService}, result, scooterID))
+}
+
+// DeleteScooter removes an available scooter. Reserved scooters have to be
+// released first; the state machine makes the final call.
+func (api *API) DeleteScooter(context *gin.Context) {
+	scooterID := context.Param("id")
+
+	unlock := api.scooterLocks.lock(scooterID)
+	defer unlock()
+
+	scooter, exists := api.stateMachine.GetScooter(scooterID)
+	if !exists {
+		context.JSON(http.StatusNotFound, gin.H{"error": "Scooter not found"})
+		return
+	}
+	if !scooter.IsAvailable {
+		context.JSON(http.StatusConflict, gin.H{"error": "Scooter is reserved"})
+		return
+	}
+
+	cmd := statemachine.ScooterCommand{
+		CommandType: statemachine.Delete,
+		ScooterID: scooterID,
+	}
+	err := api.propose(context.Request.Context(), cmd)
+	if err != nil {
+		respondProposeError(context, "", err)
+		return
+	}
+	context.JSON(http.StatusOK, gin.H{"status": "Scooter deleted", "id": scooterID})
+}
 
 func (api *API) RegisterRoutes(router *gin.Engine) {
+	// Before the routes, since gin only applies middleware to routes added
+	// after it
+	router.Use(api.requests.record)
 	router.GET("/scooters", api.GetScooters)
+	router.GET("/scooters/stats", api.GetStats)
+	router.GET("/scooters/search", api.SearchScooters)
+	router.GET("/scooters/top", api.TopScooters)
 	router.GET("/scooters/:id", api.GetScooter)
-	router.PUT("/scooters/:id", api.CreateScooter)
-	router.POST("/scooters/:id/reservations", api.ReserveScooter)
-	router.POST("/scooters/:id/releases", api.ReleaseScooter)
+	router.POST("/scooters/import", api.admitWrite, api.readCreatedAt, api.ImportScooters)
+	router.PUT("/scooters/:id", api.admitWrite, api.readCreatedAt, api.CreateScooter)
+	router.DELETE("/scooters/:id", api.admitWrite, api.readCreatedAt, api.DeleteScooter)
+	router.POST("/scooters/:id/reservations", api.admitWrite, api.readCreatedAt, api.ReserveScooter)
+	router.POST("/scooters/:id/releases", api.admitWrite, api.readCreatedAt, api.ReleaseScooter)
+	router.POST("/scooters/:id/relabel", api.admitWrite, api.readCreatedAt, api.RelabelScooter)
+	router.POST("/scooters/:id/merge", api.admitWrite, api.readCreatedAt, api.MergeScooter)
+	router.POST("/scooters/:id/service", api.admitWrite, api.readCreatedAt, api.SetServiceState)
+	router.POST("/transactions", api.admitWrite, api.readCreatedAt, api.Transact)
+	router.GET("/reservations", api.GetReservations)
+	router.GET("/clients/:client_id/distance", api.GetClientDistance)
+	router.DELETE("/reservations/:reservation_id", api.admitWrite, api.readCreatedAt, api.CancelReservation)
+	router.GET("/lag", api.GetLag)
+	router.GET("/health", api.GetHealth)
+	router.GET("/metrics", api.GetMetrics)
+	router.GET("/proposer/stats", api.GetProposerStats)
+	router.GET("/version", api.GetVersion)
+	router.GET("/log", api.GetLogRange)
+	router.GET("/log/:index", api.GetLogEntry)
+	router.POST("/admin/drain", api.DrainHandler)
+	router.POST("/admin/recover", api.RecoverFromPeer)
+	router.GET("/admin/instances/pending", api.GetPendingInstances)
+	router.GET("/paxos/instances/:id", api.GetInstance)
+	router.GET("/admin/config", api.GetConfig)
+	router.GET("/admin/state-hash", api.CompareStateHashes)
+	router.GET("/admin/heartbeat", api.GetHeartbeat)
+	router.GET("/admin/breakers", api.GetBreakers)
+	router.GET("/admin/peers", api.GetPeers)
+	router.POST("/debug/dryrun", api.DryRun)
+	router.GET("/admin/snapshots", api.GetSnapshots)
+	router.POST("/admin/snapshots/:index/restore", api.RestoreSnapshot)
+	router.PUT("/admin/scooters/:id/state", api.admitWrite, api.readCreatedAt, api.SetScooterState)
+	api.registerNamespaceRoutes(router)
 }
 
+// RegisterWitnessRoutes is all a witness serves: it holds no scooters, so
+// only its health and its Paxos side are worth asking about.
+func (api *API) RegisterWitnessRoutes(router *gin.Engine) {
+	router.GET("/health", api.GetHealth)
+	router.GET("/version", api.GetVersion)
+	router.GET("/metrics", api.GetMetrics)
+	router.GET("/admin/instances/pending", api.GetPendingInstances)
+	router.GET("/paxos/instances/:id", api.GetInstance)
+}
+
+// TakeSnapshot handles POST /snapshot: snapshot at the commit index, then
+// compact the log. A retry at the same commit index takes no new snapshot
+// but still compacts, so one whose compaction failed finishes it.
 func (api *API) TakeSnapshot(context *gin.Context) {
+	api.snapshotMutex.Lock()
+	defer api.snapshotMutex.Unlock()
+
 	index := api.log.GetCommitIndex()
-	err := api.stateMachine.TakeSnapshot(index)
-	if err != nil {
+	status := "Snapshot taken"
+	if data, existing := api.stateMachine.GetSnapshot(); len(data) > 0 && existing == index {
+		status = "Snapshot already taken"
+	} else if err := api.stateMachine.TakeSnapshot(index); err != nil {
 		context.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
-	api.log.Store(index)
-	context.JSON(http.StatusOK, gin.H{"status": "Snapshot taken", "index": index})
+
+	compactTo := index
+	if api.membership != nil {
+		watermark, err := api.membership.CompactionWatermark(context.Request.Context(), index)
+		if err != nil {
+			context.JSON(http.StatusInternalServerError, gin.H{"error": "Snapshot taken but failed to read compaction watermark: " + err.Error()})
+			return
+		}
+		compactTo = watermark
+	}
+	// Keep the log every retained snapshot needs to be restored from
+	if oldest := api.stateMachine.OldestSnapshotIndex(); oldest < compactTo {
+		compactTo = oldest
+	}
+	if compactTo >= 0 {
+		api.log.Store(compactTo)
+	}
+	context.JSON(http.StatusOK, gin.H{"status": status, "index": index, "compacted_to": compactTo, "stored_index": api.log.GetStoredIndex()})
+}
+
+
+
+
+
+func (api *API) GetLag(context *gin.Context) {
+	commitIndex := api.log.GetCommitIndex()
+	appliedIndex := api.stateMachine.AppliedIndex()
+
+	lag := commitIndex - appliedIndex
+	if lag < 0 {
+		lag = 0
+	}
+	context.JSON(http.StatusOK, gin.H{
+		"commit_index":  commitIndex,
+		"applied_index": appliedIndex,
+		"next_index":    api.log.PeekNextIndex(),
+		"lag":           lag,
+	})
+}
+
+// GetHealth handles GET /health: 503 once the state machine has halted
+// under the halt apply error policy, 200 otherwise.
+func (api *API) GetHealth(context *gin.Context) {
+	policy := api.stateMachine.ApplyErrorPolicy()
+	if err := api.stateMachine.HaltError(); err != nil {
+		context.JSON(http.StatusServiceUnavailable, gin.H{
+			"status":             "halted",
+			"apply_error_policy": policy,
+			"read_only":          api.readOnly,
+			"error":              err.Error(),
+		})
+		return
+	}
+	context.JSON(http.StatusOK, gin.H{
+		"status":             "ok",
+		"apply_error_policy": policy,
+		"read_only":          api.readOnly,
+	})
 }
 
+func (api *API) GetLogEntry(context *gin.Context) {
+	index, err := strconv.ParseInt(context.Param("index"), 10, 64)
+	if err != nil {
+		context.JSON(http.StatusBadRequest, gin.H{"error": "Invalid log index"})
+		return
+	}
 
+	entry := api.log.GetEntry(index)
+	if entry == nil {
+		context.JSON(http.StatusNotFound, gin.H{"error": "Log entry not found or compacted"})
+		return
+	}
+	context.JSON(http.StatusOK, logEntryResponse(entry))
+}
+
+// logEntryResponse shows an entry without the secrets its command carries:
+// a reservation token in the log would let any reader release someone
+// else's scooter. raw is the redacted command's bytes, base64 encoded by
+// gin, since the stored bytes hold the secrets; their hash still lets
+// replicas' logs be compared.
+func logEntryResponse(entry *log.LogEntry) gin.H {
+	sum := sha256.Sum256(entry.Command)
+	response := gin.H{"index": entry.Index, "raw_sha256": hex.EncodeToString(sum[:]), "committed_at": entry.CommittedAt}
+	if entry.ApplyError != "" {
+		response["apply_error"] = entry.ApplyError
+	}
+	var cmd statemachine.ScooterCommand
+	if err := json.Unmarshal(entry.Command, &cmd); err == nil {
+		redacted := cmd.Redacted()
+		response["command"] = redacted
+		if raw, err := json.Marshal(redacted); err == nil {
+			response["raw"] = raw
+		}
+	}
+	return response
+}
+
+// MaxLogSpan caps how many instances one GET /log may cover
+const MaxLogSpan = 1000
+
+// GetLogRange handles GET /log?from=&to=, listing every instance in the
+// inclusive range. to defaults to the commit index, within MaxLogSpan of
+// from. Instances already compacted away are marked compacted, ones not
+// committed here yet are marked missing.
+func (api *API) GetLogRange(context *gin.Context) {
+	from, err := strconv.ParseInt(context.Query("from"), 10, 64)
+	if err != nil || from < 0 {
+		context.JSON(http.StatusBadRequest, gin.H{"error": "from must be a non-negative log index"})
+		return
+	}
+	to := min(api.log.GetCommitIndex(), from+MaxLogSpan-1)
+	if value, set := context.GetQuery("to"); set {
+		if to, err = strconv.ParseInt(value, 10, 64); err != nil || to < from {
+			context.JSON(http.StatusBadRequest, gin.H{"error": "to must be a log index no smaller than from"})
+			return
+		}
+	}
+	if to-from+1 > MaxLogSpan {
+		context.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("Range covers %d instances, at most %d allowed", to-from+1, MaxLogSpan)})
+		return
+	}
 
+	storedIndex := api.log.GetStoredIndex()
+	entries := make([]gin.H, 0)
+	for index := from; index <= to; index++ {
+		if entry := api.log.GetEntry(index); entry != nil {
+			entries = append(entries, logEntryResponse(entry))
+		} else if index < storedIndex {
+			entries = append(entries, gin.H{"index": index, "compacted": true})
+		} else {
+			entries = append(entries, gin.H{"index": index, "missing": true})
+		}
+	}
+	context.JSON(http.StatusOK, gin.H{"from": from, "to": to, "entries": entries})
+}
@@ -0,0 +1,150 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+
+	"ds_project/src/server/log"
+	"ds_project/src/server/paxos"
+	"ds_project/src/server/statemachine"
+)
+
+// singleNode is an API over a one-node cluster, serving its routes
+type singleNode struct {
+	api      *API
+	engine   *gin.Engine
+	log      *log.ReplicatedLog
+	scooters *statemachine.ScooterStateMachine
+}
+
+func newSingleNode(t *testing.T) *singleNode {
+	t.Helper()
+	gin.SetMode(gin.TestMode)
+	scooters := statemachine.NewScooterStateMachine()
+	replicatedLog := log.NewReplicatedLog()
+	acceptor := paxos.NewAcceptor(scooters, replicatedLog)
+	api := NewAPI(scooters, paxos.NewProposer(1, nil, acceptor), replicatedLog)
+	api.SetAcceptor(acceptor)
+	engine := gin.New()
+	api.RegisterRoutes(engine)
+	return &singleNode{api: api, engine: engine, log: replicatedLog, scooters: scooters}
+}
+
+func (n *singleNode) do(method string, path string) *httptest.ResponseRecorder {
+	response := httptest.NewRecorder()
+	n.engine.ServeHTTP(response, httptest.NewRequest(method, path, nil))
+	return response
+}
+
+func TestProposeErrorStatus(t *testing.T) {
+	cases := []struct {
+		name string
+		err  error
+		want int
+	}{
+		{"no quorum", &paxos.ErrNoQuorum{Live: 1, Majority: 2}, http.StatusServiceUnavailable},
+		{"prepare outvoted", &paxos.ErrPreparePhase{Promises: 1, Rejected: 2, Majority: 2}, http.StatusConflict},
+		{"prepare unanswered", &paxos.ErrPreparePhase{Promises: 1, Majority: 2}, http.StatusServiceUnavailable},
+		{"accept outvoted", &paxos.ErrAcceptPhase{Accepts: 1, Rejected: 1, Majority: 2}, http.StatusConflict},
+		{"accept unanswered", &paxos.ErrAcceptPhase{Accepts: 1, Majority: 2}, http.StatusServiceUnavailable},
+		{"commit unacknowledged", &paxos.ErrCommitPhase{InstanceId: 3, Acks: 1, Majority: 2}, http.StatusServiceUnavailable},
+		{"apply rejected", &paxos.ErrApply{InstanceId: 3, Err: errors.New("scooter is reserved")}, http.StatusConflict},
+		{"deadline", &paxos.ErrDeadline{Phase: "accept", Err: context.DeadlineExceeded}, http.StatusServiceUnavailable},
+		{"instance decided", &paxos.ErrInstanceDecided{InstanceId: 3}, http.StatusServiceUnavailable},
+		{"read index", &paxos.ErrReadIndex{Responses: 1, Majority: 2}, http.StatusServiceUnavailable},
+		{"encoding failed", &ErrEncodeCommand{Err: errors.New("unsupported value")}, http.StatusInternalServerError},
+		{"command too large", &ErrCommandTooLarge{Size: 600, Max: 512}, http.StatusRequestEntityTooLarge},
+		{"wrapped", fmt.Errorf("proposing: %w", &paxos.ErrAcceptPhase{Rejected: 1, Majority: 2}), http.StatusConflict},
+		{"unknown", errors.New("something else"), http.StatusInternalServerError},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			if got := proposeErrorStatus(c.err); got != c.want {
+				t.Errorf("proposeErrorStatus(%v) = %d, want %d", c.err, got, c.want)
+			}
+		})
+	}
+}
+
+func TestOversizedCommandIsRejectedBeforeProposing(t *testing.T) {
+	node := newSingleNode(t)
+	node.api.SetMaxCommandSize(512)
+
+	longID := strings.Repeat("s", 600)
+	response := node.do(http.MethodPut, "/scooters/"+longID)
+	if response.Code != http.StatusRequestEntityTooLarge {
+		t.Fatalf("expected 413 for a command over the limit, got %d: %s", response.Code, response.Body)
+	}
+	if !strings.Contains(response.Body.String(), "maximum is 512 bytes") {
+		t.Fatalf("expected the limit in the error, got %s", response.Body)
+	}
+	// Nothing was allocated, proposed or applied
+	if next := node.log.PeekNextIndex(); next != 0 {
+		t.Fatalf("expected no instance to be allocated, next index is %d", next)
+	}
+	if _, exists := node.scooters.GetScooter(longID); exists {
+		t.Fatal("the oversized create was applied")
+	}
+
+	response = node.do(http.MethodPut, "/scooters/normal")
+	if response.Code != http.StatusOK {
+		t.Fatalf("expected a normal create to pass, got %d: %s", response.Code, response.Body)
+	}
+	if _, exists := node.scooters.GetScooter("normal"); !exists {
+		t.Fatal("the normal create wasn't applied")
+	}
+
+	// 0 lifts the limit
+	node.api.SetMaxCommandSize(0)
+	if response := node.do(http.MethodPut, "/scooters/"+longID); response.Code != http.StatusOK {
+		t.Fatalf("expected the long create to pass without a limit, got %d: %s", response.Code, response.Body)
+	}
+}
+
+func TestLogEntryShowsRedactedRawBytes(t *testing.T) {
+	node := newSingleNode(t)
+	command, err := json.Marshal(statemachine.ScooterCommand{
+		CommandType:      statemachine.Reserve,
+		ScooterID:        "s1",
+		ReservationID:    "r1",
+		ReservationToken: "secret-token",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	node.log.Append(0, command, 1)
+
+	response := node.do(http.MethodGet, "/log/0")
+	if response.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", response.Code, response.Body)
+	}
+	if strings.Contains(response.Body.String(), "secret-token") {
+		t.Fatalf("the reservation token shows in the log entry: %s", response.Body)
+	}
+	var entry struct {
+		Raw       []byte `json:"raw"`
+		RawSHA256 string `json:"raw_sha256"`
+	}
+	if err := json.Unmarshal(response.Body.Bytes(), &entry); err != nil {
+		t.Fatal(err)
+	}
+	// gin sends the bytes base64 encoded, which Unmarshal undoes
+	var raw statemachine.ScooterCommand
+	if err := json.Unmarshal(entry.Raw, &raw); err != nil {
+		t.Fatalf("raw isn't the encoded command: %v", err)
+	}
+	if raw.ScooterID != "s1" || raw.ReservationID != "r1" || raw.ReservationToken != "" {
+		t.Fatalf("expected the redacted reserve in raw, got %+v", raw)
+	}
+	if len(entry.RawSHA256) != 64 {
+		t.Fatalf("expected the stored bytes' hash, got %q", entry.RawSHA256)
+	}
+}
@@ -0,0 +1,71 @@
+package api
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"ds_project/src/server/statemachine"
+)
+
+// heartbeat counts the Noops this node has proposed as leader
+type heartbeat struct {
+	interval time.Duration
+	sent     int64
+	failed   int64
+	mutex    sync.Mutex
+}
+
+// StartHeartbeat has the leader propose a Noop every interval so the commit
+// stream keeps moving while the cluster is idle. Followers tick too but stay
+// quiet, so a node starts and stops heartbeating as leadership moves.
+func (api *API) StartHeartbeat(ctx context.Context, interval time.Duration) {
+	api.heartbeat.mutex.Lock()
+	api.heartbeat.interval = interval
+	api.heartbeat.mutex.Unlock()
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		if !api.isLeader() || api.IsDraining() {
+			continue
+		}
+
+		err := api.propose(ctx, statemachine.ScooterCommand{CommandType: statemachine.Noop})
+
+		api.heartbeat.mutex.Lock()
+		if err != nil {
+			api.heartbeat.failed++
+		} else {
+			api.heartbeat.sent++
+		}
+		api.heartbeat.mutex.Unlock()
+
+		if err != nil {
+			fmt.Printf("Heartbeat failed: %v\n", err)
+		}
+	}
+}
+
+func (api *API) GetHeartbeat(context *gin.Context) {
+	api.heartbeat.mutex.Lock()
+	defer api.heartbeat.mutex.Unlock()
+
+		context.JSON(http.StatusOK, gin.H{
+		"enabled":     api.heartbeat.interval > 0,
+		"interval_ms": api.heartbeat.interval.Milliseconds(),
+		"is_leader":   api.isLeader(),
+		"sent":        api.heartbeat.sent,
+		"failed":      api.heartbeat.failed,
+	})
+}
@@ -0,0 +1,30 @@
+package api
+
+import (
+	"crypto/rand"
+	"fmt"
+)
+
+// IDSource is the only place the API gets new IDs from. Like the clock, IDs
+// are generated here before proposing and carried in the command, so every
+// replica stores the same one; Apply never makes up an ID.
+type IDSource interface {
+	NewID() (string, error)
+}
+
+// RandomIDs hands out random version 4 UUIDs
+type RandomIDs struct{}
+
+func (RandomIDs) NewID() (string, error) {
+	var b [16]byte
+	if _, err := rand.Read(b[:]); err != nil {
+		return "", err
+	}
+	b[6] = (b[6] & 0x0f) | 0x40
+	b[8] = (b[8] & 0x3f) | 0x80
+	return fmt.Sprintf("%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:16]), nil
+}
+
+func (api *API) SetIDSource(ids IDSource) {
+	api.ids = ids
+}
@@ -0,0 +1,133 @@
+package api
+
+import (
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"ds_project/src/server/statemachine"
+)
+
+type importResult struct {
+	Row    int    `json:"row"`
+	ID     string `json:"id,omitempty"`
+	Status string `json:"status"`
+	Error  string `json:"error,omitempty"`
+}
+
+// ImportScooters handles POST /scooters/import with a CSV body of
+// id,lat,lng rows (lat and lng may be left empty). Rows are read one at a
+// time straight off the request body and each valid one is proposed as its
+// own Create, so a bad or duplicate row fails alone. The response lists
+// every row's outcome.
+func (api *API) ImportScooters(context *gin.Context) {
+	reader := csv.NewReader(context.Request.Body)
+	reader.FieldsPerRecord = -1
+	reader.TrimLeadingSpace = true
+	reader.ReuseRecord = true
+
+	results := make([]importResult, 0)
+	created, failed := 0, 0
+
+	for row := 1; ; row++ {
+		record, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+
+		result := importResult{Row: row}
+		var parseErr *csv.ParseError
+		switch {
+		case errors.As(err, &parseErr):
+			result.Status, result.Error = "invalid", parseErr.Err.Error()
+		case err != nil:
+			context.JSON(http.StatusBadRequest, gin.H{"error": "Failed to read CSV: " + err.Error(), "results": results})
+			return
+		case row == 1 && strings.EqualFold(strings.TrimSpace(record[0]), "id"):
+			continue
+		default:
+			result = api.importRow(context, row, record)
+		}
+
+		if result.Status == "created" {
+			created++
+		} else {
+			failed++
+		}
+		results = append(results, result)
+	}
+
+	context.JSON(http.StatusOK, gin.H{
+		"created": created,
+		"failed":  failed,
+		"results": results,
+	})
+}
+
+func (api *API) importRow(context *gin.Context, row int, record []string) importResult {
+	id := strings.TrimSpace(record[0])
+	result := importResult{Row: row, ID: id}
+
+	cmd, err := importCommand(id, record)
+	if err != nil {
+		result.Status, result.Error = "invalid", err.Error()
+		return result
+	}
+
+	unlock := api.scooterLocks.lock(id)
+	defer unlock()
+
+	if _, exists := api.stateMachine.GetScooter(id); exists {
+		result.Status, result.Error = "exists", "Scooter already exists"
+		return result
+	}
+
+	if err := api.propose(context.Request.Context(), cmd); err != nil {
+		result.Status, result.Error = "failed", err.Error()
+		return result
+	}
+	result.Status = "created"
+	return result
+}
+
+// importCommand builds the Create for one CSV row
+func importCommand(id string, record []string) (statemachine.ScooterCommand, error) {
+	cmd := statemachine.ScooterCommand{CommandType: statemachine.Create, ScooterID: id}
+
+	if id == "" {
+		return cmd, fmt.Errorf("Missing id")
+	}
+	if err := statemachine.ValidateScooterID(id); err != nil {
+		return cmd, err
+	}
+	if len(record) > 3 {
+		return cmd, fmt.Errorf("Expected at most 3 columns, got %d", len(record))
+	}
+
+	var coords []string
+	for _, field := range record[1:] {
+		coords = append(coords, strings.TrimSpace(field))
+	}
+	for len(coords) < 2 {
+		coords = append(coords, "")
+	}
+	if coords[0] == "" && coords[1] == "" {
+		return cmd, nil
+	}
+
+	lat, err := strconv.ParseFloat(coords[0], 64)
+	if err != nil || lat < -90 || lat > 90 {
+		return cmd, fmt.Errorf("Invalid lat %q", coords[0])
+	}
+	lng, err := strconv.ParseFloat(coords[1], 64)
+	if err != nil || lng < -180 || lng > 180 {
+		return cmd, fmt.Errorf("Invalid lng %q", coords[1])
+	}
+	cmd.Location = &statemachine.Location{Lat: lat, Lng: lng}
+	return cmd, nil
+}
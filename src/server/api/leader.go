@@ -0,0 +1,18 @@
+package api
+
+import "sync/atomic"
+
+// SetLeaderFlag hands the API the flag main keeps current from membership's
+// leader-change callback. Forwarding and the heartbeat read it instead of
+// asking membership each time. Without it the API falls back to membership.
+func (api *API) SetLeaderFlag(flag *atomic.Bool) {
+	api.leader = flag
+}
+
+// isLeader reports whether this node is the leader, as far as the API knows.
+func (api *API) isLeader() bool {
+	if api.leader != nil {
+		return api.leader.Load()
+	}
+	return api.membership != nil && api.membership.IsLeader()
+}
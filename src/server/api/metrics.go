@@ -0,0 +1,50 @@
+package api
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// GetMetrics serves this node's etcd health, proposal queue depths, acceptor
+// instance counts and HTTP request metrics in the Prometheus text format, so it can be scraped
+// without a client library.
+func (api *API) GetMetrics(context *gin.Context) {
+	var body strings.Builder
+
+	if api.membership != nil {
+		health := api.membership.Health()
+		connected := 0
+		if health.Connected {
+			connected = 1
+		}
+		writeMetric(&body, "scooter_etcd_up", "gauge", "Whether the etcd lease keepalive is running.", connected)
+		writeMetric(&body, "scooter_etcd_lease_remaining_seconds", "gauge", "Time left on the etcd lease since its last renewal.", health.LeaseRemaining.Seconds())
+		writeMetric(&body, "scooter_membership_members", "gauge", "Members the membership watch currently sees.", health.Members)
+		writeMetric(&body, "scooter_membership_watch_restarts_total", "counter", "Times the membership watch failed or closed and started over.", health.WatchRestarts)
+		writeMetric(&body, "scooter_etcd_lease_renewals_total", "counter", "Lease renewals etcd acknowledged.", health.LeaseRenewals)
+		writeMetric(&body, "scooter_etcd_lease_regrants_total", "counter", "Fresh leases granted after a renewal failed.", health.LeaseRegrants)
+	}
+
+	if api.proposer != nil {
+		stats := api.proposer.Stats()
+		writeMetric(&body, "scooter_proposal_queue_writes", "gauge", "Write proposals waiting for a proposer slot.", stats.QueuedWrites)
+		writeMetric(&body, "scooter_proposal_queue_reads", "gauge", "Noop proposals for reads and heartbeats waiting for a proposer slot.", stats.QueuedReads)
+	}
+
+	if api.acceptor != nil {
+		held, undecided := api.acceptor.InstanceCounts()
+		writeMetric(&body, "scooter_paxos_instances", "gauge", "Paxos instances the acceptor holds in memory.", held)
+		writeMetric(&body, "scooter_paxos_undecided_instances", "gauge", "Instances the acceptor holds that it hasn't seen decided.", undecided)
+	}
+
+	api.requests.write(&body)
+
+	context.Data(http.StatusOK, "text/plain; version=0.0.4; charset=utf-8", []byte(body.String()))
+}
+
+func writeMetric(body *strings.Builder, name string, kind string, help string, value any) {
+	fmt.Fprintf(body, "# HELP %s %s\n# TYPE %s %s\n%s %v\n", name, help, name, kind, name, value)
+}
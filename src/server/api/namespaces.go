@@ -0,0 +1,67 @@
+package api
+
+import (
+	"context"
+	"sort"
+
+	"github.com/gin-gonic/gin"
+
+	"ds_project/src/server/paxos"
+	"ds_project/src/server/statemachine"
+)
+
+// NamespaceRoutes adds the routes of a state machine registered with the
+// StateMachineRouter under its own namespace. RegisterRoutes mounts them
+// under /<namespace>, next to the scooter routes of the default namespace.
+type NamespaceRoutes func(group *gin.RouterGroup, namespace *Namespace)
+
+// Namespace is what a namespace's handlers need from the API to serve it
+type Namespace struct {
+	Name string
+	api  *API
+}
+
+// Propose runs an already encoded command for the namespace through Paxos,
+// with the size limit, timeout and leader forwarding of the scooter
+// writes, and returns what applying it on this node produced. The command
+// must carry the namespace in its namespace field for the router to send
+// it to the right state machine.
+func (ns *Namespace) Propose(ctx context.Context, command []byte) (statemachine.Result, error) {
+	return ns.api.proposeEncoded(ctx, command, paxos.WriteProposal)
+}
+
+// AdmitWrite goes in front of the namespace's write routes, refusing them
+// while this node drains or is a read-only replica
+func (ns *Namespace) AdmitWrite(context *gin.Context) {
+	ns.api.admitWrite(context)
+}
+
+// ErrorStatus is the HTTP status the scooter routes answer err from a
+// proposal with
+func (ns *Namespace) ErrorStatus(err error) int {
+	return proposeErrorStatus(err)
+}
+
+// SetNamespaceRoutes makes RegisterRoutes mount routes for namespace. The
+// default namespace's routes are the scooter routes and can't be replaced.
+// Set it before RegisterRoutes.
+func (api *API) SetNamespaceRoutes(namespace string, routes NamespaceRoutes) {
+	if namespace == statemachine.DefaultNamespace {
+		return
+	}
+	if api.namespaceRoutes == nil {
+		api.namespaceRoutes = make(map[string]NamespaceRoutes)
+	}
+	api.namespaceRoutes[namespace] = routes
+}
+
+func (api *API) registerNamespaceRoutes(router *gin.Engine) {
+	namespaces := make([]string, 0, len(api.namespaceRoutes))
+	for namespace := range api.namespaceRoutes {
+		namespaces = append(namespaces, namespace)
+	}
+	sort.Strings(namespaces)
+	for _, namespace := range namespaces {
+		api.namespaceRoutes[namespace](router.Group("/"+namespace), &Namespace{Name: namespace, api: api})
+	}
+}
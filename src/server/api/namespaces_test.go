@@ -0,0 +1,75 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+
+	"ds_project/src/server/log"
+	"ds_project/src/server/paxos"
+	"ds_project/src/server/statemachine"
+)
+
+// dockMachine is a second state machine on the same log, counting the docks
+// it was told to open
+type dockMachine struct {
+	opened int
+}
+
+func (m *dockMachine) Apply(index int64, commandBytes []byte) (statemachine.Result, error) {
+	m.opened++
+	return m.opened, nil
+}
+
+func TestNamespaceRoutesAreMounted(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	scooters := statemachine.NewScooterStateMachine()
+	docks := &dockMachine{}
+	router := statemachine.NewStateMachineRouter()
+	router.Register(statemachine.DefaultNamespace, scooters)
+	router.Register("docks", docks)
+
+	replicatedLog := log.NewReplicatedLog()
+	acceptor := paxos.NewAcceptor(router, replicatedLog)
+	api := NewAPI(scooters, paxos.NewProposer(1, nil, acceptor), replicatedLog)
+	api.SetAcceptor(acceptor)
+	api.SetNamespaceRoutes("docks", func(group *gin.RouterGroup, namespace *Namespace) {
+		group.POST("/open", namespace.AdmitWrite, func(context *gin.Context) {
+			command, _ := json.Marshal(gin.H{"namespace": namespace.Name, "command_type": "OPEN"})
+			result, err := namespace.Propose(context.Request.Context(), command)
+			if err != nil {
+				context.JSON(namespace.ErrorStatus(err), gin.H{"error": err.Error()})
+				return
+			}
+			context.JSON(http.StatusOK, gin.H{"opened": result})
+		})
+	})
+	engine := gin.New()
+	api.RegisterRoutes(engine)
+
+	response := httptest.NewRecorder()
+	engine.ServeHTTP(response, httptest.NewRequest(http.MethodPost, "/docks/open", nil))
+	if response.Code != http.StatusOK {
+		t.Fatalf("expected 200 from the docks route, got %d: %s", response.Code, response.Body)
+	}
+	if !strings.Contains(response.Body.String(), `"opened":1`) {
+		t.Fatalf("expected the docks machine's result, got %s", response.Body)
+	}
+	if docks.opened != 1 {
+		t.Fatalf("expected the docks machine to apply the command, opened %d", docks.opened)
+	}
+	if applied := scooters.AppliedIndex(); applied != 0 {
+		t.Fatalf("expected the scooters to be moved past the docks entry, at %d", applied)
+	}
+
+	api.Drain()
+	response = httptest.NewRecorder()
+	engine.ServeHTTP(response, httptest.NewRequest(http.MethodPost, "/docks/open", nil))
+	if response.Code != http.StatusServiceUnavailable {
+		t.Fatalf("expected a draining node to refuse the docks write, got %d", response.Code)
+	}
+}
@@ -0,0 +1,23 @@
+package api
+
+import (
+	"net/http/pprof"
+
+	"github.com/gin-gonic/gin"
+)
+
+// RegisterProfiling mounts the net/http/pprof handlers under /debug/pprof.
+// They expose heap contents and can burn CPU on demand, so main only calls
+// this when started with -pprof.
+func RegisterProfiling(router gin.IRouter) {
+	group := router.Group("/debug/pprof")
+	group.GET("/", gin.WrapF(pprof.Index))
+	group.GET("/cmdline", gin.WrapF(pprof.Cmdline))
+	group.GET("/profile", gin.WrapF(pprof.Profile))
+	group.POST("/symbol", gin.WrapF(pprof.Symbol))
+	group.GET("/symbol", gin.WrapF(pprof.Symbol))
+	group.GET("/trace", gin.WrapF(pprof.Trace))
+	group.GET("/:profile", func(context *gin.Context) {
+		pprof.Handler(context.Param("profile")).ServeHTTP(context.Writer, context.Request)
+	})
+}
@@ -0,0 +1,40 @@
+package api
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"ds_project/src/server/requestid"
+)
+
+// RequestID takes the client's X-Request-ID, or makes one up, and puts it in
+// the request's context so it follows the request into proposals and the
+// Paxos RPCs they make. The response echoes it.
+func RequestID() gin.HandlerFunc {
+	return func(context *gin.Context) {
+		id := context.GetHeader(requestid.Header)
+		if id == "" {
+			id = requestid.New()
+		}
+		context.Request = context.Request.WithContext(requestid.NewContext(context.Request.Context(), id))
+		context.Header(requestid.Header, id)
+		context.Next()
+	}
+}
+
+// RequestLogger is gin's request log with the request ID added
+func RequestLogger() gin.HandlerFunc {
+	return gin.LoggerWithFormatter(func(param gin.LogFormatterParams) string {
+		return fmt.Sprintf("[GIN] %v | %3d | %13v | %15s | %-7s %#v | request_id=%s\n%s",
+			param.TimeStamp.Format(time.RFC3339),
+			param.StatusCode,
+			param.Latency,
+			param.ClientIP,
+			param.Method,
+			param.Path,
+			requestid.FromContext(param.Request.Context()),
+			param.ErrorMessage,
+		)
+	})
+}
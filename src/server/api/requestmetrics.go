@@ -0,0 +1,120 @@
+package api
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// latencyBuckets are the upper bounds in seconds of the request latency
+// histogram, Prometheus' defaults
+var latencyBuckets = []float64{0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10}
+
+// unmatchedRoute labels requests no route matched, so stray paths share one
+// series instead of one each
+const unmatchedRoute = "unmatched"
+
+// requestMetrics counts requests by method, route template and status, and
+// keeps a latency histogram per method and route. Labelling by template
+// rather than path keeps one series per route however many scooters there
+// are.
+type requestMetrics struct {
+	routes map[routeKey]*routeMetrics
+	mutex  sync.Mutex
+}
+
+type routeKey struct {
+	method string
+	route  string
+}
+
+type routeMetrics struct {
+	statuses map[int]int64
+	// buckets[i] counts requests no slower than latencyBuckets[i]; the
+	// +Inf bucket is count
+	buckets []int64
+	count   int64
+	sum     float64
+}
+
+// record is the middleware that observes each request once it's handled
+func (m *requestMetrics) record(context *gin.Context) {
+	start := time.Now()
+	context.Next()
+	m.observe(context.Request.Method, context.FullPath(), context.Writer.Status(), time.Since(start))
+}
+
+func (m *requestMetrics) observe(method string, route string, status int, latency time.Duration) {
+	if route == "" {
+		route = unmatchedRoute
+	}
+	key := routeKey{method: method, route: route}
+
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	if m.routes == nil {
+		m.routes = make(map[routeKey]*routeMetrics)
+	}
+	metrics, exists := m.routes[key]
+	if !exists {
+		metrics = &routeMetrics{statuses: make(map[int]int64), buckets: make([]int64, len(latencyBuckets))}
+		m.routes[key] = metrics
+	}
+
+	seconds := latency.Seconds()
+	metrics.statuses[status]++
+	metrics.count++
+	metrics.sum += seconds
+	for i, bound := range latencyBuckets {
+		if seconds <= bound {
+			metrics.buckets[i]++
+		}
+	}
+}
+
+// write appends the request counter and latency histogram families to body
+func (m *requestMetrics) write(body *strings.Builder) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	keys := make([]routeKey, 0, len(m.routes))
+	for key := range m.routes {
+		keys = append(keys, key)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		if keys[i].route != keys[j].route {
+			return keys[i].route < keys[j].route
+		}
+		return keys[i].method < keys[j].method
+	})
+
+	fmt.Fprintf(body, "# HELP scooter_http_requests_total HTTP requests handled, by method, route and status.\n# TYPE scooter_http_requests_total counter\n")
+	for _, key := range keys {
+		metrics := m.routes[key]
+		statuses := make([]int, 0, len(metrics.statuses))
+		for status := range metrics.statuses {
+			statuses = append(statuses, status)
+		}
+		sort.Ints(statuses)
+		for _, status := range statuses {
+			fmt.Fprintf(body, "scooter_http_requests_total{method=%q,route=%q,status=\"%d\"} %d\n", key.method, key.route, status, metrics.statuses[status])
+		}
+	}
+
+	fmt.Fprintf(body, "# HELP scooter_http_request_duration_seconds HTTP request latency, by method and route.\n# TYPE scooter_http_request_duration_seconds histogram\n")
+	for _, key := range keys {
+		metrics := m.routes[key]
+		labels := fmt.Sprintf("method=%q,route=%q", key.method, key.route)
+		for i, bound := range latencyBuckets {
+			fmt.Fprintf(body, "scooter_http_request_duration_seconds_bucket{%s,le=\"%s\"} %d\n", labels, strconv.FormatFloat(bound, 'g', -1, 64), metrics.buckets[i])
+		}
+		fmt.Fprintf(body, "scooter_http_request_duration_seconds_bucket{%s,le=\"+Inf\"} %d\n", labels, metrics.count)
+		fmt.Fprintf(body, "scooter_http_request_duration_seconds_sum{%s} %v\n", labels, metrics.sum)
+		fmt.Fprintf(body, "scooter_http_request_duration_seconds_count{%s} %d\n", labels, metrics.count)
+	}
+}
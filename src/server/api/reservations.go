@@ -0,0 +1,57 @@
+package api
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"ds_project/src/server/statemachine"
+)
+
+// GetReservations handles GET /reservations, every active reservation on
+// this node
+func (api *API) GetReservations(context *gin.Context) {
+	if !api.ensureConsistency(context) {
+		return
+	}
+	context.JSON(http.StatusOK, gin.H{"reservations": api.stateMachine.Reservations()})
+}
+
+// CancelReservation handles DELETE /reservations/:reservation_id, which lets
+// support staff end a rider's reservation without the rider's token. The
+// scooter is looked up here and named in the command, so Apply only has to
+// check that it still holds the same reservation.
+func (api *API) CancelReservation(context *gin.Context) {
+	reservationID := context.Param("reservation_id")
+
+	scooterIDs := api.stateMachine.FindReservation(reservationID)
+	switch len(scooterIDs) {
+	case 0:
+		context.JSON(http.StatusNotFound, gin.H{"error": "Reservation not found"})
+		return
+	case 1:
+	default:
+		context.JSON(http.StatusConflict, gin.H{"error": "Reservation ID is held on more than one scooter", "scooter_ids": scooterIDs})
+		return
+	}
+
+	// Look again under the scooter's lock, in case a write that held it
+	// released or moved the reservation
+	unlock := api.scooterLocks.lock(scooterIDs[0])
+	defer unlock()
+	if current := api.stateMachine.FindReservation(reservationID); len(current) != 1 || current[0] != scooterIDs[0] {
+		context.JSON(http.StatusConflict, gin.H{"error": "Reservation changed while cancelling, retry"})
+		return
+	}
+
+	cmd := statemachine.ScooterCommand{
+		CommandType: statemachine.CancelReservation,
+		ScooterID: scooterIDs[0],
+		ReservationID: reservationID,
+	}
+	result, err := api.proposeResult(context.Request.Context(), cmd)
+	if err != nil {
+		respondProposeError(context, "", err)
+		return
+	}
+	context.JSON(http.StatusOK, withScooter(gin.H{"status": "Reservation cancelled", "reservation_id": reservationID, "scooter_id": scooterIDs[0]}, result, scooterIDs[0]))
+}
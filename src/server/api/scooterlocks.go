@@ -0,0 +1,73 @@
+package api
+
+import (
+	"sort"
+	"sync"
+)
+
+// scooterLocks serializes this node's writes per scooter, so a handler's
+// precondition checks and its proposal happen without another write to the
+// same scooter slipping in between. Writes other nodes forward straight to
+// the proposer don't take these locks; the state machine still rejects
+// whichever of those loses.
+type scooterLocks struct {
+	locks map[string]*scooterLock
+	mutex sync.Mutex
+}
+
+// scooterLock is one scooter's lock and how many writes hold or wait for
+// it, so it can be dropped once nobody does
+type scooterLock struct {
+	mutex   sync.Mutex
+	holders int
+}
+
+// lock takes the locks for every ID given, in sorted order so two writes
+// naming the same scooters can't deadlock, and returns what releases them.
+func (l *scooterLocks) lock(ids ...string) func() {
+	ids = append([]string(nil), ids...)
+	sort.Strings(ids)
+
+	held := make([]string, 0, len(ids))
+	for i, id := range ids {
+		if i > 0 && id == ids[i-1] {
+			continue
+		}
+		l.acquire(id)
+		held = append(held, id)
+	}
+
+	return func() {
+		for i := len(held) - 1; i >= 0; i-- {
+			l.release(held[i])
+		}
+	}
+}
+
+func (l *scooterLocks) acquire(id string) {
+	l.mutex.Lock()
+	if l.locks == nil {
+		l.locks = make(map[string]*scooterLock)
+	}
+	lock, exists := l.locks[id]
+	if !exists {
+		lock = &scooterLock{}
+		l.locks[id] = lock
+	}
+	lock.holders++
+	l.mutex.Unlock()
+
+	lock.mutex.Lock()
+}
+
+func (l *scooterLocks) release(id string) {
+	l.mutex.Lock()
+	lock := l.locks[id]
+	lock.holders--
+	if lock.holders == 0 {
+		delete(l.locks, id)
+	}
+	l.mutex.Unlock()
+
+	lock.mutex.Unlock()
+}
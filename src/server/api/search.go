@@ -0,0 +1,120 @@
+package api
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"ds_project/src/server/statemachine"
+)
+
+// SearchScooters handles GET /scooters/search. Every filter given must
+// match: available and out_of_service take true or false, min_distance and
+// max_distance bound the total distance, and min_lat, max_lat, min_lng and
+// max_lng together give a box the scooter's location must fall in. It
+// honours the same consistency modes as GET /scooters.
+func (api *API) SearchScooters(context *gin.Context) {
+	filter, err := parseScooterFilter(context)
+	if err != nil {
+		context.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if !api.ensureConsistency(context) {
+		return
+	}
+	context.JSON(http.StatusOK, api.stateMachine.Search(filter))
+}
+
+const (
+	DefaultTopScooters = 10
+	MaxTopScooters     = 1000
+)
+
+// TopScooters handles GET /scooters/top?n=, the n scooters with the highest
+// total distance, highest first and ties by ID. n defaults to
+// DefaultTopScooters. It honours the same consistency modes as GET
+// /scooters.
+func (api *API) TopScooters(context *gin.Context) {
+	n := DefaultTopScooters
+	if value, set := context.GetQuery("n"); set {
+		parsed, err := strconv.Atoi(value)
+		if err != nil || parsed < 1 || parsed > MaxTopScooters {
+			context.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("Invalid n %q, expected 1 to %d", value, MaxTopScooters)})
+			return
+		}
+		n = parsed
+	}
+	if !api.ensureConsistency(context) {
+		return
+	}
+	context.JSON(http.StatusOK, api.stateMachine.TopByDistance(n))
+}
+
+func parseScooterFilter(context *gin.Context) (statemachine.ScooterFilter, error) {
+	var filter statemachine.ScooterFilter
+	var err error
+
+	if filter.Available, err = boolQuery(context, "available"); err != nil {
+		return filter, err
+	}
+	if filter.OutOfService, err = boolQuery(context, "out_of_service"); err != nil {
+		return filter, err
+	}
+	if filter.MinDistance, err = floatQuery(context, "min_distance"); err != nil {
+		return filter, err
+	}
+	if filter.MaxDistance, err = floatQuery(context, "max_distance"); err != nil {
+		return filter, err
+	}
+	if filter.MinDistance != nil && filter.MaxDistance != nil && *filter.MinDistance > *filter.MaxDistance {
+		return filter, fmt.Errorf("min_distance is larger than max_distance")
+	}
+
+	corners := make([]*float64, 4)
+	given := 0
+	for i, name := range []string{"min_lat", "max_lat", "min_lng", "max_lng"} {
+		if corners[i], err = floatQuery(context, name); err != nil {
+			return filter, err
+		}
+		if corners[i] != nil {
+			given++
+		}
+	}
+	switch given {
+	case 0:
+	case 4:
+		box := statemachine.GeoBox{MinLat: *corners[0], MaxLat: *corners[1], MinLng: *corners[2], MaxLng: *corners[3]}
+		if box.MinLat > box.MaxLat || box.MinLng > box.MaxLng {
+			return filter, fmt.Errorf("The box's minimums must not exceed its maximums")
+		}
+		filter.Box = &box
+	default:
+		return filter, fmt.Errorf("A box needs all of min_lat, max_lat, min_lng and max_lng")
+	}
+	return filter, nil
+}
+
+func boolQuery(context *gin.Context, name string) (*bool, error) {
+	value, set := context.GetQuery(name)
+	if !set {
+		return nil, nil
+	}
+	parsed, err := strconv.ParseBool(value)
+	if err != nil {
+		return nil, fmt.Errorf("Invalid %s %q, expected true or false", name, value)
+	}
+	return &parsed, nil
+}
+
+func floatQuery(context *gin.Context, name string) (*float64, error) {
+	value, set := context.GetQuery(name)
+	if !set {
+		return nil, nil
+	}
+	parsed, err := strconv.ParseFloat(value, 64)
+	if err != nil {
+		return nil, fmt.Errorf("Invalid %s %q, expected a number", name, value)
+	}
+	return &parsed, nil
+}
@@ -0,0 +1,56 @@
+package api
+
+import (
+	"google.golang.org/grpc/health"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+)
+
+// SetHealthServer has the API keep server's overall status in step with this
+// node's readiness. It starts out NOT_SERVING until MarkReady.
+func (api *API) SetHealthServer(server *health.Server) {
+	api.servingMutex.Lock()
+	api.healthServer = server
+	api.servingMutex.Unlock()
+	api.updateServing()
+}
+
+// MarkReady is called once startup recovery is done and the node can serve
+func (api *API) MarkReady() {
+	api.servingMutex.Lock()
+	api.ready = true
+	api.servingMutex.Unlock()
+	api.updateServing()
+}
+
+// recovering marks a manual recovery as running until the returned function
+// is called
+func (api *API) recovering() func() {
+	api.servingMutex.Lock()
+	api.recoveries++
+	api.servingMutex.Unlock()
+	api.updateServing()
+
+	return func() {
+		api.servingMutex.Lock()
+		api.recoveries--
+		api.servingMutex.Unlock()
+		api.updateServing()
+	}
+}
+
+// updateServing reports SERVING once the node is ready, unless it is
+// draining or recovering from a peer
+func (api *API) updateServing() {
+	draining := api.IsDraining()
+
+	api.servingMutex.Lock()
+	defer api.servingMutex.Unlock()
+	if api.healthServer == nil {
+		return
+	}
+	status := healthpb.HealthCheckResponse_NOT_SERVING
+	if api.ready && !draining && api.recoveries == 0 {
+		status = healthpb.HealthCheckResponse_SERVING
+	}
+	api.healthServer.SetServingStatus("", status)
+}
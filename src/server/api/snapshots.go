@@ -0,0 +1,56 @@
+package api
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"ds_project/src/server/statemachine"
+)
+
+// GetSnapshots lists the snapshots this node retains, oldest first
+func (api *API) GetSnapshots(context *gin.Context) {
+	context.JSON(http.StatusOK, gin.H{
+		"retention": api.stateMachine.SnapshotRetention(),
+		"snapshots": api.stateMachine.Snapshots(),
+	})
+}
+
+// RestoreSnapshot handles POST /admin/snapshots/:index/restore. It rewinds
+// this node to a retained snapshot and replays the log after it, with
+// commits paused so nothing is applied in between. Newer snapshots are
+// dropped, on the assumption that they are why the operator is here.
+func (api *API) RestoreSnapshot(context *gin.Context) {
+	index, err := strconv.ParseInt(context.Param("index"), 10, 64)
+	if err != nil {
+		context.JSON(http.StatusBadRequest, gin.H{"error": "Snapshot index must be an integer"})
+		return
+	}
+	if api.acceptor == nil {
+		context.JSON(http.StatusServiceUnavailable, gin.H{"error": "No acceptor to replay the log through"})
+		return
+	}
+
+	reapplied := 0
+	api.acceptor.PauseCommits(func() {
+		if err = api.stateMachine.LoadRetainedSnapshot(index); err == nil {
+			reapplied = api.acceptor.Reapply(index)
+		}
+	})
+
+	var missing *statemachine.ErrNoSnapshot
+	switch {
+	case errors.As(err, &missing):
+		context.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+	case err != nil:
+		context.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to load snapshot: " + err.Error()})
+	default:
+		context.JSON(http.StatusOK, gin.H{
+			"status":        "Snapshot restored",
+			"index":         index,
+			"reapplied":     reapplied,
+			"applied_index": api.stateMachine.AppliedIndex(),
+		})
+	}
+}
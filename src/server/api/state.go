@@ -0,0 +1,92 @@
+package api
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"ds_project/src/server/statemachine"
+)
+
+// SetAllowSetState enables PUT /admin/scooters/:id/state. It lets QA force a
+// scooter into any state, so leave it off in production.
+func (api *API) SetAllowSetState(allow bool) {
+	api.allowSetState = allow
+}
+
+// SetScooterState overwrites a scooter, creating it if needed, with the
+// state in the body. It goes through Paxos as one SetState command, so every
+// replica ends up with the same scooter. A reserved state gets a fresh
+// reservation token, returned like a reserve's.
+func (api *API) SetScooterState(context *gin.Context) {
+	if !api.allowSetState {
+		context.JSON(http.StatusForbidden, gin.H{"error": "Setting scooter state is disabled on this node, start it with -allowsetstate"})
+		return
+	}
+	scooterID := context.Param("id")
+
+	var body struct {
+		IsAvailable   *bool                  `json:"is_available"`
+		TotalDistance float64                `json:"total_distance"`
+		ReservationID string                 `json:"reservation_id"`
+		ClientID      string                 `json:"client_id"`
+		OutOfService  bool                   `json:"out_of_service"`
+		Location      *statemachine.Location `json:"location"`
+	}
+	if !bindBody(context, &body) {
+		return
+	}
+
+	if body.IsAvailable == nil {
+		context.JSON(http.StatusBadRequest, gin.H{"error": "is_available is required"})
+		return
+	}
+	if body.TotalDistance < 0 {
+		context.JSON(http.StatusBadRequest, gin.H{"error": "total_distance must not be negative"})
+		return
+	}
+	if *body.IsAvailable && (body.ReservationID != "" || body.ClientID != "") {
+		context.JSON(http.StatusBadRequest, gin.H{"error": "An available scooter has no reservation_id or client_id"})
+		return
+	}
+	if !*body.IsAvailable && body.ReservationID == "" {
+		context.JSON(http.StatusBadRequest, gin.H{"error": "A reserved scooter needs a reservation_id"})
+		return
+	}
+
+	state := &statemachine.Scooter{
+		IsAvailable:   *body.IsAvailable,
+		TotalDistance: body.TotalDistance,
+		ReservationID: body.ReservationID,
+		ClientID:      body.ClientID,
+		OutOfService:  body.OutOfService,
+		Location:      body.Location,
+	}
+	if !state.IsAvailable {
+		token, err := api.ids.NewID()
+		if err != nil {
+			context.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate a reservation token"})
+			return
+		}
+		state.ReservationToken = token
+	}
+
+	unlock := api.scooterLocks.lock(scooterID)
+	defer unlock()
+
+	cmd := statemachine.ScooterCommand{
+		CommandType: statemachine.SetState,
+		ScooterID:   scooterID,
+		State:       state,
+	}
+	result, err := api.proposeResult(context.Request.Context(), cmd)
+	if err != nil {
+		respondProposeError(context, "", err)
+		return
+	}
+
+	response := gin.H{"status": "Scooter state set", "id": scooterID}
+	if state.ReservationToken != "" {
+		response["reservation_token"] = state.ReservationToken
+	}
+	context.JSON(http.StatusOK, withScooter(response, result, scooterID))
+}
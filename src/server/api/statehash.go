@@ -0,0 +1,95 @@
+package api
+
+import (
+	"context"
+	"net/http"
+	"sort"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	pb "ds_project/src/server/proto"
+)
+
+const stateHashTimeout = 2 * time.Second
+
+type NodeStateHash struct {
+	ID           int64  `json:"id"`
+	Address      string `json:"address"`
+	Hash         string `json:"hash,omitempty"`
+	AppliedIndex int64  `json:"applied_index"`
+	Error        string `json:"error,omitempty"`
+}
+
+// CompareStateHashes asks every live member for the hash of its applied
+// state. Hashes are only comparable between nodes at the same applied index,
+// so the cluster is consistent when no two nodes at the same index disagree.
+func (api *API) CompareStateHashes(context *gin.Context) {
+	if api.membership == nil || api.peerConns == nil {
+		context.JSON(http.StatusServiceUnavailable, gin.H{"error": "Membership is not configured"})
+		return
+	}
+
+	members := api.membership.GetMembers()
+	sort.Slice(members, func(i, j int) bool {
+		return members[i].ID < members[j].ID
+	})
+
+	nodes := make([]NodeStateHash, 0, len(members))
+	for _, member := range members {
+		nodes = append(nodes, api.fetchStateHash(member.ID, member.Address))
+	}
+
+	consistent, commonIndex := compareStateHashes(nodes)
+	context.JSON(http.StatusOK, gin.H{
+		"nodes":                nodes,
+		"consistent":           consistent,
+		"common_applied_index": commonIndex,
+	})
+}
+
+// compareStateHashes reports whether no two nodes at the same applied index
+// disagree, and that index if every node that answered is at it, else -1
+func compareStateHashes(nodes []NodeStateHash) (bool, int64) {
+	consistent := true
+	hashAt := make(map[int64]string)
+	for _, node := range nodes {
+		if node.Error != "" {
+			continue
+		}
+		if hash, seen := hashAt[node.AppliedIndex]; seen && hash != node.Hash {
+			consistent = false
+		}
+		hashAt[node.AppliedIndex] = node.Hash
+	}
+
+	// Only meaningful when every node that answered is at the same index
+	commonIndex := int64(-1)
+	if len(hashAt) == 1 {
+		for index := range hashAt {
+			commonIndex = index
+		}
+	}
+	return consistent, commonIndex
+}
+
+func (api *API) fetchStateHash(id int64, address string) NodeStateHash {
+	node := NodeStateHash{ID: id, Address: address}
+
+	conn, err := api.peerConns.Get(address)
+	if err != nil {
+		node.Error = err.Error()
+		return node
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), stateHashTimeout)
+	defer cancel()
+
+	response, err := pb.NewLogRecoveryClient(conn).GetStateHash(ctx, &pb.StateHashRequest{})
+	if err != nil {
+		node.Error = err.Error()
+		return node
+	}
+	node.Hash = response.Hash
+	node.AppliedIndex = response.AppliedIndex
+	return node
+}
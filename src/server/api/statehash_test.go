@@ -0,0 +1,35 @@
+package api
+
+import (
+	"testing"
+)
+
+func TestCompareStateHashes(t *testing.T) {
+	agreeing := []NodeStateHash{
+		{ID: 1, Hash: "aaa", AppliedIndex: 10},
+		{ID: 2, Hash: "aaa", AppliedIndex: 10},
+		{ID: 3, Error: "unavailable"},
+	}
+	if consistent, common := compareStateHashes(agreeing); !consistent || common != 10 {
+		t.Fatalf("expected consistent at 10, got %v at %d", consistent, common)
+	}
+
+	// Node 3 has diverged: same index, different state
+	diverged := []NodeStateHash{
+		{ID: 1, Hash: "aaa", AppliedIndex: 10},
+		{ID: 2, Hash: "aaa", AppliedIndex: 10},
+		{ID: 3, Hash: "bbb", AppliedIndex: 10},
+	}
+	if consistent, _ := compareStateHashes(diverged); consistent {
+		t.Fatal("expected a replica with a different hash at the same index to be reported")
+	}
+
+	// Different hashes at different indexes aren't comparable
+	lagging := []NodeStateHash{
+		{ID: 1, Hash: "aaa", AppliedIndex: 10},
+		{ID: 2, Hash: "ccc", AppliedIndex: 9},
+	}
+	if consistent, common := compareStateHashes(lagging); !consistent || common != -1 {
+		t.Fatalf("expected consistent with no common index, got %v at %d", consistent, common)
+	}
+}
@@ -0,0 +1,123 @@
+package api
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"ds_project/src/server/statemachine"
+)
+
+type transactionOperation struct {
+	Type             string `json:"type"`
+	ScooterID        string `json:"scooter_id"`
+	ReservationID    string `json:"reservation_id"`
+	ClientID         string `json:"client_id"`
+	Distance         int64  `json:"distance"`
+	ReservationToken string `json:"reservation_token"`
+	DistanceSplit    map[string]int64 `json:"distance_split"`
+	Signature        string `json:"signature"`
+}
+
+// Transact handles POST /transactions: a list of reserve and release
+// operations proposed as a single command and applied all or nothing.
+// The state machine has the final word, so any failing operation rejects
+// the whole transaction with 409.
+func (api *API) Transact(context *gin.Context) {
+	var body struct {
+		Operations []transactionOperation `json:"operations"`
+	}
+	if !bindBody(context, &body) {
+		return
+	}
+
+	if len(body.Operations) == 0 {
+		context.JSON(http.StatusBadRequest, gin.H{"error": "At least one operation is required"})
+		return
+	}
+
+	now := api.clock.Now().UnixMilli()
+	quota := api.ReservationQuota()
+	maxSpeed := api.MaxSpeedKmh()
+
+	ops := make([]statemachine.ScooterCommand, 0, len(body.Operations))
+	reservations := make([]gin.H, 0)
+	for i, op := range body.Operations {
+		if op.ScooterID == "" {
+			context.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("Operation %d has no scooter_id", i)})
+			return
+		}
+
+		switch strings.ToLower(op.Type) {
+		case "reserve":
+			token, err := api.ids.NewID()
+			if err != nil {
+				context.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate a reservation token"})
+				return
+			}
+			ops = append(ops, statemachine.ScooterCommand{
+				CommandType: statemachine.Reserve,
+				ScooterID: op.ScooterID,
+				ReservationID: op.ReservationID,
+				ClientID: op.ClientID,
+				ReservationQuota: quota,
+				ReservationToken: token,
+				Timestamp: now,
+				Signature: op.Signature,
+			})
+			reservations = append(reservations, gin.H{"scooter_id": op.ScooterID, "reservation_token": token})
+
+		case "release":
+			if op.Distance < 0 {
+				context.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("Operation %d has a negative distance", i)})
+				return
+			}
+			if err := checkDistanceSplit(op.DistanceSplit, op.Distance); err != nil {
+				context.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("Operation %d: %v", i, err)})
+				return
+			}
+			ops = append(ops, statemachine.ScooterCommand{
+				CommandType: statemachine.Release,
+				ScooterID: op.ScooterID,
+				Distance: op.Distance,
+				ReservationToken: op.ReservationToken,
+				MaxSpeedKmh: maxSpeed,
+				Timestamp: now,
+				DistanceSplit: op.DistanceSplit,
+				Signature: op.Signature,
+			})
+
+		default:
+			context.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("Operation %d has unknown type %q, expected reserve or release", i, op.Type)})
+			return
+		}
+	}
+
+	scooterIDs := make([]string, len(ops))
+	for i, op := range ops {
+		scooterIDs[i] = op.ScooterID
+	}
+	unlock := api.scooterLocks.lock(scooterIDs...)
+	defer unlock()
+
+	cmd := statemachine.ScooterCommand{
+		CommandType: statemachine.Transaction,
+		Operations: ops,
+		Timestamp: now,
+	}
+	result, err := api.proposeResult(context.Request.Context(), cmd)
+	if err != nil {
+		respondProposeError(context, "Transaction rejected: ", err)
+		return
+	}
+	response := gin.H{
+		"status":       "Transaction applied",
+		"operations":   len(ops),
+		"reservations": reservations,
+	}
+	if scooters, ok := result.([]statemachine.Scooter); ok {
+		response["scooters"] = scooters
+	}
+	context.JSON(http.StatusOK, response)
+}
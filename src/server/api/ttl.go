@@ -0,0 +1,104 @@
+package api
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"ds_project/src/server/statemachine"
+)
+
+// DefaultCommandTTL is how long after a client created a write it may still
+// be proposed
+const DefaultCommandTTL = time.Minute
+
+// CreatedAtHeader lets a client say when it first created a write, in unix
+// milliseconds. A client retrying after a partition sends the original
+// value, so an old write can be told apart from a new one.
+const CreatedAtHeader = "X-Created-At"
+
+type createdAtKey struct{}
+
+// ErrCommandExpired means a write was older than its TTL by the time it
+// would have been proposed
+type ErrCommandExpired struct {
+	Age time.Duration
+	TTL time.Duration
+}
+
+func (e *ErrCommandExpired) Error() string {
+	return fmt.Sprintf("command created %s ago is older than its %s TTL", e.Age, e.TTL)
+}
+
+// SetCommandTTL sets how old a write may be when proposed, 0 for no limit
+func (api *API) SetCommandTTL(ttl time.Duration) {
+	api.settingsMutex.Lock()
+	defer api.settingsMutex.Unlock()
+	api.commandTTL = ttl
+}
+
+func (api *API) CommandTTL() time.Duration {
+	api.settingsMutex.Lock()
+	defer api.settingsMutex.Unlock()
+	return api.commandTTL
+}
+
+// readCreatedAt is the middleware in front of every write route that takes
+// X-Created-At into the request's context for propose
+func (api *API) readCreatedAt(context *gin.Context) {
+	header := context.GetHeader(CreatedAtHeader)
+	if header == "" {
+		context.Next()
+		return
+	}
+	createdAt, err := strconv.ParseInt(header, 10, 64)
+	if err != nil || createdAt <= 0 {
+		context.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "Invalid " + CreatedAtHeader + " header"})
+		return
+	}
+	context.Request = context.Request.WithContext(withCreatedAt(context.Request.Context(), createdAt))
+	context.Next()
+}
+
+func withCreatedAt(ctx context.Context, createdAt int64) context.Context {
+	return context.WithValue(ctx, createdAtKey{}, createdAt)
+}
+
+func createdAtFrom(ctx context.Context) (int64, bool) {
+	createdAt, ok := ctx.Value(createdAtKey{}).(int64)
+	return createdAt, ok
+}
+
+// stampTTL fills in when cmd was created, from the client if it said so and
+// otherwise now, and the TTL it must be proposed within.
+func (api *API) stampTTL(ctx context.Context, cmd *statemachine.ScooterCommand) {
+	if cmd.CreatedAt == 0 {
+		if createdAt, ok := createdAtFrom(ctx); ok {
+			cmd.CreatedAt = createdAt
+		} else {
+			cmd.CreatedAt = cmd.Timestamp
+		}
+	}
+	if cmd.TTL == 0 {
+		cmd.TTL = api.CommandTTL().Milliseconds()
+	}
+}
+
+// checkExpired refuses cmd if, by this node's clock, it is already older
+// than its TTL. Apply repeats the check against the command's own Timestamp.
+func (api *API) checkExpired(cmd statemachine.ScooterCommand) error {
+	if cmd.TTL <= 0 || cmd.CreatedAt == 0 {
+		return nil
+	}
+	age := api.clock.Now().UnixMilli() - cmd.CreatedAt
+	if age > cmd.TTL {
+		return &ErrCommandExpired{
+			Age: time.Duration(age) * time.Millisecond,
+			TTL: time.Duration(cmd.TTL) * time.Millisecond,
+		}
+	}
+	return nil
+}
@@ -0,0 +1,20 @@
+package api
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"ds_project/src/server/statemachine"
+	"ds_project/src/server/version"
+)
+
+func (api *API) GetVersion(context *gin.Context) {
+	context.JSON(http.StatusOK, gin.H{
+		"version":          version.Version,
+		"commit":           version.Commit,
+		"build_time":       version.BuildTime,
+		"protocol_version": version.ProtocolVersion,
+		"command_version":  statemachine.CommandVersion,
+		"snapshot_version": statemachine.SnapshotVersion,
+	})
+}
@@ -0,0 +1,182 @@
+package config
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	clientv3 "go.etcd.io/etcd/client/v3"
+)
+
+// Prefix is where cluster-wide settings live in etcd. Each setting is its
+// own key, e.g. config/proposer_timeout = "500ms".
+const Prefix = "config/"
+
+const (
+	ProposerTimeout  = "proposer_timeout"
+	ReservationQuota = "reservation_quota"
+	MaxSpeedKmh      = "max_speed_kmh"
+	ApplyErrorPolicy = "apply_error_policy"
+	CommandTTL       = "command_ttl"
+)
+
+const (
+	minWatchBackoff = 100 * time.Millisecond
+	maxWatchBackoff = 10 * time.Second
+)
+
+// Watcher loads the settings under Prefix and keeps applying them as they
+// change, so every node runs with the same tuning without restarting.
+type Watcher struct {
+	client   *clientv3.Client
+	handlers map[string]func(value string) error
+	mutex    sync.Mutex
+}
+
+func NewWatcher(client *clientv3.Client) *Watcher {
+	return &Watcher{
+		client:   client,
+		handlers: make(map[string]func(value string) error),
+	}
+}
+
+// Handle registers apply to be called with the raw value whenever key
+// (without the prefix) is set.
+func (w *Watcher) Handle(key string, apply func(value string) error) {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+	w.handlers[key] = apply
+}
+
+// Duration adapts apply to values written as Go durations, e.g. "750ms".
+func Duration(apply func(time.Duration)) func(string) error {
+	return func(value string) error {
+		d, err := time.ParseDuration(value)
+		if err != nil {
+			return err
+		}
+		if d <= 0 {
+			return fmt.Errorf("duration must be positive, got %s", value)
+		}
+		apply(d)
+		return nil
+	}
+}
+
+// Int adapts apply to integer values.
+func Int(apply func(int)) func(string) error {
+	return func(value string) error {
+		n, err := strconv.Atoi(value)
+		if err != nil {
+			return err
+		}
+		apply(n)
+		return nil
+	}
+}
+
+// Float adapts apply to decimal values.
+func Float(apply func(float64)) func(string) error {
+	return func(value string) error {
+		f, err := strconv.ParseFloat(value, 64)
+		if err != nil {
+			return err
+		}
+		apply(f)
+		return nil
+	}
+}
+
+func (w *Watcher) apply(key []byte, value []byte) {
+	name := strings.TrimPrefix(string(key), Prefix)
+
+	w.mutex.Lock()
+	handler, exists := w.handlers[name]
+	w.mutex.Unlock()
+	if !exists {
+		return
+	}
+
+	if err := handler(string(value)); err != nil {
+		fmt.Printf("Ignoring config %s=%q: %v\n", name, value, err)
+		return
+	}
+	fmt.Printf("Applied config %s=%s\n", name, value)
+}
+
+// load applies every setting currently stored and returns the revision it
+// was read at.
+func (w *Watcher) load(ctx context.Context) (int64, error) {
+	response, err := w.client.Get(ctx, Prefix, clientv3.WithPrefix())
+	if err != nil {
+		return 0, err
+	}
+	for _, kv := range response.Kvs {
+		w.apply(kv.Key, kv.Value)
+	}
+	return response.Header.Revision, nil
+}
+
+// Watch applies the current settings and then every change until ctx is
+// done. A deleted key leaves the last applied value in place.
+func (w *Watcher) Watch(ctx context.Context) {
+	backoff := minWatchBackoff
+
+	for ctx.Err() == nil {
+		revision, err := w.load(ctx)
+		if err != nil {
+			fmt.Printf("Failed to load config: %v, retrying in %v\n", err, backoff)
+			if !sleepContext(ctx, backoff) {
+				return
+			}
+			backoff = nextBackoff(backoff)
+			continue
+		}
+
+		// Each attempt gets its own watch, cancelled before backing off, so
+		// one that failed doesn't stay open on the client
+		watchCtx, cancel := context.WithCancel(ctx)
+		watchChannel := w.client.Watch(watchCtx, Prefix, clientv3.WithPrefix(), clientv3.WithRev(revision+1))
+		for watchResponse := range watchChannel {
+			if err := watchResponse.Err(); err != nil {
+				fmt.Printf("Config watch failed: %v\n", err)
+				break
+			}
+			backoff = minWatchBackoff
+			for _, event := range watchResponse.Events {
+				if event.Type == clientv3.EventTypePut {
+					w.apply(event.Kv.Key, event.Kv.Value)
+				}
+			}
+		}
+		cancel()
+
+		if ctx.Err() != nil {
+			return
+		}
+		if !sleepContext(ctx, backoff) {
+			return
+		}
+		backoff = nextBackoff(backoff)
+	}
+}
+
+func nextBackoff(backoff time.Duration) time.Duration {
+	backoff *= 2
+	if backoff > maxWatchBackoff {
+		backoff = maxWatchBackoff
+	}
+	return backoff
+}
+
+func sleepContext(ctx context.Context, d time.Duration) bool {
+	select {
+	case <-ctx.Done():
+		return false
+	case <-time.After(d):
+		return true
+	}
+}
@@ -0,0 +1,102 @@
+package connections
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/connectivity"
+	"google.golang.org/grpc/credentials/insecure"
+
+	"ds_project/src/server/interceptors"
+)
+
+// Manager keeps one long-lived gRPC connection per peer so the proposer and
+// recovery don't pay for a fresh dial on every call.
+type Manager struct {
+	addresses []string
+	conns     map[string]*grpc.ClientConn
+	maxMessageSize int
+	mutex     sync.Mutex
+}
+
+func NewManager(addresses []string) *Manager {
+	return &Manager{
+		addresses: addresses,
+		conns:     make(map[string]*grpc.ClientConn),
+	}
+}
+
+// SetMaxMessageSize raises the send and receive limit for connections dialed
+// from now on, 0 keeps gRPC's 4MB default.
+func (m *Manager) SetMaxMessageSize(size int) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	m.maxMessageSize = size
+}
+
+func (m *Manager) Get(address string) (*grpc.ClientConn, error) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	if conn, exists := m.conns[address]; exists && conn.GetState() != connectivity.Shutdown {
+		return conn, nil
+	}
+
+	options := []grpc.DialOption{
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+		grpc.WithChainUnaryInterceptor(interceptors.PropagateRequestID()),
+	}
+	if m.maxMessageSize > 0 {
+		options = append(options, grpc.WithDefaultCallOptions(
+			grpc.MaxCallRecvMsgSize(m.maxMessageSize),
+			grpc.MaxCallSendMsgSize(m.maxMessageSize),
+		))
+	}
+	conn, err := grpc.Dial(address, options...)
+	if err != nil {
+		return nil, err
+	}
+	m.conns[address] = conn
+	return conn, nil
+}
+
+// Warm makes sure every configured peer has a connection that is connected
+// or trying to connect, nudging idle and failed ones to reconnect now rather
+// than on the next call.
+func (m *Manager) Warm() {
+	for _, address := range m.addresses {
+		conn, err := m.Get(address)
+		if err != nil {
+			continue
+		}
+		state := conn.GetState()
+		if state == connectivity.Idle || state == connectivity.TransientFailure {
+			conn.Connect()
+		}
+	}
+}
+
+func (m *Manager) Start(ctx context.Context, interval time.Duration) {
+	m.Warm()
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			m.Warm()
+		}
+	}
+}
+
+func (m *Manager) Close() {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	for address, conn := range m.conns {
+		conn.Close()
+		delete(m.conns, address)
+	}
+}
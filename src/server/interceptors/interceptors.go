@@ -0,0 +1,67 @@
+package interceptors
+
+import (
+	"context"
+	"log"
+	"runtime/debug"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+
+	"ds_project/src/server/requestid"
+)
+
+// Recovery turns a panic inside a handler into an Internal error so one bad
+// request can't take the whole gRPC server down.
+func Recovery() grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (resp interface{}, err error) {
+		defer func() {
+			if r := recover(); r != nil {
+				log.Printf("panic in %s: %v\n%s", info.FullMethod, r, debug.Stack())
+				err = status.Errorf(codes.Internal, "internal error in %s", info.FullMethod)
+			}
+		}()
+		return handler(ctx, req)
+	}
+}
+
+func Logging() grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		start := time.Now()
+		resp, err := handler(ctx, req)
+		id := requestid.FromContext(ctx)
+		if err != nil {
+			log.Printf("rpc %s took %v request_id=%s, error: %v", info.FullMethod, time.Since(start), id, err)
+		} else {
+			log.Printf("rpc %s took %v request_id=%s", info.FullMethod, time.Since(start), id)
+		}
+		return resp, err
+	}
+}
+
+// RequestID moves the caller's request ID from the incoming metadata into
+// the handler's context. Chain it before Logging so the log line carries it.
+func RequestID() grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		if md, ok := metadata.FromIncomingContext(ctx); ok {
+			if ids := md.Get(requestid.MetadataKey); len(ids) > 0 {
+				ctx = requestid.NewContext(ctx, ids[0])
+			}
+		}
+		return handler(ctx, req)
+	}
+}
+
+// PropagateRequestID sends the request ID in ctx, if any, along with every
+// outgoing call so the peer's RequestID interceptor picks it up.
+func PropagateRequestID() grpc.UnaryClientInterceptor {
+	return func(ctx context.Context, method string, req, reply interface{}, cc *grpc.ClientConn, invoker grpc.UnaryInvoker, opts ...grpc.CallOption) error {
+		if id := requestid.FromContext(ctx); id != "" {
+			ctx = metadata.AppendToOutgoingContext(ctx, requestid.MetadataKey, id)
+		}
+		return invoker(ctx, method, req, reply, cc, opts...)
+	}
+}
@@ -0,0 +1,82 @@
+package interceptors
+
+import (
+	"context"
+	"net"
+	"testing"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+
+	pb "ds_project/src/server/proto"
+)
+
+// panickyAcceptor panics on a Prepare for instance 1 and promises anything
+// else
+type panickyAcceptor struct {
+	pb.UnimplementedPaxosServer
+}
+
+func (a *panickyAcceptor) Prepare(ctx context.Context, req *pb.PrepareRequest) (*pb.PromiseResponse, error) {
+	if req.InstanceId == 1 {
+		panic("bad prepare")
+	}
+	return &pb.PromiseResponse{Ack: true, InstanceId: req.InstanceId}, nil
+}
+
+// serve starts a server with main's interceptor chain and returns a client
+// connected to it
+func serve(t *testing.T, server pb.PaxosServer) pb.PaxosClient {
+	t.Helper()
+	listener := bufconn.Listen(1 << 20)
+	grpcServer := grpc.NewServer(grpc.ChainUnaryInterceptor(RequestID(), Logging(), Recovery()))
+	pb.RegisterPaxosServer(grpcServer, server)
+	go grpcServer.Serve(listener)
+	t.Cleanup(grpcServer.Stop)
+
+	conn, err := grpc.NewClient("passthrough:///bufconn",
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) {
+			return listener.DialContext(ctx)
+		}),
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	return pb.NewPaxosClient(conn)
+}
+
+func TestHandlerPanicBecomesInternalError(t *testing.T) {
+	client := serve(t, &panickyAcceptor{})
+
+	_, err := client.Prepare(context.Background(), &pb.PrepareRequest{InstanceId: 1})
+	if status.Code(err) != codes.Internal {
+		t.Fatalf("got %v, want an Internal error", err)
+	}
+
+	// The server is still up for the next request
+	for instanceId := int64(2); instanceId < 5; instanceId++ {
+		promise, err := client.Prepare(context.Background(), &pb.PrepareRequest{InstanceId: instanceId})
+		if err != nil {
+			t.Fatalf("prepare %d after the panic: %v", instanceId, err)
+		}
+		if !promise.Ack || promise.InstanceId != instanceId {
+			t.Fatalf("prepare %d after the panic: %v", instanceId, promise)
+		}
+	}
+}
+
+func TestRecoveryPassesErrorsThrough(t *testing.T) {
+	info := &grpc.UnaryServerInfo{FullMethod: "/paxos.Paxos/Prepare"}
+	want := status.Error(codes.Unavailable, "busy")
+	_, err := Recovery()(context.Background(), nil, info, func(ctx context.Context, req interface{}) (interface{}, error) {
+		return nil, want
+	})
+	if err != want {
+		t.Fatalf("got %v, want the handler's own error", err)
+	}
+}
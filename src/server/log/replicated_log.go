@@ -1,11 +1,33 @@
 package log
 import (
+	"fmt"
 	"sync"
 )
 
+const DefaultMaxAhead = 1000
+
+// ErrTooFarAhead is returned when allocating another instance would put the
+// proposer more than the configured distance ahead of the commit index.
+type ErrTooFarAhead struct {
+	Next        int64
+	CommitIndex int64
+	MaxAhead    int64
+}
+
+func (e *ErrTooFarAhead) Error() string {
+	return fmt.Sprintf("instance %d is more than %d ahead of commit index %d", e.Next, e.MaxAhead, e.CommitIndex)
+}
+
 type LogEntry struct {
 	Index   int64
 	Command []byte
+	// CommittedAt is when the proposing node committed the entry, in unix
+	// milliseconds, so every replica records the same time
+	CommittedAt int64
+	// ApplyError is the state machine's rejection of the command, empty if
+	// it applied cleanly. Rejections are deterministic, so every replica
+	// should record the same one
+	ApplyError string
 }
 
 type ReplicatedLog struct {
@@ -13,6 +35,8 @@ type ReplicatedLog struct {
 	nextIndex int64
 	commitIndex int64
 	storedIndex int64
+	maxAhead  int64
+	abandoned map[int64]bool
 	mutex   sync.Mutex
 }
 
@@ -22,16 +46,32 @@ func NewReplicatedLog() *ReplicatedLog {
 		nextIndex:  0,
 		commitIndex: -1,
 		storedIndex: -1,
+		abandoned:   make(map[int64]bool),
 	}
 }
-func (log *ReplicatedLog) Append(index int64, command []byte){
+
+// SetMaxAhead caps how far past the commit index AllocateIndex will hand out
+// instances, 0 for no limit
+func (log *ReplicatedLog) SetMaxAhead(maxAhead int64) {
 	log.mutex.Lock()
 	defer log.mutex.Unlock()
+	log.maxAhead = maxAhead
+}
 
-	log.entries[log.nextIndex] = &LogEntry{
+// Append records the command committed at index, stored under that index so
+// GetEntry(index) finds it whatever order commits arrive in. It also clears
+// index from the abandoned set and moves nextIndex past it and commitIndex
+// up to it where they are behind.
+func (log *ReplicatedLog) Append(index int64, command []byte, committedAt int64){
+	log.mutex.Lock()
+	defer log.mutex.Unlock()
+
+	log.entries[index] = &LogEntry{
 		Index:   index,
 		Command: command,
+		CommittedAt: committedAt,
 	}
+	delete(log.abandoned, index)
 	if index >= log.nextIndex {
 		log.nextIndex = index + 1
 	}
@@ -40,6 +80,15 @@ func (log *ReplicatedLog) Append(index int64, command []byte){
 	}
 }
 
+// SetApplyError records how the state machine rejected the entry at index
+func (log *ReplicatedLog) SetApplyError(index int64, err error) {
+	log.mutex.Lock()
+	defer log.mutex.Unlock()
+	if entry, exists := log.entries[index]; exists && err != nil {
+		entry.ApplyError = err.Error()
+	}
+}
+
 func (log *ReplicatedLog) GetEntry(index int64) *LogEntry {
 	log.mutex.Lock()
 	defer log.mutex.Unlock()
@@ -60,6 +109,50 @@ func (log *ReplicatedLog) GetNextIndex() int64 {
 	return index
 }
 
+// AllocateIndex is GetNextIndex with the max-ahead guard applied, so a
+// proposer that keeps failing can't run the instance space away from what
+// has actually been committed.
+func (log *ReplicatedLog) AllocateIndex() (int64, error) {
+	log.mutex.Lock()
+	defer log.mutex.Unlock()
+	if log.maxAhead > 0 && log.nextIndex-log.commitIndex > log.maxAhead {
+		return 0, &ErrTooFarAhead{Next: log.nextIndex, CommitIndex: log.commitIndex, MaxAhead: log.maxAhead}
+	}
+	index := log.nextIndex
+	log.nextIndex++
+	return index, nil
+}
+
+// Abandon gives back an index whose proposal failed. Abandoned indices at the
+// tail are handed out again, so failed proposals don't leave permanent gaps
+// and a stalled proposer resumes once it can commit again. It reports
+// whether index is left as a gap, with a later index committed or
+// allocated, which something else has to fill before anything after it is
+// applied.
+func (log *ReplicatedLog) Abandon(index int64) bool {
+	log.mutex.Lock()
+	defer log.mutex.Unlock()
+	if _, committed := log.entries[index]; committed {
+		return false
+	}
+	if index <= log.commitIndex {
+		return true
+	}
+	log.abandoned[index] = true
+	for log.abandoned[log.nextIndex-1] {
+		delete(log.abandoned, log.nextIndex-1)
+		log.nextIndex--
+	}
+	return log.abandoned[index]
+}
+
+// PeekNextIndex returns the next index without allocating it
+func (log *ReplicatedLog) PeekNextIndex() int64 {
+	log.mutex.Lock()
+	defer log.mutex.Unlock()
+	return log.nextIndex
+}
+
 func (log *ReplicatedLog) SetCommitIndex(index int64) {
 	log.mutex.Lock()
 	defer log.mutex.Unlock()
@@ -82,11 +175,17 @@ func (log *ReplicatedLog) SetNextIndex(index int64) {
 	log.mutex.Lock()
 	defer log.mutex.Unlock()
 	log.nextIndex = index
+	log.abandoned = make(map[int64]bool)
 }
 
+// Store compacts the entries up to upToIndex. Compacting to an index
+// already compacted does nothing, so storedIndex never moves back.
 func (log *ReplicatedLog) Store(upToIndex int64) {
 	log.mutex.Lock()
 	defer log.mutex.Unlock()
+	if upToIndex < log.storedIndex {
+		return
+	}
 
 	for i := log.storedIndex ; i <= upToIndex; i++ {
 		delete(log.entries, i)
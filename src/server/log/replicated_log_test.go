@@ -0,0 +1,56 @@
+package log
+
+import (
+	"testing"
+)
+
+// Commits can arrive out of order, e.g. a peer's commit for a later instance
+// before this node's own, and each entry must land under its own index
+func TestAppendStoresEntriesUnderTheirIndex(t *testing.T) {
+	log := NewReplicatedLog()
+	log.Append(3, []byte("third"), 0)
+	log.Append(0, []byte("first"), 0)
+	log.Append(7, []byte("seventh"), 0)
+
+	for index, want := range map[int64]string{0: "first", 3: "third", 7: "seventh"} {
+		entry := log.GetEntry(index)
+		if entry == nil || entry.Index != index || string(entry.Command) != want {
+			t.Fatalf("entry at %d is %+v, want %q", index, entry, want)
+		}
+	}
+	for _, index := range []int64{1, 2, 4, 8} {
+		if entry := log.GetEntry(index); entry != nil {
+			t.Fatalf("found %+v at %d, which was never appended", entry, index)
+		}
+	}
+	if commitIndex := log.GetCommitIndex(); commitIndex != 7 {
+		t.Fatalf("commit index %d, want 7", commitIndex)
+	}
+	if next := log.PeekNextIndex(); next != 8 {
+		t.Fatalf("next index %d, want 8", next)
+	}
+}
+
+// Only an abandoned index with something allocated after it is a gap; one
+// at the tail is handed out again
+func TestAbandonReportsGaps(t *testing.T) {
+	log := NewReplicatedLog()
+	first, _ := log.AllocateIndex()
+	second, _ := log.AllocateIndex()
+
+	if !log.Abandon(first) {
+		t.Fatalf("expected abandoning %d with %d allocated after it to leave a gap", first, second)
+	}
+	if log.Abandon(second) {
+		t.Fatalf("expected abandoning the tail index %d to leave no gap", second)
+	}
+	if next := log.PeekNextIndex(); next != first {
+		t.Fatalf("expected both indexes handed back, next is %d", next)
+	}
+
+	index, _ := log.AllocateIndex()
+	log.Append(index, []byte("command"), 0)
+	if log.Abandon(index) {
+		t.Fatal("expected a committed index to leave no gap")
+	}
+}
@@ -0,0 +1,76 @@
+package log
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// ErrInvalidIndices lists the index invariants the log breaks
+type ErrInvalidIndices struct {
+	Violations []string
+}
+
+func (e *ErrInvalidIndices) Error() string {
+	return fmt.Sprintf("log indices are inconsistent: %s", strings.Join(e.Violations, "; "))
+}
+
+// Validate checks the log's indices against each other. Recovery sets them
+// one at a time, so a bug there leaves them disagreeing; this catches that
+// at startup rather than when the next proposal trips over it. The
+// invariants are:
+//   - commitIndex and storedIndex are at least -1 and nextIndex at least 0
+//   - nextIndex is past commitIndex, so no committed instance is handed out
+//     again
+//   - storedIndex is at most commitIndex+1, so nothing uncommitted has been
+//     compacted
+//   - no entry is past commitIndex, since appending an entry commits it
+//   - abandoned indices lie between commitIndex and nextIndex
+func (log *ReplicatedLog) Validate() error {
+	log.mutex.Lock()
+	defer log.mutex.Unlock()
+
+	var violations []string
+	if log.commitIndex < -1 {
+		violations = append(violations, fmt.Sprintf("commit index %d is below -1", log.commitIndex))
+	}
+	if log.storedIndex < -1 {
+		violations = append(violations, fmt.Sprintf("stored index %d is below -1", log.storedIndex))
+	}
+	if log.nextIndex < 0 {
+		violations = append(violations, fmt.Sprintf("next index %d is negative", log.nextIndex))
+	}
+	if log.nextIndex <= log.commitIndex {
+		violations = append(violations, fmt.Sprintf("next index %d is not past commit index %d", log.nextIndex, log.commitIndex))
+	}
+	if log.storedIndex > log.commitIndex+1 {
+		violations = append(violations, fmt.Sprintf("stored index %d is past commit index %d", log.storedIndex, log.commitIndex))
+	}
+
+	var pastCommit []int64
+	for index := range log.entries {
+		if index > log.commitIndex {
+			pastCommit = append(pastCommit, index)
+		}
+	}
+	if len(pastCommit) > 0 {
+		sort.Slice(pastCommit, func(i, j int) bool { return pastCommit[i] < pastCommit[j] })
+		violations = append(violations, fmt.Sprintf("entries %v are past commit index %d", pastCommit, log.commitIndex))
+	}
+
+	var misplaced []int64
+	for index := range log.abandoned {
+		if index <= log.commitIndex || index >= log.nextIndex {
+			misplaced = append(misplaced, index)
+		}
+	}
+	if len(misplaced) > 0 {
+		sort.Slice(misplaced, func(i, j int) bool { return misplaced[i] < misplaced[j] })
+		violations = append(violations, fmt.Sprintf("abandoned indices %v are outside (%d, %d)", misplaced, log.commitIndex, log.nextIndex))
+	}
+
+	if len(violations) > 0 {
+		return &ErrInvalidIndices{Violations: violations}
+	}
+	return nil
+}
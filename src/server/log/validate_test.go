@@ -0,0 +1,141 @@
+package log
+
+import (
+	"errors"
+	"slices"
+	"strings"
+	"testing"
+)
+
+// The index sequences the node itself goes through all validate
+func TestValidateAcceptsNormalUse(t *testing.T) {
+	log := NewReplicatedLog()
+	if err := log.Validate(); err != nil {
+		t.Fatalf("fresh log: %v", err)
+	}
+
+	for i := 0; i < 5; i++ {
+		index, err := log.AllocateIndex()
+		if err != nil {
+			t.Fatal(err)
+		}
+		log.Append(index, []byte("command"), 0)
+	}
+	if err := log.Validate(); err != nil {
+		t.Fatalf("after appends: %v", err)
+	}
+
+	// A proposal that failed gives its index back
+	first, _ := log.AllocateIndex()
+	second, _ := log.AllocateIndex()
+	log.Abandon(first)
+	if err := log.Validate(); err != nil {
+		t.Fatalf("with index %d abandoned and %d in flight: %v", first, second, err)
+	}
+
+	log.Store(3)
+	if err := log.Validate(); err != nil {
+		t.Fatalf("after compacting: %v", err)
+	}
+
+	// Recovery from a snapshot past everything the log has seen
+	log.SetCommitIndex(20)
+	log.SetStoredIndex(21)
+	log.SetNextIndex(21)
+	if err := log.Validate(); err != nil {
+		t.Fatalf("after installing a snapshot: %v", err)
+	}
+}
+
+func TestValidateDetectsEachViolation(t *testing.T) {
+	cases := []struct {
+		name    string
+		corrupt func(log *ReplicatedLog)
+		want    string
+	}{
+		{
+			name:    "commit index below -1",
+			corrupt: func(log *ReplicatedLog) { log.commitIndex = -2 },
+			want:    "commit index -2 is below -1",
+		},
+		{
+			name:    "stored index below -1",
+			corrupt: func(log *ReplicatedLog) { log.storedIndex = -2 },
+			want:    "stored index -2 is below -1",
+		},
+		{
+			name: "negative next index",
+			corrupt: func(log *ReplicatedLog) {
+				log.commitIndex = -1
+				log.nextIndex = -1
+			},
+			want: "next index -1 is negative",
+		},
+		{
+			name:    "next index not past commit index",
+			corrupt: func(log *ReplicatedLog) { log.nextIndex = 4 },
+			want:    "next index 4 is not past commit index 4",
+		},
+		{
+			name:    "stored index past commit index",
+			corrupt: func(log *ReplicatedLog) { log.storedIndex = 7 },
+			want:    "stored index 7 is past commit index 4",
+		},
+		{
+			name: "entry past commit index",
+			corrupt: func(log *ReplicatedLog) {
+				log.entries[8] = &LogEntry{Index: 8}
+				log.entries[6] = &LogEntry{Index: 6}
+			},
+			want: "entries [6 8] are past commit index 4",
+		},
+		{
+			name: "abandoned index outside the allocated range",
+			corrupt: func(log *ReplicatedLog) {
+				log.abandoned[2] = true
+				log.abandoned[12] = true
+			},
+			want: "abandoned indices [2 12] are outside (4, 10)",
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			// Committed up to 4, handed out up to 9
+			log := NewReplicatedLog()
+			for index := int64(0); index <= 4; index++ {
+				log.Append(index, []byte("command"), 0)
+			}
+			log.SetNextIndex(10)
+			if err := log.Validate(); err != nil {
+				t.Fatalf("before breaking it: %v", err)
+			}
+
+			c.corrupt(log)
+			err := log.Validate()
+			var invalid *ErrInvalidIndices
+			if !errors.As(err, &invalid) {
+				t.Fatalf("got %v, want ErrInvalidIndices", err)
+			}
+			if !slices.Contains(invalid.Violations, c.want) {
+				t.Fatalf("violations %q, want %q among them", invalid.Violations, c.want)
+			}
+		})
+	}
+}
+
+// Every broken invariant is reported, not just the first
+func TestValidateListsEveryViolation(t *testing.T) {
+	log := NewReplicatedLog()
+	log.commitIndex = 5
+	log.nextIndex = 3
+	log.storedIndex = 9
+	err := log.Validate()
+	var invalid *ErrInvalidIndices
+	if !errors.As(err, &invalid) || len(invalid.Violations) != 2 {
+		t.Fatalf("got %v, want two violations", err)
+	}
+	if !strings.Contains(err.Error(), "next index 3 is not past commit index 5") || !strings.Contains(err.Error(), "stored index 9 is past commit index 5") {
+		t.Fatalf("message %q doesn't name both", err)
+	}
+}
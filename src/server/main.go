@@ -7,16 +7,28 @@ import (
 	"log"
 	"net"
 	"os"
+	"os/signal"
 	"strings"
+	"sync/atomic"
+	"syscall"
+	"time"
 	"context"
+	"net/http"
 	"ds_project/src/server/paxos"
 	pb "ds_project/src/server/proto"
 	"google.golang.org/grpc"
+	"google.golang.org/grpc/health"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/reflection"
 
 	"ds_project/src/server/membership"
 	"ds_project/src/server/recovery"
 	"ds_project/src/server/statemachine"
 	"ds_project/src/server/api"
+	"ds_project/src/server/config"
+	"ds_project/src/server/connections"
+	"ds_project/src/server/interceptors"
+	"ds_project/src/server/version"
 	replicated_log "ds_project/src/server/log"
 	"github.com/gin-gonic/gin"
 
@@ -27,37 +39,204 @@ func main() {
 	port := flag.String("port", "50051", "Server port")
 	servers := flag.String("servers", "", "Comma separated list of server addresses")
 	testingPort := flag.String("testport", "8081", "Testing server port")
+	reservationQuota := flag.Int("reservationquota", 0, "Maximum active reservations per client, 0 for no limit")
+	maxCommandSize := flag.Int("maxcommandsize", api.DefaultMaxCommandSize, "Maximum size in bytes of a proposed command")
+	maxInstancesAhead := flag.Int64("maxinstancesahead", replicated_log.DefaultMaxAhead, "How far past the commit index new instances may be allocated, 0 for no limit")
+	maxSpeedKmh := flag.Float64("maxspeedkmh", 0, "Reject releases implying a faster average speed in km/h, 0 for no check")
+	proposeTimeout := flag.Duration("proposetimeout", api.DefaultProposeTimeout, "How long a request may wait for its command to be chosen, 0 for no limit")
+	heartbeatInterval := flag.Duration("heartbeatinterval", 0, "How often the leader proposes a Noop to keep commits flowing, 0 to disable")
+	grpcMaxMessageSize := flag.Int("grpcmaxmsgsize", 64<<20, "Maximum gRPC message size in bytes, sent and received, for recovery payloads")
+	breakerThreshold := flag.Int("breakerthreshold", paxos.DefaultBreakerThreshold, "Consecutive failed RPCs before the proposer skips a peer, 0 to never skip")
+	breakerCooldown := flag.Duration("breakercooldown", paxos.DefaultBreakerCooldown, "How long the proposer skips a failing peer before probing it again")
+	commandTTL := flag.Duration("commandttl", api.DefaultCommandTTL, "How long after the client created a write it may still be proposed, 0 for no limit")
+	applyErrorPolicy := flag.String("applyerrorpolicy", string(statemachine.SkipApplyErrors), "What to do when a committed command fails to apply: skip to log and continue, halt to stop applying and report unhealthy")
+	readOnly := flag.Bool("readonly", false, "Run as a read-only replica: never propose or lead, refuse writes and follow the log")
+	followInterval := flag.Duration("followinterval", 2*time.Second, "How often a read-only replica recovers from its peers")
+	recoveryStrategy := flag.String("recoverystrategy", string(recovery.Freshest), "Which peer recovery tries first: freshest to probe every peer's commit index and take the highest, ordered to go down -servers in order")
+	maxInstances := flag.Int("maxinstances", 0, "Paxos instances the acceptor keeps in memory before forgetting compacted ones, dropping undecided ones below the commit index, and refusing new ones while that many are still undecided, 0 for no limit")
+	witness := flag.Bool("witness", false, "Run as a witness: vote in Paxos but keep no log or state and serve no data")
+	weights := flag.String("weights", "", "Paxos voting weights as addr=weight,..., unlisted servers weigh 1; must match on every node")
+	allowSetState := flag.Bool("allowsetstate", false, "Serve PUT /admin/scooters/:id/state, which forces a scooter into any state; for testing only")
+	profiling := flag.Bool("pprof", false, "Serve net/http/pprof profiles under /debug/pprof on the test port")
+	peersFromMembership := flag.Bool("peersfrommembership", false, "Add every member registered in etcd to the proposer's peers, with -servers only as a bootstrap seed")
+	clusterSize := flag.Int("clustersize", 0, "Number of voting nodes in the cluster, this one included; required with -peersfrommembership")
+	snapshotRetention := flag.Int("snapshotretention", statemachine.DefaultSnapshotRetention, "How many snapshots to keep for restoring an older one, the log is kept back to the oldest")
+	acceptBatchWindow := flag.Duration("acceptbatchwindow", 0, "How long an accept waits for concurrent proposals' accepts to the same peer to share one RPC, 0 to send each alone")
+	proposalSlots := flag.Int("proposalslots", 0, "How many proposals may run at once before the rest queue, 0 for no limit")
+	writesPerRead := flag.Int("writesperread", paxos.DefaultWritesPerRead, "How many queued writes may take a free proposal slot ahead of a queued read")
+	waitCommitMajority := flag.Bool("waitcommitmajority", false, "Make proposals wait for a majority to acknowledge the commit, failing without one")
+	leaseRenewInterval := flag.Duration("leaserenewinterval", 0, "How often to renew the etcd lease, granting a new one if renewal fails; 0 leaves it to the etcd client's keepalive")
+	leaseRenewJitter := flag.Duration("leaserenewjitter", 0, "Random amount up to which each lease renewal is moved earlier or later")
+	signingKeys := flag.String("signingkeys", "", "Client public keys that verify reserve and release signatures, as client=base64key,... with * for the default key; must match on every node")
+	requireSignatures := flag.Bool("requiresignatures", false, "Reject reserves and releases without a valid client signature; must match on every node")
+	memberReapInterval := flag.Duration("memberreapinterval", 10*time.Second, "How often to sweep members the watch missed leaving, 0 to disable")
+	advertise := flag.String("advertise", "", "Address peers use to reach this server, defaults to localhost:<port>")
 	flag.Parse()
 
+	if *witness && *readOnly {
+		log.Fatalf("-witness and -readonly can't be combined")
+	}
+	if *leaseRenewInterval < 0 || *leaseRenewJitter < 0 || (*leaseRenewInterval > 0 && *leaseRenewInterval+*leaseRenewJitter >= membership.LeaseTTL) {
+		log.Fatalf("-leaserenewinterval plus -leaserenewjitter must be under the %v lease TTL", membership.LeaseTTL)
+	}
+	voteWeights, err := paxos.ParseWeights(*weights)
+	if err != nil {
+		log.Fatalf("Invalid -weights: %v", err)
+	}
+
 	var serverAddresses []string
 	if *servers != "" {
 		serverAddresses = strings.Split(*servers, ",")
 	}
 
+	policy, err := statemachine.ParseApplyErrorPolicy(*applyErrorPolicy)
+	if err != nil {
+		log.Fatalf("Invalid -applyerrorpolicy: %v", err)
+	}
+	strategy, err := recovery.ParseStrategy(*recoveryStrategy)
+	if err != nil {
+		log.Fatalf("Invalid -recoverystrategy: %v", err)
+	}
+	keys, err := statemachine.ParseSigningKeys(*signingKeys)
+	if err != nil {
+		log.Fatalf("Invalid -signingkeys: %v", err)
+	}
+	keys.Required = *requireSignatures
+
 	statementMachine := statemachine.NewScooterStateMachine()
+	statementMachine.SetApplyErrorPolicy(policy)
+	statementMachine.SetSigningKeys(keys)
+	statementMachine.SetSnapshotRetention(*snapshotRetention)
+	stateMachineRouter := statemachine.NewStateMachineRouter()
+	stateMachineRouter.Register(statemachine.DefaultNamespace, statementMachine)
 	replicatedLog := replicated_log.NewReplicatedLog()
+	replicatedLog.SetMaxAhead(*maxInstancesAhead)
 
-	acceptor := paxos.NewAcceptor(statementMachine, replicatedLog)
+	acceptor := paxos.NewAcceptor(stateMachineRouter, replicatedLog)
+	if *witness {
+		acceptor.SetWitness()
+	}
+	acceptor.SetMaxInstances(*maxInstances)
 	proposer := paxos.NewProposer(*id, serverAddresses, acceptor)
+	peerConnections := connections.NewManager(serverAddresses)
+	peerConnections.SetMaxMessageSize(*grpcMaxMessageSize)
+	proposer.SetConnections(peerConnections)
+	proposer.SetCircuitBreaker(*breakerThreshold, *breakerCooldown)
+	proposer.SetWaitForCommitMajority(*waitCommitMajority)
+	proposer.SetAcceptBatchWindow(*acceptBatchWindow)
+	proposer.SetProposalSlots(*proposalSlots, *writesPerRead)
 
 	etcdHost := "localhost:2379"
 	if envEtcd := os.Getenv("ETCD_SERVER"); envEtcd != "" {
 		etcdHost = envEtcd
 	}
 	etcEndpoints := []string{etcdHost}
-	membershipService, err := membership.NewMembership(*id, "localhost:"+ *port, etcEndpoints)
+	advertiseAddress := *advertise
+	if advertiseAddress == "" {
+		advertiseAddress = "localhost:" + *port
+	}
+	// Credentials come from the environment rather than flags so they stay
+	// out of the process list
+	etcdAuth := membership.EtcdAuth{
+		Username: os.Getenv("ETCD_USERNAME"),
+		Password: os.Getenv("ETCD_PASSWORD"),
+		CAFile:   os.Getenv("ETCD_CACERT"),
+		CertFile: os.Getenv("ETCD_CERT"),
+		KeyFile:  os.Getenv("ETCD_KEY"),
+	}
+	membershipService, err := membership.NewMembership(*id, advertiseAddress, etcEndpoints, etcdAuth)
 	if err != nil {
 		log.Fatalf("Failed to create membership service: %v", err)
 	}
 
+	membershipService.SetProtocolVersion(version.ProtocolVersion)
+	membershipService.SetLeaseRenewal(*leaseRenewInterval, *leaseRenewJitter)
+	if *readOnly {
+		membershipService.SetReadOnly()
+	}
+	if *witness {
+		membershipService.SetWitness()
+	}
+	proposer.SetWeights(voteWeights, advertiseAddress)
+	// Forwarding and the heartbeat read this instead of asking membership
+	var isLeader atomic.Bool
+	membershipService.OnLeaderChange(func(leaderID int64) {
+		isLeader.Store(leaderID == *id)
+	})
+
 	ctx := context.Background()
 	err = membershipService.Start(ctx)
 	if err != nil {
 		log.Fatalf("Failed to start membership service: %v", err)
 	}
 	go membershipService.Watch(ctx)
+	if *memberReapInterval > 0 {
+		go membershipService.Reap(ctx, *memberReapInterval)
+	}
+	go membershipService.WatchLearners(ctx)
+	go membershipService.WatchWitnesses(ctx)
+	go peerConnections.Start(ctx, 5*time.Second)
+	// A witness applies nothing, so its progress would hold back compaction
+	if !*witness {
+		go membershipService.StartProgressPublisher(ctx, 2*time.Second, statementMachine.AppliedIndex)
+	}
+	proposer.SetMembership(membershipService)
+	if *peersFromMembership {
+		if *clusterSize < 1 {
+			log.Fatalf("-peersfrommembership needs -clustersize, the number of voting nodes")
+		}
+		if err := membershipService.Sync(ctx); err != nil {
+			log.Fatalf("Failed to sync membership: %v", err)
+		}
+		proposer.SetPeersFromMembership(*clusterSize)
+		serverAddresses = proposer.Servers()
+		fmt.Printf("Proposer peers from membership: %v\n", serverAddresses)
+	}
+
+	recoverer := recovery.NewRecoverer(peerConnections, statementMachine, stateMachineRouter, replicatedLog)
+	recoverer.SetCommitPauser(acceptor)
+	recoverer.SetMembership(membershipService, advertiseAddress)
+	recoverer.SetStrategy(strategy)
+	// Commits for later instances wait behind one that never reached this
+	// node; a peer that has it can fill it in
+	acceptor.SetStallHandler(func(index int64) {
+		fmt.Printf("Applying stalled at %d, recovering from peers\n", index)
+		if err := recoverer.Recover(serverAddresses); err != nil {
+			fmt.Printf("Recovery for stalled index %d failed: %v\n", index, err)
+		}
+	})
 
 	apiHandler := api.NewAPI(statementMachine, proposer, replicatedLog)
+	apiHandler.SetRecoverer(recoverer)
+	apiHandler.SetAcceptor(acceptor)
+	apiHandler.SetMembership(membershipService)
+	apiHandler.SetLeaderFlag(&isLeader)
+	apiHandler.SetMaxCommandSize(*maxCommandSize)
+	apiHandler.SetReservationQuota(*reservationQuota)
+	apiHandler.SetProposeTimeout(*proposeTimeout)
+	apiHandler.SetMaxSpeedKmh(*maxSpeedKmh)
+	apiHandler.SetCommandTTL(*commandTTL)
+	apiHandler.SetReadOnly(*readOnly)
+	apiHandler.SetAllowSetState(*allowSetState)
+	apiHandler.SetPeerConnections(peerConnections)
+
+	configWatcher := config.NewWatcher(membershipService.Client())
+	configWatcher.Handle(config.ProposerTimeout, config.Duration(proposer.SetRPCTimeout))
+	configWatcher.Handle(config.ReservationQuota, config.Int(apiHandler.SetReservationQuota))
+	configWatcher.Handle(config.MaxSpeedKmh, config.Float(apiHandler.SetMaxSpeedKmh))
+	configWatcher.Handle(config.CommandTTL, config.Duration(apiHandler.SetCommandTTL))
+	configWatcher.Handle(config.ApplyErrorPolicy, func(value string) error {
+		policy, err := statemachine.ParseApplyErrorPolicy(value)
+		if err != nil {
+			return err
+		}
+		statementMachine.SetApplyErrorPolicy(policy)
+		return nil
+	})
+	go configWatcher.Watch(ctx)
+	if *heartbeatInterval > 0 {
+		go apiHandler.StartHeartbeat(ctx, *heartbeatInterval)
+	}
 
 	//fmt.Printf("Server %d started\n", *id)
 
@@ -66,9 +245,27 @@ func main() {
       log.Fatalf("Failed to listen: %v", err)
   	}
 
-	grpcServer := grpc.NewServer()
+	// RequestID runs first so Logging sees the caller's ID; Logging wraps
+	// Recovery so recovered panics are logged as failed RPCs
+	grpcServer := grpc.NewServer(
+		grpc.ChainUnaryInterceptor(interceptors.RequestID(), interceptors.Logging(), interceptors.Recovery()),
+		grpc.MaxRecvMsgSize(*grpcMaxMessageSize),
+		grpc.MaxSendMsgSize(*grpcMaxMessageSize),
+	)
 	pb.RegisterPaxosServer(grpcServer, acceptor)
-	pb.RegisterLogRecoveryServer(grpcServer, recovery.NewLogRecovery(statementMachine, replicatedLog))
+	// A witness has no log to give, so peers recovering move on to the next
+	if !*witness {
+		logRecovery := recovery.NewLogRecovery(statementMachine, replicatedLog)
+		logRecovery.SetLeaderFlag(&isLeader)
+		pb.RegisterLogRecoveryServer(grpcServer, logRecovery)
+	}
+	pb.RegisterForwardingServer(grpcServer, api.NewForwardServer(apiHandler))
+	// NOT_SERVING until startup recovery is done, and again while draining
+	// or recovering from a peer
+	healthServer := health.NewServer()
+	apiHandler.SetHealthServer(healthServer)
+	healthpb.RegisterHealthServer(grpcServer, healthServer)
+	reflection.Register(grpcServer)
 
 	go grpcServer.Serve(listener)
 
@@ -96,9 +293,50 @@ func main() {
 
     //   log.Fatal(http.ListenAndServe(":"+*testingPort, nil))
 
-	router := gin.Default()
-	apiHandler.RegisterRoutes(router)
-	router.POST("/snapshot", apiHandler.TakeSnapshot)
-	recovery.Recover(serverAddresses, statementMachine, replicatedLog)
-	router.Run(":" + *testingPort)
+	router := gin.New()
+	router.Use(api.RequestID(), api.RequestLogger(), gin.Recovery())
+	if *witness {
+		apiHandler.RegisterWitnessRoutes(router)
+	} else {
+		apiHandler.RegisterRoutes(router)
+		router.POST("/snapshot", apiHandler.TakeSnapshot)
+		if err := recoverer.Recover(serverAddresses); err != nil {
+			fmt.Printf("Recovery failed: %v\n", err)
+		}
+		if err := replicatedLog.Validate(); err != nil {
+			log.Fatalf("After recovery: %v", err)
+		}
+		if applied, commit := statementMachine.AppliedIndex(), replicatedLog.GetCommitIndex(); applied > commit {
+			log.Fatalf("After recovery: applied index %d is past commit index %d", applied, commit)
+		}
+	}
+	apiHandler.MarkReady()
+	if *profiling {
+		api.RegisterProfiling(router)
+	}
+	if *readOnly {
+		go recoverer.Follow(ctx, serverAddresses, *followInterval)
+	}
+
+	httpServer := &http.Server{Addr: ":" + *testingPort, Handler: router}
+	go func() {
+		if err := httpServer.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+			log.Fatalf("Failed to serve HTTP: %v", err)
+		}
+	}()
+
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGINT, syscall.SIGTERM)
+	<-signals
+
+	fmt.Printf("Server %d shutting down, draining writes\n", *id)
+	apiHandler.Drain()
+	apiHandler.WaitForWrites()
+
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	httpServer.Shutdown(shutdownCtx)
+	grpcServer.GracefulStop()
+	peerConnections.Close()
+	membershipService.Stop()
 }
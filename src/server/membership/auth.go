@@ -0,0 +1,90 @@
+package membership
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"os"
+	"time"
+
+	clientv3 "go.etcd.io/etcd/client/v3"
+)
+
+const etcdDialTimeout = 5 * time.Second
+
+// EtcdAuth is how to authenticate to etcd. The zero value connects without
+// credentials or TLS, which is what the local compose cluster uses.
+type EtcdAuth struct {
+	Username string
+	Password string
+	// CAFile verifies etcd's certificate. CertFile and KeyFile are this
+	// node's client certificate, for etcd with --client-cert-auth.
+	CAFile   string
+	CertFile string
+	KeyFile  string
+}
+
+// ErrEtcdAuth is returned for EtcdAuth settings that can't be used, such as
+// a password without a username or a certificate that doesn't load
+type ErrEtcdAuth struct {
+	Reason string
+}
+
+func (e *ErrEtcdAuth) Error() string {
+	return fmt.Sprintf("invalid etcd auth: %s", e.Reason)
+}
+
+// UsesTLS reports whether any of the TLS files are set
+func (auth EtcdAuth) UsesTLS() bool {
+	return auth.CAFile != "" || auth.CertFile != "" || auth.KeyFile != ""
+}
+
+// clientConfig is the clientv3 config for reaching endpoints with auth
+func (auth EtcdAuth) clientConfig(endpoints []string) (clientv3.Config, error) {
+	config := clientv3.Config{
+		Endpoints:   endpoints,
+		DialTimeout: etcdDialTimeout,
+	}
+
+	if auth.Password != "" && auth.Username == "" {
+		return config, &ErrEtcdAuth{Reason: "password given without a username"}
+	}
+	config.Username = auth.Username
+	config.Password = auth.Password
+
+	if !auth.UsesTLS() {
+		return config, nil
+	}
+	if (auth.CertFile == "") != (auth.KeyFile == "") {
+		return config, &ErrEtcdAuth{Reason: "client certificate and key must be given together"}
+	}
+
+	tlsConfig := &tls.Config{MinVersion: tls.VersionTLS12}
+	if auth.CAFile != "" {
+		pem, err := os.ReadFile(auth.CAFile)
+		if err != nil {
+			return config, &ErrEtcdAuth{Reason: fmt.Sprintf("reading CA %s: %v", auth.CAFile, err)}
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return config, &ErrEtcdAuth{Reason: fmt.Sprintf("no certificates found in CA %s", auth.CAFile)}
+		}
+		tlsConfig.RootCAs = pool
+	}
+	if auth.CertFile != "" {
+		cert, err := tls.LoadX509KeyPair(auth.CertFile, auth.KeyFile)
+		if err != nil {
+			return config, &ErrEtcdAuth{Reason: fmt.Sprintf("loading client certificate: %v", err)}
+		}
+		tlsConfig.Certificates = []tls.Certificate{cert}
+	}
+	config.TLS = tlsConfig
+	return config, nil
+}
+
+// Auth is the EtcdAuth this node connected with, minus the password
+func (m *Membership) Auth() EtcdAuth {
+	auth := m.auth
+	auth.Password = ""
+	return auth
+}
@@ -0,0 +1,88 @@
+package membership
+
+import (
+	"sync"
+	"time"
+)
+
+// EtcdHealth is how this node's link to etcd looks right now
+type EtcdHealth struct {
+	// Connected is true while the lease keepalive is running. Once its
+	// channel closes the lease is lost and it stays false.
+	Connected bool
+	// LeaseRemaining is how long the lease lasts past the last renewal
+	LeaseRemaining time.Duration
+	Members        int
+	// WatchRestarts counts the membership watch failing or closing and
+	// starting over from a fresh sync
+	WatchRestarts int64
+	// LeaseRenewals counts renewals etcd acknowledged, and LeaseRegrants
+	// the fresh leases renewLease granted after a renewal failed
+	LeaseRenewals int64
+	LeaseRegrants int64
+}
+
+type etcdHealth struct {
+	connected     bool
+	leaseTTL      time.Duration
+	lastRenewal   time.Time
+	watchRestarts int64
+	renewals      int64
+	regrants      int64
+	mutex         sync.Mutex
+}
+
+// granted records a new lease, which counts as renewed just now
+func (h *etcdHealth) granted(ttl int64) {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+	h.connected = true
+	h.leaseTTL = time.Duration(ttl) * time.Second
+	h.lastRenewal = time.Now()
+}
+
+func (h *etcdHealth) renewed(ttl int64) {
+	h.granted(ttl)
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+	h.renewals++
+}
+
+func (h *etcdHealth) regranted(ttl int64) {
+	h.granted(ttl)
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+	h.regrants++
+}
+
+func (h *etcdHealth) lost() {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+	h.connected = false
+}
+
+func (h *etcdHealth) watchRestarted() {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+	h.watchRestarts++
+}
+
+// Health reports the keepalive's state, the lease time left and the members
+// the watch currently sees. With SetLeaseRenewal, Connected is false from a
+// failed renewal until the fresh lease is granted.
+func (m *Membership) Health() EtcdHealth {
+	m.health.mutex.Lock()
+	health := EtcdHealth{
+		Connected:     m.health.connected,
+		WatchRestarts: m.health.watchRestarts,
+		LeaseRenewals: m.health.renewals,
+		LeaseRegrants: m.health.regrants,
+	}
+	if m.health.connected {
+		health.LeaseRemaining = max(m.health.leaseTTL-time.Since(m.health.lastRenewal), 0)
+	}
+	m.health.mutex.Unlock()
+
+	health.Members = len(m.GetMembers())
+	return health
+}
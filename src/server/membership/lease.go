@@ -0,0 +1,134 @@
+package membership
+
+import (
+	"context"
+	"fmt"
+	"math/rand/v2"
+	"strconv"
+	"time"
+
+	clientv3 "go.etcd.io/etcd/client/v3"
+)
+
+// LeaseTTL is how long this node's registration outlives its last renewal
+const LeaseTTL = 5 * time.Second
+
+// SetLeaseRenewal has Start renew the lease itself every interval, moved by
+// a random amount up to jitter either way so nodes started together don't
+// renew together. A renewal etcd refuses, say because the lease already
+// expired, grants a fresh lease and registers again under it. An interval
+// of 0 leaves renewal to the etcd client's KeepAlive, which stops for good
+// once the lease is lost. Call it before Start; interval plus jitter must
+// stay under LeaseTTL.
+func (m *Membership) SetLeaseRenewal(interval time.Duration, jitter time.Duration) {
+	m.renewInterval = interval
+	m.renewJitter = jitter
+}
+
+func (m *Membership) currentLease() clientv3.LeaseID {
+	m.mutex.RLock()
+	defer m.mutex.RUnlock()
+	return m.leaseID
+}
+
+// register grants a lease and puts this node's keys under it. It fails with
+// ErrDuplicateID if another address holds this node's registration.
+func (m *Membership) register(ctx context.Context) (*clientv3.LeaseGrantResponse, error) {
+	lease, err := m.client.Grant(ctx, int64(LeaseTTL/time.Second))
+	if err != nil {
+		return nil, err
+	}
+	m.mutex.Lock()
+	m.leaseID = lease.ID
+	m.mutex.Unlock()
+
+	if err := m.claim(ctx, m.registrationKey(), lease.ID); err != nil {
+		return nil, err
+	}
+	if m.protocolVersion > 0 {
+		_, err = m.client.Put(ctx, fmt.Sprintf("protocol/%d", m.id), strconv.Itoa(m.protocolVersion), clientv3.WithLease(lease.ID))
+		if err != nil {
+			return nil, err
+		}
+	}
+	return lease, nil
+}
+
+// renewalDelay is renewInterval moved by up to renewJitter either way
+func (m *Membership) renewalDelay() time.Duration {
+	if m.renewJitter <= 0 {
+		return m.renewInterval
+	}
+	offset := time.Duration(rand.Int64N(int64(2*m.renewJitter)+1)) - m.renewJitter
+	return max(m.renewInterval+offset, 0)
+}
+
+// renewLease renews the lease every renewalDelay until ctx is done. When a
+// renewal fails it grants a fresh lease, backing off between attempts.
+func (m *Membership) renewLease(ctx context.Context) {
+	for sleepContext(ctx, m.renewalDelay()) {
+		response, err := m.client.KeepAliveOnce(ctx, m.currentLease())
+		if err == nil {
+			m.health.renewed(response.TTL)
+			continue
+		}
+		if ctx.Err() != nil {
+			return
+		}
+
+		fmt.Printf("Lease renewal failed, granting a new lease: %v\n", err)
+		m.health.lost()
+		backoff := minWatchBackoff
+		for {
+			lease, err := m.register(ctx)
+			if err == nil {
+				m.health.regranted(lease.TTL)
+				fmt.Printf("Registered again under lease %x\n", lease.ID)
+				break
+			}
+			fmt.Printf("Failed to grant a new lease: %v\n", err)
+			if !sleepContext(ctx, backoff) {
+				return
+			}
+			backoff = nextBackoff(backoff)
+		}
+	}
+}
+
+// ErrDuplicateID is returned by Start when another node is registered with
+// this node's ID under a different address
+type ErrDuplicateID struct {
+	Key      string
+	Address  string
+	Existing string
+}
+
+func (e *ErrDuplicateID) Error() string {
+	return fmt.Sprintf("%s is already registered by %s, not %s; two nodes share an ID, or this node moved and must wait up to %v for the old lease to expire", e.Key, e.Existing, e.Address, LeaseTTL)
+}
+
+// claim puts this node's address at key under lease, but only if key is
+// absent or already holds this address, as it does after a restart or a
+// re-grant. Each check and put is one etcd transaction, so of two nodes
+// starting with the same ID only one gets the key.
+func (m *Membership) claim(ctx context.Context, key string, lease clientv3.LeaseID) error {
+	put := clientv3.OpPut(key, m.address, clientv3.WithLease(lease))
+	absent := clientv3.Compare(clientv3.CreateRevision(key), "=", 0)
+	ours := clientv3.Compare(clientv3.Value(key), "=", m.address)
+	for {
+		for _, condition := range []clientv3.Cmp{absent, ours} {
+			response, err := m.client.Txn(ctx).If(condition).Then(put).Else(clientv3.OpGet(key)).Commit()
+			if err != nil {
+				return err
+			}
+			if response.Succeeded {
+				return nil
+			}
+			kvs := response.Responses[0].GetResponseRange().Kvs
+			if len(kvs) > 0 && string(kvs[0].Value) != m.address {
+				return &ErrDuplicateID{Key: key, Address: m.address, Existing: string(kvs[0].Value)}
+			}
+		}
+		// The key expired between the two checks, so it's free again
+	}
+}
@@ -2,6 +2,7 @@ package membership
 
 import (
 	"fmt"
+	"strconv"
 	"sync"
 	"context"
 	"time"
@@ -17,25 +18,44 @@ type Member struct {
 
 type Membership struct {
 	client *clientv3.Client
+	// leaseID changes when renewLease grants a fresh lease; read it with
+	// currentLease
 	leaseID clientv3.LeaseID
 	id   int64
 	address string
 
 	members map[int64]Member
+	// memberRevisions is the etcd revision each member was last seen at,
+	// so a sweep never drops one that joined after its own read
+	memberRevisions map[int64]int64
 	currentLeaderID int64
 
 	onLeaderChange func(leaderID int64)
+	protocolVersion int
+	readOnly bool
+	witness bool
+	// roles holds the non-member nodes by registration prefix
+	roles map[string]map[int64]Member
+	health etcdHealth
+	auth   EtcdAuth
+	// renewInterval, when set, has renewLease renew the lease instead of
+	// KeepAlive, every renewInterval give or take renewJitter
+	renewInterval time.Duration
+	renewJitter   time.Duration
 
 	mutex sync.RWMutex
 }
 
 
-func NewMembership(id int64, address string, endpoints []string) (*Membership, error) {
+// NewMembership connects to etcd at endpoints, authenticating with auth. Pass
+// the zero EtcdAuth for an etcd without auth or TLS.
+func NewMembership(id int64, address string, endpoints []string, auth EtcdAuth) (*Membership, error) {
 
-	client, err := clientv3.New(clientv3.Config{
-		Endpoints: endpoints,
-		DialTimeout: 5 * time.Second,
-	})
+	config, err := auth.clientConfig(endpoints)
+	if err != nil {
+		return nil, err
+	}
+	client, err := clientv3.New(config)
 	if err != nil {
 		return nil, err
 	}
@@ -44,37 +64,56 @@ func NewMembership(id int64, address string, endpoints []string) (*Membership, e
 		client: client,
 		id: id,
 		address: address,
+		auth: auth,
 		members: make(map[int64]Member),
+		memberRevisions: make(map[int64]int64),
+		roles: map[string]map[int64]Member{
+			learnersPrefix:  make(map[int64]Member),
+			witnessesPrefix: make(map[int64]Member),
+		},
 	}
 
 	return membership, nil
 }
 
+// OnLeaderChange registers callback to run with the new leader's ID each time
+// the leader changes. Register it before Start so the first election is seen.
+// The callback must not block on membership.
 func (m *Membership) OnLeaderChange(callback func(leaderID int64)) {
 	m.onLeaderChange = callback
 }
 
+// SetProtocolVersion makes Start publish version under protocol/<id>, and
+// the watch warn about members that publish a different one.
+func (m *Membership) SetProtocolVersion(version int) {
+	m.protocolVersion = version
+}
+
 func (m *Membership) Start(ctx context.Context) error {
 
-	lease,err := m.client.Grant(ctx, 5)
+	lease, err := m.register(ctx)
 	if err != nil {
 		return err
 	}
-	m.leaseID = lease.ID
+	m.health.granted(lease.TTL)
 
-	_, err = m.client.Put(ctx, fmt.Sprintf("members/%d", m.id), m.address, clientv3.WithLease(m.leaseID))
-	if err != nil {
-		return err
+	if m.renewInterval > 0 {
+		go m.renewLease(ctx)
+		return nil
 	}
 
-	ch, err := m.client.KeepAlive(ctx, m.leaseID)
+	ch, err := m.client.KeepAlive(ctx, lease.ID)
 	if err != nil {
 		return err
 	}
 	
+	// The channel closes once etcd has gone unanswered past the lease's TTL
 	go func() {
-		for range ch {
+		for response := range ch {
+			m.health.renewed(response.TTL)
 		}
+		m.health.lost()
+		fmt.Printf("Lease keepalive stopped, lost the etcd lease\n")
 	}()
 
 	return nil
@@ -85,11 +124,14 @@ func (m *Membership) Stop()	{
 	m.client.Close()
 }
 
+// electLeader picks the lowest member ID as leader. The leader-change
+// callback runs synchronously once the lock is released, rather than in its
+// own goroutine, so successive changes reach it in order.
 func (n *Membership) electLeader()  {
 	n.mutex.Lock()
-	defer n.mutex.Unlock()
 
 	if len(n.members) == 0 {
+		n.mutex.Unlock()
 		return
 	}
 
@@ -102,48 +144,232 @@ func (n *Membership) electLeader()  {
 		return memberIDs[i] < memberIDs[j]
 	})
 
-	if memberIDs[0] != n.currentLeaderID {	
+	changed := memberIDs[0] != n.currentLeaderID
+	if changed {	
 		n.currentLeaderID = memberIDs[0]
 		fmt.Printf("New leader elected: Server %d\n", n.currentLeaderID)
-		if n.onLeaderChange != nil {
-			go n.onLeaderChange(n.currentLeaderID)
-		}
+	}
+	leaderID := n.currentLeaderID
+	n.mutex.Unlock()
+
+	if changed && n.onLeaderChange != nil {
+		n.onLeaderChange(leaderID)
 	}
 }
 
 
 
-func (m *Membership) Watch(ctx context.Context) {
+const (
+	minWatchBackoff = 100 * time.Millisecond
+	maxWatchBackoff = 10 * time.Second
+)
+
+// syncMembers replaces the local member map with what etcd currently holds
+// and returns the revision it was read at, so a watch can resume right after.
+func (m *Membership) syncMembers(ctx context.Context) (int64, error) {
 	response, err := m.client.Get(ctx, "members/", clientv3.WithPrefix())
-	if err == nil {
-		for _, kv := range response.Kvs {
-			var memberID int64
-			fmt.Sscanf(string(kv.Key), "members/%d", &memberID)
-			m.mutex.Lock()
-			m.members[memberID] = Member{ID: memberID, Address: string(kv.Value)}
-			m.mutex.Unlock()
+	if err != nil {
+		return 0, err
+	}
+
+	members := make(map[int64]Member)
+	revisions := make(map[int64]int64)
+	for _, kv := range response.Kvs {
+		var memberID int64
+		fmt.Sscanf(string(kv.Key), "members/%d", &memberID)
+		members[memberID] = Member{ID: memberID, Address: string(kv.Value)}
+		revisions[memberID] = kv.ModRevision
+	}
+
+	m.mutex.Lock()
+	m.members = members
+	m.memberRevisions = revisions
+	m.mutex.Unlock()
+	m.electLeader()
+	m.checkProtocolVersions(ctx)
+
+	return response.Header.Revision, nil
+}
+
+// checkProtocolVersions warns about every member publishing a protocol
+// version other than ours. Members that don't publish one are older builds
+// and are reported too.
+func (m *Membership) checkProtocolVersions(ctx context.Context) {
+	if m.protocolVersion == 0 {
+		return
+	}
+
+	response, err := m.client.Get(ctx, "protocol/", clientv3.WithPrefix())
+	if err != nil {
+		fmt.Printf("Failed to read protocol versions: %v\n", err)
+		return
+	}
+
+	versions := make(map[int64]int)
+	for _, kv := range response.Kvs {
+		var memberID int64
+		fmt.Sscanf(string(kv.Key), "protocol/%d", &memberID)
+		version, _ := strconv.Atoi(string(kv.Value))
+		versions[memberID] = version
+	}
+
+	for _, member := range m.GetMembers() {
+		version, published := versions[member.ID]
+		if !published {
+			fmt.Printf("WARNING: Server %d does not publish a protocol version, we speak %d\n", member.ID, m.protocolVersion)
+		} else if version != m.protocolVersion {
+			fmt.Printf("WARNING: Server %d speaks protocol version %d, we speak %d\n", member.ID, version, m.protocolVersion)
 		}
-		m.electLeader()
 	}
+}
 
-	watchChannel := m.client.Watch(ctx, "members/", clientv3.WithPrefix())
-	for watchResponse := range watchChannel {
-		for _, event := range watchResponse.Events {
-			var memberID int64
-			fmt.Sscanf(string(event.Kv.Key), "members/%d", &memberID)
+// Sync reads the members, learners and witnesses registered right now, for
+// callers that need a view before the watches have done their first sync.
+func (m *Membership) Sync(ctx context.Context) error {
+	if _, err := m.syncMembers(ctx); err != nil {
+		return err
+	}
+	for _, prefix := range []string{learnersPrefix, witnessesPrefix} {
+		if _, err := m.syncRole(ctx, prefix); err != nil {
+			return err
+		}
+	}
+	return nil
+}
 
-			m.mutex.Lock()
-			if event.Type == clientv3.EventTypePut {
-				m.members[memberID] = Member{ID: memberID, Address: string(event.Kv.Value)}
-				fmt.Printf("Server %d joined with address %s\n", memberID, string(event.Kv.Value))
-			} else if event.Type == clientv3.EventTypeDelete {
-				delete(m.members, memberID)
-				fmt.Printf("Server %d has left\n", memberID)
+func (m *Membership) Watch(ctx context.Context) {
+	backoff := minWatchBackoff
+
+	for ctx.Err() == nil {
+		revision, err := m.syncMembers(ctx)
+		if err != nil {
+			m.health.watchRestarted()
+			fmt.Printf("Failed to sync members: %v, retrying in %v\n", err, backoff)
+			if !sleepContext(ctx, backoff) {
+				return
+			}
+			backoff = nextBackoff(backoff)
+			continue
+		}
+
+		// Each attempt gets its own watch, cancelled before backing off, so
+		// one that failed doesn't stay open on the client
+		watchCtx, cancel := context.WithCancel(ctx)
+		watchChannel := m.client.Watch(watchCtx, "members/", clientv3.WithPrefix(), clientv3.WithRev(revision+1))
+		for watchResponse := range watchChannel {
+			if err := watchResponse.Err(); err != nil {
+				fmt.Printf("Membership watch failed: %v\n", err)
+				break
+			}
+			backoff = minWatchBackoff
+			for _, event := range watchResponse.Events {
+				var memberID int64
+				fmt.Sscanf(string(event.Kv.Key), "members/%d", &memberID)
+
+				m.mutex.Lock()
+				if event.Type == clientv3.EventTypePut {
+					m.members[memberID] = Member{ID: memberID, Address: string(event.Kv.Value)}
+					m.memberRevisions[memberID] = event.Kv.ModRevision
+					fmt.Printf("Server %d joined with address %s\n", memberID, string(event.Kv.Value))
+				} else if event.Type == clientv3.EventTypeDelete {
+					delete(m.members, memberID)
+					delete(m.memberRevisions, memberID)
+					fmt.Printf("Server %d has left\n", memberID)
+				}
+				m.mutex.Unlock()
+				m.electLeader()
+				if event.Type == clientv3.EventTypePut {
+					m.checkProtocolVersions(ctx)
+				}
 			}
-			m.mutex.Unlock()
-			m.electLeader()
 		}
+		cancel()
+
+		if ctx.Err() != nil {
+			return
+		}
+		m.health.watchRestarted()
+		fmt.Printf("Membership watch closed, reconnecting in %v\n", backoff)
+		if !sleepContext(ctx, backoff) {
+			return
+		}
+		backoff = nextBackoff(backoff)
+	}
+}
+
+// Reap cross-checks the members against etcd every interval and drops
+// those whose key is gone, in case the watch missed them leaving, e.g.
+// while stalled or reconnecting. It is a safety net behind Watch and only
+// ever removes members; joins are left to the watch.
+func (m *Membership) Reap(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		if err := m.reapStaleMembers(ctx); err != nil {
+			fmt.Printf("Failed to sweep members: %v\n", err)
+		}
+	}
+}
+
+func (m *Membership) reapStaleMembers(ctx context.Context) error {
+	response, err := m.client.Get(ctx, "members/", clientv3.WithPrefix(), clientv3.WithKeysOnly())
+	if err != nil {
+		return err
+	}
+
+	present := make(map[int64]bool)
+	for _, kv := range response.Kvs {
+		var memberID int64
+		fmt.Sscanf(string(kv.Key), "members/%d", &memberID)
+		present[memberID] = true
+	}
+
+	reaped := make([]int64, 0)
+	m.mutex.Lock()
+	for memberID := range m.members {
+		if !present[memberID] && m.memberRevisions[memberID] <= response.Header.Revision {
+			delete(m.members, memberID)
+			delete(m.memberRevisions, memberID)
+			reaped = append(reaped, memberID)
+		}
+	}
+	m.mutex.Unlock()
+
+	for _, memberID := range reaped {
+		fmt.Printf("Reaped server %d, it left without the watch noticing\n", memberID)
 	}
+	if len(reaped) > 0 {
+		m.electLeader()
+	}
+	return nil
+}
+
+func nextBackoff(backoff time.Duration) time.Duration {
+	backoff *= 2
+	if backoff > maxWatchBackoff {
+		backoff = maxWatchBackoff
+	}
+	return backoff
+}
+
+func sleepContext(ctx context.Context, d time.Duration) bool {
+	select {
+	case <-ctx.Done():
+		return false
+	case <-time.After(d):
+		return true
+	}
+}
+
+// Client exposes the etcd client so other subsystems can share the
+// connection instead of dialing their own.
+func (m *Membership) Client() *clientv3.Client {
+	return m.client
 }
 
 func (m *Membership) GetMembers() []Member {
@@ -168,7 +394,83 @@ func (m *Membership) IsLeader() bool {
 	return m.id == m.currentLeaderID
 }
 
+// HasLeader reports whether a leader is elected and still a member. Between
+// the last member leaving and the next one joining there is none.
+func (m *Membership) HasLeader() bool {
+	m.mutex.RLock()
+	defer m.mutex.RUnlock()
+	_, exists := m.members[m.currentLeaderID]
+	return m.currentLeaderID != 0 && exists
+}
+
+// LeaderAddress returns the address the current leader registered with, or
+// false if no leader has been elected or it has since left.
+func (m *Membership) LeaderAddress() (string, bool) {
+	m.mutex.RLock()
+	defer m.mutex.RUnlock()
+	leader, exists := m.members[m.currentLeaderID]
+	if !exists {
+		return "", false
+	}
+	return leader.Address, true
+}
+
 
 			
 
 
+
+func (m *Membership) PublishProgress(ctx context.Context, index int64) error {
+	_, err := m.client.Put(ctx, fmt.Sprintf("progress/%d", m.id), fmt.Sprintf("%d", index), clientv3.WithLease(m.currentLease()))
+	return err
+}
+
+func (m *Membership) StartProgressPublisher(ctx context.Context, interval time.Duration, progress func() int64) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		if err := m.PublishProgress(ctx, progress()); err != nil {
+			fmt.Printf("Failed to publish progress: %v\n", err)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// CompactionWatermark returns the highest index every live member has
+// already applied, capped at local. Entries above it may still be needed by
+// a lagging member to recover, so the log must not be compacted past it. A
+// live member that hasn't published its progress yet holds compaction back
+// entirely.
+func (m *Membership) CompactionWatermark(ctx context.Context, local int64) (int64, error) {
+	response, err := m.client.Get(ctx, "progress/", clientv3.WithPrefix())
+	if err != nil {
+		return -1, err
+	}
+
+	progress := make(map[int64]int64)
+	for _, kv := range response.Kvs {
+		var memberID, index int64
+		fmt.Sscanf(string(kv.Key), "progress/%d", &memberID)
+		fmt.Sscanf(string(kv.Value), "%d", &index)
+		progress[memberID] = index
+	}
+
+	watermark := local
+	for _, member := range m.GetMembers() {
+		if member.ID == m.id {
+			continue
+		}
+		index, exists := progress[member.ID]
+		if !exists {
+			return -1, nil
+		}
+		if index < watermark {
+			watermark = index
+		}
+	}
+	return watermark, nil
+}
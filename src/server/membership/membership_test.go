@@ -0,0 +1,189 @@
+package membership
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"go.etcd.io/etcd/api/v3/etcdserverpb"
+	"go.etcd.io/etcd/api/v3/mvccpb"
+	clientv3 "go.etcd.io/etcd/client/v3"
+)
+
+// fakeEtcd stands in for the KV and Watcher of an etcd client. Get answers
+// from members at the current revision, and every Watch hands the test a
+// channel to feed and close.
+type fakeEtcd struct {
+	clientv3.KV
+	clientv3.Watcher
+
+	mutex    sync.Mutex
+	members  map[int64]string
+	revision int64
+	watches  chan fakeWatch
+}
+
+type fakeWatch struct {
+	ctx      context.Context
+	revision int64
+	events   chan clientv3.WatchResponse
+}
+
+func newFakeEtcd() *fakeEtcd {
+	return &fakeEtcd{members: make(map[int64]string), watches: make(chan fakeWatch, 10)}
+}
+
+// join registers a member in etcd without telling any watch
+func (f *fakeEtcd) join(id int64, address string) *mvccpb.KeyValue {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	f.revision++
+	f.members[id] = address
+	return &mvccpb.KeyValue{Key: []byte(fmt.Sprintf("members/%d", id)), Value: []byte(address), ModRevision: f.revision}
+}
+
+func (f *fakeEtcd) Get(ctx context.Context, key string, opts ...clientv3.OpOption) (*clientv3.GetResponse, error) {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	response := &clientv3.GetResponse{Header: &etcdserverpb.ResponseHeader{Revision: f.revision}}
+	for id, address := range f.members {
+		response.Kvs = append(response.Kvs, &mvccpb.KeyValue{Key: []byte(fmt.Sprintf("members/%d", id)), Value: []byte(address)})
+	}
+	return response, nil
+}
+
+func (f *fakeEtcd) Watch(ctx context.Context, key string, opts ...clientv3.OpOption) clientv3.WatchChan {
+	watch := fakeWatch{ctx: ctx, revision: clientv3.OpGet(key, opts...).Rev(), events: make(chan clientv3.WatchResponse)}
+	f.watches <- watch
+	return watch.events
+}
+
+// nextWatch waits for Watch to open its next watch
+func (f *fakeEtcd) nextWatch(t *testing.T) fakeWatch {
+	t.Helper()
+	select {
+	case watch := <-f.watches:
+		return watch
+	case <-time.After(5 * time.Second):
+		t.Fatal("the watch was never opened")
+		return fakeWatch{}
+	}
+}
+
+func newWatchedMembership(etcd *fakeEtcd) *Membership {
+	client := clientv3.NewCtxClient(context.Background())
+	client.KV = etcd
+	client.Watcher = etcd
+	return &Membership{
+		client:          client,
+		members:         make(map[int64]Member),
+		memberRevisions: make(map[int64]int64),
+	}
+}
+
+func waitForMember(t *testing.T, m *Membership, id int64) {
+	t.Helper()
+	for deadline := time.Now().Add(5 * time.Second); time.Now().Before(deadline); time.Sleep(5 * time.Millisecond) {
+		for _, member := range m.GetMembers() {
+			if member.ID == id {
+				return
+			}
+		}
+	}
+	t.Fatalf("server %d never showed up, members are %v", id, m.GetMembers())
+}
+
+func TestWatchSeesJoinsAfterTheChannelCloses(t *testing.T) {
+	etcd := newFakeEtcd()
+	etcd.join(1, "server1:50051")
+	m := newWatchedMembership(etcd)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go m.Watch(ctx)
+
+	watch := etcd.nextWatch(t)
+	if watch.revision != 2 {
+		t.Fatalf("first watch opened at revision %d, want 2, right after the sync", watch.revision)
+	}
+	waitForMember(t, m, 1)
+	watch.events <- clientv3.WatchResponse{Events: []*clientv3.Event{{Type: clientv3.EventTypePut, Kv: etcd.join(2, "server2:50052")}}}
+	waitForMember(t, m, 2)
+
+	// Server 3 joins while the watch is down, so only the re-sync can see it
+	etcd.join(3, "server3:50053")
+	close(watch.events)
+
+	watch = etcd.nextWatch(t)
+	if watch.revision != 4 {
+		t.Fatalf("watch reopened at revision %d, want 4, right after the re-sync", watch.revision)
+	}
+	waitForMember(t, m, 3)
+	watch.events <- clientv3.WatchResponse{Events: []*clientv3.Event{{Type: clientv3.EventTypePut, Kv: etcd.join(4, "server4:50054")}}}
+	waitForMember(t, m, 4)
+
+	if restarts := m.Health().WatchRestarts; restarts != 1 {
+		t.Fatalf("%d watch restarts, want 1", restarts)
+	}
+	if leader := m.GetLeader(); leader != 1 {
+		t.Fatalf("leader %d, want 1", leader)
+	}
+}
+
+func TestWatchResyncsAfterCompaction(t *testing.T) {
+	etcd := newFakeEtcd()
+	etcd.join(1, "server1:50051")
+	m := newWatchedMembership(etcd)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go m.Watch(ctx)
+
+	watch := etcd.nextWatch(t)
+	etcd.join(2, "server2:50052")
+	// The revision the watch wanted was compacted away, so it can't resume
+	watch.events <- clientv3.WatchResponse{CompactRevision: 2}
+
+	failed := watch
+	watch = etcd.nextWatch(t)
+	if failed.ctx.Err() == nil {
+		t.Fatal("the failed watch was left open when the next one was opened")
+	}
+	waitForMember(t, m, 2)
+	if watch.revision != 3 {
+		t.Fatalf("watch reopened at revision %d, want 3", watch.revision)
+	}
+}
+
+func TestRoleWatchIsCancelledBeforeReopening(t *testing.T) {
+	etcd := newFakeEtcd()
+	m := newWatchedMembership(etcd)
+	m.roles = make(map[string]map[int64]Member)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go m.WatchWitnesses(ctx)
+
+	failed := etcd.nextWatch(t)
+	failed.events <- clientv3.WatchResponse{CompactRevision: 1}
+	etcd.nextWatch(t)
+	if failed.ctx.Err() == nil {
+		t.Fatal("the failed watch was left open when the next one was opened")
+	}
+}
+
+func TestBackoffDoublesUpToTheMax(t *testing.T) {
+	backoff := minWatchBackoff
+	for i := 0; i < 20; i++ {
+		next := nextBackoff(backoff)
+		if next != min(2*backoff, maxWatchBackoff) {
+			t.Fatalf("backoff went from %v to %v", backoff, next)
+		}
+		backoff = next
+	}
+	if backoff != maxWatchBackoff {
+		t.Fatalf("backoff settled at %v, want %v", backoff, maxWatchBackoff)
+	}
+}
@@ -0,0 +1,149 @@
+package membership
+
+import (
+	"context"
+	"fmt"
+
+	clientv3 "go.etcd.io/etcd/client/v3"
+)
+
+// Nodes that aren't full members register under their own prefix instead of
+// members/, so they are never elected leader.
+const (
+	// learnersPrefix is for read-only nodes. They don't count towards the
+	// live quorum, but proposers send them commits so they follow the log.
+	learnersPrefix = "learners/"
+	// witnessesPrefix is for witnesses, which vote in Paxos but hold no
+	// state. They count towards the live quorum.
+	witnessesPrefix = "witnesses/"
+)
+
+// SetReadOnly makes Start register this node as a learner. Call it before
+// Start.
+func (m *Membership) SetReadOnly() {
+	m.readOnly = true
+}
+
+func (m *Membership) IsReadOnly() bool {
+	return m.readOnly
+}
+
+// SetWitness makes Start register this node as a witness. Call it before
+// Start.
+func (m *Membership) SetWitness() {
+	m.witness = true
+}
+
+func (m *Membership) registrationKey() string {
+	switch {
+	case m.witness:
+		return fmt.Sprintf("%s%d", witnessesPrefix, m.id)
+	case m.readOnly:
+		return fmt.Sprintf("%s%d", learnersPrefix, m.id)
+	default:
+		return fmt.Sprintf("members/%d", m.id)
+	}
+}
+
+// GetLearners returns the read-only nodes currently registered
+func (m *Membership) GetLearners() []Member {
+	return m.getRole(learnersPrefix)
+}
+
+// GetWitnesses returns the witnesses currently registered
+func (m *Membership) GetWitnesses() []Member {
+	return m.getRole(witnessesPrefix)
+}
+
+// WatchLearners keeps the learner view current until ctx is done
+func (m *Membership) WatchLearners(ctx context.Context) {
+	m.watchRole(ctx, learnersPrefix, "Read-only server")
+}
+
+// WatchWitnesses keeps the witness view current until ctx is done
+func (m *Membership) WatchWitnesses(ctx context.Context) {
+	m.watchRole(ctx, witnessesPrefix, "Witness")
+}
+
+func (m *Membership) getRole(prefix string) []Member {
+	m.mutex.RLock()
+	defer m.mutex.RUnlock()
+	nodes := make([]Member, 0, len(m.roles[prefix]))
+	for _, node := range m.roles[prefix] {
+		nodes = append(nodes, node)
+	}
+	return nodes
+}
+
+func (m *Membership) syncRole(ctx context.Context, prefix string) (int64, error) {
+	response, err := m.client.Get(ctx, prefix, clientv3.WithPrefix())
+	if err != nil {
+		return 0, err
+	}
+
+	nodes := make(map[int64]Member)
+	for _, kv := range response.Kvs {
+		var nodeID int64
+		fmt.Sscanf(string(kv.Key), prefix+"%d", &nodeID)
+		nodes[nodeID] = Member{ID: nodeID, Address: string(kv.Value)}
+	}
+
+	m.mutex.Lock()
+	m.roles[prefix] = nodes
+	m.mutex.Unlock()
+
+	return response.Header.Revision, nil
+}
+
+// watchRole keeps the nodes registered under prefix current the same way
+// Watch does for members. name is how they are called in the log.
+func (m *Membership) watchRole(ctx context.Context, prefix string, name string) {
+	backoff := minWatchBackoff
+
+	for ctx.Err() == nil {
+		revision, err := m.syncRole(ctx, prefix)
+		if err != nil {
+			fmt.Printf("Failed to sync %s: %v, retrying in %v\n", prefix, err, backoff)
+			if !sleepContext(ctx, backoff) {
+				return
+			}
+			backoff = nextBackoff(backoff)
+			continue
+		}
+
+		// Each attempt gets its own watch, cancelled before backing off, so
+		// one that failed doesn't stay open on the client
+		watchCtx, cancel := context.WithCancel(ctx)
+		watchChannel := m.client.Watch(watchCtx, prefix, clientv3.WithPrefix(), clientv3.WithRev(revision+1))
+		for watchResponse := range watchChannel {
+			if err := watchResponse.Err(); err != nil {
+				fmt.Printf("Watch of %s failed: %v\n", prefix, err)
+				break
+			}
+			backoff = minWatchBackoff
+			for _, event := range watchResponse.Events {
+				var nodeID int64
+				fmt.Sscanf(string(event.Kv.Key), prefix+"%d", &nodeID)
+
+				m.mutex.Lock()
+				if event.Type == clientv3.EventTypePut {
+					m.roles[prefix][nodeID] = Member{ID: nodeID, Address: string(event.Kv.Value)}
+					fmt.Printf("%s %d joined with address %s\n", name, nodeID, string(event.Kv.Value))
+				} else if event.Type == clientv3.EventTypeDelete {
+					delete(m.roles[prefix], nodeID)
+					fmt.Printf("%s %d has left\n", name, nodeID)
+				}
+				m.mutex.Unlock()
+			}
+		}
+		cancel()
+
+		if ctx.Err() != nil {
+			return
+		}
+		if !sleepContext(ctx, backoff) {
+			return
+		}
+		backoff = nextBackoff(backoff)
+	}
+}
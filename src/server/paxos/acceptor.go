@@ -1,7 +1,11 @@
 package paxos
 
 import (
+	"bytes"
+	"errors"
+	"sort"
 	"sync"
+	"sync/atomic"
 	"context"
 
 	pb "ds_project/src/server/proto"
@@ -11,12 +15,33 @@ import (
 )
 
 type AcceptorInstance struct {
-	lastRound     []int64
-	lastGoodRound []int64
+	lastRound     Round
+	lastGoodRound Round
 	v_i 		  int64
 	decided		  bool
 	decidedValue  int64
 }
+// keptResults is how many recent apply results Result can look up
+const keptResults = 1024
+
+type applyTask struct {
+	index   int64
+	command []byte
+	done    chan applyOutcome
+}
+
+// applyOutcome is the state machine's verdict on one command
+type applyOutcome struct {
+	result statemachine.Result
+	err    error
+}
+
+// Lock ordering: a.mutex is taken first, then the log's own mutex inside
+// commit. The state machine is only touched by the apply loop, outside
+// a.mutex, so a slow Apply never holds up Prepare or Accept, and a commit
+// waits for room in the apply queue before taking a.mutex. The API only
+// takes the state machine's lock on reads, so a read can wait behind an
+// apply but never deadlock with it.
 type Acceptor struct {
 	pb.UnimplementedPaxosServer
 
@@ -24,30 +49,141 @@ type Acceptor struct {
 	
 	mutex sync.Mutex
 
-	stateMachine *statemachine.ScooterStateMachine
+	// maxInstances caps the instance map, 0 for no limit; see
+	// SetMaxInstances. undecided counts the map's undecided instances, and
+	// instances below forgottenBelow were dropped once compacted. Instances
+	// below evictedBelow that aren't in the map were dropped undecided.
+	maxInstances   int
+	undecided      int
+	forgottenBelow int64
+	evictedBelow   int64
+
+	stateMachine statemachine.StateMachine
 	log          *log.ReplicatedLog
 
+	applyQueue *applyQueue
+
+	// onStall is told the index the apply loop is stuck at; see
+	// SetStallHandler. stalling is set while it runs.
+	onStall  func(index int64)
+	stalling atomic.Bool
+
+	// witness votes in prepare and accept but keeps no log or state
+	witness bool
+
+	// highestAccepted is the highest instance accepted or decided here,
+	// -1 before any, for ReadIndex
+	highestAccepted int64
+
+	// results keeps what the last keptResults successful applies
+	// produced, oldest first in resultOrder, for writes forwarded to the
+	// leader to look up once they are applied here
+	results      map[int64]statemachine.Result
+	resultOrder  []int64
+	resultsMutex sync.Mutex
 }
 	
-func NewAcceptor(stateMachine *statemachine.ScooterStateMachine, log *log.ReplicatedLog) *Acceptor {
-	return &Acceptor{
+// appliedIndexer is implemented by state machines that track the highest
+// index up to which every entry has been applied
+type appliedIndexer interface {
+	AppliedIndex() int64
+}
+
+func NewAcceptor(stateMachine statemachine.StateMachine, log *log.ReplicatedLog) *Acceptor {
+	var applied func() int64
+	if indexer, ok := stateMachine.(appliedIndexer); ok {
+		applied = indexer.AppliedIndex
+	}
+	a := &Acceptor{
 		instance: make(map[int64]*AcceptorInstance),
 		stateMachine: stateMachine,
 		log:          log,
+		applyQueue:   newApplyQueue(applyWindow, applied),
+		results:      make(map[int64]statemachine.Result),
+		highestAccepted: -1,
 	}
+	go a.applyLoop()
+	return a
 }	
 
-func (a *Acceptor) getInstance(instanceId int64) *AcceptorInstance {
-	if _, exists := a.instance[instanceId]; !exists {
-		a.instance[instanceId] = &AcceptorInstance{
-			lastRound:     []int64{0, 0},
-			lastGoodRound: []int64{0, 0},
-			v_i:           0,
-			decided:       false,
-			decidedValue:  0,
+// SetWitness makes this acceptor a witness: commits only mark the instance
+// decided, nothing is appended to the log or applied. Set it before serving.
+func (a *Acceptor) SetWitness() {
+	a.witness = true
+}
+
+// SetStallHandler has fn called, in its own goroutine, when the apply loop
+// has waited applyStallTimeout at an index that was never committed here
+// while later ones wait behind it. It isn't called again until it returns.
+// Set it before serving.
+func (a *Acceptor) SetStallHandler(fn func(index int64)) {
+	a.onStall = fn
+}
+
+// applyLoop applies decided commands one at a time, in index order.
+func (a *Acceptor) applyLoop() {
+	for {
+		task := a.applyQueue.pop(a.completeStale, a.reportStall)
+		if len(task.command) == 0 {
+			// Nothing to apply, but the index still counts as applied
+			if skipper, ok := a.stateMachine.(statemachine.Skipper); ok {
+				skipper.Skip(task.index)
+			}
+			a.applyQueue.finish()
+			task.done <- applyOutcome{}
+			continue
+		}
+		result, err := a.stateMachine.Apply(task.index, task.command)
+		a.log.SetApplyError(task.index, err)
+		if err == nil {
+			a.keepResult(task.index, result)
+		}
+		a.applyQueue.finish()
+		task.done <- applyOutcome{result: result, err: err}
+	}
+}
+
+// completeStale answers commits whose entries recovery or a snapshot
+// applied before the apply loop got to them, with the error recorded in
+// the log if there is one.
+func (a *Acceptor) completeStale(tasks []applyTask) {
+	for _, task := range tasks {
+		var err error
+		if entry := a.log.GetEntry(task.index); entry != nil && entry.ApplyError != "" {
+			err = errors.New(entry.ApplyError)
 		}
+		task.done <- applyOutcome{err: err}
+	}
+}
+
+func (a *Acceptor) reportStall(index int64) {
+	if a.onStall == nil || !a.stalling.CompareAndSwap(false, true) {
+		return
+	}
+	go func() {
+		defer a.stalling.Store(false)
+		a.onStall(index)
+	}()
+}
+
+func (a *Acceptor) keepResult(index int64, result statemachine.Result) {
+	a.resultsMutex.Lock()
+	defer a.resultsMutex.Unlock()
+	a.results[index] = result
+	a.resultOrder = append(a.resultOrder, index)
+	if len(a.resultOrder) > keptResults {
+		delete(a.results, a.resultOrder[0])
+		a.resultOrder = a.resultOrder[1:]
 	}
-	return a.instance[instanceId]
+}
+
+// Result returns what applying the command at index produced here, if it
+// was applied through a commit recently enough to still be remembered.
+func (a *Acceptor) Result(index int64) (statemachine.Result, bool) {
+	a.resultsMutex.Lock()
+	defer a.resultsMutex.Unlock()
+	result, exists := a.results[index]
+	return result, exists
 }
 
 func (a *Acceptor) Prepare(ctx context.Context, req *pb.PrepareRequest) (*pb.PromiseResponse, error) {
@@ -55,14 +191,17 @@ func (a *Acceptor) Prepare(ctx context.Context, req *pb.PrepareRequest) (*pb.Pro
 	a.mutex.Lock()
 	defer a.mutex.Unlock()
 
-	instance := a.getInstance(req.InstanceId)
+	instance, err := a.getInstance(req.InstanceId)
+	if err != nil {
+		return nil, err
+	}
 
-	if req.Round[0] > instance.lastRound[0] || (req.Round[0] == instance.lastRound[0] && req.Round[1] > instance.lastRound[1]) {
-		instance.lastRound = req.Round
+	if round := RoundFromProto(req.Round); round.Greater(instance.lastRound) {
+		instance.lastRound = round
 		return &pb.PromiseResponse{
 			Round:  req.Round,
 			Ack:          true,
-			LastGoodRound:  instance.lastGoodRound,
+			LastGoodRound:  instance.lastGoodRound.Proto(),
 			Value:        instance.v_i,
 			InstanceId: req.InstanceId,
 		}, nil
@@ -71,7 +210,7 @@ func (a *Acceptor) Prepare(ctx context.Context, req *pb.PrepareRequest) (*pb.Pro
 	return &pb.PromiseResponse{
 		    Round:  req.Round,
 			Ack:          false,
-			LastGoodRound:  instance.lastGoodRound,
+			LastGoodRound:  instance.lastGoodRound.Proto(),
 			Value:        instance.v_i,
 			InstanceId: req.InstanceId,
 	}, nil
@@ -80,43 +219,229 @@ func (a *Acceptor) Prepare(ctx context.Context, req *pb.PrepareRequest) (*pb.Pro
 func (a *Acceptor) Accept(ctx context.Context, req *pb.AcceptRequest) (*pb.AcceptedResponse, error) {
 	a.mutex.Lock()
 	defer a.mutex.Unlock()
-	instance := a.getInstance(req.InstanceId)
+	return a.acceptLocked(req), nil
+}
+
+// AcceptBatch handles each accept in the batch as Accept would, in order,
+// under a single acquisition of the acceptor mutex.
+func (a *Acceptor) AcceptBatch(ctx context.Context, req *pb.AcceptBatchRequest) (*pb.AcceptBatchResponse, error) {
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+
+	accepted := make([]*pb.AcceptedResponse, len(req.Accepts))
+	for i, accept := range req.Accepts {
+		accepted[i] = a.acceptLocked(accept)
+	}
+	return &pb.AcceptBatchResponse{Accepted: accepted}, nil
+}
+
+func (a *Acceptor) acceptLocked(req *pb.AcceptRequest) *pb.AcceptedResponse {
+	instance, err := a.getInstance(req.InstanceId)
+	if err != nil {
+		return &pb.AcceptedResponse{
+			Round: req.Round,
+			Ack:       false,
+			InstanceId: req.InstanceId,
+		}
+	}
 
-	if req.Round[0] > instance.lastRound[0] ||
-	  (req.Round[0] == instance.lastRound[0] && req.Round[1] >= instance.lastRound[1]) ||
-	  (instance.lastRound[0] == 0 && instance.lastRound[1] == 0) {
-		instance.lastRound = req.Round
-		instance.lastGoodRound = req.Round
+	if round := RoundFromProto(req.Round); !round.Less(instance.lastRound) || instance.lastRound.IsZero() {
+		instance.lastRound = round
+		instance.lastGoodRound = round
 		instance.v_i = req.Value
+		a.highestAccepted = max(a.highestAccepted, req.InstanceId)
 
 		return &pb.AcceptedResponse{
 			Round: req.Round,
 			Ack:       true,
-		}, nil
+			InstanceId: req.InstanceId,
+		}
 	}
 	
 	return &pb.AcceptedResponse{
 		Round: req.Round,
 		Ack:       false,
-	}, nil
+		InstanceId: req.InstanceId,
+	}
 }
 
 func (a *Acceptor) Commit(ctx context.Context, req *pb.CommitRequest) (*pb.CommitResponse, error) {	
+	// Refuse rather than hold the proposer once it stops waiting; the
+	// instance is then missing here until recovery brings it in
+	if err := a.reserveApply(ctx, req.InstanceId); err != nil {
+		return nil, err
+	}
+	a.commit(req)
+
+	return &pb.CommitResponse{
+	}, nil
+}
+
+// reserveApply waits until instanceId is close enough to the next index to
+// apply for the queue to hold its command. A witness applies nothing.
+func (a *Acceptor) reserveApply(ctx context.Context, instanceId int64) error {
+	if a.witness {
+		return nil
+	}
+	return a.applyQueue.reserve(ctx, instanceId)
+}
+
+// commit records the decision and queues the command for the apply loop,
+// which applies it once every index before it has been applied. The
+// returned channel yields the state machine's verdict on the command so
+// the local proposer can report it, and its result, to its client. It
+// waits, outside a.mutex, for room in the queue, so a sender far ahead of
+// the apply loop is slowed down instead of piling up commands.
+func (a *Acceptor) commit(req *pb.CommitRequest) <-chan applyOutcome {
+	a.reserveApply(context.Background(), req.InstanceId)
+
 	a.mutex.Lock()
 	defer a.mutex.Unlock()
 
-	instance := a.getInstance(req.InstanceId)
+	done := make(chan applyOutcome, 1)
+	instance, known := a.learnInstance(req.InstanceId)
 
-	if !instance.decided {
+	if known && !instance.decided {
 		instance.decided = true
+		a.undecided--
 		instance.decidedValue = req.Value
+		a.highestAccepted = max(a.highestAccepted, req.InstanceId)
 
-		if req.Command != nil && len(req.Command) > 0 {
-			a.log.Append(req.InstanceId, req.Command)
-			a.stateMachine.Apply(req.Command)
+		if a.witness {
+			done <- applyOutcome{}
+			return done
+		}
+		if len(req.Command) > 0 {
+			// Recovery can write a decided entry straight into the log and
+			// apply it before the commit for it arrives. Applying it again
+			// would run the command twice; if a different command is there
+			// the proposer has to try again at another index.
+			if entry := a.log.GetEntry(req.InstanceId); entry != nil {
+				if !bytes.Equal(entry.Command, req.Command) {
+					done <- applyOutcome{err: &ErrInstanceDecided{InstanceId: req.InstanceId}}
+					return done
+				}
+				done <- applyOutcome{}
+				return done
+			}
+			a.log.Append(req.InstanceId, req.Command, req.CommittedAt)
 		}
+		// An instance decided without a command is still queued, or the
+		// apply loop would wait at it for good
+		a.applyQueue.push(applyTask{index: req.InstanceId, command: req.Command, done: done})
+		return done
 	}
+	done <- applyOutcome{}
+	return done
+}
 
-	return &pb.CommitResponse{
-	}, nil
-}
\ No newline at end of file
+// ReadIndex reports the highest instance this acceptor has accepted or seen
+// decided. It changes nothing, so answering it costs no instance.
+func (a *Acceptor) ReadIndex(ctx context.Context, req *pb.ReadIndexRequest) (*pb.ReadIndexResponse, error) {
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+	return &pb.ReadIndexResponse{HighestAccepted: a.highestAccepted}, nil
+}
+
+// IsDecided reports whether instanceId has been committed here, either
+// through Commit or by recovery writing it straight into the log.
+func (a *Acceptor) IsDecided(instanceId int64) bool {
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+	if instance, exists := a.instance[instanceId]; exists && instance.decided {
+		return true
+	}
+	return instanceId < a.forgottenBelow || a.log.GetEntry(instanceId) != nil
+}
+
+// PauseCommits runs fn while no commit can be recorded or applied. Commands
+// already queued are applied before fn runs, up to the first index missing
+// here; those after it wait until it arrives.
+func (a *Acceptor) PauseCommits(fn func()) {
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+	a.applyQueue.pause()
+	defer a.applyQueue.resume()
+	fn()
+}
+
+// Reapply runs the logged commands after index through the state machine
+// again, in index order, for a state machine just rewound to a snapshot at
+// index. Call it from PauseCommits. It returns how many entries it applied.
+func (a *Acceptor) Reapply(index int64) int {
+	applied := 0
+	for i := index + 1; i <= a.log.GetCommitIndex(); i++ {
+		// Stop at a gap rather than apply the entries after it out of order
+		entry := a.log.GetEntry(i)
+		if entry == nil {
+			break
+		}
+		_, err := a.stateMachine.Apply(entry.Index, entry.Command)
+		a.log.SetApplyError(entry.Index, err)
+		applied++
+	}
+	return applied
+}
+
+type PendingInstance struct {
+	InstanceId    int64   `json:"instance_id"`
+	LastRound     []int64 `json:"last_round"`
+	LastGoodRound []int64 `json:"last_good_round"`
+	Value         int64   `json:"value"`
+}
+
+// PendingInstances lists the instances this acceptor has accepted a value
+// for but never seen committed, ordered by instance id.
+func (a *Acceptor) PendingInstances() []PendingInstance {
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+
+	pending := []PendingInstance{}
+	for instanceId, instance := range a.instance {
+		if instance.decided || instance.lastGoodRound.IsZero() {
+			continue
+		}
+		pending = append(pending, PendingInstance{
+			InstanceId:    instanceId,
+			LastRound:     instance.lastRound.Proto(),
+			LastGoodRound: instance.lastGoodRound.Proto(),
+			Value:         instance.v_i,
+		})
+	}
+	sort.Slice(pending, func(i, j int) bool {
+		return pending[i].InstanceId < pending[j].InstanceId
+	})
+	return pending
+}
+
+type InstanceState struct {
+	InstanceId    int64   `json:"instance_id"`
+	LastRound     []int64 `json:"last_round"`
+	LastGoodRound []int64 `json:"last_good_round"`
+	Value         int64   `json:"value"`
+	Decided       bool    `json:"decided"`
+	DecidedValue  int64   `json:"decided_value"`
+}
+
+// Instance reports where this acceptor stands on instanceId, and false if it
+// has never heard of it. An instance recovery wrote straight into the log,
+// or one forgotten once compacted, shows as decided with zero rounds.
+func (a *Acceptor) Instance(instanceId int64) (InstanceState, bool) {
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+
+	state := InstanceState{InstanceId: instanceId}
+	instance, exists := a.instance[instanceId]
+	if !exists {
+		state.LastRound = Round{}.Proto()
+		state.LastGoodRound = Round{}.Proto()
+		state.Decided = instanceId < a.forgottenBelow || a.log.GetEntry(instanceId) != nil
+		return state, state.Decided
+	}
+	state.LastRound = instance.lastRound.Proto()
+	state.LastGoodRound = instance.lastGoodRound.Proto()
+	state.Value = instance.v_i
+	state.Decided = instance.decided
+	state.DecidedValue = instance.decidedValue
+	return state, true
+}
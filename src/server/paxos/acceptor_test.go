@@ -0,0 +1,66 @@
+package paxos
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	pb "ds_project/src/server/proto"
+)
+
+func TestCommitSkipsEntryRecoveryAlreadyApplied(t *testing.T) {
+	cluster := newTestCluster("a")
+	acceptor, replicatedLog, machine := cluster.acceptors["a"], cluster.logs["a"], cluster.machines["a"]
+
+	// Recovery appends and applies instance 0 before its commit arrives
+	recovered := createCommand(t, "recovered")
+	replicatedLog.Append(0, recovered, 1)
+	if _, err := machine.Apply(0, recovered); err != nil {
+		t.Fatal(err)
+	}
+
+	applied := <-acceptor.commit(&pb.CommitRequest{Value: 0, InstanceId: 0, Command: recovered, CommittedAt: 1})
+	if applied.err != nil {
+		t.Fatalf("expected the same command to be accepted as already applied, got %v", applied.err)
+	}
+	if !acceptor.IsDecided(0) {
+		t.Fatal("expected instance 0 to be marked decided")
+	}
+	if _, undecided := acceptor.InstanceCounts(); undecided != 0 {
+		t.Fatalf("expected no undecided instances, got %d", undecided)
+	}
+
+	// A different command for an index recovery already filled has to go
+	// elsewhere rather than be applied on top
+	replicatedLog.Append(1, recovered, 1)
+	applied = <-acceptor.commit(&pb.CommitRequest{Value: 1, InstanceId: 1, Command: createCommand(t, "other"), CommittedAt: 1})
+	var decided *ErrInstanceDecided
+	if !errors.As(applied.err, &decided) || decided.InstanceId != 1 {
+		t.Fatalf("expected ErrInstanceDecided for instance 1, got %v", applied.err)
+	}
+	if _, exists := machine.GetScooter("other"); exists {
+		t.Fatal("the command for an already logged index was applied")
+	}
+}
+
+func TestProposeReturnsInstanceDecidedForRecoveredEntry(t *testing.T) {
+	cluster := newTestCluster("a", "b", "c")
+	p, transport := cluster.proposer(1, "a")
+	transport.SetFault("b", LinkFault{Delay: 100 * time.Millisecond})
+	transport.SetFault("c", LinkFault{Delay: 100 * time.Millisecond})
+
+	// Recovery fills instance 0 while the proposal for it is under way
+	go func() {
+		time.Sleep(30 * time.Millisecond)
+		cluster.logs["a"].Append(0, createCommand(t, "recovered"), 1)
+	}()
+	_, err := p.Propose(context.Background(), 0, 0, createCommand(t, "mine"))
+	var decided *ErrInstanceDecided
+	if !errors.As(err, &decided) {
+		t.Fatalf("expected ErrInstanceDecided, got %v", err)
+	}
+	if _, exists := cluster.machines["a"].GetScooter("mine"); exists {
+		t.Fatal("the proposal was applied on top of the recovered entry")
+	}
+}
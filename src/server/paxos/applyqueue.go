@@ -0,0 +1,186 @@
+package paxos
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// applyWindow is how many indexes past the next one to apply the queue
+// holds commands for
+const applyWindow = 1024
+
+// applyStallTimeout is how long the apply loop waits at a missing index,
+// with later commands held behind it, before reporting the gap
+const applyStallTimeout = 2 * time.Second
+
+// ErrApplyBacklog is returned by Commit for an instance too far past the
+// next one to apply, once the caller stops waiting for room
+type ErrApplyBacklog struct {
+	InstanceId int64
+	Next       int64
+	Window     int64
+}
+
+func (e *ErrApplyBacklog) Error() string {
+	return fmt.Sprintf("instance %d is more than %d past %d, the next to apply", e.InstanceId, e.Window, e.Next)
+}
+
+// applyQueue holds decided commands until the apply loop gets to them and
+// hands them over in index order. next is the index after the last one
+// applied, and a command committed ahead of it waits until every index
+// before it has been applied, whatever order the commits arrived in.
+// Commands are only held up to window indexes past next; see reserve.
+type applyQueue struct {
+	tasks  map[int64]applyTask
+	next   int64
+	window int64
+	// applied is the state machine's own applied index, if it keeps one,
+	// so the queue moves past entries recovery or a snapshot applied
+	// without it
+	applied func() int64
+	// busy is set while the loop applies the task it popped, paused while
+	// PauseCommits runs
+	busy   bool
+	paused bool
+	mutex  sync.Mutex
+	// changed is closed and replaced whenever a task arrives or next moves
+	changed chan struct{}
+}
+
+func newApplyQueue(window int64, applied func() int64) *applyQueue {
+	q := &applyQueue{
+		tasks:   make(map[int64]applyTask),
+		window:  window,
+		applied: applied,
+		changed: make(chan struct{}),
+	}
+	q.catchUpLocked()
+	return q
+}
+
+func (q *applyQueue) notifyLocked() {
+	close(q.changed)
+	q.changed = make(chan struct{})
+}
+
+// catchUpLocked moves next past whatever the state machine applied without
+// the queue and returns the tasks that leaves behind
+func (q *applyQueue) catchUpLocked() []applyTask {
+	if q.applied == nil || q.busy {
+		return nil
+	}
+	applied := q.applied()
+	if applied < q.next {
+		return nil
+	}
+	q.next = applied + 1
+	var stale []applyTask
+	for index, task := range q.tasks {
+		if index < q.next {
+			stale = append(stale, task)
+			delete(q.tasks, index)
+		}
+	}
+	q.notifyLocked()
+	return stale
+}
+
+// reserve waits until index is within the window, so commits far ahead of
+// the apply loop hold nothing until it catches up. It gives up with
+// ErrApplyBacklog once ctx is done.
+func (q *applyQueue) reserve(ctx context.Context, index int64) error {
+	for {
+		q.mutex.Lock()
+		next := q.next
+		if q.applied != nil {
+			next = max(next, q.applied()+1)
+		}
+		if index < next+q.window {
+			q.mutex.Unlock()
+			return nil
+		}
+		changed := q.changed
+		q.mutex.Unlock()
+
+		select {
+		case <-changed:
+		case <-ctx.Done():
+			return &ErrApplyBacklog{InstanceId: index, Next: next, Window: q.window}
+		}
+	}
+}
+
+func (q *applyQueue) push(task applyTask) {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+	q.tasks[task.index] = task
+	q.notifyLocked()
+}
+
+// pop waits for the task at next and marks the queue busy until finish.
+// Tasks left behind by catching up are handed to stale. While later tasks
+// wait on a missing index, stalled is called with it every
+// applyStallTimeout.
+func (q *applyQueue) pop(stale func([]applyTask), stalled func(index int64)) applyTask {
+	for {
+		q.mutex.Lock()
+		left := q.catchUpLocked()
+		task, ready := q.tasks[q.next]
+		if ready && !q.paused {
+			delete(q.tasks, q.next)
+			q.busy = true
+			q.mutex.Unlock()
+			stale(left)
+			return task
+		}
+		next, waiting := q.next, !q.paused && len(q.tasks) > 0
+		changed := q.changed
+		q.mutex.Unlock()
+		stale(left)
+
+		if !waiting {
+			<-changed
+			continue
+		}
+		select {
+		case <-changed:
+		case <-time.After(applyStallTimeout):
+			stalled(next)
+		}
+	}
+}
+
+// finish records that the task pop returned has been applied
+func (q *applyQueue) finish() {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+	q.busy = false
+	q.next++
+	q.notifyLocked()
+}
+
+// pause waits for the loop to apply every task it can without a missing
+// index arriving, then stops it taking more until resume
+func (q *applyQueue) pause() {
+	for {
+		q.mutex.Lock()
+		_, ready := q.tasks[q.next]
+		if !q.busy && !ready {
+			q.paused = true
+			q.mutex.Unlock()
+			return
+		}
+		changed := q.changed
+		q.mutex.Unlock()
+		<-changed
+	}
+}
+
+func (q *applyQueue) resume() {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+	q.paused = false
+	q.notifyLocked()
+}
@@ -0,0 +1,151 @@
+package paxos
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"ds_project/src/server/log"
+	pb "ds_project/src/server/proto"
+	"ds_project/src/server/statemachine"
+)
+
+// slowMachine blocks every Apply until release is closed and records the
+// order indexes were applied in
+type slowMachine struct {
+	release chan struct{}
+	applied []int64
+	mutex   sync.Mutex
+}
+
+func (m *slowMachine) Apply(index int64, commandBytes []byte) (statemachine.Result, error) {
+	<-m.release
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	m.applied = append(m.applied, index)
+	return nil, nil
+}
+
+func (m *slowMachine) appliedIndexes() []int64 {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	return append([]int64(nil), m.applied...)
+}
+
+func commitAt(acceptor *Acceptor, instanceId int64) <-chan applyOutcome {
+	return acceptor.commit(&pb.CommitRequest{Value: instanceId, InstanceId: instanceId, Command: []byte(`{}`), CommittedAt: 1})
+}
+
+func TestCommitsApplyInIndexOrder(t *testing.T) {
+	machine := &slowMachine{release: make(chan struct{})}
+	close(machine.release)
+	acceptor := NewAcceptor(machine, log.NewReplicatedLog())
+
+	for instanceId := int64(0); instanceId < 5; instanceId++ {
+		<-commitAt(acceptor, instanceId)
+	}
+
+	// 6 is decided first, but must wait for 5
+	sixth := commitAt(acceptor, 6)
+	select {
+	case <-sixth:
+		t.Fatal("6 was applied before 5 was committed")
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	<-commitAt(acceptor, 5)
+	<-sixth
+	applied := machine.appliedIndexes()
+	for i, index := range applied {
+		if index != int64(i) {
+			t.Fatalf("applied %v, expected index order", applied)
+		}
+	}
+	if len(applied) != 7 {
+		t.Fatalf("expected 7 applies, got %v", applied)
+	}
+}
+
+func TestSlowApplyDoesNotBlockAcceptor(t *testing.T) {
+	machine := &slowMachine{release: make(chan struct{})}
+	acceptor := NewAcceptor(machine, log.NewReplicatedLog())
+
+	// A full window of commits while the apply loop is stuck
+	committed := make(chan struct{})
+	outcomes := make([]<-chan applyOutcome, applyWindow)
+	go func() {
+		defer close(committed)
+		for i := range outcomes {
+			outcomes[i] = commitAt(acceptor, int64(i))
+		}
+	}()
+	select {
+	case <-committed:
+	case <-time.After(5 * time.Second):
+		t.Fatal("commit blocked behind a slow apply")
+	}
+
+	// One more is refused once the sender stops waiting for room
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	_, err := acceptor.Commit(ctx, &pb.CommitRequest{Value: applyWindow, InstanceId: applyWindow, Command: []byte(`{}`), CommittedAt: 1})
+	var backlog *ErrApplyBacklog
+	if !errors.As(err, &backlog) {
+		t.Fatalf("expected ErrApplyBacklog past the window, got %v", err)
+	}
+	if acceptor.IsDecided(applyWindow) {
+		t.Fatal("a refused commit was recorded")
+	}
+
+	prepared := make(chan error, 1)
+	go func() {
+		_, err := acceptor.Prepare(context.Background(), &pb.PrepareRequest{Round: Round{Ballot: 1, ProposerID: 1}.Proto(), InstanceId: applyWindow})
+		prepared <- err
+	}()
+	select {
+	case err := <-prepared:
+		if err != nil {
+			t.Fatal(err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("Prepare waited on a slow apply")
+	}
+
+	close(machine.release)
+	for _, outcome := range outcomes {
+		<-outcome
+	}
+	if applied := machine.appliedIndexes(); len(applied) != applyWindow {
+		t.Fatalf("expected %d applies, got %d", applyWindow, len(applied))
+	}
+
+	// With the backlog applied there is room again
+	if _, err := acceptor.Commit(context.Background(), &pb.CommitRequest{Value: applyWindow, InstanceId: applyWindow, Command: []byte(`{}`), CommittedAt: 1}); err != nil {
+		t.Fatalf("expected the commit to be taken once the window moved, got %v", err)
+	}
+}
+
+func TestStalledApplyIsReported(t *testing.T) {
+	machine := &slowMachine{release: make(chan struct{})}
+	close(machine.release)
+	acceptor := NewAcceptor(machine, log.NewReplicatedLog())
+	stalled := make(chan int64, 1)
+	acceptor.SetStallHandler(func(index int64) {
+		select {
+		case stalled <- index:
+		default:
+		}
+	})
+
+	commitAt(acceptor, 1)
+	select {
+	case index := <-stalled:
+		if index != 0 {
+			t.Fatalf("expected the stall at 0, got %d", index)
+		}
+	case <-time.After(applyStallTimeout + 2*time.Second):
+		t.Fatal("the missing index was never reported")
+	}
+}
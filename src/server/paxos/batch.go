@@ -0,0 +1,109 @@
+package paxos
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	pb "ds_project/src/server/proto"
+)
+
+// acceptReply is one proposal's share of a batched accept
+type acceptReply struct {
+	response *pb.AcceptedResponse
+	err      error
+}
+
+// acceptBatch is what has queued up for one peer since its window opened
+type acceptBatch struct {
+	accepts []*pb.AcceptRequest
+	replies []chan acceptReply
+}
+
+// acceptBatcher coalesces the accepts concurrent proposals send to the same
+// peer. The first accept queued for a peer opens a window; everything queued
+// before it closes goes out in one AcceptBatch RPC.
+type acceptBatcher struct {
+	window  time.Duration
+	pending map[string]*acceptBatch
+	// sent is told how many accepts each RPC carried
+	sent    func(accepts int)
+	mutex   sync.Mutex
+}
+
+func newAcceptBatcher(sent func(accepts int)) *acceptBatcher {
+	return &acceptBatcher{pending: make(map[string]*acceptBatch), sent: sent}
+}
+
+func (b *acceptBatcher) setWindow(window time.Duration) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	b.window = window
+}
+
+// enabled reports whether accepts should be batched at all
+func (b *acceptBatcher) enabled() bool {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	return b.window > 0
+}
+
+// enqueue queues accept for peer and returns where its reply will arrive.
+// The batch is sent over transport with the timeout of whichever proposal
+// opened the window.
+func (b *acceptBatcher) enqueue(transport Transport, peer string, timeout time.Duration, accept *pb.AcceptRequest) <-chan acceptReply {
+	reply := make(chan acceptReply, 1)
+
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	batch, exists := b.pending[peer]
+	if !exists {
+		batch = &acceptBatch{}
+		b.pending[peer] = batch
+		time.AfterFunc(b.window, func() {
+			b.flush(transport, peer, timeout)
+		})
+	}
+	batch.accepts = append(batch.accepts, accept)
+	batch.replies = append(batch.replies, reply)
+	return reply
+}
+
+// flush sends what is pending for peer and hands each proposal its
+// response. A failed RPC fails every accept in the batch.
+func (b *acceptBatcher) flush(transport Transport, peer string, timeout time.Duration) {
+	b.mutex.Lock()
+	batch := b.pending[peer]
+	delete(b.pending, peer)
+	b.mutex.Unlock()
+
+	response, err := b.send(transport, peer, timeout, batch.accepts)
+	for i, reply := range batch.replies {
+		if err != nil {
+			reply <- acceptReply{err: err}
+		} else {
+			reply <- acceptReply{response: response.Accepted[i]}
+		}
+	}
+}
+
+func (b *acceptBatcher) send(transport Transport, peer string, timeout time.Duration, accepts []*pb.AcceptRequest) (*pb.AcceptBatchResponse, error) {
+	client, err := transport.Client(peer)
+	if err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	b.sent(len(accepts))
+	response, err := client.AcceptBatch(ctx, &pb.AcceptBatchRequest{Accepts: accepts})
+	if err != nil {
+		return nil, err
+	}
+	if len(response.Accepted) != len(accepts) {
+		return nil, fmt.Errorf("%s answered %d of %d batched accepts", peer, len(response.Accepted), len(accepts))
+	}
+	return response, nil
+}
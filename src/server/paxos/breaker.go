@@ -0,0 +1,138 @@
+package paxos
+
+import (
+	"sync"
+	"time"
+)
+
+const (
+	DefaultBreakerThreshold = 3
+	DefaultBreakerCooldown  = 5 * time.Second
+)
+
+type BreakerState string
+
+const (
+	BreakerClosed   BreakerState = "closed"
+	BreakerOpen     BreakerState = "open"
+	BreakerHalfOpen BreakerState = "half_open"
+)
+
+type peerBreaker struct {
+	failures  int
+	openUntil time.Time
+	probing   bool
+}
+
+// PeerHealth is one peer's circuit breaker as reported by Breakers
+type PeerHealth struct {
+	Peer                string       `json:"peer"`
+	State               BreakerState `json:"state"`
+	ConsecutiveFailures int          `json:"consecutive_failures"`
+}
+
+// breakers trips a peer open after threshold consecutive failed RPCs. An
+// open peer is skipped until cooldown passes, then a single call is let
+// through as a probe: success closes the breaker, failure reopens it.
+// A threshold of 0 never trips.
+type breakers struct {
+	threshold int
+	cooldown  time.Duration
+	peers     map[string]*peerBreaker
+	mutex     sync.Mutex
+}
+
+func newBreakers(threshold int, cooldown time.Duration) *breakers {
+	return &breakers{
+		threshold: threshold,
+		cooldown:  cooldown,
+		peers:     make(map[string]*peerBreaker),
+	}
+}
+
+func (b *breakers) configure(threshold int, cooldown time.Duration) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	b.threshold = threshold
+	b.cooldown = cooldown
+}
+
+func (b *breakers) get(peer string) *peerBreaker {
+	if _, exists := b.peers[peer]; !exists {
+		b.peers[peer] = &peerBreaker{}
+	}
+	return b.peers[peer]
+}
+
+func (b *breakers) state(breaker *peerBreaker, now time.Time) BreakerState {
+	switch {
+	case b.threshold <= 0 || breaker.failures < b.threshold:
+		return BreakerClosed
+	case breaker.probing || !now.Before(breaker.openUntil):
+		return BreakerHalfOpen
+	default:
+		return BreakerOpen
+	}
+}
+
+// allow reports whether a call to peer should be made now
+func (b *breakers) allow(peer string) bool {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	breaker := b.get(peer)
+	switch b.state(breaker, time.Now()) {
+	case BreakerClosed:
+		return true
+	case BreakerHalfOpen:
+		if breaker.probing {
+			return false
+		}
+		breaker.probing = true
+		return true
+	default:
+		return false
+	}
+}
+
+// record feeds the outcome of a call that allow let through
+func (b *breakers) record(peer string, err error) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	breaker := b.get(peer)
+	breaker.probing = false
+	if err == nil {
+		breaker.failures = 0
+		return
+	}
+	breaker.failures++
+	if b.threshold > 0 && breaker.failures >= b.threshold {
+		breaker.openUntil = time.Now().Add(b.cooldown)
+	}
+}
+
+// cancel forgets a call that allow let through but that failed for reasons
+// of our own, such as the proposal's deadline, without counting against peer
+func (b *breakers) cancel(peer string) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	b.get(peer).probing = false
+}
+
+func (b *breakers) health(peers []string) []PeerHealth {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	now := time.Now()
+	result := make([]PeerHealth, 0, len(peers))
+	for _, peer := range peers {
+		breaker := b.get(peer)
+		result = append(result, PeerHealth{
+			Peer:                peer,
+			State:               b.state(breaker, now),
+			ConsecutiveFailures: breaker.failures,
+		})
+	}
+	return result
+}
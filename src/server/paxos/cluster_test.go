@@ -0,0 +1,83 @@
+package paxos
+
+import (
+	"encoding/json"
+	"fmt"
+	"testing"
+	"time"
+
+	"ds_project/src/server/log"
+	"ds_project/src/server/statemachine"
+)
+
+// testCluster is a set of acceptors in one process, each with its own log
+// and state machine, for proposers to reach over a MemoryTransport
+type testCluster struct {
+	acceptors map[string]*Acceptor
+	machines  map[string]*statemachine.ScooterStateMachine
+	logs      map[string]*log.ReplicatedLog
+}
+
+func newTestCluster(names ...string) *testCluster {
+	c := &testCluster{
+		acceptors: make(map[string]*Acceptor),
+		machines:  make(map[string]*statemachine.ScooterStateMachine),
+		logs:      make(map[string]*log.ReplicatedLog),
+	}
+	for _, name := range names {
+		c.machines[name] = statemachine.NewScooterStateMachine()
+		c.logs[name] = log.NewReplicatedLog()
+		c.acceptors[name] = NewAcceptor(c.machines[name], c.logs[name])
+	}
+	return c
+}
+
+// proposer returns a proposer whose local acceptor is self's and whose
+// peers are every other acceptor in the cluster
+func (c *testCluster) proposer(id int64, self string) (*Proposer, *MemoryTransport) {
+	var peers []string
+	for name := range c.acceptors {
+		if name != self {
+			peers = append(peers, name)
+		}
+	}
+	p := NewProposer(id, peers, c.acceptors[self])
+	transport := NewMemoryTransport(self, c.acceptors)
+	p.SetTransport(transport)
+	return p, transport
+}
+
+func createCommand(t testing.TB, scooterID string) []byte {
+	t.Helper()
+	command, err := json.Marshal(statemachine.ScooterCommand{CommandType: statemachine.Create, ScooterID: scooterID})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return command
+}
+
+func noopCommand(t testing.TB) []byte {
+	t.Helper()
+	command, err := json.Marshal(statemachine.ScooterCommand{CommandType: statemachine.Noop})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return command
+}
+
+// waitFor polls condition until it holds, failing the test after a few
+// seconds
+func waitFor(t testing.TB, what string, condition func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for !condition() {
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out waiting for %s", what)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+func scooterName(i int) string {
+	return fmt.Sprintf("scooter-%d", i)
+}
@@ -0,0 +1,101 @@
+package paxos
+
+import (
+	"fmt"
+)
+
+// The counts in ErrNoQuorum, ErrPreparePhase, ErrAcceptPhase and
+// ErrCommitPhase are voting weight, which is the number of nodes unless SetWeights says otherwise.
+type ErrNoQuorum struct {
+	Live     int
+	Majority int
+}
+
+func (e *ErrNoQuorum) Error() string {
+	return fmt.Sprintf("only %d live members, need %d for a majority", e.Live, e.Majority)
+}
+
+type ErrPreparePhase struct {
+	Promises int
+	Rejected int
+	Majority int
+}
+
+func (e *ErrPreparePhase) Error() string {
+	return fmt.Sprintf("failed to reach majority in prepare phase got %d promises, need %d promises", e.Promises, e.Majority)
+}
+
+type ErrAcceptPhase struct {
+	Accepts  int
+	Rejected int
+	Majority int
+}
+
+func (e *ErrAcceptPhase) Error() string {
+	return fmt.Sprintf("failed to reach majority in accept phase got %d accepts, need %d accepts", e.Accepts, e.Majority)
+}
+
+// ErrCommitPhase means the value was chosen, but with WaitForCommitMajority
+// set not enough acceptors acknowledged its commit in time. The command is
+// committed here and still takes effect once the others learn it.
+type ErrCommitPhase struct {
+	InstanceId int64
+	Acks       int
+	Majority   int
+}
+
+func (e *ErrCommitPhase) Error() string {
+	return fmt.Sprintf("instance %d was chosen but only %d acknowledged its commit, need %d", e.InstanceId, e.Acks, e.Majority)
+}
+
+// ErrApply means the command was chosen and committed, but the state
+// machine rejected it when applying (e.g. a stale precondition).
+type ErrApply struct {
+	InstanceId int64
+	Err        error
+}
+
+func (e *ErrApply) Error() string {
+	return fmt.Sprintf("command committed at instance %d was rejected: %v", e.InstanceId, e.Err)
+}
+
+func (e *ErrApply) Unwrap() error {
+	return e.Err
+}
+
+// ErrDeadline means the caller's deadline ran out before the proposal could
+// reach a majority.
+type ErrDeadline struct {
+	Phase string
+	Err   error
+}
+
+func (e *ErrDeadline) Error() string {
+	return fmt.Sprintf("proposal deadline exceeded in %s phase", e.Phase)
+}
+
+func (e *ErrDeadline) Unwrap() error {
+	return e.Err
+}
+
+// ErrInstanceDecided means the instance was already decided, e.g. filled in
+// by recovery, before this proposal started. The caller should move on to a
+// fresh instance.
+type ErrInstanceDecided struct {
+	InstanceId int64
+}
+
+func (e *ErrInstanceDecided) Error() string {
+	return fmt.Sprintf("instance %d is already decided", e.InstanceId)
+}
+
+// ErrReadIndex means too few acceptors answered ReadIndex to know what a
+// majority has accepted.
+type ErrReadIndex struct {
+	Responses int
+	Majority  int
+}
+
+func (e *ErrReadIndex) Error() string {
+	return fmt.Sprintf("failed to confirm read index got %d responses, need %d", e.Responses, e.Majority)
+}
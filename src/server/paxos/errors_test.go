@@ -0,0 +1,269 @@
+package paxos
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"google.golang.org/grpc"
+
+	pb "ds_project/src/server/proto"
+	"ds_project/src/server/statemachine"
+)
+
+var errPhaseDown = errors.New("phase failed on purpose")
+
+// failingTransport fails the chosen phases' calls to every peer and passes
+// the rest through
+type failingTransport struct {
+	Transport
+	accept bool
+	commit bool
+}
+
+func (t *failingTransport) Client(server string) (pb.PaxosClient, error) {
+	client, err := t.Transport.Client(server)
+	if err != nil {
+		return nil, err
+	}
+	return &failingClient{PaxosClient: client, transport: t}, nil
+}
+
+type failingClient struct {
+	pb.PaxosClient
+	transport *failingTransport
+}
+
+func (c *failingClient) Accept(ctx context.Context, in *pb.AcceptRequest, opts ...grpc.CallOption) (*pb.AcceptedResponse, error) {
+	if c.transport.accept {
+		return nil, errPhaseDown
+	}
+	return c.PaxosClient.Accept(ctx, in, opts...)
+}
+
+func (c *failingClient) AcceptBatch(ctx context.Context, in *pb.AcceptBatchRequest, opts ...grpc.CallOption) (*pb.AcceptBatchResponse, error) {
+	if c.transport.accept {
+		return nil, errPhaseDown
+	}
+	return c.PaxosClient.AcceptBatch(ctx, in, opts...)
+}
+
+func (c *failingClient) Commit(ctx context.Context, in *pb.CommitRequest, opts ...grpc.CallOption) (*pb.CommitResponse, error) {
+	if c.transport.commit {
+		return nil, errPhaseDown
+	}
+	return c.PaxosClient.Commit(ctx, in, opts...)
+}
+
+// proposerErrorKinds returns the name of every Propose error type err
+// matches with errors.As
+func proposerErrorKinds(err error) []string {
+	var (
+		noQuorum *ErrNoQuorum
+		prepare  *ErrPreparePhase
+		accept   *ErrAcceptPhase
+		commit   *ErrCommitPhase
+		apply    *ErrApply
+		deadline *ErrDeadline
+		decided  *ErrInstanceDecided
+	)
+	var kinds []string
+	for name, target := range map[string]any{
+		"ErrNoQuorum":        &noQuorum,
+		"ErrPreparePhase":    &prepare,
+		"ErrAcceptPhase":     &accept,
+		"ErrCommitPhase":     &commit,
+		"ErrApply":           &apply,
+		"ErrDeadline":        &deadline,
+		"ErrInstanceDecided": &decided,
+	} {
+		if errors.As(err, target) {
+			kinds = append(kinds, name)
+		}
+	}
+	return kinds
+}
+
+func TestProposeErrorsClassify(t *testing.T) {
+	cases := []struct {
+		name string
+		kind string
+		// propose sets up a three-node cluster so proposing fails, and
+		// returns the error
+		propose func(t *testing.T, c *testCluster) error
+		check   func(t *testing.T, err error)
+	}{
+		{
+			name: "membership short of the cluster size",
+			kind: "ErrNoQuorum",
+			propose: func(t *testing.T, c *testCluster) error {
+				p, _ := c.proposer(1, "a")
+				p.SetPeersFromMembership(5)
+				_, err := p.Propose(context.Background(), 0, 0, createCommand(t, "s"))
+				return err
+			},
+			check: func(t *testing.T, err error) {
+				var noQuorum *ErrNoQuorum
+				errors.As(err, &noQuorum)
+				if noQuorum.Live != 3 || noQuorum.Majority != 3 {
+					t.Errorf("got %+v, want 3 live and a majority of 3", noQuorum)
+				}
+			},
+		},
+		{
+			name: "peers promised a higher round",
+			kind: "ErrPreparePhase",
+			propose: func(t *testing.T, c *testCluster) error {
+				higher := Round{Ballot: 50, ProposerID: 2}
+				for _, name := range []string{"b", "c"} {
+					c.acceptors[name].Prepare(context.Background(), &pb.PrepareRequest{Round: higher.Proto(), InstanceId: 0})
+				}
+				p, _ := c.proposer(1, "a")
+				_, err := p.Propose(context.Background(), 0, 0, createCommand(t, "s"))
+				return err
+			},
+			check: func(t *testing.T, err error) {
+				var prepare *ErrPreparePhase
+				errors.As(err, &prepare)
+				if prepare.Promises != 1 || prepare.Rejected != 2 || prepare.Majority != 2 {
+					t.Errorf("got %+v, want 1 promise, 2 rejections and a majority of 2", prepare)
+				}
+			},
+		},
+		{
+			name: "peers unreachable for accepts",
+			kind: "ErrAcceptPhase",
+			propose: func(t *testing.T, c *testCluster) error {
+				p, transport := c.proposer(1, "a")
+				p.SetTransport(&failingTransport{Transport: transport, accept: true})
+				_, err := p.Propose(context.Background(), 0, 0, createCommand(t, "s"))
+				return err
+			},
+			check: func(t *testing.T, err error) {
+				var accept *ErrAcceptPhase
+				errors.As(err, &accept)
+				if accept.Accepts != 1 || accept.Rejected != 0 || accept.Majority != 2 {
+					t.Errorf("got %+v, want 1 accept, no rejections and a majority of 2", accept)
+				}
+			},
+		},
+		{
+			name: "peers unreachable for commits",
+			kind: "ErrCommitPhase",
+			propose: func(t *testing.T, c *testCluster) error {
+				p, transport := c.proposer(1, "a")
+				p.SetTransport(&failingTransport{Transport: transport, commit: true})
+				p.SetWaitForCommitMajority(true)
+				_, err := p.Propose(context.Background(), 0, 0, createCommand(t, "s"))
+				return err
+			},
+			check: func(t *testing.T, err error) {
+				var commit *ErrCommitPhase
+				errors.As(err, &commit)
+				if commit.InstanceId != 0 || commit.Acks != 1 || commit.Majority != 2 {
+					t.Errorf("got %+v, want 1 ack of instance 0 and a majority of 2", commit)
+				}
+			},
+		},
+		{
+			name: "state machine rejects the command",
+			kind: "ErrApply",
+			propose: func(t *testing.T, c *testCluster) error {
+				p, _ := c.proposer(1, "a")
+				command, err := json.Marshal(statemachine.ScooterCommand{CommandType: statemachine.Reserve, ScooterID: "missing", ClientID: "client"})
+				if err != nil {
+					t.Fatal(err)
+				}
+				_, err = p.Propose(context.Background(), 0, 0, command)
+				return err
+			},
+			check: func(t *testing.T, err error) {
+				var apply *ErrApply
+				errors.As(err, &apply)
+				if apply.InstanceId != 0 || !statemachine.IsRejection(err) {
+					t.Errorf("got %+v, want instance 0 wrapping a rejection", apply)
+				}
+			},
+		},
+		{
+			name: "peers too slow for the caller's deadline",
+			kind: "ErrDeadline",
+			propose: func(t *testing.T, c *testCluster) error {
+				p, transport := c.proposer(1, "a")
+				transport.SetFault("b", LinkFault{Delay: time.Minute})
+				transport.SetFault("c", LinkFault{Delay: time.Minute})
+				ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+				defer cancel()
+				_, err := p.Propose(ctx, 0, 0, createCommand(t, "s"))
+				return err
+			},
+			check: func(t *testing.T, err error) {
+				var deadline *ErrDeadline
+				errors.As(err, &deadline)
+				if deadline.Phase != "prepare" || !errors.Is(err, context.DeadlineExceeded) {
+					t.Errorf("got %+v, want the prepare phase wrapping context.DeadlineExceeded", deadline)
+				}
+			},
+		},
+		{
+			name: "instance already decided",
+			kind: "ErrInstanceDecided",
+			propose: func(t *testing.T, c *testCluster) error {
+				p, _ := c.proposer(1, "a")
+				if _, err := p.Propose(context.Background(), 0, 0, createCommand(t, "s")); err != nil {
+					t.Fatal(err)
+				}
+				_, err := p.Propose(context.Background(), 0, 0, createCommand(t, "other"))
+				return err
+			},
+			check: func(t *testing.T, err error) {
+				var decided *ErrInstanceDecided
+				errors.As(err, &decided)
+				if decided.InstanceId != 0 {
+					t.Errorf("got %+v, want instance 0", decided)
+				}
+			},
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			err := c.propose(t, newTestCluster("a", "b", "c"))
+			if err == nil {
+				t.Fatal("propose succeeded")
+			}
+			kinds := proposerErrorKinds(err)
+			if len(kinds) != 1 || kinds[0] != c.kind {
+				t.Fatalf("%v classifies as %v, want only %s", err, kinds, c.kind)
+			}
+			if strings.TrimSpace(err.Error()) == "" {
+				t.Fatalf("%s has no message", c.kind)
+			}
+			c.check(t, err)
+		})
+	}
+}
+
+// The messages keep the counts a person reading the logs needs
+func TestProposeErrorMessages(t *testing.T) {
+	cases := []struct {
+		err  error
+		want string
+	}{
+		{&ErrNoQuorum{Live: 1, Majority: 2}, "only 1 live members, need 2 for a majority"},
+		{&ErrPreparePhase{Promises: 1, Rejected: 1, Majority: 2}, "failed to reach majority in prepare phase got 1 promises, need 2 promises"},
+		{&ErrAcceptPhase{Accepts: 1, Majority: 3}, "failed to reach majority in accept phase got 1 accepts, need 3 accepts"},
+		{&ErrCommitPhase{InstanceId: 4, Acks: 1, Majority: 2}, "instance 4 was chosen but only 1 acknowledged its commit, need 2"},
+		{&ErrApply{InstanceId: 4, Err: errPhaseDown}, "command committed at instance 4 was rejected: phase failed on purpose"},
+		{&ErrDeadline{Phase: "accept", Err: context.DeadlineExceeded}, "proposal deadline exceeded in accept phase"},
+		{&ErrInstanceDecided{InstanceId: 4}, "instance 4 is already decided"},
+	}
+	for _, c := range cases {
+		if got := c.err.Error(); got != c.want {
+			t.Errorf("got %q, want %q", got, c.want)
+		}
+	}
+}
@@ -0,0 +1,146 @@
+package paxos
+
+import "fmt"
+
+// ErrTooManyInstances is returned by Prepare and Accept for an instance the
+// acceptor hasn't seen while Limit instances are already undecided here,
+// e.g. under a flood of proposals that never finish
+type ErrTooManyInstances struct {
+	Limit int
+}
+
+func (e *ErrTooManyInstances) Error() string {
+	return fmt.Sprintf("%d instances are undecided here, not taking on another", e.Limit)
+}
+
+// ErrInstanceForgotten is returned for an instance the acceptor dropped
+// after it was decided and compacted out of the log
+type ErrInstanceForgotten struct {
+	InstanceId int64
+}
+
+func (e *ErrInstanceForgotten) Error() string {
+	return fmt.Sprintf("instance %d was decided and compacted", e.InstanceId)
+}
+
+// ErrInstanceEvicted is returned for an instance the acceptor dropped while
+// it was still undecided here, to make room under the cap. It no longer
+// votes on it, which leaves deciding it to the other acceptors.
+type ErrInstanceEvicted struct {
+	InstanceId int64
+}
+
+func (e *ErrInstanceEvicted) Error() string {
+	return fmt.Sprintf("instance %d was dropped undecided to make room, not voting on it", e.InstanceId)
+}
+
+// SetMaxInstances caps how many instances the acceptor keeps in memory, 0
+// for no limit. Past the cap it first forgets instances the log has
+// compacted, which were decided and snapshotted, then undecided ones below
+// the commit index, which it stops voting on. If limit are still undecided
+// it refuses new ones in Prepare and Accept. Commits are always recorded,
+// so the map can run over the cap until the next compaction.
+func (a *Acceptor) SetMaxInstances(limit int) {
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+	a.maxInstances = limit
+}
+
+// InstanceCounts returns how many instances are held in memory and how
+// many of those are undecided
+func (a *Acceptor) InstanceCounts() (held int, undecided int) {
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+	return len(a.instance), a.undecided
+}
+
+// getInstance returns instanceId's state, adding it if this is the first
+// Prepare or Accept for it, unless the cap or compaction rules it out
+func (a *Acceptor) getInstance(instanceId int64) (*AcceptorInstance, error) {
+	if instance, exists := a.instance[instanceId]; exists {
+		return instance, nil
+	}
+	if instanceId < a.forgottenBelow {
+		return nil, &ErrInstanceForgotten{InstanceId: instanceId}
+	}
+	if instanceId < a.evictedBelow {
+		return nil, &ErrInstanceEvicted{InstanceId: instanceId}
+	}
+	if a.maxInstances > 0 && len(a.instance) >= a.maxInstances {
+		a.forgetCompactedLocked()
+		if a.undecided >= a.maxInstances {
+			a.evictUndecidedLocked()
+		}
+		if a.undecided >= a.maxInstances {
+			return nil, &ErrTooManyInstances{Limit: a.maxInstances}
+		}
+	}
+	return a.addInstance(instanceId), nil
+}
+
+// learnInstance is getInstance for a commit, which is never refused
+func (a *Acceptor) learnInstance(instanceId int64) (*AcceptorInstance, bool) {
+	if instance, exists := a.instance[instanceId]; exists {
+		return instance, true
+	}
+	if instanceId < a.forgottenBelow {
+		return nil, false
+	}
+	if a.maxInstances > 0 && len(a.instance) >= a.maxInstances {
+		a.forgetCompactedLocked()
+	}
+	return a.addInstance(instanceId), true
+}
+
+func (a *Acceptor) addInstance(instanceId int64) *AcceptorInstance {
+	instance := &AcceptorInstance{}
+	a.instance[instanceId] = instance
+	a.undecided++
+	return instance
+}
+
+// forgetCompactedLocked drops every instance below the log's stored index.
+// Those entries are compacted into a snapshot, so they were chosen however
+// this acceptor last saw them, and anything asking about them later is told
+// so instead of starting them afresh.
+func (a *Acceptor) forgetCompactedLocked() {
+	storedIndex := a.log.GetStoredIndex()
+	if storedIndex <= a.forgottenBelow {
+		return
+	}
+	for instanceId, instance := range a.instance {
+		if instanceId >= storedIndex {
+			continue
+		}
+		if !instance.decided {
+			a.undecided--
+		}
+		delete(a.instance, instanceId)
+	}
+	a.forgottenBelow = storedIndex
+}
+
+// evictUndecidedLocked drops the undecided instances below the log's commit
+// index, so ones this acceptor never saw decided can't fill the cap for
+// good. Later Prepares and Accepts for them are refused rather than started
+// afresh, since a forgotten promise could let a lower round's value be
+// chosen; commits for them are still recorded. Those recovery has already
+// written into the log are decided, so they are kept and marked as such.
+func (a *Acceptor) evictUndecidedLocked() {
+	commitIndex := a.log.GetCommitIndex()
+	if commitIndex <= a.evictedBelow {
+		return
+	}
+	for instanceId, instance := range a.instance {
+		if instance.decided || instanceId >= commitIndex {
+			continue
+		}
+		a.undecided--
+		if a.log.GetEntry(instanceId) != nil {
+			instance.decided = true
+			continue
+		}
+		delete(a.instance, instanceId)
+	}
+	a.evictedBelow = commitIndex
+}
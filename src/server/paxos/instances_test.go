@@ -0,0 +1,92 @@
+package paxos
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	pb "ds_project/src/server/proto"
+)
+
+// prepareRaw promises instanceId to a round no proposer here will use, the
+// way a proposal that never finishes would leave it
+func prepareRaw(t *testing.T, acceptor *Acceptor, instanceId int64) {
+	t.Helper()
+	round := Round{Ballot: 1, ProposerID: 99}
+	if _, err := acceptor.Prepare(context.Background(), &pb.PrepareRequest{Round: round.Proto(), InstanceId: instanceId}); err != nil {
+		t.Fatalf("prepare for instance %d: %v", instanceId, err)
+	}
+}
+
+func TestUndecidedInstancesBelowCommitIndexAreEvicted(t *testing.T) {
+	const limit = 3
+	cluster := newTestCluster("a", "b")
+	for _, acceptor := range cluster.acceptors {
+		acceptor.SetMaxInstances(limit)
+		for instanceId := int64(0); instanceId < limit; instanceId++ {
+			prepareRaw(t, acceptor, instanceId)
+		}
+	}
+	p, _ := cluster.proposer(1, "a")
+	p.SetWaitForCommitMajority(true)
+
+	// Both acceptors are full of undecided instances, so neither takes on
+	// another and there is no majority
+	_, err := p.Propose(context.Background(), 3, 3, createCommand(t, "wedged"))
+	var prepareErr *ErrPreparePhase
+	if !errors.As(err, &prepareErr) {
+		t.Fatalf("expected ErrPreparePhase while the cap is full, got %v", err)
+	}
+
+	// The instances after them are decided elsewhere, and the commits for
+	// them move the commit index past the stuck ones. They aren't applied
+	// until the stuck ones are filled in.
+	for _, acceptor := range cluster.acceptors {
+		for instanceId := int64(3); instanceId <= 4; instanceId++ {
+			acceptor.commit(&pb.CommitRequest{Value: instanceId, InstanceId: instanceId, Command: createCommand(t, scooterName(int(instanceId))), CommittedAt: 1})
+		}
+	}
+
+	proposed := make(chan error, 1)
+	go func() {
+		_, err := p.Propose(context.Background(), 5, 5, createCommand(t, "unwedged"))
+		proposed <- err
+	}()
+	waitFor(t, "instance 5 to be decided", func() bool {
+		return cluster.acceptors["a"].IsDecided(5) && cluster.acceptors["b"].IsDecided(5)
+	})
+	if _, exists := cluster.machines["a"].GetScooter("unwedged"); exists {
+		t.Fatal("the write after eviction was applied before the instances below it")
+	}
+
+	// An evicted instance isn't voted on again
+	_, err = cluster.acceptors["a"].Prepare(context.Background(), &pb.PrepareRequest{Round: Round{Ballot: 5, ProposerID: 1}.Proto(), InstanceId: 1})
+	var evicted *ErrInstanceEvicted
+	if !errors.As(err, &evicted) {
+		t.Fatalf("expected ErrInstanceEvicted for an evicted instance, got %v", err)
+	}
+
+	// Fill the stuck instances the way a Noop proposal for each would
+	for _, acceptor := range cluster.acceptors {
+		for instanceId := int64(0); instanceId < limit; instanceId++ {
+			acceptor.commit(&pb.CommitRequest{Value: instanceId, InstanceId: instanceId, Command: noopCommand(t), CommittedAt: 1})
+		}
+	}
+	select {
+	case err := <-proposed:
+		if err != nil {
+			t.Fatalf("expected a write once the stuck instances fall below the commit index, got %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("the write after eviction wasn't applied once the instances below it were filled")
+	}
+	for name, acceptor := range cluster.acceptors {
+		if _, undecided := acceptor.InstanceCounts(); undecided != 0 {
+			t.Fatalf("acceptor %s: expected no undecided instances, got %d", name, undecided)
+		}
+	}
+	if _, exists := cluster.machines["a"].GetScooter("unwedged"); !exists {
+		t.Fatal("the write after eviction wasn't applied")
+	}
+}
@@ -0,0 +1,60 @@
+package paxos
+
+import (
+	"fmt"
+	"slices"
+)
+
+// SetPeersFromMembership makes the proposer add every member and witness
+// registered in etcd to its peers, on top of the servers it was constructed with, which
+// then only serve as a seed until membership has synced. Members are added
+// as they join but never dropped when their lease expires: a crashed node
+// is still an acceptor whose vote is missing, and shrinking the peer set on
+// one side of a partition would shrink its majority with it.
+//
+// clusterSize is how many voting nodes the cluster has, this one included.
+// Each node's view of the membership fills in at its own pace, so the
+// majority is never smaller than a majority of clusterSize, and nothing is
+// proposed until the peers add up to it.
+func (p *Proposer) SetPeersFromMembership(clusterSize int) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	p.peersFromMembership = true
+	p.clusterSize = clusterSize
+}
+
+// checkClusterSize returns ErrNoQuorum while peers come from membership
+// and fewer than the configured cluster size are known yet
+func (p *Proposer) checkClusterSize(servers []string) error {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	if !p.peersFromMembership || len(servers)+1 >= p.clusterSize {
+		return nil
+	}
+	return &ErrNoQuorum{Live: len(servers) + 1, Majority: p.clusterSize/2 + 1}
+}
+
+// Servers returns the peers the proposer currently sends prepares, accepts
+// and commits to, not counting its local acceptor.
+func (p *Proposer) Servers() []string {
+	p.mutex.Lock()
+	m := p.membership
+	derive := p.peersFromMembership
+	p.mutex.Unlock()
+
+	if derive && m != nil {
+		members := append(m.GetMembers(), m.GetWitnesses()...)
+		p.mutex.Lock()
+		for _, member := range members {
+			if member.Address != p.self && !slices.Contains(p.servers, member.Address) {
+				p.servers = append(p.servers, member.Address)
+				fmt.Printf("Proposer added peer %s from membership\n", member.Address)
+			}
+		}
+		p.mutex.Unlock()
+	}
+
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	return slices.Clone(p.servers)
+}
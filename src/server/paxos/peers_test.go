@@ -0,0 +1,50 @@
+package paxos
+
+import (
+	"context"
+	"errors"
+	"testing"
+)
+
+func TestPeersFromMembershipWaitsForClusterSize(t *testing.T) {
+	cluster := newTestCluster("a", "b", "c")
+	acceptor := cluster.acceptors["a"]
+
+	// Only the seed is known so far, which on its own looks like a
+	// single-node cluster
+	early := NewProposer(1, nil, acceptor)
+	early.SetTransport(NewMemoryTransport("a", cluster.acceptors))
+	early.SetPeersFromMembership(3)
+	_, err := early.Propose(context.Background(), 1, 0, createCommand(t, "early"))
+	var noQuorum *ErrNoQuorum
+	if !errors.As(err, &noQuorum) {
+		t.Fatalf("expected ErrNoQuorum before the peers add up to the cluster size, got %v", err)
+	}
+	if noQuorum.Majority != 2 {
+		t.Fatalf("expected a majority of 2 out of 3, got %d", noQuorum.Majority)
+	}
+	if _, err := early.ReadIndex(context.Background()); !errors.As(err, &noQuorum) {
+		t.Fatalf("expected ReadIndex to refuse too, got %v", err)
+	}
+	if acceptor.IsDecided(0) {
+		t.Fatal("instance 0 was decided by the local acceptor alone")
+	}
+
+	full, _ := cluster.proposer(1, "a")
+	full.SetPeersFromMembership(3)
+	if _, err := full.Propose(context.Background(), 1, 0, createCommand(t, "full")); err != nil {
+		t.Fatalf("expected the proposal to go through once all peers are known, got %v", err)
+	}
+}
+
+func TestPeersFromMembershipMajorityNeverBelowClusterSize(t *testing.T) {
+	cluster := newTestCluster("a", "b", "c", "d", "e")
+	p := NewProposer(1, []string{"b", "c", "d", "e"}, cluster.acceptors["a"])
+	if got := p.majority([]string{"b"}); got != 2 {
+		t.Fatalf("expected a majority of 2 for two nodes without membership, got %d", got)
+	}
+	p.SetPeersFromMembership(5)
+	if got := p.majority([]string{"b"}); got != 3 {
+		t.Fatalf("expected the majority of a five-node cluster, got %d", got)
+	}
+}
@@ -1,165 +1,465 @@
 package paxos
 
 import (
+	"errors"
+	"fmt"
 	"sync"
 	"context"
-	"fmt"
+	"slices"
 	"time"
 
 	pb "ds_project/src/server/proto"
-	"google.golang.org/grpc"
-	"google.golang.org/grpc/credentials/insecure"
+	"ds_project/src/server/connections"
+	"ds_project/src/server/membership"
+	"ds_project/src/server/statemachine"
 )
 
+// Lock ordering: p.mutex only guards the proposer's own fields and is never
+// held while calling the local acceptor, a peer or membership. Propose can
+// therefore run concurrently for reads (Noops) and writes; they only
+// serialize on the acceptor mutex for the duration of each phase.
 type Proposer struct {
 	id		int64
 	leader	int64
-	round	[]int64
+	round	Round
 	value	int64
 	servers []string
 	localAcceptor *Acceptor
+	membership *membership.Membership
+	transport Transport
+	rpcTimeout time.Duration
+	breakers *breakers
+	batcher  *acceptBatcher
+	scheduler *proposalScheduler
+	counters proposerCounters
+	// weights and self are set by SetWeights
+	weights map[string]int
+	self    string
+	peersFromMembership bool
+	clusterSize int
+	waitForCommitMajority bool
 
 	mutex sync.Mutex
 }
 
+const DefaultRPCTimeout = 2 * time.Second
+
 func NewProposer(id int64, servers []string, localAcceptor *Acceptor) *Proposer{
-	return &Proposer{
+	p := &Proposer{
 		id:     id,
 		servers: servers,
-		round: []int64{0,id},
+		round: Round{ProposerID: id},
 		localAcceptor: localAcceptor,
+		transport: NewGRPCTransport(connections.NewManager(servers)),
+		rpcTimeout: DefaultRPCTimeout,
+		breakers: newBreakers(DefaultBreakerThreshold, DefaultBreakerCooldown),
+	}
+	p.batcher = newAcceptBatcher(p.countAcceptRPC)
+	p.scheduler = newProposalScheduler()
+	return p
+}
+
+// SetRPCTimeout sets how long each prepare, accept and commit call waits for
+// a peer. It can change while proposals are running; each Propose uses the
+// value it started with.
+func (p *Proposer) SetRPCTimeout(timeout time.Duration) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	p.rpcTimeout = timeout
+}
+
+func (p *Proposer) RPCTimeout() time.Duration {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	return p.rpcTimeout
+}
+
+// SetWaitForCommitMajority makes Propose wait, once a value is chosen, until
+// a majority of acceptors acknowledge its commit rather than sending
+// commits in the background. Without that majority it fails with
+// ErrCommitPhase, even though the value is chosen.
+func (p *Proposer) SetWaitForCommitMajority(wait bool) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	p.waitForCommitMajority = wait
+}
+
+// SetAcceptBatchWindow makes the accept phase coalesce: each proposal's
+// accept for a peer waits up to window for others to join it, and they go
+// out together in one AcceptBatch RPC. A window of 0, the default, sends
+// every accept on its own.
+func (p *Proposer) SetAcceptBatchWindow(window time.Duration) {
+	p.batcher.setWindow(window)
+}
+
+// SetCircuitBreaker sets how many consecutive failed RPCs make prepare and
+// accept skip a peer, and for how long before probing it again. Skipped
+// peers still count towards the majority needed; a threshold of 0 disables
+// the breaker.
+func (p *Proposer) SetCircuitBreaker(threshold int, cooldown time.Duration) {
+	p.breakers.configure(threshold, cooldown)
+}
+
+// PeerHealth reports each peer's circuit breaker
+func (p *Proposer) PeerHealth() []PeerHealth {
+	return p.breakers.health(p.Servers())
+}
+
+// recordRPC feeds an RPC's outcome to the peer's breaker. Failures after ctx
+// is done are the proposal running out of time, not the peer's fault.
+func (p *Proposer) recordRPC(ctx context.Context, peer string, err error) {
+	if err != nil && ctx.Err() != nil {
+		p.breakers.cancel(peer)
+		return
+	}
+	p.breakers.record(peer, err)
+}
+
+func (p *Proposer) SetConnections(m *connections.Manager) {
+	p.SetTransport(NewGRPCTransport(m))
+}
+
+// SetTransport replaces how the proposer reaches its peers, e.g. with a
+// MemoryTransport in tests.
+func (p *Proposer) SetTransport(transport Transport) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	p.transport = transport
+}
+
+// SetMembership lets the proposer consult the live membership view. The
+// quorum itself is always a majority of the configured servers (safety);
+// membership is only used to give up early when not enough nodes are alive
+// to ever reach that majority (liveness).
+func (p *Proposer) SetMembership(m *membership.Membership) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	p.membership = m
+}
+
+// majority is the voting weight a phase needs: more than half of the total
+// weight of servers and the local acceptor.
+func (p *Proposer) majority(servers []string) int {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	totalWeight := p.weightLocked(p.self)
+	for _, server := range servers {
+		totalWeight += p.weightLocked(server)
 	}
+	if p.peersFromMembership {
+		return max(totalWeight/2+1, p.clusterSize/2+1)
+	}
+	return totalWeight/2 + 1
 }
 
-func (p *Proposer) choose() []int64{
-	p.round[0] += 1
+// liveMembers is the voting weight of the members and witnesses currently
+// registered, or -1 without a membership view.
+func (p *Proposer) liveMembers() int {
+	p.mutex.Lock()
+	m := p.membership
+	p.mutex.Unlock()
+	if m == nil {
+		return -1
+	}
+	live := 0
+	for _, member := range append(m.GetMembers(), m.GetWitnesses()...) {
+		live += p.weight(member.Address)
+	}
+	return live
+}
+
+// learners returns the addresses of registered read-only nodes that aren't
+// already among the servers, so they can be sent commits too
+func (p *Proposer) learners() []string {
+	p.mutex.Lock()
+	m := p.membership
+	p.mutex.Unlock()
+	if m == nil {
+		return nil
+	}
+
+	servers := p.Servers()
+	addresses := make([]string, 0)
+	for _, learner := range m.GetLearners() {
+		if !slices.Contains(servers, learner.Address) {
+			addresses = append(addresses, learner.Address)
+		}
+	}
+	return addresses
+}
+
+// Round is the round this proposer last started, across all instances
+func (p *Proposer) Round() Round {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
 	return p.round
 }
 
-func (p *Proposer) Propose(value int64, instanceId int64, command []byte) (int64, error){
+func (p *Proposer) choose() Round {
+	p.round.Ballot += 1
+	return p.round
+}
+
+// Outcome is what became of a proposal: the value chosen for the instance
+// and what the local state machine made of the command.
+type Outcome struct {
+	Value  int64
+	Result statemachine.Result
+}
+
+// Propose runs both phases for instanceId, giving up with ErrDeadline once ctx
+// is done. Each RPC is additionally bounded by the proposer's RPC timeout.
+// Commits are sent regardless of ctx, since the value is already chosen.
+func (p *Proposer) Propose(ctx context.Context, value int64, instanceId int64, command []byte) (Outcome, error){
 	finalValue := value 
+	servers := p.Servers()
+	majority := p.majority(servers)
+	if err := p.checkClusterSize(servers); err != nil {
+		return Outcome{}, err
+	}
+
+	// An empty view means membership hasn't synced yet, so don't trust it
+	if live := p.liveMembers(); live > 0 && live < majority {
+		return Outcome{}, &ErrNoQuorum{Live: live, Majority: majority}
+	}
+
+	if p.localAcceptor.IsDecided(instanceId) {
+		p.count(func(c *proposerCounters) { c.retries++ })
+		return Outcome{}, &ErrInstanceDecided{InstanceId: instanceId}
+	}
+	p.count(func(c *proposerCounters) { c.proposals++ })
+
+	// With no peers the local acceptor is the whole quorum: nothing can
+	// compete for the instance, so skip the round and commit straight away
+	if len(servers) == 0 {
+		return p.commitLocal(value, instanceId, command, time.Now().UnixMilli())
+	}
+
 	p.mutex.Lock()
 	round := p.choose()
+	timeout := p.rpcTimeout
+	transport := p.transport
 	p.mutex.Unlock()
 
-	totalAcceptors := len(p.servers) + 1
-	majority := totalAcceptors/2 + 1
-
 	promises := make([]*pb.PromiseResponse, 0)
+	promised := 0
+	rejected := 0
 
-	for _, acceptor := range p.servers {
-		conn, err := grpc.Dial(acceptor, grpc.WithTransportCredentials(insecure.NewCredentials()))
+	for _, acceptor := range servers {
+		if !p.breakers.allow(acceptor) {
+			continue
+		}
+		client, err := transport.Client(acceptor)
 		if err != nil {
+			p.breakers.record(acceptor, err)
 			continue
 		}
-		defer conn.Close()
 		
-		client := pb.NewPaxosClient(conn)
-		ctx,cancel := context.WithTimeout(context.Background(), 2*time.Second)
+		rpcCtx, cancel := context.WithTimeout(ctx, timeout)
 		defer cancel()
 
-		response, err := client.Prepare(ctx, &pb.PrepareRequest{
-			Round: round,
+		response, err := client.Prepare(rpcCtx, &pb.PrepareRequest{
+			Round: round.Proto(),
 			InstanceId: instanceId,
 		})
+		p.recordRPC(ctx, acceptor, err)
 		if err != nil {
 			continue
 		}
 
 		if response.Ack {
 			promises = append(promises, response)
+			promised += p.weight(acceptor)
+		} else {
+			rejected += 1
 		}
 	}
 
-	localPromise, _ := p.localAcceptor.Prepare(context.Background(), &pb.PrepareRequest{
-		Round: round,
+	// A local acceptor that fails counts like an unreachable peer: no
+	// promise, but no rejection either
+	localPromise, err := p.localAcceptor.Prepare(context.Background(), &pb.PrepareRequest{
+		Round: round.Proto(),
 		InstanceId: instanceId,
 	})
-	if localPromise.Ack {
+	if err != nil || localPromise == nil {
+		fmt.Printf("Local prepare for instance %d failed: %v\n", instanceId, err)
+	} else if localPromise.Ack {
 		promises = append(promises, localPromise)
+		promised += p.localWeight()
+	} else {
+		rejected += 1
 	}
 
-	if len(promises) < majority {
-		return 0, fmt.Errorf("failed to reach majority in prepare phase got %d promises, need %d promises", len(promises), majority)
+	p.count(func(c *proposerCounters) {
+		c.prepareNacks += int64(rejected)
+		if promised < majority && rejected > 0 {
+			c.conflicts++
+		}
+	})
+
+	if promised < majority {
+		if err := ctx.Err(); err != nil {
+			return Outcome{}, &ErrDeadline{Phase: "prepare", Err: err}
+		}
+		return Outcome{}, &ErrPreparePhase{Promises: promised, Rejected: rejected, Majority: majority}
 	}
 
-	highestLastGoodRound := []int64{0,0}
+	highestLastGoodRound := Round{}
 	for _, promise := range promises {
-		if promise.LastGoodRound[0] > highestLastGoodRound[0] ||
-		   (promise.LastGoodRound[0] == highestLastGoodRound[0] && promise.LastGoodRound[1] > highestLastGoodRound[1]) {
-			highestLastGoodRound = promise.LastGoodRound
+		if lastGoodRound := RoundFromProto(promise.LastGoodRound); lastGoodRound.Greater(highestLastGoodRound) {
+			highestLastGoodRound = lastGoodRound
 			finalValue = promise.Value
 		}
 	}
 
 
-	acceptedCount := 0
-	for _, acceptor := range p.servers {
-		conn, err := grpc.Dial(acceptor, grpc.WithTransportCredentials(insecure.NewCredentials()))
-		if err != nil {
-			continue
+	accept := &pb.AcceptRequest{
+		Round: round.Proto(),
+		Value: finalValue,
+		InstanceId: instanceId,
+	}
+
+	// Batched accepts are queued for every peer before waiting on any, so
+	// the peers' windows run side by side
+	batched := p.batcher.enabled()
+	replies := make(map[string]<-chan acceptReply)
+	if batched {
+		for _, acceptor := range servers {
+			if p.breakers.allow(acceptor) {
+				replies[acceptor] = p.batcher.enqueue(transport, acceptor, timeout, accept)
+			}
 		}
-		defer conn.Close()
-		
-		client := pb.NewPaxosClient(conn)
-		ctx,cancel := context.WithTimeout(context.Background(), 2*time.Second)
-		defer cancel()
+	}
 
-		response, err := client.Accept(ctx, &pb.AcceptRequest{
-			Round: round,
-			Value: finalValue,
-			InstanceId: instanceId,
-		})	
+	acceptedCount := 0
+	rejected = 0
+	for _, acceptor := range servers {
+		var response *pb.AcceptedResponse
+		if batched {
+			reply, queued := replies[acceptor]
+			if !queued {
+				continue
+			}
+			response, err = awaitAccept(ctx, reply)
+		} else {
+			if !p.breakers.allow(acceptor) {
+				continue
+			}
+			response, err = p.acceptFrom(ctx, transport, acceptor, timeout, accept)
+		}
+		p.recordRPC(ctx, acceptor, err)
 		if err != nil {
 			continue
 		}
 		
 		if response.Ack {
-			acceptedCount += 1
+			acceptedCount += p.weight(acceptor)
+		} else {
+			rejected += 1
 		}
 
 	}
 
-	localAccept, _ := p.localAcceptor.Accept(context.Background(), &pb.AcceptRequest{
-		Round: round,
-		Value: finalValue,
-		InstanceId: instanceId,
-	})
-	if localAccept.Ack {
-		acceptedCount += 1
+	localAccept, err := p.localAcceptor.Accept(context.Background(), accept)
+	if err != nil || localAccept == nil {
+		fmt.Printf("Local accept for instance %d failed: %v\n", instanceId, err)
+	} else if localAccept.Ack {
+		acceptedCount += p.localWeight()
+	} else {
+		rejected += 1
 	}
 
+	p.count(func(c *proposerCounters) {
+		c.acceptNacks += int64(rejected)
+		if acceptedCount < majority && rejected > 0 {
+			c.conflicts++
+		}
+	})
+
 	if acceptedCount < majority {
-		return 0, fmt.Errorf("failed to reach majority in accept phase got %d accepts, need %d accepts", acceptedCount, majority)
+		if err := ctx.Err(); err != nil {
+			return Outcome{}, &ErrDeadline{Phase: "accept", Err: err}
+		}
+		return Outcome{}, &ErrAcceptPhase{Accepts: acceptedCount, Rejected: rejected, Majority: majority}
 	}
 
-	for _, acceptor := range p.servers {
+	// Commits go to every peer, breaker or not: they don't hold up the
+	// proposal unless waitForCommitMajority is set, and one that lands
+	// closes the peer's breaker early. Each reports the weight it acked.
+	committedAt := time.Now().UnixMilli()
+	commitAcks := make(chan int, len(servers))
+	for _, acceptor := range servers {
 		go func(acceptor string) {
-			conn, err := grpc.Dial(acceptor, grpc.WithTransportCredentials(insecure.NewCredentials()))
+			client, err := transport.Client(acceptor)
 			if err != nil {
+				commitAcks <- 0
 				return 
 			}
-			defer conn.Close()
 			
-			client := pb.NewPaxosClient(conn)
-			ctx,cancel := context.WithTimeout(context.Background(), 2*time.Second)
+			ctx,cancel := context.WithTimeout(context.WithoutCancel(ctx), timeout)
 			defer cancel()
 
 			_, err = client.Commit(ctx, &pb.CommitRequest{
 				Value: finalValue,
 				InstanceId: instanceId,
 				Command: command,
+				CommittedAt: committedAt,
 			})
+			p.breakers.record(acceptor, err)
+			if err != nil {
+				commitAcks <- 0
+				return
+			}
+			commitAcks <- p.weight(acceptor)
 		}(acceptor)
 	}
 
-	p.localAcceptor.Commit(context.Background(), &pb.CommitRequest{
-		Value: finalValue,
-		InstanceId: instanceId,
-		Command: command,
-	})
+	// Read-only learners never vote, they only need to hear the outcome
+	for _, learner := range p.learners() {
+		go func(learner string) {
+			client, err := transport.Client(learner)
+			if err != nil {
+				return
+			}
+
+			ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), timeout)
+			defer cancel()
+
+			client.Commit(ctx, &pb.CommitRequest{
+				Value: finalValue,
+				InstanceId: instanceId,
+				Command: command,
+				CommittedAt: committedAt,
+			})
+		}(learner)
+	}
+
+	// Success only goes back to the client once the entry is in the local
+	// log and applied. Any durable log would need to be written by Append,
+	// which this already waits for.
+	outcome, err := p.commitLocal(finalValue, instanceId, command, committedAt)
+	p.mutex.Lock()
+	wait := p.waitForCommitMajority
+	p.mutex.Unlock()
+	if err != nil || !wait {
+		return outcome, err
+	}
+
+	committed := p.localWeight()
+	for range servers {
+		if committed >= majority {
+			break
+		}
+		committed += <-commitAcks
+	}
+	if committed < majority {
+		return outcome, &ErrCommitPhase{InstanceId: instanceId, Acks: committed, Majority: majority}
+	}
+	return outcome, nil
+
+
+
 
-	return finalValue, nil
 
 
 
@@ -168,8 +468,48 @@ func (p *Proposer) Propose(value int64, instanceId int64, command []byte) (int64
 
 
 
+}
+
+// acceptFrom sends accept to peer on its own, bounded by timeout
+func (p *Proposer) acceptFrom(ctx context.Context, transport Transport, peer string, timeout time.Duration, accept *pb.AcceptRequest) (*pb.AcceptedResponse, error) {
+	client, err := transport.Client(peer)
+	if err != nil {
+		return nil, err
+	}
 
+	rpcCtx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
 
+	p.countAcceptRPC(1)
+	return client.Accept(rpcCtx, accept)
+}
 
+// awaitAccept waits for a batched accept's reply, or for ctx to be done
+func awaitAccept(ctx context.Context, reply <-chan acceptReply) (*pb.AcceptedResponse, error) {
+	select {
+	case r := <-reply:
+		return r.response, r.err
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
 
-}
\ No newline at end of file
+// commitLocal commits through the local acceptor and waits for the state
+// machine's verdict on the command.
+func (p *Proposer) commitLocal(value int64, instanceId int64, command []byte, committedAt int64) (Outcome, error) {
+	p.count(func(c *proposerCounters) { c.chosen++ })
+	applied := <-p.localAcceptor.commit(&pb.CommitRequest{
+		Value: value,
+		InstanceId: instanceId,
+		Command: command,
+		CommittedAt: committedAt,
+	})
+	var decided *ErrInstanceDecided
+	if errors.As(applied.err, &decided) {
+		return Outcome{}, applied.err
+	}
+	if applied.err != nil {
+		return Outcome{Value: value}, &ErrApply{InstanceId: instanceId, Err: applied.err}
+	}
+	return Outcome{Value: value, Result: applied.result}, nil
+}
@@ -0,0 +1,173 @@
+package paxos
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/rand"
+	"sync"
+	"testing"
+	"time"
+
+	pb "ds_project/src/server/proto"
+)
+
+// TestCompetingProposersChooseOneValue runs three proposers against the
+// same three acceptors, each proposing its own value for every instance,
+// over links that delay and drop calls. Whatever wins, every proposer that
+// succeeds and every acceptor that learns the outcome must agree on it.
+func TestCompetingProposersChooseOneValue(t *testing.T) {
+	const instances = 20
+	names := []string{"a", "b", "c"}
+	cluster := newTestCluster(names...)
+
+	proposers := make([]*Proposer, len(names))
+	transports := make([]*MemoryTransport, len(names))
+	for i, name := range names {
+		proposers[i], transports[i] = cluster.proposer(int64(i+1), name)
+		proposers[i].SetRPCTimeout(200 * time.Millisecond)
+	}
+	transports[0].SetFault("b", LinkFault{Delay: 3 * time.Millisecond})
+	transports[1].SetFault("c", LinkFault{Delay: time.Millisecond})
+	transports[2].SetFault("a", LinkFault{Drop: true})
+
+	// Drop and heal one more link at a time while the proposals run, never
+	// cutting any proposer off from a majority for good
+	stop := make(chan struct{})
+	flapped := make(chan struct{})
+	go func() {
+		defer close(flapped)
+		random := rand.New(rand.NewSource(1))
+		for {
+			select {
+			case <-stop:
+				return
+			case <-time.After(2 * time.Millisecond):
+			}
+			from := random.Intn(2)
+			to := names[(from+1+random.Intn(2))%len(names)]
+			transports[from].SetFault(to, LinkFault{Drop: true})
+			time.Sleep(time.Duration(random.Intn(3)) * time.Millisecond)
+			transports[from].SetFault(to, LinkFault{})
+		}
+	}()
+
+	type win struct {
+		proposer int
+		value    int64
+	}
+	wins := make([][]win, instances)
+	var winsMutex sync.Mutex
+
+	var wg sync.WaitGroup
+	for instance := int64(0); instance < instances; instance++ {
+		for i, p := range proposers {
+			wg.Add(1)
+			go func(i int, p *Proposer, instance int64) {
+				defer wg.Done()
+				value := int64(i+1)*1000 + instance
+				command := createCommand(t, fmt.Sprintf("proposer-%d-instance-%d", i+1, instance))
+				for attempt := 0; attempt < 50; attempt++ {
+					outcome, err := p.Propose(context.Background(), value, instance, command)
+					var decided *ErrInstanceDecided
+					if errors.As(err, &decided) {
+						return
+					}
+					if err == nil {
+						winsMutex.Lock()
+						wins[instance] = append(wins[instance], win{proposer: i + 1, value: outcome.Value})
+						winsMutex.Unlock()
+						return
+					}
+					time.Sleep(time.Duration(rand.Intn(5)) * time.Millisecond)
+				}
+			}(i, p, instance)
+		}
+	}
+	wg.Wait()
+	close(stop)
+	<-flapped
+
+	for instance := int64(0); instance < instances; instance++ {
+		if len(wins[instance]) == 0 {
+			t.Errorf("instance %d: no proposer succeeded", instance)
+			continue
+		}
+		chosen := wins[instance][0].value
+		if chosen%1000 != instance || chosen/1000 < 1 || chosen/1000 > int64(len(names)) {
+			t.Errorf("instance %d: chose %d, which nobody proposed for it", instance, chosen)
+		}
+		for _, w := range wins[instance] {
+			if w.value != chosen {
+				t.Errorf("instance %d: proposer %d got %d chosen, another got %d", instance, w.proposer, w.value, chosen)
+			}
+		}
+		for _, name := range names {
+			if value, decided := decidedValue(cluster.acceptors[name], instance); decided && value != chosen {
+				t.Errorf("instance %d: acceptor %s decided %d, proposers got %d", instance, name, value, chosen)
+			}
+		}
+	}
+}
+
+// decidedValue is the value acceptor a recorded as chosen for instanceId,
+// if it has seen the commit
+func decidedValue(a *Acceptor, instanceId int64) (int64, bool) {
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+	instance, exists := a.instance[instanceId]
+	if !exists || !instance.decided {
+		return 0, false
+	}
+	return instance.decidedValue, true
+}
+
+// fullLocalAcceptor caps a's acceptor at one undecided instance and fills
+// it, so its Prepare and Accept for any new instance return an error
+func fullLocalAcceptor(t *testing.T, cluster *testCluster) {
+	t.Helper()
+	acceptor := cluster.acceptors["a"]
+	acceptor.SetMaxInstances(1)
+	prepareRaw(t, acceptor, 100)
+	_, err := acceptor.Prepare(context.Background(), &pb.PrepareRequest{Round: Round{Ballot: 1, ProposerID: 1}.Proto(), InstanceId: 0})
+	var tooMany *ErrTooManyInstances
+	if !errors.As(err, &tooMany) {
+		t.Fatalf("expected the full acceptor to refuse instance 0, got %v", err)
+	}
+}
+
+// A local Prepare or Accept that errors is a missing vote, like an
+// unreachable peer, and the proposal carries on with the others
+func TestFailingLocalAcceptorIsAMissingVote(t *testing.T) {
+	cluster := newTestCluster("a", "b", "c")
+	fullLocalAcceptor(t, cluster)
+	p, _ := cluster.proposer(1, "a")
+
+	if _, err := p.Propose(context.Background(), 0, 0, createCommand(t, "s")); err != nil {
+		t.Fatalf("expected b and c to carry the proposal, got %v", err)
+	}
+	// The commit is still learned locally, cap or not
+	if !cluster.acceptors["a"].IsDecided(0) {
+		t.Fatal("a didn't learn the commit")
+	}
+	if _, exists := cluster.machines["a"].GetScooter("s"); !exists {
+		t.Fatal("a didn't apply the commit")
+	}
+}
+
+func TestFailingLocalAcceptorWithoutMajority(t *testing.T) {
+	cluster := newTestCluster("a", "b", "c")
+	fullLocalAcceptor(t, cluster)
+	p, transport := cluster.proposer(1, "a")
+	transport.SetFault("c", LinkFault{Drop: true})
+
+	_, err := p.Propose(context.Background(), 0, 0, createCommand(t, "s"))
+	var prepare *ErrPreparePhase
+	if !errors.As(err, &prepare) {
+		t.Fatalf("got %v, want ErrPreparePhase", err)
+	}
+	// Neither a promise nor a rejection from a
+	if prepare.Promises != 1 || prepare.Rejected != 0 {
+		t.Fatalf("got %+v, want only b's promise and no rejections", prepare)
+	}
+}
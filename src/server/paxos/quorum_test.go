@@ -0,0 +1,80 @@
+package paxos
+
+import (
+	"context"
+	"errors"
+	"testing"
+)
+
+// A node that never comes back only costs its vote: the rest of the
+// configured set still makes a majority
+func TestWritesSurviveOneNodePermanentlyDown(t *testing.T) {
+	cluster := newTestCluster("a", "b", "c")
+	p, transport := cluster.proposer(1, "a")
+	transport.SetFault("c", LinkFault{Drop: true})
+
+	const writes = 20
+	for i := 0; i < writes; i++ {
+		if _, err := p.Propose(context.Background(), int64(i), int64(i), createCommand(t, scooterName(i))); err != nil {
+			t.Fatalf("write %d with c down: %v", i, err)
+		}
+	}
+
+	if got := len(cluster.machines["a"].GetScooters()); got != writes {
+		t.Fatalf("a applied %d writes, want %d", got, writes)
+	}
+	// b's vote is what made each majority
+	for i := int64(0); i < writes; i++ {
+		if state, _ := cluster.acceptors["b"].Instance(i); RoundFromProto(state.LastGoodRound).IsZero() {
+			t.Fatalf("b never accepted instance %d", i)
+		}
+	}
+	if _, known := cluster.acceptors["c"].Instance(0); known {
+		t.Fatal("c heard about instance 0 through a dropped link")
+	}
+}
+
+// The majority is over the configured set, not whoever is still reachable.
+// With two of three down the one left can't decide on its own, which is
+// what keeps both sides of a partition from deciding different values.
+func TestMajorityStaysOverConfiguredNodes(t *testing.T) {
+	cluster := newTestCluster("a", "b", "c")
+	p, transport := cluster.proposer(1, "a")
+	transport.SetFault("b", LinkFault{Drop: true})
+	transport.SetFault("c", LinkFault{Drop: true})
+
+	_, err := p.Propose(context.Background(), 0, 0, createCommand(t, "alone"))
+	var prepare *ErrPreparePhase
+	if !errors.As(err, &prepare) {
+		t.Fatalf("got %v, want ErrPreparePhase", err)
+	}
+	if prepare.Promises != 1 || prepare.Majority != 2 {
+		t.Fatalf("got %+v, want 1 promise short of a majority of 2", prepare)
+	}
+	if cluster.acceptors["a"].IsDecided(0) {
+		t.Fatal("a decided instance 0 on its own")
+	}
+
+	// Once one of them is back the same instance goes through
+	transport.SetFault("b", LinkFault{})
+	if _, err := p.Propose(context.Background(), 0, 0, createCommand(t, "alone")); err != nil {
+		t.Fatalf("write after b came back: %v", err)
+	}
+}
+
+func TestFiveNodesTolerateTwoDown(t *testing.T) {
+	cluster := newTestCluster("a", "b", "c", "d", "e")
+	p, transport := cluster.proposer(1, "a")
+	transport.SetFault("d", LinkFault{Drop: true})
+	transport.SetFault("e", LinkFault{Drop: true})
+	if _, err := p.Propose(context.Background(), 0, 0, createCommand(t, "two-down")); err != nil {
+		t.Fatalf("write with two of five down: %v", err)
+	}
+
+	transport.SetFault("c", LinkFault{Drop: true})
+	_, err := p.Propose(context.Background(), 1, 1, createCommand(t, "three-down"))
+	var prepare *ErrPreparePhase
+	if !errors.As(err, &prepare) || prepare.Majority != 3 {
+		t.Fatalf("got %v, want ErrPreparePhase short of a majority of 3", err)
+	}
+}
@@ -0,0 +1,61 @@
+package paxos
+
+import (
+	"context"
+
+	pb "ds_project/src/server/proto"
+)
+
+// ReadIndex returns the highest instance any of a majority of acceptors has
+// accepted. A value is only chosen once a majority accepted it, and every
+// majority overlaps, so everything chosen before the call is at or below the
+// returned index. Unlike a Noop round it allocates no instance and changes
+// no acceptor state.
+func (p *Proposer) ReadIndex(ctx context.Context) (int64, error) {
+	servers := p.Servers()
+	majority := p.majority(servers)
+	if err := p.checkClusterSize(servers); err != nil {
+		return 0, err
+	}
+
+	p.mutex.Lock()
+	timeout := p.rpcTimeout
+	transport := p.transport
+	p.mutex.Unlock()
+
+	local, _ := p.localAcceptor.ReadIndex(ctx, &pb.ReadIndexRequest{})
+	highest := local.HighestAccepted
+	responded := p.localWeight()
+
+	for _, acceptor := range servers {
+		if responded >= majority {
+			break
+		}
+		if !p.breakers.allow(acceptor) {
+			continue
+		}
+		client, err := transport.Client(acceptor)
+		if err != nil {
+			p.breakers.record(acceptor, err)
+			continue
+		}
+
+		rpcCtx, cancel := context.WithTimeout(ctx, timeout)
+		response, err := client.ReadIndex(rpcCtx, &pb.ReadIndexRequest{})
+		cancel()
+		p.recordRPC(ctx, acceptor, err)
+		if err != nil {
+			continue
+		}
+		highest = max(highest, response.HighestAccepted)
+		responded += p.weight(acceptor)
+	}
+
+	if responded < majority {
+		if err := ctx.Err(); err != nil {
+			return 0, &ErrDeadline{Phase: "read index", Err: err}
+		}
+		return 0, &ErrReadIndex{Responses: responded, Majority: majority}
+	}
+	return highest, nil
+}
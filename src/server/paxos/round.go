@@ -0,0 +1,41 @@
+package paxos
+
+// Round orders proposals: a higher ballot wins, and the proposer ID breaks
+// ties so two proposers never use the same round. On the wire it is the
+// repeated int64 pair [ballot, proposer ID].
+type Round struct {
+	Ballot     int64
+	ProposerID int64
+}
+
+// RoundFromProto converts the wire form. Missing parts read as zero.
+func RoundFromProto(parts []int64) Round {
+	var r Round
+	if len(parts) > 0 {
+		r.Ballot = parts[0]
+	}
+	if len(parts) > 1 {
+		r.ProposerID = parts[1]
+	}
+	return r
+}
+
+// Proto returns a fresh slice, so callers can't alias stored rounds.
+func (r Round) Proto() []int64 {
+	return []int64{r.Ballot, r.ProposerID}
+}
+
+func (r Round) Less(other Round) bool {
+	if r.Ballot != other.Ballot {
+		return r.Ballot < other.Ballot
+	}
+	return r.ProposerID < other.ProposerID
+}
+
+func (r Round) Greater(other Round) bool {
+	return other.Less(r)
+}
+
+func (r Round) IsZero() bool {
+	return r.Ballot == 0 && r.ProposerID == 0
+}
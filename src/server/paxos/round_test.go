@@ -0,0 +1,75 @@
+package paxos
+
+import (
+	"testing"
+)
+
+func TestRoundComparison(t *testing.T) {
+	cases := []struct {
+		name    string
+		a, b    Round
+		less    bool
+		greater bool
+	}{
+		{"higher ballot wins", Round{Ballot: 1, ProposerID: 5}, Round{Ballot: 2, ProposerID: 1}, true, false},
+		{"ballot outweighs proposer ID", Round{Ballot: 3, ProposerID: 1}, Round{Ballot: 2, ProposerID: 9}, false, true},
+		{"proposer ID breaks a tie", Round{Ballot: 2, ProposerID: 1}, Round{Ballot: 2, ProposerID: 2}, true, false},
+		{"equal rounds are neither", Round{Ballot: 2, ProposerID: 2}, Round{Ballot: 2, ProposerID: 2}, false, false},
+		{"zero is below any real round", Round{}, Round{Ballot: 0, ProposerID: 1}, true, false},
+		{"zero equals zero", Round{}, Round{}, false, false},
+		{"negative ballots still order", Round{Ballot: -1, ProposerID: 9}, Round{}, true, false},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			if got := c.a.Less(c.b); got != c.less {
+				t.Errorf("%v.Less(%v) = %v, want %v", c.a, c.b, got, c.less)
+			}
+			if got := c.a.Greater(c.b); got != c.greater {
+				t.Errorf("%v.Greater(%v) = %v, want %v", c.a, c.b, got, c.greater)
+			}
+			// Exactly one of less, greater and equal holds
+			if c.a.Less(c.b) && c.b.Less(c.a) {
+				t.Errorf("%v and %v are each less than the other", c.a, c.b)
+			}
+		})
+	}
+}
+
+func TestRoundFromProto(t *testing.T) {
+	cases := []struct {
+		name  string
+		parts []int64
+		want  Round
+	}{
+		{"nil is the zero round", nil, Round{}},
+		{"missing proposer ID reads as zero", []int64{4}, Round{Ballot: 4}},
+		{"both parts", []int64{4, 2}, Round{Ballot: 4, ProposerID: 2}},
+		{"extra parts are ignored", []int64{4, 2, 9}, Round{Ballot: 4, ProposerID: 2}},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			if got := RoundFromProto(c.parts); got != c.want {
+				t.Errorf("RoundFromProto(%v) = %v, want %v", c.parts, got, c.want)
+			}
+		})
+	}
+
+	if !RoundFromProto(nil).IsZero() {
+		t.Error("expected the round of an empty proto to be zero")
+	}
+	if (Round{ProposerID: 1}).IsZero() {
+		t.Error("a round with only a proposer ID isn't zero")
+	}
+}
+
+func TestRoundProtoDoesNotAlias(t *testing.T) {
+	round := Round{Ballot: 3, ProposerID: 1}
+	parts := round.Proto()
+	parts[0] = 99
+	if round.Ballot != 3 || round.Proto()[0] != 3 {
+		t.Fatal("changing the proto slice changed the round")
+	}
+	if RoundFromProto(round.Proto()) != round {
+		t.Fatal("a round doesn't survive the trip through its proto form")
+	}
+}
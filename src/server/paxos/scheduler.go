@@ -0,0 +1,135 @@
+package paxos
+
+import (
+	"context"
+	"sync"
+)
+
+// ProposalClass is which queue a proposal waits in when the proposer's
+// slots are full
+type ProposalClass int
+
+const (
+	WriteProposal ProposalClass = iota
+	// ReadProposal is a Noop run for a read or a heartbeat
+	ReadProposal
+)
+
+const DefaultWritesPerRead = 4
+
+// proposalScheduler caps how many proposals run at once. Past the cap,
+// proposals wait in a queue per class, and a freed slot goes to the next
+// write unless writesPerRead writes have gone ahead of a waiting read, so
+// neither class can hold every round while the other waits.
+type proposalScheduler struct {
+	// slots is how many proposals may run at once, 0 for no limit
+	slots         int
+	writesPerRead int
+	inFlight      int
+	queues        [2][]chan struct{}
+	// writesSinceRead counts writes granted past a waiting read
+	writesSinceRead int
+	mutex           sync.Mutex
+}
+
+func newProposalScheduler() *proposalScheduler {
+	return &proposalScheduler{writesPerRead: DefaultWritesPerRead}
+}
+
+func (s *proposalScheduler) configure(slots int, writesPerRead int) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.slots = slots
+	s.writesPerRead = max(writesPerRead, 1)
+	// Raising the cap frees slots for whoever is waiting
+	for (s.slots == 0 || s.inFlight < s.slots) && s.grantLocked() {
+		s.inFlight++
+	}
+}
+
+// admit waits for a slot for a proposal of class, returning what gives it
+// back. It gives up with ErrDeadline if ctx is done first.
+func (s *proposalScheduler) admit(ctx context.Context, class ProposalClass) (func(), error) {
+	s.mutex.Lock()
+	if s.slots == 0 || (s.inFlight < s.slots && len(s.queues[WriteProposal]) == 0 && len(s.queues[ReadProposal]) == 0) {
+		s.inFlight++
+		s.mutex.Unlock()
+		return s.release, nil
+	}
+	turn := make(chan struct{})
+	s.queues[class] = append(s.queues[class], turn)
+	s.mutex.Unlock()
+
+	select {
+	case <-turn:
+		return s.release, nil
+	case <-ctx.Done():
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	for i, queued := range s.queues[class] {
+		if queued == turn {
+			s.queues[class] = append(s.queues[class][:i], s.queues[class][i+1:]...)
+			return nil, &ErrDeadline{Phase: "queue", Err: ctx.Err()}
+		}
+	}
+	// The slot was handed over just as ctx ended, so pass it on
+	if !s.grantLocked() {
+		s.inFlight--
+	}
+	return nil, &ErrDeadline{Phase: "queue", Err: ctx.Err()}
+}
+
+// release hands the slot to the next queued proposal, if any
+func (s *proposalScheduler) release() {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if !s.grantLocked() {
+		s.inFlight--
+	}
+}
+
+// grantLocked wakes the proposal whose turn it is and reports whether there
+// was one. The slot moves to it, so inFlight doesn't change.
+func (s *proposalScheduler) grantLocked() bool {
+	writes, reads := len(s.queues[WriteProposal]), len(s.queues[ReadProposal])
+	class := WriteProposal
+	switch {
+	case writes == 0 && reads == 0:
+		return false
+	case writes == 0:
+		class = ReadProposal
+	case reads > 0 && s.writesSinceRead >= s.writesPerRead:
+		class = ReadProposal
+	}
+
+	if class == ReadProposal {
+		s.writesSinceRead = 0
+	} else if reads > 0 {
+		s.writesSinceRead++
+	}
+	turn := s.queues[class][0]
+	s.queues[class] = s.queues[class][1:]
+	close(turn)
+	return true
+}
+
+func (s *proposalScheduler) depths() (writes int, reads int) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return len(s.queues[WriteProposal]), len(s.queues[ReadProposal])
+}
+
+// SetProposalSlots caps how many proposals run at once, 0 for no limit, and
+// sets how many queued writes may go ahead of a queued read. It can change
+// while proposals are running.
+func (p *Proposer) SetProposalSlots(slots int, writesPerRead int) {
+	p.scheduler.configure(slots, writesPerRead)
+}
+
+// Admit waits for a proposal slot for class. Call the returned function once
+// the proposal is done, however many instances it tried.
+func (p *Proposer) Admit(ctx context.Context, class ProposalClass) (func(), error) {
+	return p.scheduler.admit(ctx, class)
+}
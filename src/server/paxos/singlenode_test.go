@@ -0,0 +1,154 @@
+package paxos
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	pb "ds_project/src/server/proto"
+	"ds_project/src/server/statemachine"
+)
+
+// proposeNext allocates the next index and proposes command for it, as the
+// API does for a write
+func proposeNext(t testing.TB, c *testCluster, p *Proposer, self string, command []byte) int64 {
+	t.Helper()
+	index, err := c.logs[self].AllocateIndex()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := p.Propose(context.Background(), index, index, command); err != nil {
+		t.Fatalf("propose %d: %v", index, err)
+	}
+	return index
+}
+
+func TestSingleNodeCommitsWithoutARound(t *testing.T) {
+	c := newTestCluster("solo")
+	p, _ := c.proposer(1, "solo")
+
+	const count = 50
+	for i := 0; i < count; i++ {
+		index := proposeNext(t, c, p, "solo", createCommand(t, scooterName(i)))
+		if index != int64(i) {
+			t.Fatalf("proposal %d went to index %d", i, index)
+		}
+
+		state, known := c.acceptors["solo"].Instance(index)
+		if !known || !state.Decided || state.DecidedValue != index {
+			t.Fatalf("instance %d: %+v, want decided on %d", index, state, index)
+		}
+		// No round was run, so the acceptor never promised or accepted anything
+		if !RoundFromProto(state.LastRound).IsZero() || !RoundFromProto(state.LastGoodRound).IsZero() {
+			t.Fatalf("instance %d went through a round: %+v", index, state)
+		}
+	}
+
+	machine := c.machines["solo"]
+	if got := len(machine.GetScooters()); got != count {
+		t.Fatalf("%d scooters after %d creates", got, count)
+	}
+	if got := machine.AppliedIndex(); got != count-1 {
+		t.Fatalf("applied index %d, want %d", got, count-1)
+	}
+	if got := c.logs["solo"].GetCommitIndex(); got != count-1 {
+		t.Fatalf("commit index %d, want %d", got, count-1)
+	}
+
+	_, err := p.Propose(context.Background(), 3, 3, createCommand(t, "late"))
+	var decided *ErrInstanceDecided
+	if !errors.As(err, &decided) || decided.InstanceId != 3 {
+		t.Fatalf("proposing a decided instance again: %v, want ErrInstanceDecided", err)
+	}
+}
+
+func TestSingleNodeSnapshotMatchesState(t *testing.T) {
+	c := newTestCluster("solo")
+	p, _ := c.proposer(1, "solo")
+	machine := c.machines["solo"]
+
+	for i := 0; i < 10; i++ {
+		proposeNext(t, c, p, "solo", createCommand(t, scooterName(i)))
+	}
+	if err := machine.TakeSnapshot(machine.AppliedIndex()); err != nil {
+		t.Fatal(err)
+	}
+	data, index := machine.GetSnapshot()
+	if index != 9 {
+		t.Fatalf("snapshot at %d, want 9", index)
+	}
+
+	// A node recovering from the snapshot ends up with the same state
+	restored := statemachine.NewScooterStateMachine()
+	if err := restored.LoadSnapshot(data, index); err != nil {
+		t.Fatal(err)
+	}
+	want, _, err := machine.StateHash()
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, _, err := restored.StateHash()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got != want {
+		t.Fatalf("restored state hash %s, want %s", got, want)
+	}
+
+	// and later commits carry on from the snapshot's index
+	next := proposeNext(t, c, p, "solo", createCommand(t, "after-snapshot"))
+	if next != index+1 {
+		t.Fatalf("first commit after the snapshot went to %d, want %d", next, index+1)
+	}
+	if _, exists := machine.GetScooter("after-snapshot"); !exists {
+		t.Fatal("commit after the snapshot wasn't applied")
+	}
+}
+
+// fullRound runs both phases against the acceptor alone before committing,
+// which is what a proposal with no peers did before skipping the round
+func fullRound(tb testing.TB, acceptor *Acceptor, round Round, instanceId int64, command []byte) {
+	promise, err := acceptor.Prepare(context.Background(), &pb.PrepareRequest{Round: round.Proto(), InstanceId: instanceId})
+	if err != nil || !promise.Ack {
+		tb.Fatalf("prepare %d: %v %v", instanceId, promise, err)
+	}
+	accepted, err := acceptor.Accept(context.Background(), &pb.AcceptRequest{Round: round.Proto(), InstanceId: instanceId, Value: instanceId})
+	if err != nil || !accepted.Ack {
+		tb.Fatalf("accept %d: %v %v", instanceId, accepted, err)
+	}
+	if outcome := <-acceptor.commit(&pb.CommitRequest{Value: instanceId, InstanceId: instanceId, Command: command}); outcome.err != nil {
+		tb.Fatalf("commit %d: %v", instanceId, outcome.err)
+	}
+}
+
+func BenchmarkSingleNodePropose(b *testing.B) {
+	c := newTestCluster("solo")
+	p, _ := c.proposer(1, "solo")
+	commands := make([][]byte, b.N)
+	for i := range commands {
+		commands[i] = createCommand(b, scooterName(i))
+	}
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		proposeNext(b, c, p, "solo", commands[i])
+	}
+}
+
+func BenchmarkSingleNodeFullRound(b *testing.B) {
+	c := newTestCluster("solo")
+	acceptor := c.acceptors["solo"]
+	commands := make([][]byte, b.N)
+	for i := range commands {
+		commands[i] = createCommand(b, scooterName(i))
+	}
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		index, err := c.logs["solo"].AllocateIndex()
+		if err != nil {
+			b.Fatal(err)
+		}
+		fullRound(b, acceptor, Round{Ballot: 1, ProposerID: 1}, index, commands[i])
+	}
+}
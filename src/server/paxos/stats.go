@@ -0,0 +1,82 @@
+package paxos
+
+// ProposerStats counts what this node's proposer has run into since it
+// started. NACKs come from acceptors that had promised a higher round,
+// which means another node was proposing for the same instance.
+type ProposerStats struct {
+	Proposals    int64 `json:"proposals"`
+	Chosen       int64 `json:"chosen"`
+	PrepareNacks int64 `json:"prepare_nacks"`
+	AcceptNacks  int64 `json:"accept_nacks"`
+	// Conflicts are proposals that failed because of at least one NACK
+	Conflicts int64 `json:"conflicts"`
+	// Retries are proposals turned away because their instance was already
+	// decided, so the caller had to try again at a fresh one
+	Retries int64 `json:"retries"`
+	// AcceptRPCs are the accept calls made to peers, and AcceptsSent the
+	// accepts they carried; with batching one RPC carries several
+	AcceptRPCs  int64 `json:"accept_rpcs"`
+	AcceptsSent int64 `json:"accepts_sent"`
+	// QueuedWrites and QueuedReads are proposals waiting for a slot
+	QueuedWrites int `json:"queued_writes"`
+	QueuedReads  int `json:"queued_reads"`
+	// Round is the last round this proposer used, as [ballot, proposer id]
+	Round   []int64 `json:"round"`
+
+	ConflictRate     float64 `json:"conflict_rate"`
+	RetriesPerChosen float64 `json:"retries_per_chosen"`
+}
+
+type proposerCounters struct {
+	proposals    int64
+	chosen       int64
+	prepareNacks int64
+	acceptNacks  int64
+	conflicts    int64
+	retries      int64
+	acceptRPCs   int64
+	acceptsSent  int64
+}
+
+func (p *Proposer) count(update func(c *proposerCounters)) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	update(&p.counters)
+}
+
+// countAcceptRPC records one accept RPC to a peer carrying accepts accepts
+func (p *Proposer) countAcceptRPC(accepts int) {
+	p.count(func(c *proposerCounters) {
+		c.acceptRPCs++
+		c.acceptsSent += int64(accepts)
+	})
+}
+
+func (p *Proposer) Stats() ProposerStats {
+	queuedWrites, queuedReads := p.scheduler.depths()
+
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	c := p.counters
+	stats := ProposerStats{
+		Proposals:    c.proposals,
+		Chosen:       c.chosen,
+		PrepareNacks: c.prepareNacks,
+		AcceptNacks:  c.acceptNacks,
+		Conflicts:    c.conflicts,
+		Retries:      c.retries,
+		AcceptRPCs:   c.acceptRPCs,
+		AcceptsSent:  c.acceptsSent,
+		QueuedWrites: queuedWrites,
+		QueuedReads:  queuedReads,
+		Round:        p.round.Proto(),
+	}
+	if c.proposals > 0 {
+		stats.ConflictRate = float64(c.conflicts) / float64(c.proposals)
+	}
+	if c.chosen > 0 {
+		stats.RetriesPerChosen = float64(c.retries) / float64(c.chosen)
+	}
+	return stats
+}
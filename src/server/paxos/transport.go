@@ -0,0 +1,154 @@
+package paxos
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"google.golang.org/grpc"
+
+	pb "ds_project/src/server/proto"
+	"ds_project/src/server/connections"
+)
+
+// Transport hands the proposer a Paxos client for each peer, so the same
+// Propose code can run over gRPC or entirely in process.
+type Transport interface {
+	Client(server string) (pb.PaxosClient, error)
+}
+
+// GRPCTransport reaches peers over the shared gRPC connections
+type GRPCTransport struct {
+	conns *connections.Manager
+}
+
+func NewGRPCTransport(conns *connections.Manager) *GRPCTransport {
+	return &GRPCTransport{conns: conns}
+}
+
+func (t *GRPCTransport) Client(server string) (pb.PaxosClient, error) {
+	conn, err := t.conns.Get(server)
+	if err != nil {
+		return nil, err
+	}
+	return pb.NewPaxosClient(conn), nil
+}
+
+// ErrDropped is what a MemoryTransport call returns when the link drops it
+type ErrDropped struct {
+	From string
+	To   string
+}
+
+func (e *ErrDropped) Error() string {
+	return fmt.Sprintf("message from %s to %s dropped", e.From, e.To)
+}
+
+// LinkFault is how a MemoryTransport treats calls to one peer. Delay is
+// waited out (or until the call's ctx is done) before delivering; Drop
+// fails the call without reaching the acceptor.
+type LinkFault struct {
+	Delay time.Duration
+	Drop  bool
+}
+
+// MemoryTransport routes calls straight to Acceptor objects in the same
+// process. It exists for tests: several proposers can share one set of
+// acceptors, and per-link delays and drops stand in for a slow or
+// partitioned network without opening a port.
+type MemoryTransport struct {
+	from      string
+	acceptors map[string]*Acceptor
+	faults    map[string]LinkFault
+	mutex     sync.Mutex
+}
+
+// NewMemoryTransport gives the proposer named from access to acceptors,
+// keyed by the server names the proposer was constructed with.
+func NewMemoryTransport(from string, acceptors map[string]*Acceptor) *MemoryTransport {
+	return &MemoryTransport{
+		from:      from,
+		acceptors: acceptors,
+		faults:    make(map[string]LinkFault),
+	}
+}
+
+// SetFault changes how calls to server behave from now on; the zero
+// LinkFault heals the link.
+func (t *MemoryTransport) SetFault(server string, fault LinkFault) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	t.faults[server] = fault
+}
+
+func (t *MemoryTransport) fault(server string) LinkFault {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	return t.faults[server]
+}
+
+func (t *MemoryTransport) Client(server string) (pb.PaxosClient, error) {
+	acceptor, exists := t.acceptors[server]
+	if !exists {
+		return nil, fmt.Errorf("no in-memory acceptor for %s", server)
+	}
+	return &memoryClient{transport: t, server: server, acceptor: acceptor}, nil
+}
+
+type memoryClient struct {
+	transport *MemoryTransport
+	server    string
+	acceptor  *Acceptor
+}
+
+// deliver applies the link's fault before a call reaches the acceptor
+func (c *memoryClient) deliver(ctx context.Context) error {
+	fault := c.transport.fault(c.server)
+	if fault.Drop {
+		return &ErrDropped{From: c.transport.from, To: c.server}
+	}
+	if fault.Delay > 0 {
+		select {
+		case <-time.After(fault.Delay):
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+	return nil
+}
+
+func (c *memoryClient) Prepare(ctx context.Context, in *pb.PrepareRequest, opts ...grpc.CallOption) (*pb.PromiseResponse, error) {
+	if err := c.deliver(ctx); err != nil {
+		return nil, err
+	}
+	return c.acceptor.Prepare(ctx, in)
+}
+
+func (c *memoryClient) Accept(ctx context.Context, in *pb.AcceptRequest, opts ...grpc.CallOption) (*pb.AcceptedResponse, error) {
+	if err := c.deliver(ctx); err != nil {
+		return nil, err
+	}
+	return c.acceptor.Accept(ctx, in)
+}
+
+func (c *memoryClient) AcceptBatch(ctx context.Context, in *pb.AcceptBatchRequest, opts ...grpc.CallOption) (*pb.AcceptBatchResponse, error) {
+	if err := c.deliver(ctx); err != nil {
+		return nil, err
+	}
+	return c.acceptor.AcceptBatch(ctx, in)
+}
+
+func (c *memoryClient) Commit(ctx context.Context, in *pb.CommitRequest, opts ...grpc.CallOption) (*pb.CommitResponse, error) {
+	if err := c.deliver(ctx); err != nil {
+		return nil, err
+	}
+	return c.acceptor.Commit(ctx, in)
+}
+
+func (c *memoryClient) ReadIndex(ctx context.Context, in *pb.ReadIndexRequest, opts ...grpc.CallOption) (*pb.ReadIndexResponse, error) {
+	if err := c.deliver(ctx); err != nil {
+		return nil, err
+	}
+	return c.acceptor.ReadIndex(ctx, in)
+}
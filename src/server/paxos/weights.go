@@ -0,0 +1,59 @@
+package paxos
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// SetWeights gives acceptors unequal votes, keyed by the server addresses
+// the proposer was constructed with; self is this node's own address, for
+// the local acceptor. Anyone not listed votes with weight 1. A quorum is
+// then more than half of the total weight, so e.g. two full nodes of
+// weight 2 and a witness of weight 1 reach it with either full node plus
+// the witness. Every proposer must be given the same weights.
+func (p *Proposer) SetWeights(weights map[string]int, self string) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	p.weights = weights
+	p.self = self
+}
+
+// ParseWeights reads weights written as addr=weight,addr=weight
+func ParseWeights(value string) (map[string]int, error) {
+	weights := make(map[string]int)
+	if value == "" {
+		return weights, nil
+	}
+	for _, pair := range strings.Split(value, ",") {
+		address, weight, found := strings.Cut(pair, "=")
+		if !found {
+			return nil, fmt.Errorf("weight %q is not addr=weight", pair)
+		}
+		w, err := strconv.Atoi(weight)
+		if err != nil || w < 0 {
+			return nil, fmt.Errorf("weight of %s must be a non-negative integer, got %q", address, weight)
+		}
+		weights[address] = w
+	}
+	return weights, nil
+}
+
+func (p *Proposer) weight(server string) int {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	return p.weightLocked(server)
+}
+
+func (p *Proposer) weightLocked(server string) int {
+	if weight, exists := p.weights[server]; exists {
+		return weight
+	}
+	return 1
+}
+
+func (p *Proposer) localWeight() int {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	return p.weightLocked(p.self)
+}
@@ -269,18 +269,109 @@ func (x *AcceptedResponse) GetInstanceId() int64 {
 	return 0
 }
 
+// AcceptBatch carries the accepts a proposer had pending for one peer, each
+// for its own instance. Responses come back in the same order.
+type AcceptBatchRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Accepts       []*AcceptRequest       `protobuf:"bytes,1,rep,name=accepts,proto3" json:"accepts,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *AcceptBatchRequest) Reset() {
+	*x = AcceptBatchRequest{}
+	mi := &file_paxos_proto_msgTypes[4]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *AcceptBatchRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*AcceptBatchRequest) ProtoMessage() {}
+
+func (x *AcceptBatchRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_paxos_proto_msgTypes[4]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use AcceptBatchRequest.ProtoReflect.Descriptor instead.
+func (*AcceptBatchRequest) Descriptor() ([]byte, []int) {
+	return file_paxos_proto_rawDescGZIP(), []int{4}
+}
+
+func (x *AcceptBatchRequest) GetAccepts() []*AcceptRequest {
+	if x != nil {
+		return x.Accepts
+	}
+	return nil
+}
+
+type AcceptBatchResponse struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Accepted      []*AcceptedResponse    `protobuf:"bytes,1,rep,name=accepted,proto3" json:"accepted,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *AcceptBatchResponse) Reset() {
+	*x = AcceptBatchResponse{}
+	mi := &file_paxos_proto_msgTypes[5]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *AcceptBatchResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*AcceptBatchResponse) ProtoMessage() {}
+
+func (x *AcceptBatchResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_paxos_proto_msgTypes[5]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use AcceptBatchResponse.ProtoReflect.Descriptor instead.
+func (*AcceptBatchResponse) Descriptor() ([]byte, []int) {
+	return file_paxos_proto_rawDescGZIP(), []int{5}
+}
+
+func (x *AcceptBatchResponse) GetAccepted() []*AcceptedResponse {
+	if x != nil {
+		return x.Accepted
+	}
+	return nil
+}
+
 type CommitRequest struct {
 	state         protoimpl.MessageState `protogen:"open.v1"`
 	Value         int64                  `protobuf:"varint,1,opt,name=value,proto3" json:"value,omitempty"`
 	InstanceId    int64                  `protobuf:"varint,2,opt,name=instance_id,json=instanceId,proto3" json:"instance_id,omitempty"`
 	Command       []byte                 `protobuf:"bytes,3,opt,name=command,proto3" json:"command,omitempty"`
+	CommittedAt   int64                  `protobuf:"varint,4,opt,name=committed_at,json=committedAt,proto3" json:"committed_at,omitempty"`
 	unknownFields protoimpl.UnknownFields
 	sizeCache     protoimpl.SizeCache
 }
 
 func (x *CommitRequest) Reset() {
 	*x = CommitRequest{}
-	mi := &file_paxos_proto_msgTypes[4]
+	mi := &file_paxos_proto_msgTypes[6]
 	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 	ms.StoreMessageInfo(mi)
 }
@@ -292,7 +383,7 @@ func (x *CommitRequest) String() string {
 func (*CommitRequest) ProtoMessage() {}
 
 func (x *CommitRequest) ProtoReflect() protoreflect.Message {
-	mi := &file_paxos_proto_msgTypes[4]
+	mi := &file_paxos_proto_msgTypes[6]
 	if x != nil {
 		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 		if ms.LoadMessageInfo() == nil {
@@ -305,7 +396,7 @@ func (x *CommitRequest) ProtoReflect() protoreflect.Message {
 
 // Deprecated: Use CommitRequest.ProtoReflect.Descriptor instead.
 func (*CommitRequest) Descriptor() ([]byte, []int) {
-	return file_paxos_proto_rawDescGZIP(), []int{4}
+	return file_paxos_proto_rawDescGZIP(), []int{6}
 }
 
 func (x *CommitRequest) GetValue() int64 {
@@ -329,6 +420,13 @@ func (x *CommitRequest) GetCommand() []byte {
 	return nil
 }
 
+func (x *CommitRequest) GetCommittedAt() int64 {
+	if x != nil {
+		return x.CommittedAt
+	}
+	return 0
+}
+
 type CommitResponse struct {
 	state         protoimpl.MessageState `protogen:"open.v1"`
 	unknownFields protoimpl.UnknownFields
@@ -337,7 +435,7 @@ type CommitResponse struct {
 
 func (x *CommitResponse) Reset() {
 	*x = CommitResponse{}
-	mi := &file_paxos_proto_msgTypes[5]
+	mi := &file_paxos_proto_msgTypes[7]
 	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 	ms.StoreMessageInfo(mi)
 }
@@ -349,7 +447,7 @@ func (x *CommitResponse) String() string {
 func (*CommitResponse) ProtoMessage() {}
 
 func (x *CommitResponse) ProtoReflect() protoreflect.Message {
-	mi := &file_paxos_proto_msgTypes[5]
+	mi := &file_paxos_proto_msgTypes[7]
 	if x != nil {
 		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 		if ms.LoadMessageInfo() == nil {
@@ -362,19 +460,281 @@ func (x *CommitResponse) ProtoReflect() protoreflect.Message {
 
 // Deprecated: Use CommitResponse.ProtoReflect.Descriptor instead.
 func (*CommitResponse) Descriptor() ([]byte, []int) {
-	return file_paxos_proto_rawDescGZIP(), []int{5}
+	return file_paxos_proto_rawDescGZIP(), []int{7}
 }
 
-type GetLogRequest struct {
+// ReadIndex asks an acceptor for the highest instance it has accepted or
+// seen decided, -1 if none. Across a majority that bounds every instance
+// chosen so far, so a read can wait for it instead of running a round.
+type ReadIndexRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *ReadIndexRequest) Reset() {
+	*x = ReadIndexRequest{}
+	mi := &file_paxos_proto_msgTypes[8]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *ReadIndexRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ReadIndexRequest) ProtoMessage() {}
+
+func (x *ReadIndexRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_paxos_proto_msgTypes[8]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ReadIndexRequest.ProtoReflect.Descriptor instead.
+func (*ReadIndexRequest) Descriptor() ([]byte, []int) {
+	return file_paxos_proto_rawDescGZIP(), []int{8}
+}
+
+type ReadIndexResponse struct {
+	state           protoimpl.MessageState `protogen:"open.v1"`
+	HighestAccepted int64                  `protobuf:"varint,1,opt,name=highest_accepted,json=highestAccepted,proto3" json:"highest_accepted,omitempty"`
+	unknownFields   protoimpl.UnknownFields
+	sizeCache       protoimpl.SizeCache
+}
+
+func (x *ReadIndexResponse) Reset() {
+	*x = ReadIndexResponse{}
+	mi := &file_paxos_proto_msgTypes[9]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *ReadIndexResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ReadIndexResponse) ProtoMessage() {}
+
+func (x *ReadIndexResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_paxos_proto_msgTypes[9]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ReadIndexResponse.ProtoReflect.Descriptor instead.
+func (*ReadIndexResponse) Descriptor() ([]byte, []int) {
+	return file_paxos_proto_rawDescGZIP(), []int{9}
+}
+
+func (x *ReadIndexResponse) GetHighestAccepted() int64 {
+	if x != nil {
+		return x.HighestAccepted
+	}
+	return 0
+}
+
+// GetCommitIndex is a cheap probe a recovering node sends each peer to pick
+// the most up-to-date one before fetching its log
+type CommitIndexRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *CommitIndexRequest) Reset() {
+	*x = CommitIndexRequest{}
+	mi := &file_paxos_proto_msgTypes[10]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *CommitIndexRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*CommitIndexRequest) ProtoMessage() {}
+
+func (x *CommitIndexRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_paxos_proto_msgTypes[10]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use CommitIndexRequest.ProtoReflect.Descriptor instead.
+func (*CommitIndexRequest) Descriptor() ([]byte, []int) {
+	return file_paxos_proto_rawDescGZIP(), []int{10}
+}
+
+type CommitIndexResponse struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	CommitIndex   int64                  `protobuf:"varint,1,opt,name=commit_index,json=commitIndex,proto3" json:"commit_index,omitempty"`
+	IsLeader      bool                   `protobuf:"varint,2,opt,name=is_leader,json=isLeader,proto3" json:"is_leader,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *CommitIndexResponse) Reset() {
+	*x = CommitIndexResponse{}
+	mi := &file_paxos_proto_msgTypes[11]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *CommitIndexResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*CommitIndexResponse) ProtoMessage() {}
+
+func (x *CommitIndexResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_paxos_proto_msgTypes[11]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use CommitIndexResponse.ProtoReflect.Descriptor instead.
+func (*CommitIndexResponse) Descriptor() ([]byte, []int) {
+	return file_paxos_proto_rawDescGZIP(), []int{11}
+}
+
+func (x *CommitIndexResponse) GetCommitIndex() int64 {
+	if x != nil {
+		return x.CommitIndex
+	}
+	return 0
+}
+
+func (x *CommitIndexResponse) GetIsLeader() bool {
+	if x != nil {
+		return x.IsLeader
+	}
+	return false
+}
+
+type StateHashRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *StateHashRequest) Reset() {
+	*x = StateHashRequest{}
+	mi := &file_paxos_proto_msgTypes[12]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *StateHashRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*StateHashRequest) ProtoMessage() {}
+
+func (x *StateHashRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_paxos_proto_msgTypes[12]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use StateHashRequest.ProtoReflect.Descriptor instead.
+func (*StateHashRequest) Descriptor() ([]byte, []int) {
+	return file_paxos_proto_rawDescGZIP(), []int{12}
+}
+
+type StateHashResponse struct {
 	state         protoimpl.MessageState `protogen:"open.v1"`
-	StartingIndex int64                  `protobuf:"varint,1,opt,name=starting_index,json=startingIndex,proto3" json:"starting_index,omitempty"`
+	Hash          string                 `protobuf:"bytes,1,opt,name=hash,proto3" json:"hash,omitempty"`
+	AppliedIndex  int64                  `protobuf:"varint,2,opt,name=applied_index,json=appliedIndex,proto3" json:"applied_index,omitempty"`
 	unknownFields protoimpl.UnknownFields
 	sizeCache     protoimpl.SizeCache
 }
 
+func (x *StateHashResponse) Reset() {
+	*x = StateHashResponse{}
+	mi := &file_paxos_proto_msgTypes[13]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *StateHashResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*StateHashResponse) ProtoMessage() {}
+
+func (x *StateHashResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_paxos_proto_msgTypes[13]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use StateHashResponse.ProtoReflect.Descriptor instead.
+func (*StateHashResponse) Descriptor() ([]byte, []int) {
+	return file_paxos_proto_rawDescGZIP(), []int{13}
+}
+
+func (x *StateHashResponse) GetHash() string {
+	if x != nil {
+		return x.Hash
+	}
+	return ""
+}
+
+func (x *StateHashResponse) GetAppliedIndex() int64 {
+	if x != nil {
+		return x.AppliedIndex
+	}
+	return 0
+}
+
+type GetLogRequest struct {
+	state            protoimpl.MessageState `protogen:"open.v1"`
+	StartingIndex    int64                  `protobuf:"varint,1,opt,name=starting_index,json=startingIndex,proto3" json:"starting_index,omitempty"`
+	AcceptCompressed bool                   `protobuf:"varint,2,opt,name=accept_compressed,json=acceptCompressed,proto3" json:"accept_compressed,omitempty"`
+	unknownFields    protoimpl.UnknownFields
+	sizeCache        protoimpl.SizeCache
+}
+
 func (x *GetLogRequest) Reset() {
 	*x = GetLogRequest{}
-	mi := &file_paxos_proto_msgTypes[6]
+	mi := &file_paxos_proto_msgTypes[14]
 	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 	ms.StoreMessageInfo(mi)
 }
@@ -386,7 +746,7 @@ func (x *GetLogRequest) String() string {
 func (*GetLogRequest) ProtoMessage() {}
 
 func (x *GetLogRequest) ProtoReflect() protoreflect.Message {
-	mi := &file_paxos_proto_msgTypes[6]
+	mi := &file_paxos_proto_msgTypes[14]
 	if x != nil {
 		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 		if ms.LoadMessageInfo() == nil {
@@ -399,7 +759,7 @@ func (x *GetLogRequest) ProtoReflect() protoreflect.Message {
 
 // Deprecated: Use GetLogRequest.ProtoReflect.Descriptor instead.
 func (*GetLogRequest) Descriptor() ([]byte, []int) {
-	return file_paxos_proto_rawDescGZIP(), []int{6}
+	return file_paxos_proto_rawDescGZIP(), []int{14}
 }
 
 func (x *GetLogRequest) GetStartingIndex() int64 {
@@ -409,19 +769,27 @@ func (x *GetLogRequest) GetStartingIndex() int64 {
 	return 0
 }
 
+func (x *GetLogRequest) GetAcceptCompressed() bool {
+	if x != nil {
+		return x.AcceptCompressed
+	}
+	return false
+}
+
 type GetLogResponse struct {
-	state         protoimpl.MessageState `protogen:"open.v1"`
-	LogEntry      []*LogEntry            `protobuf:"bytes,1,rep,name=log_entry,json=logEntry,proto3" json:"log_entry,omitempty"`
-	CommitIndex   int64                  `protobuf:"varint,2,opt,name=commit_index,json=commitIndex,proto3" json:"commit_index,omitempty"`
-	SnapshotData  []byte                 `protobuf:"bytes,3,opt,name=snapshot_data,json=snapshotData,proto3" json:"snapshot_data,omitempty"`
-	SnapshotIndex int64                  `protobuf:"varint,4,opt,name=snapshot_index,json=snapshotIndex,proto3" json:"snapshot_index,omitempty"`
-	unknownFields protoimpl.UnknownFields
-	sizeCache     protoimpl.SizeCache
+	state              protoimpl.MessageState `protogen:"open.v1"`
+	LogEntry           []*LogEntry            `protobuf:"bytes,1,rep,name=log_entry,json=logEntry,proto3" json:"log_entry,omitempty"`
+	CommitIndex        int64                  `protobuf:"varint,2,opt,name=commit_index,json=commitIndex,proto3" json:"commit_index,omitempty"`
+	SnapshotData       []byte                 `protobuf:"bytes,3,opt,name=snapshot_data,json=snapshotData,proto3" json:"snapshot_data,omitempty"`
+	SnapshotIndex      int64                  `protobuf:"varint,4,opt,name=snapshot_index,json=snapshotIndex,proto3" json:"snapshot_index,omitempty"`
+	SnapshotCompressed bool                   `protobuf:"varint,5,opt,name=snapshot_compressed,json=snapshotCompressed,proto3" json:"snapshot_compressed,omitempty"`
+	unknownFields      protoimpl.UnknownFields
+	sizeCache          protoimpl.SizeCache
 }
 
 func (x *GetLogResponse) Reset() {
 	*x = GetLogResponse{}
-	mi := &file_paxos_proto_msgTypes[7]
+	mi := &file_paxos_proto_msgTypes[15]
 	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 	ms.StoreMessageInfo(mi)
 }
@@ -433,7 +801,7 @@ func (x *GetLogResponse) String() string {
 func (*GetLogResponse) ProtoMessage() {}
 
 func (x *GetLogResponse) ProtoReflect() protoreflect.Message {
-	mi := &file_paxos_proto_msgTypes[7]
+	mi := &file_paxos_proto_msgTypes[15]
 	if x != nil {
 		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 		if ms.LoadMessageInfo() == nil {
@@ -446,7 +814,7 @@ func (x *GetLogResponse) ProtoReflect() protoreflect.Message {
 
 // Deprecated: Use GetLogResponse.ProtoReflect.Descriptor instead.
 func (*GetLogResponse) Descriptor() ([]byte, []int) {
-	return file_paxos_proto_rawDescGZIP(), []int{7}
+	return file_paxos_proto_rawDescGZIP(), []int{15}
 }
 
 func (x *GetLogResponse) GetLogEntry() []*LogEntry {
@@ -477,17 +845,130 @@ func (x *GetLogResponse) GetSnapshotIndex() int64 {
 	return 0
 }
 
+func (x *GetLogResponse) GetSnapshotCompressed() bool {
+	if x != nil {
+		return x.SnapshotCompressed
+	}
+	return false
+}
+
+type ForwardProposeRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Command       []byte                 `protobuf:"bytes,1,opt,name=command,proto3" json:"command,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *ForwardProposeRequest) Reset() {
+	*x = ForwardProposeRequest{}
+	mi := &file_paxos_proto_msgTypes[16]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *ForwardProposeRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ForwardProposeRequest) ProtoMessage() {}
+
+func (x *ForwardProposeRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_paxos_proto_msgTypes[16]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ForwardProposeRequest.ProtoReflect.Descriptor instead.
+func (*ForwardProposeRequest) Descriptor() ([]byte, []int) {
+	return file_paxos_proto_rawDescGZIP(), []int{16}
+}
+
+func (x *ForwardProposeRequest) GetCommand() []byte {
+	if x != nil {
+		return x.Command
+	}
+	return nil
+}
+
+type ForwardProposeResponse struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	InstanceId    int64                  `protobuf:"varint,1,opt,name=instance_id,json=instanceId,proto3" json:"instance_id,omitempty"`
+	Status        int32                  `protobuf:"varint,2,opt,name=status,proto3" json:"status,omitempty"`
+	Error         string                 `protobuf:"bytes,3,opt,name=error,proto3" json:"error,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *ForwardProposeResponse) Reset() {
+	*x = ForwardProposeResponse{}
+	mi := &file_paxos_proto_msgTypes[17]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *ForwardProposeResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ForwardProposeResponse) ProtoMessage() {}
+
+func (x *ForwardProposeResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_paxos_proto_msgTypes[17]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ForwardProposeResponse.ProtoReflect.Descriptor instead.
+func (*ForwardProposeResponse) Descriptor() ([]byte, []int) {
+	return file_paxos_proto_rawDescGZIP(), []int{17}
+}
+
+func (x *ForwardProposeResponse) GetInstanceId() int64 {
+	if x != nil {
+		return x.InstanceId
+	}
+	return 0
+}
+
+func (x *ForwardProposeResponse) GetStatus() int32 {
+	if x != nil {
+		return x.Status
+	}
+	return 0
+}
+
+func (x *ForwardProposeResponse) GetError() string {
+	if x != nil {
+		return x.Error
+	}
+	return ""
+}
+
 type LogEntry struct {
 	state         protoimpl.MessageState `protogen:"open.v1"`
 	Index         int64                  `protobuf:"varint,1,opt,name=index,proto3" json:"index,omitempty"`
 	Command       []byte                 `protobuf:"bytes,2,opt,name=command,proto3" json:"command,omitempty"`
+	CommittedAt   int64                  `protobuf:"varint,3,opt,name=committed_at,json=committedAt,proto3" json:"committed_at,omitempty"`
+	ApplyError    string                 `protobuf:"bytes,4,opt,name=apply_error,json=applyError,proto3" json:"apply_error,omitempty"`
 	unknownFields protoimpl.UnknownFields
 	sizeCache     protoimpl.SizeCache
 }
 
 func (x *LogEntry) Reset() {
 	*x = LogEntry{}
-	mi := &file_paxos_proto_msgTypes[8]
+	mi := &file_paxos_proto_msgTypes[18]
 	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 	ms.StoreMessageInfo(mi)
 }
@@ -499,7 +980,7 @@ func (x *LogEntry) String() string {
 func (*LogEntry) ProtoMessage() {}
 
 func (x *LogEntry) ProtoReflect() protoreflect.Message {
-	mi := &file_paxos_proto_msgTypes[8]
+	mi := &file_paxos_proto_msgTypes[18]
 	if x != nil {
 		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 		if ms.LoadMessageInfo() == nil {
@@ -512,7 +993,7 @@ func (x *LogEntry) ProtoReflect() protoreflect.Message {
 
 // Deprecated: Use LogEntry.ProtoReflect.Descriptor instead.
 func (*LogEntry) Descriptor() ([]byte, []int) {
-	return file_paxos_proto_rawDescGZIP(), []int{8}
+	return file_paxos_proto_rawDescGZIP(), []int{18}
 }
 
 func (x *LogEntry) GetIndex() int64 {
@@ -529,6 +1010,20 @@ func (x *LogEntry) GetCommand() []byte {
 	return nil
 }
 
+func (x *LogEntry) GetCommittedAt() int64 {
+	if x != nil {
+		return x.CommittedAt
+	}
+	return 0
+}
+
+func (x *LogEntry) GetApplyError() string {
+	if x != nil {
+		return x.ApplyError
+	}
+	return ""
+}
+
 var File_paxos_proto protoreflect.FileDescriptor
 
 const file_paxos_proto_rawDesc = "" +
@@ -554,29 +1049,64 @@ const file_paxos_proto_rawDesc = "" +
 	"\x05round\x18\x01 \x03(\x03R\x05round\x12\x10\n" +
 	"\x03ack\x18\x02 \x01(\bR\x03ack\x12\x1f\n" +
 	"\vinstance_id\x18\x03 \x01(\x03R\n" +
-	"instanceId\"`\n" +
+	"instanceId\"D\n" +
+	"\x12AcceptBatchRequest\x12.\n" +
+	"\aaccepts\x18\x01 \x03(\v2\x14.paxos.AcceptRequestR\aaccepts\"J\n" +
+	"\x13AcceptBatchResponse\x123\n" +
+	"\baccepted\x18\x01 \x03(\v2\x17.paxos.AcceptedResponseR\baccepted\"\x83\x01\n" +
 	"\rCommitRequest\x12\x14\n" +
 	"\x05value\x18\x01 \x01(\x03R\x05value\x12\x1f\n" +
 	"\vinstance_id\x18\x02 \x01(\x03R\n" +
 	"instanceId\x12\x18\n" +
-	"\acommand\x18\x03 \x01(\fR\acommand\"\x10\n" +
-	"\x0eCommitResponse\"6\n" +
+	"\acommand\x18\x03 \x01(\fR\acommand\x12!\n" +
+	"\fcommitted_at\x18\x04 \x01(\x03R\vcommittedAt\"\x10\n" +
+	"\x0eCommitResponse\"\x12\n" +
+	"\x10ReadIndexRequest\">\n" +
+	"\x11ReadIndexResponse\x12)\n" +
+	"\x10highest_accepted\x18\x01 \x01(\x03R\x0fhighestAccepted\"\x14\n" +
+	"\x12CommitIndexRequest\"U\n" +
+	"\x13CommitIndexResponse\x12!\n" +
+	"\fcommit_index\x18\x01 \x01(\x03R\vcommitIndex\x12\x1b\n" +
+	"\tis_leader\x18\x02 \x01(\bR\bisLeader\"\x12\n" +
+	"\x10StateHashRequest\"L\n" +
+	"\x11StateHashResponse\x12\x12\n" +
+	"\x04hash\x18\x01 \x01(\tR\x04hash\x12#\n" +
+	"\rapplied_index\x18\x02 \x01(\x03R\fappliedIndex\"c\n" +
 	"\rGetLogRequest\x12%\n" +
-	"\x0estarting_index\x18\x01 \x01(\x03R\rstartingIndex\"\xad\x01\n" +
+	"\x0estarting_index\x18\x01 \x01(\x03R\rstartingIndex\x12+\n" +
+	"\x11accept_compressed\x18\x02 \x01(\bR\x10acceptCompressed\"\xde\x01\n" +
 	"\x0eGetLogResponse\x12,\n" +
 	"\tlog_entry\x18\x01 \x03(\v2\x0f.paxos.LogEntryR\blogEntry\x12!\n" +
 	"\fcommit_index\x18\x02 \x01(\x03R\vcommitIndex\x12#\n" +
 	"\rsnapshot_data\x18\x03 \x01(\fR\fsnapshotData\x12%\n" +
-	"\x0esnapshot_index\x18\x04 \x01(\x03R\rsnapshotIndex\":\n" +
+	"\x0esnapshot_index\x18\x04 \x01(\x03R\rsnapshotIndex\x12/\n" +
+	"\x13snapshot_compressed\x18\x05 \x01(\bR\x12snapshotCompressed\"1\n" +
+	"\x15ForwardProposeRequest\x12\x18\n" +
+	"\acommand\x18\x01 \x01(\fR\acommand\"g\n" +
+	"\x16ForwardProposeResponse\x12\x1f\n" +
+	"\vinstance_id\x18\x01 \x01(\x03R\n" +
+	"instanceId\x12\x16\n" +
+	"\x06status\x18\x02 \x01(\x05R\x06status\x12\x14\n" +
+	"\x05error\x18\x03 \x01(\tR\x05error\"~\n" +
 	"\bLogEntry\x12\x14\n" +
 	"\x05index\x18\x01 \x01(\x03R\x05index\x12\x18\n" +
-	"\acommand\x18\x02 \x01(\fR\acommand2\xb1\x01\n" +
+	"\acommand\x18\x02 \x01(\fR\acommand\x12!\n" +
+	"\fcommitted_at\x18\x03 \x01(\x03R\vcommittedAt\x12\x1f\n" +
+	"\vapply_error\x18\x04 \x01(\tR\n" +
+	"applyError2\xb7\x02\n" +
 	"\x05Paxos\x128\n" +
 	"\aPrepare\x12\x15.paxos.PrepareRequest\x1a\x16.paxos.PromiseResponse\x127\n" +
-	"\x06Accept\x12\x14.paxos.AcceptRequest\x1a\x17.paxos.AcceptedResponse\x125\n" +
-	"\x06Commit\x12\x14.paxos.CommitRequest\x1a\x15.paxos.CommitResponse2D\n" +
+	"\x06Accept\x12\x14.paxos.AcceptRequest\x1a\x17.paxos.AcceptedResponse\x12D\n" +
+	"\vAcceptBatch\x12\x19.paxos.AcceptBatchRequest\x1a\x1a.paxos.AcceptBatchResponse\x125\n" +
+	"\x06Commit\x12\x14.paxos.CommitRequest\x1a\x15.paxos.CommitResponse\x12>\n" +
+	"\tReadIndex\x12\x17.paxos.ReadIndexRequest\x1a\x18.paxos.ReadIndexResponse2\xd0\x01\n" +
 	"\vLogRecovery\x125\n" +
-	"\x06GetLog\x12\x14.paxos.GetLogRequest\x1a\x15.paxos.GetLogResponseB\x1dZ\x1bds_project/src/server/protob\x06proto3"
+	"\x06GetLog\x12\x14.paxos.GetLogRequest\x1a\x15.paxos.GetLogResponse\x12A\n" +
+	"\fGetStateHash\x12\x17.paxos.StateHashRequest\x1a\x18.paxos.StateHashResponse\x12G\n" +
+	"\x0eGetCommitIndex\x12\x19.paxos.CommitIndexRequest\x1a\x1a.paxos.CommitIndexResponse2[\n" +
+	"\n" +
+	"Forwarding\x12M\n" +
+	"\x0eForwardPropose\x12\x1c.paxos.ForwardProposeRequest\x1a\x1d.paxos.ForwardProposeResponseB\x1dZ\x1bds_project/src/server/protob\x06proto3"
 
 var (
 	file_paxos_proto_rawDescOnce sync.Once
@@ -590,33 +1120,55 @@ func file_paxos_proto_rawDescGZIP() []byte {
 	return file_paxos_proto_rawDescData
 }
 
-var file_paxos_proto_msgTypes = make([]protoimpl.MessageInfo, 9)
+var file_paxos_proto_msgTypes = make([]protoimpl.MessageInfo, 19)
 var file_paxos_proto_goTypes = []any{
-	(*PrepareRequest)(nil),   // 0: paxos.PrepareRequest
-	(*PromiseResponse)(nil),  // 1: paxos.PromiseResponse
-	(*AcceptRequest)(nil),    // 2: paxos.AcceptRequest
-	(*AcceptedResponse)(nil), // 3: paxos.AcceptedResponse
-	(*CommitRequest)(nil),    // 4: paxos.CommitRequest
-	(*CommitResponse)(nil),   // 5: paxos.CommitResponse
-	(*GetLogRequest)(nil),    // 6: paxos.GetLogRequest
-	(*GetLogResponse)(nil),   // 7: paxos.GetLogResponse
-	(*LogEntry)(nil),         // 8: paxos.LogEntry
+	(*PrepareRequest)(nil),         // 0: paxos.PrepareRequest
+	(*PromiseResponse)(nil),        // 1: paxos.PromiseResponse
+	(*AcceptRequest)(nil),          // 2: paxos.AcceptRequest
+	(*AcceptedResponse)(nil),       // 3: paxos.AcceptedResponse
+	(*AcceptBatchRequest)(nil),     // 4: paxos.AcceptBatchRequest
+	(*AcceptBatchResponse)(nil),    // 5: paxos.AcceptBatchResponse
+	(*CommitRequest)(nil),          // 6: paxos.CommitRequest
+	(*CommitResponse)(nil),         // 7: paxos.CommitResponse
+	(*ReadIndexRequest)(nil),       // 8: paxos.ReadIndexRequest
+	(*ReadIndexResponse)(nil),      // 9: paxos.ReadIndexResponse
+	(*CommitIndexRequest)(nil),     // 10: paxos.CommitIndexRequest
+	(*CommitIndexResponse)(nil),    // 11: paxos.CommitIndexResponse
+	(*StateHashRequest)(nil),       // 12: paxos.StateHashRequest
+	(*StateHashResponse)(nil),      // 13: paxos.StateHashResponse
+	(*GetLogRequest)(nil),          // 14: paxos.GetLogRequest
+	(*GetLogResponse)(nil),         // 15: paxos.GetLogResponse
+	(*ForwardProposeRequest)(nil),  // 16: paxos.ForwardProposeRequest
+	(*ForwardProposeResponse)(nil), // 17: paxos.ForwardProposeResponse
+	(*LogEntry)(nil),               // 18: paxos.LogEntry
 }
 var file_paxos_proto_depIdxs = []int32{
-	8, // 0: paxos.GetLogResponse.log_entry:type_name -> paxos.LogEntry
-	0, // 1: paxos.Paxos.Prepare:input_type -> paxos.PrepareRequest
-	2, // 2: paxos.Paxos.Accept:input_type -> paxos.AcceptRequest
-	4, // 3: paxos.Paxos.Commit:input_type -> paxos.CommitRequest
-	6, // 4: paxos.LogRecovery.GetLog:input_type -> paxos.GetLogRequest
-	1, // 5: paxos.Paxos.Prepare:output_type -> paxos.PromiseResponse
-	3, // 6: paxos.Paxos.Accept:output_type -> paxos.AcceptedResponse
-	5, // 7: paxos.Paxos.Commit:output_type -> paxos.CommitResponse
-	7, // 8: paxos.LogRecovery.GetLog:output_type -> paxos.GetLogResponse
-	5, // [5:9] is the sub-list for method output_type
-	1, // [1:5] is the sub-list for method input_type
-	1, // [1:1] is the sub-list for extension type_name
-	1, // [1:1] is the sub-list for extension extendee
-	0, // [0:1] is the sub-list for field type_name
+	2,  // 0: paxos.AcceptBatchRequest.accepts:type_name -> paxos.AcceptRequest
+	3,  // 1: paxos.AcceptBatchResponse.accepted:type_name -> paxos.AcceptedResponse
+	18, // 2: paxos.GetLogResponse.log_entry:type_name -> paxos.LogEntry
+	0,  // 3: paxos.Paxos.Prepare:input_type -> paxos.PrepareRequest
+	2,  // 4: paxos.Paxos.Accept:input_type -> paxos.AcceptRequest
+	4,  // 5: paxos.Paxos.AcceptBatch:input_type -> paxos.AcceptBatchRequest
+	6,  // 6: paxos.Paxos.Commit:input_type -> paxos.CommitRequest
+	8,  // 7: paxos.Paxos.ReadIndex:input_type -> paxos.ReadIndexRequest
+	14, // 8: paxos.LogRecovery.GetLog:input_type -> paxos.GetLogRequest
+	12, // 9: paxos.LogRecovery.GetStateHash:input_type -> paxos.StateHashRequest
+	10, // 10: paxos.LogRecovery.GetCommitIndex:input_type -> paxos.CommitIndexRequest
+	16, // 11: paxos.Forwarding.ForwardPropose:input_type -> paxos.ForwardProposeRequest
+	1,  // 12: paxos.Paxos.Prepare:output_type -> paxos.PromiseResponse
+	3,  // 13: paxos.Paxos.Accept:output_type -> paxos.AcceptedResponse
+	5,  // 14: paxos.Paxos.AcceptBatch:output_type -> paxos.AcceptBatchResponse
+	7,  // 15: paxos.Paxos.Commit:output_type -> paxos.CommitResponse
+	9,  // 16: paxos.Paxos.ReadIndex:output_type -> paxos.ReadIndexResponse
+	15, // 17: paxos.LogRecovery.GetLog:output_type -> paxos.GetLogResponse
+	13, // 18: paxos.LogRecovery.GetStateHash:output_type -> paxos.StateHashResponse
+	11, // 19: paxos.LogRecovery.GetCommitIndex:output_type -> paxos.CommitIndexResponse
+	17, // 20: paxos.Forwarding.ForwardPropose:output_type -> paxos.ForwardProposeResponse
+	12, // [12:21] is the sub-list for method output_type
+	3,  // [3:12] is the sub-list for method input_type
+	3,  // [3:3] is the sub-list for extension type_name
+	3,  // [3:3] is the sub-list for extension extendee
+	0,  // [0:3] is the sub-list for field type_name
 }
 
 func init() { file_paxos_proto_init() }
@@ -630,9 +1182,9 @@ func file_paxos_proto_init() {
 			GoPackagePath: reflect.TypeOf(x{}).PkgPath(),
 			RawDescriptor: unsafe.Slice(unsafe.StringData(file_paxos_proto_rawDesc), len(file_paxos_proto_rawDesc)),
 			NumEnums:      0,
-			NumMessages:   9,
+			NumMessages:   19,
 			NumExtensions: 0,
-			NumServices:   2,
+			NumServices:   3,
 		},
 		GoTypes:           file_paxos_proto_goTypes,
 		DependencyIndexes: file_paxos_proto_depIdxs,
@@ -19,9 +19,11 @@ import (
 const _ = grpc.SupportPackageIsVersion9
 
 const (
-	Paxos_Prepare_FullMethodName = "/paxos.Paxos/Prepare"
-	Paxos_Accept_FullMethodName  = "/paxos.Paxos/Accept"
-	Paxos_Commit_FullMethodName  = "/paxos.Paxos/Commit"
+	Paxos_Prepare_FullMethodName     = "/paxos.Paxos/Prepare"
+	Paxos_Accept_FullMethodName      = "/paxos.Paxos/Accept"
+	Paxos_AcceptBatch_FullMethodName = "/paxos.Paxos/AcceptBatch"
+	Paxos_Commit_FullMethodName      = "/paxos.Paxos/Commit"
+	Paxos_ReadIndex_FullMethodName   = "/paxos.Paxos/ReadIndex"
 )
 
 // PaxosClient is the client API for Paxos service.
@@ -30,7 +32,9 @@ const (
 type PaxosClient interface {
 	Prepare(ctx context.Context, in *PrepareRequest, opts ...grpc.CallOption) (*PromiseResponse, error)
 	Accept(ctx context.Context, in *AcceptRequest, opts ...grpc.CallOption) (*AcceptedResponse, error)
+	AcceptBatch(ctx context.Context, in *AcceptBatchRequest, opts ...grpc.CallOption) (*AcceptBatchResponse, error)
 	Commit(ctx context.Context, in *CommitRequest, opts ...grpc.CallOption) (*CommitResponse, error)
+	ReadIndex(ctx context.Context, in *ReadIndexRequest, opts ...grpc.CallOption) (*ReadIndexResponse, error)
 }
 
 type paxosClient struct {
@@ -61,6 +65,16 @@ func (c *paxosClient) Accept(ctx context.Context, in *AcceptRequest, opts ...grp
 	return out, nil
 }
 
+func (c *paxosClient) AcceptBatch(ctx context.Context, in *AcceptBatchRequest, opts ...grpc.CallOption) (*AcceptBatchResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(AcceptBatchResponse)
+	err := c.cc.Invoke(ctx, Paxos_AcceptBatch_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
 func (c *paxosClient) Commit(ctx context.Context, in *CommitRequest, opts ...grpc.CallOption) (*CommitResponse, error) {
 	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
 	out := new(CommitResponse)
@@ -71,13 +85,25 @@ func (c *paxosClient) Commit(ctx context.Context, in *CommitRequest, opts ...grp
 	return out, nil
 }
 
+func (c *paxosClient) ReadIndex(ctx context.Context, in *ReadIndexRequest, opts ...grpc.CallOption) (*ReadIndexResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(ReadIndexResponse)
+	err := c.cc.Invoke(ctx, Paxos_ReadIndex_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
 // PaxosServer is the server API for Paxos service.
 // All implementations must embed UnimplementedPaxosServer
 // for forward compatibility.
 type PaxosServer interface {
 	Prepare(context.Context, *PrepareRequest) (*PromiseResponse, error)
 	Accept(context.Context, *AcceptRequest) (*AcceptedResponse, error)
+	AcceptBatch(context.Context, *AcceptBatchRequest) (*AcceptBatchResponse, error)
 	Commit(context.Context, *CommitRequest) (*CommitResponse, error)
+	ReadIndex(context.Context, *ReadIndexRequest) (*ReadIndexResponse, error)
 	mustEmbedUnimplementedPaxosServer()
 }
 
@@ -94,9 +120,15 @@ func (UnimplementedPaxosServer) Prepare(context.Context, *PrepareRequest) (*Prom
 func (UnimplementedPaxosServer) Accept(context.Context, *AcceptRequest) (*AcceptedResponse, error) {
 	return nil, status.Error(codes.Unimplemented, "method Accept not implemented")
 }
+func (UnimplementedPaxosServer) AcceptBatch(context.Context, *AcceptBatchRequest) (*AcceptBatchResponse, error) {
+	return nil, status.Error(codes.Unimplemented, "method AcceptBatch not implemented")
+}
 func (UnimplementedPaxosServer) Commit(context.Context, *CommitRequest) (*CommitResponse, error) {
 	return nil, status.Error(codes.Unimplemented, "method Commit not implemented")
 }
+func (UnimplementedPaxosServer) ReadIndex(context.Context, *ReadIndexRequest) (*ReadIndexResponse, error) {
+	return nil, status.Error(codes.Unimplemented, "method ReadIndex not implemented")
+}
 func (UnimplementedPaxosServer) mustEmbedUnimplementedPaxosServer() {}
 func (UnimplementedPaxosServer) testEmbeddedByValue()               {}
 
@@ -154,6 +186,24 @@ func _Paxos_Accept_Handler(srv interface{}, ctx context.Context, dec func(interf
 	return interceptor(ctx, in, info, handler)
 }
 
+func _Paxos_AcceptBatch_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(AcceptBatchRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(PaxosServer).AcceptBatch(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Paxos_AcceptBatch_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(PaxosServer).AcceptBatch(ctx, req.(*AcceptBatchRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
 func _Paxos_Commit_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
 	in := new(CommitRequest)
 	if err := dec(in); err != nil {
@@ -172,6 +222,24 @@ func _Paxos_Commit_Handler(srv interface{}, ctx context.Context, dec func(interf
 	return interceptor(ctx, in, info, handler)
 }
 
+func _Paxos_ReadIndex_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ReadIndexRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(PaxosServer).ReadIndex(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Paxos_ReadIndex_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(PaxosServer).ReadIndex(ctx, req.(*ReadIndexRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
 // Paxos_ServiceDesc is the grpc.ServiceDesc for Paxos service.
 // It's only intended for direct use with grpc.RegisterService,
 // and not to be introspected or modified (even as a copy)
@@ -187,17 +255,27 @@ var Paxos_ServiceDesc = grpc.ServiceDesc{
 			MethodName: "Accept",
 			Handler:    _Paxos_Accept_Handler,
 		},
+		{
+			MethodName: "AcceptBatch",
+			Handler:    _Paxos_AcceptBatch_Handler,
+		},
 		{
 			MethodName: "Commit",
 			Handler:    _Paxos_Commit_Handler,
 		},
+		{
+			MethodName: "ReadIndex",
+			Handler:    _Paxos_ReadIndex_Handler,
+		},
 	},
 	Streams:  []grpc.StreamDesc{},
 	Metadata: "paxos.proto",
 }
 
 const (
-	LogRecovery_GetLog_FullMethodName = "/paxos.LogRecovery/GetLog"
+	LogRecovery_GetLog_FullMethodName         = "/paxos.LogRecovery/GetLog"
+	LogRecovery_GetStateHash_FullMethodName   = "/paxos.LogRecovery/GetStateHash"
+	LogRecovery_GetCommitIndex_FullMethodName = "/paxos.LogRecovery/GetCommitIndex"
 )
 
 // LogRecoveryClient is the client API for LogRecovery service.
@@ -205,6 +283,8 @@ const (
 // For semantics around ctx use and closing/ending streaming RPCs, please refer to https://pkg.go.dev/google.golang.org/grpc/?tab=doc#ClientConn.NewStream.
 type LogRecoveryClient interface {
 	GetLog(ctx context.Context, in *GetLogRequest, opts ...grpc.CallOption) (*GetLogResponse, error)
+	GetStateHash(ctx context.Context, in *StateHashRequest, opts ...grpc.CallOption) (*StateHashResponse, error)
+	GetCommitIndex(ctx context.Context, in *CommitIndexRequest, opts ...grpc.CallOption) (*CommitIndexResponse, error)
 }
 
 type logRecoveryClient struct {
@@ -225,11 +305,33 @@ func (c *logRecoveryClient) GetLog(ctx context.Context, in *GetLogRequest, opts
 	return out, nil
 }
 
+func (c *logRecoveryClient) GetStateHash(ctx context.Context, in *StateHashRequest, opts ...grpc.CallOption) (*StateHashResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(StateHashResponse)
+	err := c.cc.Invoke(ctx, LogRecovery_GetStateHash_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *logRecoveryClient) GetCommitIndex(ctx context.Context, in *CommitIndexRequest, opts ...grpc.CallOption) (*CommitIndexResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(CommitIndexResponse)
+	err := c.cc.Invoke(ctx, LogRecovery_GetCommitIndex_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
 // LogRecoveryServer is the server API for LogRecovery service.
 // All implementations must embed UnimplementedLogRecoveryServer
 // for forward compatibility.
 type LogRecoveryServer interface {
 	GetLog(context.Context, *GetLogRequest) (*GetLogResponse, error)
+	GetStateHash(context.Context, *StateHashRequest) (*StateHashResponse, error)
+	GetCommitIndex(context.Context, *CommitIndexRequest) (*CommitIndexResponse, error)
 	mustEmbedUnimplementedLogRecoveryServer()
 }
 
@@ -243,6 +345,12 @@ type UnimplementedLogRecoveryServer struct{}
 func (UnimplementedLogRecoveryServer) GetLog(context.Context, *GetLogRequest) (*GetLogResponse, error) {
 	return nil, status.Error(codes.Unimplemented, "method GetLog not implemented")
 }
+func (UnimplementedLogRecoveryServer) GetStateHash(context.Context, *StateHashRequest) (*StateHashResponse, error) {
+	return nil, status.Error(codes.Unimplemented, "method GetStateHash not implemented")
+}
+func (UnimplementedLogRecoveryServer) GetCommitIndex(context.Context, *CommitIndexRequest) (*CommitIndexResponse, error) {
+	return nil, status.Error(codes.Unimplemented, "method GetCommitIndex not implemented")
+}
 func (UnimplementedLogRecoveryServer) mustEmbedUnimplementedLogRecoveryServer() {}
 func (UnimplementedLogRecoveryServer) testEmbeddedByValue()                     {}
 
@@ -282,6 +390,42 @@ func _LogRecovery_GetLog_Handler(srv interface{}, ctx context.Context, dec func(
 	return interceptor(ctx, in, info, handler)
 }
 
+func _LogRecovery_GetStateHash_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(StateHashRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(LogRecoveryServer).GetStateHash(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: LogRecovery_GetStateHash_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(LogRecoveryServer).GetStateHash(ctx, req.(*StateHashRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _LogRecovery_GetCommitIndex_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(CommitIndexRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(LogRecoveryServer).GetCommitIndex(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: LogRecovery_GetCommitIndex_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(LogRecoveryServer).GetCommitIndex(ctx, req.(*CommitIndexRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
 // LogRecovery_ServiceDesc is the grpc.ServiceDesc for LogRecovery service.
 // It's only intended for direct use with grpc.RegisterService,
 // and not to be introspected or modified (even as a copy)
@@ -293,6 +437,116 @@ var LogRecovery_ServiceDesc = grpc.ServiceDesc{
 			MethodName: "GetLog",
 			Handler:    _LogRecovery_GetLog_Handler,
 		},
+		{
+			MethodName: "GetStateHash",
+			Handler:    _LogRecovery_GetStateHash_Handler,
+		},
+		{
+			MethodName: "GetCommitIndex",
+			Handler:    _LogRecovery_GetCommitIndex_Handler,
+		},
+	},
+	Streams:  []grpc.StreamDesc{},
+	Metadata: "paxos.proto",
+}
+
+const (
+	Forwarding_ForwardPropose_FullMethodName = "/paxos.Forwarding/ForwardPropose"
+)
+
+// ForwardingClient is the client API for Forwarding service.
+//
+// For semantics around ctx use and closing/ending streaming RPCs, please refer to https://pkg.go.dev/google.golang.org/grpc/?tab=doc#ClientConn.NewStream.
+type ForwardingClient interface {
+	ForwardPropose(ctx context.Context, in *ForwardProposeRequest, opts ...grpc.CallOption) (*ForwardProposeResponse, error)
+}
+
+type forwardingClient struct {
+	cc grpc.ClientConnInterface
+}
+
+func NewForwardingClient(cc grpc.ClientConnInterface) ForwardingClient {
+	return &forwardingClient{cc}
+}
+
+func (c *forwardingClient) ForwardPropose(ctx context.Context, in *ForwardProposeRequest, opts ...grpc.CallOption) (*ForwardProposeResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(ForwardProposeResponse)
+	err := c.cc.Invoke(ctx, Forwarding_ForwardPropose_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// ForwardingServer is the server API for Forwarding service.
+// All implementations must embed UnimplementedForwardingServer
+// for forward compatibility.
+type ForwardingServer interface {
+	ForwardPropose(context.Context, *ForwardProposeRequest) (*ForwardProposeResponse, error)
+	mustEmbedUnimplementedForwardingServer()
+}
+
+// UnimplementedForwardingServer must be embedded to have
+// forward compatible implementations.
+//
+// NOTE: this should be embedded by value instead of pointer to avoid a nil
+// pointer dereference when methods are called.
+type UnimplementedForwardingServer struct{}
+
+func (UnimplementedForwardingServer) ForwardPropose(context.Context, *ForwardProposeRequest) (*ForwardProposeResponse, error) {
+	return nil, status.Error(codes.Unimplemented, "method ForwardPropose not implemented")
+}
+func (UnimplementedForwardingServer) mustEmbedUnimplementedForwardingServer() {}
+func (UnimplementedForwardingServer) testEmbeddedByValue()                    {}
+
+// UnsafeForwardingServer may be embedded to opt out of forward compatibility for this service.
+// Use of this interface is not recommended, as added methods to ForwardingServer will
+// result in compilation errors.
+type UnsafeForwardingServer interface {
+	mustEmbedUnimplementedForwardingServer()
+}
+
+func RegisterForwardingServer(s grpc.ServiceRegistrar, srv ForwardingServer) {
+	// If the following call panics, it indicates UnimplementedForwardingServer was
+	// embedded by pointer and is nil.  This will cause panics if an
+	// unimplemented method is ever invoked, so we test this at initialization
+	// time to prevent it from happening at runtime later due to I/O.
+	if t, ok := srv.(interface{ testEmbeddedByValue() }); ok {
+		t.testEmbeddedByValue()
+	}
+	s.RegisterService(&Forwarding_ServiceDesc, srv)
+}
+
+func _Forwarding_ForwardPropose_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ForwardProposeRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(ForwardingServer).ForwardPropose(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Forwarding_ForwardPropose_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(ForwardingServer).ForwardPropose(ctx, req.(*ForwardProposeRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+// Forwarding_ServiceDesc is the grpc.ServiceDesc for Forwarding service.
+// It's only intended for direct use with grpc.RegisterService,
+// and not to be introspected or modified (even as a copy)
+var Forwarding_ServiceDesc = grpc.ServiceDesc{
+	ServiceName: "paxos.Forwarding",
+	HandlerType: (*ForwardingServer)(nil),
+	Methods: []grpc.MethodDesc{
+		{
+			MethodName: "ForwardPropose",
+			Handler:    _Forwarding_ForwardPropose_Handler,
+		},
 	},
 	Streams:  []grpc.StreamDesc{},
 	Metadata: "paxos.proto",
@@ -0,0 +1,91 @@
+package recovery
+
+import (
+	"bytes"
+	"context"
+	"testing"
+
+	pb "ds_project/src/server/proto"
+)
+
+func TestCompressedSnapshotRoundTrip(t *testing.T) {
+	peer, peerLog := machineAt(t, "peer", 500)
+	if err := peer.TakeSnapshot(500); err != nil {
+		t.Fatal(err)
+	}
+	peerLog.Store(500)
+	snapshot, _ := peer.GetSnapshot()
+	server := NewLogRecovery(peer, peerLog)
+
+	compressed, err := server.GetLog(context.Background(), &pb.GetLogRequest{StartingIndex: 0, AcceptCompressed: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !compressed.SnapshotCompressed || len(compressed.SnapshotData) >= len(snapshot) {
+		t.Fatalf("expected a smaller compressed snapshot, got %d bytes from %d (compressed: %v)", len(compressed.SnapshotData), len(snapshot), compressed.SnapshotCompressed)
+	}
+	decompressed, err := decompressSnapshot(compressed.SnapshotData)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(decompressed, snapshot) {
+		t.Fatal("the decompressed snapshot differs from the original")
+	}
+
+	// Recovering nodes that don't ask for compression get it as before
+	raw, err := server.GetLog(context.Background(), &pb.GetLogRequest{StartingIndex: 0})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if raw.SnapshotCompressed || !bytes.Equal(raw.SnapshotData, snapshot) {
+		t.Fatal("expected the raw snapshot without AcceptCompressed")
+	}
+
+	// Installing the compressed response ends in the peer's state
+	sm, localLog := machineAt(t, "local", 0)
+	if _, err := NewRecoverer(nil, sm, sm, localLog).install("peer", compressed); err != nil {
+		t.Fatal(err)
+	}
+	want, _, _ := peer.StateHash()
+	got, _, _ := sm.StateHash()
+	if got != want {
+		t.Fatal("the node recovered from a compressed snapshot doesn't match the peer")
+	}
+}
+
+func TestDecompressRejectsCorruptSnapshot(t *testing.T) {
+	compressed, err := compressSnapshot([]byte(`{"version":4,"data":{}}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	compressed[len(compressed)/2] ^= 0xff
+	if _, err := decompressSnapshot(compressed); err == nil {
+		t.Fatal("expected a corrupted snapshot to fail to decompress")
+	}
+	if _, err := decompressSnapshot([]byte("not gzip")); err == nil {
+		t.Fatal("expected uncompressed data to fail to decompress")
+	}
+}
+
+// BenchmarkCompressSnapshot reports how much gzip saves on a snapshot of
+// 5000 scooters, as the ratio of compressed to raw size
+func BenchmarkCompressSnapshot(b *testing.B) {
+	sm, _ := machineAt(b, "scooter", 5000)
+	if err := sm.TakeSnapshot(5000); err != nil {
+		b.Fatal(err)
+	}
+	snapshot, _ := sm.GetSnapshot()
+
+	var compressed []byte
+	b.SetBytes(int64(len(snapshot)))
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		var err error
+		if compressed, err = compressSnapshot(snapshot); err != nil {
+			b.Fatal(err)
+		}
+	}
+	b.ReportMetric(float64(len(snapshot)), "raw-bytes")
+	b.ReportMetric(float64(len(compressed)), "gzip-bytes")
+	b.ReportMetric(float64(len(compressed))/float64(len(snapshot)), "ratio")
+}
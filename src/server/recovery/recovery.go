@@ -2,13 +2,16 @@ package recovery
 
 import (
 	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"sync/atomic"
 	"time"
 
-	"google.golang.org/grpc"
-	"google.golang.org/grpc/credentials/insecure"
-
 	pb "ds_project/src/server/proto"
+	"ds_project/src/server/connections"
 	"ds_project/src/server/log"
+	"ds_project/src/server/membership"
 	"ds_project/src/server/statemachine"
 )
 
@@ -16,6 +19,7 @@ type LogRecovery struct {
 	pb.UnimplementedLogRecoveryServer
 	stateMachine *statemachine.ScooterStateMachine
 	log          *log.ReplicatedLog
+	leader       *atomic.Bool
 }
 
 func NewLogRecovery(stateMachine *statemachine.ScooterStateMachine, log *log.ReplicatedLog) *LogRecovery {
@@ -25,9 +29,33 @@ func NewLogRecovery(stateMachine *statemachine.ScooterStateMachine, log *log.Rep
 	}
 }
 
+// ErrCompacted is returned by GetLog when the entries a recovering node asks
+// for are compacted away and no snapshot here covers them. Serving the rest
+// would leave it with a gap, so it has to recover from another peer.
+type ErrCompacted struct {
+	StartingIndex int64
+	StoredIndex   int64
+	SnapshotIndex int64
+}
+
+func (e *ErrCompacted) Error() string {
+	return fmt.Sprintf("entries from %d are compacted up to %d and the snapshot only covers up to %d", e.StartingIndex, e.StoredIndex, e.SnapshotIndex)
+}
+
+// GetLog returns the snapshot and the entries after it. When the requested
+// start is compacted the snapshot is what covers it, so it must reach at
+// least up to the first entry still stored.
 func (r *LogRecovery) GetLog(ctx context.Context, req *pb.GetLogRequest) (*pb.GetLogResponse, error) {
 	snapshotData, snapshotIndex := r.stateMachine.GetSnapshot()
 
+	covered := snapshotIndex
+	if len(snapshotData) == 0 {
+		covered = -1
+	}
+	if storedIndex := r.log.GetStoredIndex(); req.StartingIndex < storedIndex && covered < storedIndex-1 {
+		return nil, &ErrCompacted{StartingIndex: req.StartingIndex, StoredIndex: storedIndex, SnapshotIndex: covered}
+	}
+
 	startIndex := req.StartingIndex
 	if startIndex < snapshotIndex {
 		startIndex = snapshotIndex + 1
@@ -36,62 +64,295 @@ func (r *LogRecovery) GetLog(ctx context.Context, req *pb.GetLogRequest) (*pb.Ge
 
 	entries := make([]*pb.LogEntry, 0)
 
-	for i := startIndex; i < r.log.GetNextIndex(); i++ {
+	nextIndex := r.log.PeekNextIndex()
+	for i := startIndex; i < nextIndex; i++ {
 		entry := r.log.GetEntry(i)
 		if entry != nil {
 			entries = append(entries, &pb.LogEntry{
 				Index:   entry.Index,
 				Command: entry.Command,
+				CommittedAt: entry.CommittedAt,
+				ApplyError: entry.ApplyError,
 			})
 		}
 	}
+	compressed := false
+	if req.AcceptCompressed && len(snapshotData) > 0 {
+		data, err := compressSnapshot(snapshotData)
+		if err != nil {
+			return nil, err
+		}
+		snapshotData = data
+		compressed = true
+	}
+
 	return &pb.GetLogResponse{
 		LogEntry:    entries,
 		CommitIndex: r.log.GetCommitIndex(),
 		SnapshotData: snapshotData,
 		SnapshotIndex: snapshotIndex,
+		SnapshotCompressed: compressed,
 	}, nil
 }
 
-func Recover(servers []string, stateMachine *statemachine.ScooterStateMachine, log *log.ReplicatedLog) error {
-	for _, server := range servers {
-		conn, err := grpc.Dial(server, grpc.WithTransportCredentials(insecure.NewCredentials()))
-		if err != nil {
-			continue
+func (r *LogRecovery) GetStateHash(ctx context.Context, req *pb.StateHashRequest) (*pb.StateHashResponse, error) {
+	hash, appliedIndex, err := r.stateMachine.StateHash()
+	if err != nil {
+		return nil, err
+	}
+	return &pb.StateHashResponse{
+		Hash:         hash,
+		AppliedIndex: appliedIndex,
+	}, nil
+}
+
+// ErrApplyDiverged is returned when recovered entries applied differently
+// here than on the peer they came from: a command the peer applied failed
+// here, or the other way round. Either means this node's state no longer
+// matches the peer's.
+type ErrApplyDiverged struct {
+	Peer     string
+	Failures map[int64]error
+}
+
+// Indices returns the diverged indices in log order
+func (e *ErrApplyDiverged) Indices() []int64 {
+	indices := make([]int64, 0, len(e.Failures))
+	for index := range e.Failures {
+		indices = append(indices, index)
+	}
+	sort.Slice(indices, func(i, j int) bool { return indices[i] < indices[j] })
+	return indices
+}
+
+func (e *ErrApplyDiverged) Error() string {
+	indices := e.Indices()
+	return fmt.Sprintf("%d entries recovered from %s applied differently than on the peer, first at index %d: %v", len(indices), e.Peer, indices[0], e.Failures[indices[0]])
+}
+
+// CommitPauser lets recovery install state without racing live commits
+type CommitPauser interface {
+	PauseCommits(fn func())
+}
+
+// MemberSource is the cluster membership recovery checks an empty server
+// list against
+type MemberSource interface {
+	Sync(ctx context.Context) error
+	GetMembers() []membership.Member
+}
+
+type Recoverer struct {
+	conns        *connections.Manager
+	stateMachine *statemachine.ScooterStateMachine
+	applier      statemachine.StateMachine
+	log          *log.ReplicatedLog
+	pauser       CommitPauser
+	members      MemberSource
+	self         string
+	strategy     Strategy
+	// picked is the server the Freshest strategy last put first
+	picked string
+}
+
+func NewRecoverer(conns *connections.Manager, stateMachine *statemachine.ScooterStateMachine, applier statemachine.StateMachine, log *log.ReplicatedLog) *Recoverer {
+	return &Recoverer{
+		conns:        conns,
+		stateMachine: stateMachine,
+		applier:      applier,
+		log:          log,
+	}
+}
+
+func (r *Recoverer) SetCommitPauser(pauser CommitPauser) {
+	r.pauser = pauser
+}
+
+// SetMembership lets Recover warn when it's given no servers although other
+// members are registered. self is this node's address, which doesn't count.
+func (r *Recoverer) SetMembership(members MemberSource, self string) {
+	r.members = members
+	r.self = self
+}
+
+func (r *Recoverer) Recover(servers []string) error {
+	if len(servers) == 0 {
+		r.warnIfMembersExist()
+	}
+	for _, server := range r.order(servers) {
+		_, err := r.RecoverFrom(server)
+		if err == nil {
+			return nil
+		}
+		// The entries are installed by now, so another peer can't redo them
+		var diverged *ErrApplyDiverged
+		if errors.As(err, &diverged) {
+			return err
+		}
+	}
+	return nil
+}
+
+// warnIfMembersExist flags a node started without -servers in a cluster
+// that has other members: it would come up empty instead of catching up.
+func (r *Recoverer) warnIfMembersExist() {
+	if r.members == nil {
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := r.members.Sync(ctx); err != nil {
+		fmt.Printf("Recovery has no servers and membership couldn't be read: %v\n", err)
+		return
+	}
+
+	var others []string
+	for _, member := range r.members.GetMembers() {
+		if member.Address != r.self {
+			others = append(others, member.Address)
 		}
-		defer conn.Close()
+	}
+	if len(others) > 0 {
+		fmt.Printf("WARNING: recovery has no servers to catch up from, but membership lists %v. Starting with empty state; check -servers, or start with -peersfrommembership to take peers from membership\n", others)
+	}
+}
 
-		client := pb.NewLogRecoveryClient(conn)
-		ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
-		defer cancel()
+// Follow recovers from servers every interval until ctx is done. A
+// read-only replica relies on it to pick up whatever commits it missed.
+func (r *Recoverer) Follow(ctx context.Context, servers []string, interval time.Duration) {
+	// Startup recovery has already warned if that was a mistake
+	if len(servers) == 0 {
+		return
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
 
-		request := &pb.GetLogRequest{
-			StartingIndex: log.GetNextIndex(),
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := r.Recover(servers); err != nil {
+				fmt.Printf("Following the log failed: %v\n", err)
+			}
 		}
-		response, err := client.GetLog(ctx, request)
+	}
+}
+
+// RecoverFrom catches this node up from a single peer and returns how many
+// log entries were applied. Commits are paused while the fetched state is
+// installed so it can't interleave with entries arriving through Paxos.
+func (r *Recoverer) RecoverFrom(server string) (int, error) {
+	response, err := r.fetch(server)
+	if err != nil {
+		return 0, err
+	}
+
+	if r.pauser == nil {
+		return r.install(server, response)
+	}
+
+	var applied int
+	r.pauser.PauseCommits(func() {
+		applied, err = r.install(server, response)
+	})
+	return applied, err
+}
+
+func (r *Recoverer) fetch(server string) (*pb.GetLogResponse, error) {
+	conn, err := r.conns.Get(server)
+	if err != nil {
+		return nil, err
+	}
+
+	client := pb.NewLogRecoveryClient(conn)
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+	defer cancel()
+
+	// From the first entry not applied here, so gaps below entries that
+	// were committed out of order are fetched too
+	request := &pb.GetLogRequest{
+		StartingIndex: r.stateMachine.AppliedIndex() + 1,
+		AcceptCompressed: true,
+	}
+	return client.GetLog(ctx, request)
+}
+
+func (r *Recoverer) install(server string, response *pb.GetLogResponse) (int, error) {
+	// Only a snapshot past everything this node has applied moves it
+	// forward; anything older would roll its state back. Entries committed
+	// here but not applied yet don't count, the snapshot covers them, and
+	// neither do indexes only allocated here, they may never be decided.
+	current := r.stateMachine.AppliedIndex()
+	if len(response.SnapshotData) > 0 && response.SnapshotIndex <= current {
+		fmt.Printf("Recovery from %s: not installing snapshot at %d, this node is already at %d\n", server, response.SnapshotIndex, current)
+	}
+	if len(response.SnapshotData) > 0 && response.SnapshotIndex > current {
+		snapshotData := response.SnapshotData
+		if response.SnapshotCompressed {
+			data, err := decompressSnapshot(snapshotData)
+			if err != nil {
+				return 0, err
+			}
+			snapshotData = data
+		}
+
+		err := r.stateMachine.LoadSnapshot(snapshotData, response.SnapshotIndex)
 		if err != nil {
+			return 0, err
+		}
+		// Update all log indices to reflect snapshot state
+		r.log.SetStoredIndex(response.SnapshotIndex)
+		r.log.SetCommitIndex(response.SnapshotIndex)
+		// Proposals may still be running on indexes allocated past it
+		r.log.SetNextIndex(max(response.SnapshotIndex+1, r.log.PeekNextIndex()))
+	}
+
+	// Apply log entries after the snapshot in index order, stopping at the
+	// first one the peer is missing too: applying past it would run later
+	// commands before it. A command the peer also rejected is expected to
+	// fail again; any other difference in outcome is divergence.
+	failures := make(map[int64]error)
+	applied := 0
+	next := r.stateMachine.AppliedIndex() + 1
+	for _, entry := range response.LogEntry {
+		if entry.Index < next {
+			continue
+		}
+		for entry.Index > next && r.stateMachine.IsApplied(next) {
+			next++
+		}
+		if entry.Index > next {
+			break
+		}
+		next++
+		// Applied here already, past a gap this entry's predecessors filled
+		if r.stateMachine.IsApplied(entry.Index) {
 			continue
 		}
+		applied++
+		r.log.Append(entry.Index, entry.Command, entry.CommittedAt)
+		_, err := r.applier.Apply(entry.Index, entry.Command)
+		r.log.SetApplyError(entry.Index, err)
 
-		// Load snapshot if available and we're behind
-		if len(response.SnapshotData) > 0 && response.SnapshotIndex >= log.GetNextIndex() {
-			err := stateMachine.LoadSnapshot(response.SnapshotData, response.SnapshotIndex)
-			if err != nil {
-				continue
-			}
-			// Update all log indices to reflect snapshot state
-			log.SetStoredIndex(response.SnapshotIndex)
-			log.SetCommitIndex(response.SnapshotIndex)
-			log.SetNextIndex(response.SnapshotIndex + 1)
+		switch {
+		case err != nil && entry.ApplyError == "":
+			failures[entry.Index] = err
+		case err == nil && entry.ApplyError != "":
+			failures[entry.Index] = fmt.Errorf("applied here but rejected on the peer: %s", entry.ApplyError)
 		}
+	}
 
-		// Apply log entries after the snapshot
-		for _, entry := range response.LogEntry {
-			log.Append(entry.Index, entry.Command)
-			stateMachine.Apply(entry.Command)
+	if len(failures) > 0 {
+		diverged := &ErrApplyDiverged{Peer: server, Failures: failures}
+		for _, index := range diverged.Indices() {
+			fmt.Printf("Recovery from %s: entry %d did not apply as on the peer: %v\n", server, index, failures[index])
 		}
-		log.SetCommitIndex(response.CommitIndex)
-		return nil
+		return applied, diverged
 	}
-	return nil
+
+	if response.CommitIndex > r.log.GetCommitIndex() {
+		r.log.SetCommitIndex(response.CommitIndex)
+	}
+	return applied, nil
 }
@@ -0,0 +1,171 @@
+package recovery
+
+import (
+	"encoding/json"
+	"fmt"
+	"testing"
+
+	"ds_project/src/server/log"
+	pb "ds_project/src/server/proto"
+	"ds_project/src/server/statemachine"
+)
+
+// machineAt returns a state machine that has applied a Noop at index 0
+// and creates for prefix-1 to prefix-count at indexes 1 to count, and a log
+// holding them
+func machineAt(t testing.TB, prefix string, count int) (*statemachine.ScooterStateMachine, *log.ReplicatedLog) {
+	t.Helper()
+	sm := statemachine.NewScooterStateMachine()
+	replicatedLog := log.NewReplicatedLog()
+	for i := 0; i <= count; i++ {
+		cmd := statemachine.ScooterCommand{CommandType: statemachine.Create, ScooterID: fmt.Sprintf("%s-%d", prefix, i)}
+		if i == 0 {
+			cmd = statemachine.ScooterCommand{CommandType: statemachine.Noop}
+		}
+		command, err := json.Marshal(cmd)
+		if err != nil {
+			t.Fatal(err)
+		}
+		index := int64(i)
+		replicatedLog.Append(index, command, 0)
+		if _, err := sm.Apply(index, command); err != nil {
+			t.Fatal(err)
+		}
+		replicatedLog.SetCommitIndex(index)
+	}
+	replicatedLog.SetNextIndex(int64(count) + 1)
+	return sm, replicatedLog
+}
+
+// snapshotAt is a GetLog response carrying the peer's snapshot at index
+func snapshotAt(t *testing.T, index int) *pb.GetLogResponse {
+	t.Helper()
+	peer, _ := machineAt(t, "peer", index)
+	if err := peer.TakeSnapshot(int64(index)); err != nil {
+		t.Fatal(err)
+	}
+	data, snapshotIndex := peer.GetSnapshot()
+	return &pb.GetLogResponse{SnapshotData: data, SnapshotIndex: snapshotIndex, CommitIndex: snapshotIndex}
+}
+
+func TestInstallRefusesOlderSnapshot(t *testing.T) {
+	sm, replicatedLog := machineAt(t, "local", 7)
+	r := NewRecoverer(nil, sm, sm, replicatedLog)
+
+	if _, err := r.install("peer", snapshotAt(t, 5)); err != nil {
+		t.Fatal(err)
+	}
+	if _, exists := sm.GetScooter("local-7"); !exists {
+		t.Fatal("an older snapshot rolled back a scooter created after it")
+	}
+	if _, exists := sm.GetScooter("peer-1"); exists {
+		t.Fatal("an older snapshot was installed")
+	}
+	if applied := sm.AppliedIndex(); applied != 7 {
+		t.Fatalf("expected applied index to stay at 7, got %d", applied)
+	}
+}
+
+func TestInstallTakesNewerSnapshotDespiteAllocatedIndexes(t *testing.T) {
+	sm, replicatedLog := machineAt(t, "local", 2)
+	// Proposals that never committed here allocated indexes past the
+	// snapshot, which mustn't make it look like this node is ahead
+	for i := 0; i < 8; i++ {
+		if _, err := replicatedLog.AllocateIndex(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	nextIndex := replicatedLog.PeekNextIndex()
+	r := NewRecoverer(nil, sm, sm, replicatedLog)
+
+	if _, err := r.install("peer", snapshotAt(t, 5)); err != nil {
+		t.Fatal(err)
+	}
+	if _, exists := sm.GetScooter("peer-5"); !exists {
+		t.Fatal("the newer snapshot wasn't installed")
+	}
+	if applied := sm.AppliedIndex(); applied != 5 {
+		t.Fatalf("expected applied index 5, got %d", applied)
+	}
+	if commitIndex := replicatedLog.GetCommitIndex(); commitIndex != 5 {
+		t.Fatalf("expected commit index 5, got %d", commitIndex)
+	}
+	if next := replicatedLog.PeekNextIndex(); next != nextIndex {
+		t.Fatalf("expected next index to stay at %d, got %d", nextIndex, next)
+	}
+}
+
+// entriesFrom is a GetLog response carrying commands at the given indexes
+func entriesFrom(commands map[int64][]byte) *pb.GetLogResponse {
+	response := &pb.GetLogResponse{CommitIndex: -1}
+	for index := int64(0); len(response.LogEntry) < len(commands); index++ {
+		if command, exists := commands[index]; exists {
+			response.LogEntry = append(response.LogEntry, &pb.LogEntry{Index: index, Command: command})
+			response.CommitIndex = index
+		}
+	}
+	return response
+}
+
+func command(t *testing.T, cmd statemachine.ScooterCommand) []byte {
+	t.Helper()
+	data, err := json.Marshal(cmd)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return data
+}
+
+// An entry committed here out of order, past a gap, was applied already and
+// mustn't run twice when recovery fills the gap below it
+func TestInstallFillsGapWithoutReapplying(t *testing.T) {
+	sm, replicatedLog := machineAt(t, "local", 3)
+	reserve := command(t, statemachine.ScooterCommand{CommandType: statemachine.Reserve, ScooterID: "local-1", ReservationID: "r1"})
+	replicatedLog.Append(5, reserve, 0)
+	if _, err := sm.Apply(5, reserve); err != nil {
+		t.Fatal(err)
+	}
+	r := NewRecoverer(nil, sm, sm, replicatedLog)
+
+	response := entriesFrom(map[int64][]byte{
+		4: command(t, statemachine.ScooterCommand{CommandType: statemachine.Create, ScooterID: "peer-4"}),
+		5: reserve,
+		6: command(t, statemachine.ScooterCommand{CommandType: statemachine.Create, ScooterID: "peer-6"}),
+	})
+	// Reserving local-1 a second time would be rejected and reported as
+	// divergence, since the peer applied it fine
+	applied, err := r.install("peer", response)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if applied != 2 {
+		t.Fatalf("applied %d entries, want 4 and 6", applied)
+	}
+	if index := sm.AppliedIndex(); index != 6 {
+		t.Fatalf("applied index %d, want 6", index)
+	}
+}
+
+// Entries past one the peer doesn't have either wait for it, rather than
+// run ahead of it
+func TestInstallStopsAtGap(t *testing.T) {
+	sm, replicatedLog := machineAt(t, "local", 3)
+	r := NewRecoverer(nil, sm, sm, replicatedLog)
+
+	response := entriesFrom(map[int64][]byte{
+		4: command(t, statemachine.ScooterCommand{CommandType: statemachine.Create, ScooterID: "peer-4"}),
+		6: command(t, statemachine.ScooterCommand{CommandType: statemachine.Create, ScooterID: "peer-6"}),
+	})
+	if _, err := r.install("peer", response); err != nil {
+		t.Fatal(err)
+	}
+	if _, exists := sm.GetScooter("peer-4"); !exists {
+		t.Fatal("the entry before the gap wasn't applied")
+	}
+	if _, exists := sm.GetScooter("peer-6"); exists {
+		t.Fatal("an entry past the gap was applied")
+	}
+	if index := sm.AppliedIndex(); index != 4 {
+		t.Fatalf("applied index %d, want 4", index)
+	}
+}
@@ -0,0 +1,125 @@
+package recovery
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	pb "ds_project/src/server/proto"
+)
+
+// Strategy decides which order Recover tries its servers in
+type Strategy string
+
+const (
+	// InOrder tries servers in the order they were given
+	InOrder Strategy = "ordered"
+	// Freshest probes every server's commit index first and tries the
+	// highest first, the leader first among equals. Servers that don't
+	// answer the probe go last, in the order given.
+	Freshest Strategy = "freshest"
+)
+
+const probeTimeout = 2 * time.Second
+
+func ParseStrategy(value string) (Strategy, error) {
+	switch strategy := Strategy(value); strategy {
+	case InOrder, Freshest:
+		return strategy, nil
+	default:
+		return "", fmt.Errorf("unknown recovery strategy %q, expected ordered or freshest", value)
+	}
+}
+
+// SetLeaderFlag hands GetCommitIndex the flag main keeps current from
+// membership, so probes can tell which peer leads
+func (r *LogRecovery) SetLeaderFlag(flag *atomic.Bool) {
+	r.leader = flag
+}
+
+// GetCommitIndex answers a recovering node's probe with how far this node
+// has committed
+func (r *LogRecovery) GetCommitIndex(ctx context.Context, req *pb.CommitIndexRequest) (*pb.CommitIndexResponse, error) {
+	return &pb.CommitIndexResponse{
+		CommitIndex: r.log.GetCommitIndex(),
+		IsLeader:    r.leader != nil && r.leader.Load(),
+	}, nil
+}
+
+func (r *Recoverer) SetStrategy(strategy Strategy) {
+	r.strategy = strategy
+}
+
+func (r *Recoverer) Strategy() Strategy {
+	if r.strategy == "" {
+		return InOrder
+	}
+	return r.strategy
+}
+
+// probe is one server's answer to GetCommitIndex. ok is false if it didn't
+// answer.
+type probe struct {
+	server      string
+	commitIndex int64
+	isLeader    bool
+	ok          bool
+}
+
+// order returns servers in the order the strategy wants them tried
+func (r *Recoverer) order(servers []string) []string {
+	if r.strategy != Freshest || len(servers) < 2 {
+		return servers
+	}
+
+	probes := make([]probe, len(servers))
+	var wg sync.WaitGroup
+	for i, server := range servers {
+		wg.Add(1)
+		go func(i int, server string) {
+			defer wg.Done()
+			probes[i] = r.probe(server)
+		}(i, server)
+	}
+	wg.Wait()
+
+	sort.SliceStable(probes, func(i, j int) bool {
+		a, b := probes[i], probes[j]
+		if a.ok != b.ok {
+			return a.ok
+		}
+		if a.commitIndex != b.commitIndex {
+			return a.commitIndex > b.commitIndex
+		}
+		return a.isLeader && !b.isLeader
+	})
+
+	ordered := make([]string, len(probes))
+	for i, p := range probes {
+		ordered[i] = p.server
+	}
+	// Following recovers every few seconds, so only say when the pick changes
+	if best := probes[0]; best.ok && best.server != r.picked {
+		r.picked = best.server
+		fmt.Printf("Recovery picked %s, commit index %d (leader: %v), out of %v\n", best.server, best.commitIndex, best.isLeader, servers)
+	}
+	return ordered
+}
+
+func (r *Recoverer) probe(server string) probe {
+	conn, err := r.conns.Get(server)
+	if err != nil {
+		return probe{server: server}
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), probeTimeout)
+	defer cancel()
+	response, err := pb.NewLogRecoveryClient(conn).GetCommitIndex(ctx, &pb.CommitIndexRequest{})
+	if err != nil {
+		return probe{server: server}
+	}
+	return probe{server: server, commitIndex: response.CommitIndex, isLeader: response.IsLeader, ok: true}
+}
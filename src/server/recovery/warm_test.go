@@ -0,0 +1,96 @@
+package recovery
+
+import (
+	"net"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/connectivity"
+
+	"ds_project/src/server/connections"
+	"ds_project/src/server/log"
+	pb "ds_project/src/server/proto"
+	"ds_project/src/server/statemachine"
+)
+
+// countingListener counts the connections a server accepts, i.e. how many
+// times it has been dialed
+type countingListener struct {
+	net.Listener
+	accepted atomic.Int64
+}
+
+func (l *countingListener) Accept() (net.Conn, error) {
+	conn, err := l.Listener.Accept()
+	if err == nil {
+		l.accepted.Add(1)
+	}
+	return conn, err
+}
+
+// servePeer serves LogRecovery for a node that has applied count creates
+// and returns its address and the listener counting dials to it
+func servePeer(t *testing.T, count int) (string, *countingListener) {
+	t.Helper()
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Skipf("can't listen on localhost: %v", err)
+	}
+	counting := &countingListener{Listener: listener}
+
+	sm, replicatedLog := machineAt(t, "peer", count)
+	server := grpc.NewServer()
+	pb.RegisterLogRecoveryServer(server, NewLogRecovery(sm, replicatedLog))
+	go server.Serve(counting)
+	t.Cleanup(server.Stop)
+	return listener.Addr().String(), counting
+}
+
+func waitReady(t *testing.T, conns *connections.Manager, address string) {
+	t.Helper()
+	for deadline := time.Now().Add(5 * time.Second); time.Now().Before(deadline); time.Sleep(5 * time.Millisecond) {
+		conn, err := conns.Get(address)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if conn.GetState() == connectivity.Ready {
+			return
+		}
+	}
+	t.Fatalf("connection to %s never became ready", address)
+}
+
+func TestRecoverUsesWarmConnection(t *testing.T) {
+	address, peer := servePeer(t, 5)
+	conns := connections.NewManager([]string{address})
+	defer conns.Close()
+
+	// Warming connects ahead of any call
+	conns.Warm()
+	waitReady(t, conns, address)
+	if dials := peer.accepted.Load(); dials != 1 {
+		t.Fatalf("peer was dialed %d times while warming, want 1", dials)
+	}
+	warm, _ := conns.Get(address)
+
+	sm := statemachine.NewScooterStateMachine()
+	r := NewRecoverer(conns, sm, sm, log.NewReplicatedLog())
+	for _, strategy := range []Strategy{InOrder, Freshest} {
+		r.SetStrategy(strategy)
+		if err := r.Recover([]string{address}); err != nil {
+			t.Fatalf("recovering with %s: %v", strategy, err)
+		}
+	}
+
+	if _, exists := sm.GetScooter("peer-5"); !exists {
+		t.Fatal("recovery didn't catch up from the peer")
+	}
+	if dials := peer.accepted.Load(); dials != 1 {
+		t.Fatalf("peer was dialed %d times, want only the warm connection", dials)
+	}
+	if conn, _ := conns.Get(address); conn != warm {
+		t.Fatal("recovery replaced the warm connection")
+	}
+}
@@ -0,0 +1,294 @@
+package statemachine
+
+import (
+	"fmt"
+	"sync"
+)
+
+// CommandHandler applies one command type. It runs with applies serialized
+// and the shards of every scooter the command names (ScooterID,
+// NewScooterID, SourceScooterID and each operation's ScooterID) write-locked, so it may only
+// touch those scooters, through LockedScooter and PutScooter. sm.mutex is
+// not held. Like the rest of apply it must be deterministic, and it should
+// return Rejectf for commands the rules refuse.
+type CommandHandler func(sm *ScooterStateMachine, cmd ScooterCommand) error
+
+var (
+	commandHandlers = make(map[string]CommandHandler)
+	handlersMutex   sync.RWMutex
+)
+
+// RegisterCommand makes Apply dispatch commandType to handler. Call it from
+// an init function so every replica has the same handlers before the first
+// apply. Registering a type twice panics.
+func RegisterCommand(commandType string, handler CommandHandler) {
+	handlersMutex.Lock()
+	defer handlersMutex.Unlock()
+	if _, exists := commandHandlers[commandType]; exists {
+		panic("statemachine: command " + commandType + " registered twice")
+	}
+	commandHandlers[commandType] = handler
+}
+
+func commandHandler(commandType string) (CommandHandler, bool) {
+	handlersMutex.RLock()
+	defer handlersMutex.RUnlock()
+	handler, exists := commandHandlers[commandType]
+	return handler, exists
+}
+
+// Rejectf refuses a command by the state machine's rules; see ErrRejected
+func Rejectf(format string, args ...interface{}) error {
+	return reject(format, args...)
+}
+
+// LockedScooter looks a scooter up from inside a CommandHandler, whose
+// shards are already locked
+func (sm *ScooterStateMachine) LockedScooter(id string) (*Scooter, bool) {
+	scooter, exists := sm.shardFor(id).scooters[id]
+	return scooter, exists
+}
+
+// PutScooter stores a scooter from inside a CommandHandler
+func (sm *ScooterStateMachine) PutScooter(scooter *Scooter) {
+	sm.shardFor(scooter.ID).scooters[scooter.ID] = scooter
+}
+
+// ApplyingIndex is the log index of the command being applied, for handlers
+// that record it
+func (sm *ScooterStateMachine) ApplyingIndex() int64 {
+	return sm.applying
+}
+
+func init() {
+	RegisterCommand(Create, applyCreate)
+	RegisterCommand(Reserve, applyReserve)
+	RegisterCommand(Release, applyRelease)
+	RegisterCommand(Relabel, applyRelabel)
+	RegisterCommand(SetServiceState, applySetServiceState)
+	RegisterCommand(Transaction, func(sm *ScooterStateMachine, cmd ScooterCommand) error {
+		return sm.applyTransaction(cmd.Operations)
+	})
+	RegisterCommand(CancelReservation, applyCancelReservation)
+	RegisterCommand(Delete, applyDelete)
+	RegisterCommand(SetState, applySetState)
+	RegisterCommand(Merge, applyMerge)
+	// A Noop changes no state, but apply has already counted its index as
+	// applied, so the Noops of read rounds and heartbeats close the
+	// commit/applied gap like any other entry
+	RegisterCommand(Noop, func(sm *ScooterStateMachine, cmd ScooterCommand) error {
+		return nil
+	})
+}
+
+func applyCreate(sm *ScooterStateMachine, cmd ScooterCommand) error {
+	shard := sm.shardFor(cmd.ScooterID)
+	if scooter, exists := shard.scooters[cmd.ScooterID]; exists {
+		// A retried create of an untouched scooter is not a conflict
+		if scooter.MatchesCreate(cmd) {
+			return nil
+		}
+		return reject("Scooter %s already exists", cmd.ScooterID)
+	}
+
+	shard.scooters[cmd.ScooterID] = &Scooter{
+		ID: cmd.ScooterID,
+		IsAvailable: true,
+		TotalDistance: 0,
+		Version: 1,
+		Location: cmd.Location,
+	}
+	delete(shard.tombstones, cmd.ScooterID)
+	return nil
+}
+
+func applyReserve(sm *ScooterStateMachine, cmd ScooterCommand) error {
+	scooter, exists := sm.shardFor(cmd.ScooterID).scooters[cmd.ScooterID]
+
+	sm.mutex.Lock()
+	defer sm.mutex.Unlock()
+
+	if err := checkReserve(scooter, exists, cmd, sm.clientReservations[cmd.ClientID]); err != nil {
+		return err
+	}
+	if err := checkSignature(sm.signingKeys, cmd, cmd.ClientID); err != nil {
+		return err
+	}
+
+	scooter.reserve(cmd)
+	sm.adjustReservations(cmd.ClientID, 1)
+	return nil
+}
+
+func applyRelease(sm *ScooterStateMachine, cmd ScooterCommand) error {
+	scooter, exists := sm.shardFor(cmd.ScooterID).scooters[cmd.ScooterID]
+
+	if err := checkRelease(scooter, exists, cmd); err != nil {
+		return err
+	}
+	if err := checkSignature(sm.SigningKeys(), cmd, scooter.ClientID); err != nil {
+		return err
+	}
+
+	clientID := scooter.release(cmd)
+	sm.mutex.Lock()
+	sm.adjustReservations(clientID, -1)
+	sm.addClientDistances(cmd.DistanceSplit)
+	sm.mutex.Unlock()
+	return nil
+}
+
+func applyRelabel(sm *ScooterStateMachine, cmd ScooterCommand) error {
+	from, to := sm.shardFor(cmd.ScooterID), sm.shardFor(cmd.NewScooterID)
+	scooter, exists := from.scooters[cmd.ScooterID]
+
+	if !exists {
+		return reject("Scooter %s does not exist", cmd.ScooterID)
+	}
+
+	if _, exists := to.scooters[cmd.NewScooterID]; exists {
+		return reject("Scooter %s already exists", cmd.NewScooterID)
+	}
+
+	delete(from.scooters, cmd.ScooterID)
+	scooter.ID = cmd.NewScooterID
+	scooter.Version++
+	to.scooters[cmd.NewScooterID] = scooter
+	return nil
+}
+
+func applySetServiceState(sm *ScooterStateMachine, cmd ScooterCommand) error {
+	scooter, exists := sm.shardFor(cmd.ScooterID).scooters[cmd.ScooterID]
+
+	if !exists {
+		return reject("Scooter %s does not exist", cmd.ScooterID)
+	}
+
+	if scooter.OutOfService != cmd.OutOfService {
+		scooter.OutOfService = cmd.OutOfService
+		scooter.Version++
+	}
+	return nil
+}
+
+func applyCancelReservation(sm *ScooterStateMachine, cmd ScooterCommand) error {
+	scooter, exists := sm.shardFor(cmd.ScooterID).scooters[cmd.ScooterID]
+
+	if !exists {
+		return reject("Scooter %s does not exist", cmd.ScooterID)
+	}
+
+	if scooter.IsAvailable || scooter.ReservationID != cmd.ReservationID {
+		return reject("Reservation %s is not active on scooter %s", cmd.ReservationID, cmd.ScooterID)
+	}
+
+	// A forced release: no token, no distance
+	clientID := scooter.release(ScooterCommand{})
+	sm.mutex.Lock()
+	sm.adjustReservations(clientID, -1)
+	sm.mutex.Unlock()
+	return nil
+}
+
+func applyDelete(sm *ScooterStateMachine, cmd ScooterCommand) error {
+	shard := sm.shardFor(cmd.ScooterID)
+	scooter, exists := shard.scooters[cmd.ScooterID]
+
+	if !exists {
+		// Already deleted, e.g. replayed on top of a later snapshot
+		if _, deleted := shard.tombstones[cmd.ScooterID]; deleted {
+			return nil
+		}
+		return reject("Scooter %s does not exist", cmd.ScooterID)
+	}
+
+	if !scooter.IsAvailable {
+		return reject("Scooter %s is reserved", cmd.ScooterID)
+	}
+
+	delete(shard.scooters, cmd.ScooterID)
+	shard.tombstones[cmd.ScooterID] = sm.applying
+	return nil
+}
+
+// applyMerge folds the source scooter into ScooterID after a hardware swap:
+// the target keeps its own state plus the source's distance, and the source
+// is deleted. Neither may be reserved.
+func applyMerge(sm *ScooterStateMachine, cmd ScooterCommand) error {
+	if cmd.SourceScooterID == cmd.ScooterID {
+		return reject("Scooter %s can't be merged into itself", cmd.ScooterID)
+	}
+	source := sm.shardFor(cmd.SourceScooterID)
+	target, exists := sm.shardFor(cmd.ScooterID).scooters[cmd.ScooterID]
+	if !exists {
+		return reject("Scooter %s does not exist", cmd.ScooterID)
+	}
+
+	merged, exists := source.scooters[cmd.SourceScooterID]
+	if !exists {
+		// This merge is already reflected, e.g. replayed on top of a
+		// later snapshot
+		if index, deleted := source.tombstones[cmd.SourceScooterID]; deleted && index == sm.applying {
+			return nil
+		}
+		return reject("Scooter %s does not exist", cmd.SourceScooterID)
+	}
+
+	if !merged.IsAvailable {
+		return reject("Scooter %s is reserved", cmd.SourceScooterID)
+	}
+	if !target.IsAvailable {
+		return reject("Scooter %s is reserved", cmd.ScooterID)
+	}
+
+	target.TotalDistance += merged.TotalDistance
+	target.Version++
+	delete(source.scooters, cmd.SourceScooterID)
+	source.tombstones[cmd.SourceScooterID] = sm.applying
+	return nil
+}
+
+// dispatch runs cmd through its registered handler
+func (sm *ScooterStateMachine) dispatch(cmd ScooterCommand) error {
+	handler, exists := commandHandler(cmd.CommandType)
+	if !exists {
+		return fmt.Errorf("Unknown command type %s", cmd.CommandType)
+	}
+	return handler(sm, cmd)
+}
+
+// applySetState overwrites a scooter with cmd.State, creating it if needed,
+// without going through the commands that would normally get it there. Its
+// version still moves forward, so clients holding the old one see a change.
+func applySetState(sm *ScooterStateMachine, cmd ScooterCommand) error {
+	if cmd.State == nil {
+		return reject("No state given for scooter %s", cmd.ScooterID)
+	}
+
+	shard := sm.shardFor(cmd.ScooterID)
+	scooter := *cmd.State
+	scooter.ID = cmd.ScooterID
+	scooter.Version = 1
+	if !scooter.IsAvailable && scooter.ReservedAt == 0 {
+		scooter.ReservedAt = cmd.Timestamp
+	}
+
+	previousClient := ""
+	if old, exists := shard.scooters[cmd.ScooterID]; exists {
+		scooter.Version = old.Version + 1
+		if !old.IsAvailable {
+			previousClient = old.ClientID
+		}
+	}
+
+	sm.mutex.Lock()
+	sm.adjustReservations(previousClient, -1)
+	if !scooter.IsAvailable {
+		sm.adjustReservations(scooter.ClientID, 1)
+	}
+	sm.mutex.Unlock()
+
+	shard.scooters[cmd.ScooterID] = &scooter
+	delete(shard.tombstones, cmd.ScooterID)
+	return nil
+}
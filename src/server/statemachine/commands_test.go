@@ -0,0 +1,97 @@
+package statemachine_test
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"ds_project/src/server/statemachine"
+)
+
+// retire is registered the way a package outside statemachine would add a
+// command: from its own init, through the exported handler helpers
+const retire = "retire"
+
+func init() {
+	statemachine.RegisterCommand(retire, func(sm *statemachine.ScooterStateMachine, cmd statemachine.ScooterCommand) error {
+		scooter, exists := sm.LockedScooter(cmd.ScooterID)
+		if !exists {
+			return statemachine.Rejectf("Scooter %s does not exist", cmd.ScooterID)
+		}
+		if !scooter.IsAvailable {
+			return statemachine.Rejectf("Scooter %s is reserved", cmd.ScooterID)
+		}
+		retired := *scooter
+		retired.OutOfService = true
+		retired.IsAvailable = false
+		retired.Version = sm.ApplyingIndex()
+		sm.PutScooter(&retired)
+		return nil
+	})
+}
+
+func apply(t *testing.T, sm *statemachine.ScooterStateMachine, index int64, cmd statemachine.ScooterCommand) (statemachine.Result, error) {
+	t.Helper()
+	command, err := json.Marshal(cmd)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return sm.Apply(index, command)
+}
+
+func TestRegisteredCommandIsDispatched(t *testing.T) {
+	sm := statemachine.NewScooterStateMachine()
+	if _, err := apply(t, sm, 0, statemachine.ScooterCommand{CommandType: statemachine.Noop}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := apply(t, sm, 1, statemachine.ScooterCommand{CommandType: statemachine.Create, ScooterID: "s"}); err != nil {
+		t.Fatal(err)
+	}
+
+	result, err := apply(t, sm, 2, statemachine.ScooterCommand{CommandType: retire, ScooterID: "s"})
+	if err != nil {
+		t.Fatalf("applying the registered command: %v", err)
+	}
+	scooter, _ := sm.GetScooter("s")
+	if !scooter.OutOfService || scooter.IsAvailable || scooter.Version != 2 {
+		t.Fatalf("scooter after retire: %+v", scooter)
+	}
+	// Its result is the scooters it touched, as for the built-in commands
+	touched, ok := result.([]statemachine.Scooter)
+	if !ok || len(touched) != 1 || !touched[0].OutOfService {
+		t.Fatalf("result %#v, want the retired scooter", result)
+	}
+	if sm.AppliedIndex() != 2 {
+		t.Fatalf("applied index %d, want 2", sm.AppliedIndex())
+	}
+}
+
+func TestRegisteredCommandRejects(t *testing.T) {
+	sm := statemachine.NewScooterStateMachine()
+	_, err := apply(t, sm, 1, statemachine.ScooterCommand{CommandType: retire, ScooterID: "missing"})
+	if !statemachine.IsRejection(err) {
+		t.Fatalf("got %v, want a rejection", err)
+	}
+	if sm.HaltError() != nil {
+		t.Fatal("a rejection halted the state machine")
+	}
+}
+
+func TestUnknownCommandType(t *testing.T) {
+	sm := statemachine.NewScooterStateMachine()
+	_, err := apply(t, sm, 1, statemachine.ScooterCommand{CommandType: "unregistered", ScooterID: "s"})
+	if err == nil || statemachine.IsRejection(err) || !strings.Contains(err.Error(), "Unknown command type unregistered") {
+		t.Fatalf("got %v, want an unknown command type failure", err)
+	}
+}
+
+func TestRegisterCommandTwicePanics(t *testing.T) {
+	defer func() {
+		if recover() == nil {
+			t.Fatal("registering create a second time didn't panic")
+		}
+	}()
+	statemachine.RegisterCommand(statemachine.Create, func(*statemachine.ScooterStateMachine, statemachine.ScooterCommand) error {
+		return nil
+	})
+}
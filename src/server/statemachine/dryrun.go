@@ -0,0 +1,59 @@
+package statemachine
+
+import (
+	"encoding/json"
+)
+
+// DryRun applies cmd to a throwaway copy of the scooters it names and the
+// per-client tallies, leaving sm as it was. It returns the copies as they
+// would be afterwards, like Apply's result, and the error applying cmd
+// would give. Applies wait while the copy is taken, so it reflects one
+// point in the log.
+func (sm *ScooterStateMachine) DryRun(cmd ScooterCommand) ([]Scooter, error) {
+	commandBytes, err := json.Marshal(cmd)
+	if err != nil {
+		return nil, err
+	}
+
+	sm.applyMutex.Lock()
+	sandbox := sm.sandbox(cmd.scooterIDs())
+	sm.applyMutex.Unlock()
+
+	result, err := sandbox.Apply(sandbox.appliedIndex+1, commandBytes)
+	scooters, _ := result.([]Scooter)
+	return scooters, err
+}
+
+// sandbox is a new state machine holding copies of the scooters and
+// tombstones named by ids and of everything outside the shards that a
+// command's checks read, signing keys and halt state included. Callers
+// hold applyMutex.
+func (sm *ScooterStateMachine) sandbox(ids []string) *ScooterStateMachine {
+	sandbox := NewScooterStateMachine()
+	for _, id := range ids {
+		shard := sm.shardFor(id)
+		shard.mutex.RLock()
+		if scooter, exists := shard.scooters[id]; exists {
+			copied := scooter.clone()
+			sandbox.shardFor(id).scooters[id] = &copied
+		}
+		if index, deleted := shard.tombstones[id]; deleted {
+			sandbox.shardFor(id).tombstones[id] = index
+		}
+		shard.mutex.RUnlock()
+	}
+
+	sm.mutex.RLock()
+	defer sm.mutex.RUnlock()
+	sandbox.appliedIndex = sm.appliedIndex
+	sandbox.signingKeys = sm.signingKeys
+	sandbox.applyErrorPolicy = sm.applyErrorPolicy
+	sandbox.halted = sm.halted
+	for clientID, count := range sm.clientReservations {
+		sandbox.clientReservations[clientID] = count
+	}
+	for clientID, distance := range sm.clientDistances {
+		sandbox.clientDistances[clientID] = distance
+	}
+	return sandbox
+}
@@ -0,0 +1,56 @@
+package statemachine
+
+import (
+	"crypto/ed25519"
+	"encoding/base64"
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestDryRunChecksSignatures(t *testing.T) {
+	public, private, err := ed25519.GenerateKey(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, otherPrivate, err := ed25519.GenerateKey(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	sm := newFleet(t, 1)
+	sm.SetSigningKeys(SigningKeys{Clients: map[string]ed25519.PublicKey{"rider": public}, Required: true})
+
+	reserve := ScooterCommand{CommandType: Reserve, ScooterID: "scooter-0", ReservationID: "r1", ClientID: "rider"}
+	reserve.Signature = base64.StdEncoding.EncodeToString(ed25519.Sign(otherPrivate, reserve.SigningPayload()))
+	_, err = sm.DryRun(reserve)
+	if !IsRejection(err) || !strings.Contains(err.Error(), "does not match") {
+		t.Fatalf("expected a dry run with a bad signature to fail like Apply, got %v", err)
+	}
+
+	reserve.Signature = base64.StdEncoding.EncodeToString(ed25519.Sign(private, reserve.SigningPayload()))
+	scooters, err := sm.DryRun(reserve)
+	if err != nil {
+		t.Fatalf("expected a dry run with a good signature to pass, got %v", err)
+	}
+	if len(scooters) != 1 || scooters[0].IsAvailable {
+		t.Fatalf("expected the dry run to show the scooter reserved, got %+v", scooters)
+	}
+	if scooter, _ := sm.GetScooter("scooter-0"); !scooter.IsAvailable {
+		t.Fatal("the dry run reserved the real scooter")
+	}
+}
+
+func TestDryRunKeepsHaltPolicy(t *testing.T) {
+	sm := newFleet(t, 1)
+	sm.SetApplyErrorPolicy(HaltOnApplyError)
+	sm.mutex.Lock()
+	sm.halted = &ErrHalted{Index: 1, Err: errors.New("diverged")}
+	sm.mutex.Unlock()
+
+	_, err := sm.DryRun(ScooterCommand{CommandType: Create, ScooterID: "new"})
+	var halted *ErrHalted
+	if !errors.As(err, &halted) {
+		t.Fatalf("expected a dry run on a halted state machine to report it, got %v", err)
+	}
+}
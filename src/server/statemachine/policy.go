@@ -0,0 +1,63 @@
+package statemachine
+
+import (
+	"errors"
+	"fmt"
+)
+
+// ApplyErrorPolicy decides what the state machine does when applying a
+// committed command fails for a reason other than a business rule.
+type ApplyErrorPolicy string
+
+const (
+	// SkipApplyErrors logs the failure and carries on with the next entry
+	SkipApplyErrors ApplyErrorPolicy = "skip"
+	// HaltOnApplyError stops applying and reports the node unhealthy until
+	// an operator restarts it
+	HaltOnApplyError ApplyErrorPolicy = "halt"
+)
+
+func ParseApplyErrorPolicy(value string) (ApplyErrorPolicy, error) {
+	switch policy := ApplyErrorPolicy(value); policy {
+	case SkipApplyErrors, HaltOnApplyError:
+		return policy, nil
+	default:
+		return "", fmt.Errorf("unknown apply error policy %q, expected skip or halt", value)
+	}
+}
+
+// ErrRejected is a command refused by the state machine's rules, e.g.
+// reserving a scooter someone else holds. Every replica refuses it the same
+// way, so it never counts against the apply error policy.
+type ErrRejected struct {
+	Reason string
+}
+
+func (e *ErrRejected) Error() string {
+	return e.Reason
+}
+
+func reject(format string, args ...interface{}) error {
+	return &ErrRejected{Reason: fmt.Sprintf(format, args...)}
+}
+
+// IsRejection reports whether err is a rule rejection rather than a failure
+func IsRejection(err error) bool {
+	var rejected *ErrRejected
+	return errors.As(err, &rejected)
+}
+
+// ErrHalted is returned for every command once the halt policy has stopped
+// the state machine. Index and Err are the entry that stopped it.
+type ErrHalted struct {
+	Index int64
+	Err   error
+}
+
+func (e *ErrHalted) Error() string {
+	return fmt.Sprintf("state machine halted after entry %d failed to apply: %v", e.Index, e.Err)
+}
+
+func (e *ErrHalted) Unwrap() error {
+	return e.Err
+}
@@ -0,0 +1,51 @@
+package statemachine
+
+import (
+	"sort"
+)
+
+// Reservation is one active reservation as listed for support staff
+type Reservation struct {
+	ScooterID     string `json:"scooter_id"`
+	ReservationID string `json:"reservation_id"`
+	ClientID      string `json:"client_id,omitempty"`
+	ReservedAt    int64  `json:"reserved_at,omitempty"`
+}
+
+// Reservations lists every active reservation, ordered by scooter ID. It
+// scans the fleet; there is no index by reservation ID.
+func (sm *ScooterStateMachine) Reservations() []Reservation {
+	sm.rLockAll()
+	defer sm.rUnlockAll()
+
+	reservations := make([]Reservation, 0)
+	for _, shard := range sm.shards {
+		for _, scooter := range shard.scooters {
+			if scooter.IsAvailable {
+				continue
+			}
+			reservations = append(reservations, Reservation{
+				ScooterID:     scooter.ID,
+				ReservationID: scooter.ReservationID,
+				ClientID:      scooter.ClientID,
+				ReservedAt:    scooter.ReservedAt,
+			})
+		}
+	}
+	sort.Slice(reservations, func(i, j int) bool {
+		return reservations[i].ScooterID < reservations[j].ScooterID
+	})
+	return reservations
+}
+
+// FindReservation returns the scooters currently held under reservationID.
+// Reservation IDs come from clients, so more than one is possible.
+func (sm *ScooterStateMachine) FindReservation(reservationID string) []string {
+	scooterIDs := make([]string, 0)
+	for _, reservation := range sm.Reservations() {
+		if reservation.ReservationID == reservationID {
+			scooterIDs = append(scooterIDs, reservation.ScooterID)
+		}
+	}
+	return scooterIDs
+}
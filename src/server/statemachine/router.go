@@ -0,0 +1,114 @@
+package statemachine
+
+import (
+	"encoding/json"
+	"fmt"
+	"sync"
+)
+
+const DefaultNamespace = "scooters"
+
+// CommandVersion is the format of the command envelope and ScooterCommand.
+// Bump it whenever a field changes meaning or a new command type is added.
+const CommandVersion = 12
+
+// Result is what a state machine reports back from applying one command,
+// for the node that proposed it to hand to its client. It may be nil.
+type Result any
+
+type StateMachine interface {
+	Apply(index int64, commandBytes []byte) (Result, error)
+}
+
+// StateMachineRouter lets several independent state machines share one
+// replicated log. Every command names its namespace and only the state
+// machine registered under that namespace applies it; commands without a
+// namespace go to DefaultNamespace.
+type StateMachineRouter struct {
+	machines map[string]StateMachine
+	mutex    sync.RWMutex
+}
+
+func NewStateMachineRouter() *StateMachineRouter {
+	return &StateMachineRouter{
+		machines: make(map[string]StateMachine),
+	}
+}
+
+func (r *StateMachineRouter) Register(namespace string, sm StateMachine) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	r.machines[namespace] = sm
+}
+
+func (r *StateMachineRouter) Get(namespace string) (StateMachine, bool) {
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+	sm, exists := r.machines[namespace]
+	return sm, exists
+}
+
+// Skipper is implemented by state machines that track how far they have
+// applied, so the router can move them past entries meant for another
+// namespace, or for none.
+type Skipper interface {
+	Skip(index int64)
+}
+
+func (r *StateMachineRouter) Apply(index int64, commandBytes []byte) (Result, error) {
+	var envelope struct {
+		Namespace string `json:"namespace"`
+	}
+	if err := json.Unmarshal(commandBytes, &envelope); err != nil {
+		r.skipAllBut("", index)
+		return nil, err
+	}
+	if envelope.Namespace == "" {
+		envelope.Namespace = DefaultNamespace
+	}
+
+	r.skipAllBut(envelope.Namespace, index)
+	sm, exists := r.Get(envelope.Namespace)
+	if !exists {
+		return nil, fmt.Errorf("no state machine registered for namespace %s", envelope.Namespace)
+	}
+	return sm.Apply(index, commandBytes)
+}
+
+// skipAllBut moves every state machine except namespace's past index. Each
+// one's applied index then follows the shared log, which is what waits for
+// an index to be applied look at.
+func (r *StateMachineRouter) skipAllBut(namespace string, index int64) {
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+	for name, sm := range r.machines {
+		if skipper, ok := sm.(Skipper); ok && name != namespace {
+			skipper.Skip(index)
+		}
+	}
+}
+
+// Skip moves every state machine past index, for an index decided without
+// a command
+func (r *StateMachineRouter) Skip(index int64) {
+	r.skipAllBut("", index)
+}
+
+// AppliedIndex is the lowest applied index of the state machines that track
+// one, or -1 if none do. Since each is moved past the others' entries, it
+// is how far the shared log has been applied.
+func (r *StateMachineRouter) AppliedIndex() int64 {
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+	applied, tracked := int64(-1), false
+	for _, sm := range r.machines {
+		indexer, ok := sm.(interface{ AppliedIndex() int64 })
+		if !ok {
+			continue
+		}
+		if index := indexer.AppliedIndex(); !tracked || index < applied {
+			applied, tracked = index, true
+		}
+	}
+	return applied
+}
@@ -0,0 +1,68 @@
+package statemachine
+
+import (
+	"testing"
+)
+
+// recordingMachine remembers the indexes it applied and skipped
+type recordingMachine struct {
+	applied []int64
+	skipped []int64
+}
+
+func (m *recordingMachine) Apply(index int64, commandBytes []byte) (Result, error) {
+	m.applied = append(m.applied, index)
+	return nil, nil
+}
+
+func (m *recordingMachine) Skip(index int64) {
+	m.skipped = append(m.skipped, index)
+}
+
+func TestRouterSendsCommandsToTheirNamespace(t *testing.T) {
+	scooters := NewScooterStateMachine()
+	docks := &recordingMachine{}
+	router := NewStateMachineRouter()
+	router.Register(DefaultNamespace, scooters)
+	router.Register("docks", docks)
+
+	if _, err := router.Apply(0, encode(t, ScooterCommand{CommandType: Create, ScooterID: "s1"})); err != nil {
+		t.Fatal(err)
+	}
+	if _, exists := scooters.GetScooter("s1"); !exists {
+		t.Fatal("a command without a namespace didn't reach the scooters")
+	}
+
+	if _, err := router.Apply(1, []byte(`{"namespace":"docks","command_type":"OPEN"}`)); err != nil {
+		t.Fatal(err)
+	}
+	if len(docks.applied) != 1 || docks.applied[0] != 1 {
+		t.Fatalf("expected docks to apply index 1, applied %v", docks.applied)
+	}
+	if applied := scooters.AppliedIndex(); applied != 1 {
+		t.Fatalf("expected the scooters to be moved past the docks entry, at %d", applied)
+	}
+	if len(docks.skipped) != 1 || docks.skipped[0] != 0 {
+		t.Fatalf("expected docks to skip the scooter entry at 0, skipped %v", docks.skipped)
+	}
+}
+
+func TestRouterRecordsUnroutableEntries(t *testing.T) {
+	scooters := NewScooterStateMachine()
+	router := NewStateMachineRouter()
+	router.Register(DefaultNamespace, scooters)
+
+	if _, err := router.Apply(0, []byte(`{"namespace":"users","command_type":"CREATE"}`)); err == nil {
+		t.Fatal("expected an error for a namespace nothing is registered under")
+	}
+	if applied := scooters.AppliedIndex(); applied != 0 {
+		t.Fatalf("expected applied index 0 after an entry for an unknown namespace, got %d", applied)
+	}
+
+	if _, err := router.Apply(1, []byte(`not json`)); err == nil {
+		t.Fatal("expected an error for a malformed entry")
+	}
+	if applied := scooters.AppliedIndex(); applied != 1 {
+		t.Fatalf("expected applied index 1 after a malformed entry, got %d", applied)
+	}
+}
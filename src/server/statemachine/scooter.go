@@ -2,7 +2,14 @@ package statemachine
 
 import (
 	"fmt"
+	"math"
+	"time"
+	"slices"
+	"sort"
 	"sync"
+	"hash/fnv"
+	"crypto/sha256"
+	"encoding/hex"
 	"encoding/json"
 )
 
@@ -11,133 +18,641 @@ type Scooter struct {
 	IsAvailable bool	`json:"is_available"`
 	TotalDistance float64	`json:"total_distance"`
 	ReservationID string	`json:"current_reservation_id,omitempty"`
+	Version     int64	`json:"version"`
+	ReservedAt  int64	`json:"reserved_at,omitempty"`
+	ClientID    string	`json:"client_id,omitempty"`
+	OutOfService bool	`json:"out_of_service"`
+	// ReservationToken proves who holds the reservation and must accompany
+	// the release. API responses leave it out; see Public
+	ReservationToken string	`json:"reservation_token,omitempty"`
+	Location    *Location	`json:"location,omitempty"`
+}
+
+// Location is where a scooter was placed when it was created
+type Location struct {
+	Lat float64 `json:"lat"`
+	Lng float64 `json:"lng"`
 }
 
 const (
 	Create = "CREATE"
 	Reserve = "RESERVE"
 	Release = "RELEASE"
+	Relabel = "RELABEL"
+	SetServiceState = "SET_SERVICE_STATE"
+	Transaction = "TRANSACTION"
+	Delete = "DELETE"
+	CancelReservation = "CANCEL_RESERVATION"
+	SetState = "SET_STATE"
+	Merge = "MERGE"
 	Noop   = "NOOP"
 )
 
 type ScooterCommand struct {	
+	Namespace     string `json:"namespace,omitempty"`
 	CommandType   string `json:"command_type"`
 	ScooterID     string `json:"scooter_id"`
 	ReservationID string `json:"reservation_id,omitempty"`
 	Distance      int64  `json:"distance,omitempty"`
+	ExpectedVersion *int64 `json:"expected_version,omitempty"`
+	// Timestamp is stamped by the proposing node in unix milliseconds
+	Timestamp     int64  `json:"timestamp,omitempty"`
+	ClientID      string `json:"client_id,omitempty"`
+	// ReservationQuota caps ClientID's active reservations, 0 means no cap.
+	// It travels in the command so every replica enforces the same limit.
+	ReservationQuota int `json:"reservation_quota,omitempty"`
+	NewScooterID  string `json:"new_scooter_id,omitempty"`
+	// SourceScooterID is the scooter a Merge folds into ScooterID
+	SourceScooterID string `json:"source_scooter_id,omitempty"`
+	// MaxSpeedKmh rejects a Release whose distance over the reservation's
+	// duration implies a faster speed, 0 means no check
+	MaxSpeedKmh   float64 `json:"max_speed_kmh,omitempty"`
+	OutOfService  bool   `json:"out_of_service,omitempty"`
+	// ReservationToken is generated by the proposing node for a Reserve and
+	// presented again by the rider on Release
+	ReservationToken string `json:"reservation_token,omitempty"`
+	// Operations are the Reserve and Release commands of a Transaction,
+	// applied all together or not at all
+	Operations    []ScooterCommand `json:"operations,omitempty"`
+	// Location optionally places a scooter being created
+	Location      *Location `json:"location,omitempty"`
+	// CreatedAt is when the client created the write, in unix milliseconds.
+	// A command whose Timestamp is more than TTL milliseconds later has
+	// expired; a TTL of 0 never expires.
+	CreatedAt     int64  `json:"created_at,omitempty"`
+	TTL           int64  `json:"ttl_ms,omitempty"`
+	// State is the whole scooter a SetState overwrites ScooterID with
+	State         *Scooter `json:"state,omitempty"`
+	// DistanceSplit optionally divides a Release's Distance between the
+	// co-riders' client IDs; the shares must sum to Distance
+	DistanceSplit map[string]int64 `json:"distance_split,omitempty"`
+	// Signature is the client's base64 ed25519 signature over
+	// SigningPayload, for Reserve and Release
+	Signature     string `json:"signature,omitempty"`
 }
 
-type ScooterStateMachine struct {
+// Expired reports whether cmd was proposed after its TTL ran out. It only
+// looks at times carried in the command, so every replica agrees.
+func (cmd ScooterCommand) Expired() bool {
+	return cmd.TTL > 0 && cmd.CreatedAt > 0 && cmd.Timestamp-cmd.CreatedAt > cmd.TTL
+}
+
+// shardCount is how many independently locked pieces the fleet is split
+// into, so work on one scooter doesn't block reads of the others.
+const shardCount = 32
+
+type scooterShard struct {
 	scooters map[string]*Scooter
+	// tombstones maps each deleted scooter to the index that deleted it.
+	// They are snapshotted with the scooters, so a delete the snapshot
+	// already reflects can be replayed from the log without failing.
+	tombstones map[string]int64
+	mutex    sync.RWMutex
+}
+
+// Lock ordering: shards in ascending order, then sm.mutex. Apply locks only
+// the shards its command touches; whole-fleet reads, snapshots and the state
+// hash lock every shard. Applies are serialized on applyMutex.
+type ScooterStateMachine struct {
+	shards [shardCount]*scooterShard
 	snapshotData []byte
 	snapshotIndex int64
+	// snapshots are the last snapshotRetention taken, oldest first; the
+	// newest is also snapshotData
+	snapshots []RetainedSnapshot
+	snapshotRetention int
+	// appliedIndex is the highest index every entry up to which has been
+	// applied or skipped. appliedAbove holds indexes applied past a gap
+	// below them, until the gap is filled.
+	appliedIndex int64
+	appliedAbove map[int64]bool
+	// clientReservations is derived from the scooters' ClientID and rebuilt
+	// whenever a snapshot is loaded
+	clientReservations map[string]int
+	// clientDistances totals the shares split releases credited each
+	// client. Unlike clientReservations it can't be derived from the
+	// scooters, so it is snapshotted.
+	clientDistances map[string]int64
+	signingKeys SigningKeys
+	applyErrorPolicy ApplyErrorPolicy
+	halted *ErrHalted
+	// applying is the index being applied, guarded by applyMutex
+	applying int64
+	// mutex guards the fields above, not the shards
 	mutex    sync.RWMutex
+	applyMutex sync.Mutex
 }
 
 func NewScooterStateMachine() *ScooterStateMachine {
-	return &ScooterStateMachine{
-		scooters: make(map[string]*Scooter),
+	sm := &ScooterStateMachine{
+		appliedIndex: -1,
+		appliedAbove: make(map[int64]bool),
+		clientReservations: make(map[string]int),
+		clientDistances: make(map[string]int64),
+		applyErrorPolicy: SkipApplyErrors,
+		snapshotRetention: DefaultSnapshotRetention,
+	}
+	for i := range sm.shards {
+		sm.shards[i] = &scooterShard{
+			scooters:   make(map[string]*Scooter),
+			tombstones: make(map[string]int64),
+		}
 	}
+	return sm
 }
 
-func (sm *ScooterStateMachine) Apply(commandBytes []byte) error {
-	var cmd ScooterCommand 
+// SetApplyErrorPolicy chooses what happens when a committed command fails
+// to apply; see ApplyErrorPolicy. An already halted state machine stays
+// halted.
+func (sm *ScooterStateMachine) SetApplyErrorPolicy(policy ApplyErrorPolicy) {
+	sm.mutex.Lock()
+	defer sm.mutex.Unlock()
+	sm.applyErrorPolicy = policy
+}
 
-	 err := json.Unmarshal(commandBytes, &cmd)  
-  	if err != nil{                            
-      return err                             
-  	}  
+func (sm *ScooterStateMachine) ApplyErrorPolicy() ApplyErrorPolicy {
+	sm.mutex.RLock()
+	defer sm.mutex.RUnlock()
+	return sm.applyErrorPolicy
+}
 
+// HaltError is why the state machine stopped applying, or nil while it is
+// healthy.
+func (sm *ScooterStateMachine) HaltError() error {
+	sm.mutex.RLock()
+	defer sm.mutex.RUnlock()
+	if sm.halted == nil {
+		return nil
+	}
+	return sm.halted
+}
 
-	sm.mutex.Lock()
-	defer sm.mutex.Unlock()
+func shardIndex(scooterID string) int {
+	h := fnv.New32a()
+	h.Write([]byte(scooterID))
+	return int(h.Sum32() % shardCount)
+}
 
-	switch cmd.CommandType {
-	case Create:
+func (sm *ScooterStateMachine) shardFor(scooterID string) *scooterShard {
+	return sm.shards[shardIndex(scooterID)]
+}
 
-		if _, exists := sm.scooters[cmd.ScooterID]; exists {
-			return fmt.Errorf("Scooter %s already exists", cmd.ScooterID)
+// lockShards write-locks the shards holding ids in ascending order and
+// returns them for unlockShards.
+func (sm *ScooterStateMachine) lockShards(ids ...string) []int {
+	indexes := make([]int, 0, len(ids))
+	for _, id := range ids {
+		index := shardIndex(id)
+		if !slices.Contains(indexes, index) {
+			indexes = append(indexes, index)
 		}
+	}
+	sort.Ints(indexes)
+	for _, index := range indexes {
+		sm.shards[index].mutex.Lock()
+	}
+	return indexes
+}
+
+func (sm *ScooterStateMachine) unlockShards(indexes []int) {
+	for _, index := range indexes {
+		sm.shards[index].mutex.Unlock()
+	}
+}
 
-		sm.scooters[cmd.ScooterID] = &Scooter{
-			ID: cmd.ScooterID,
-			IsAvailable: true,
-			TotalDistance: 0,
+// scootersLocked copies the scooters named by ids that exist, once each,
+// for callers already holding their shards
+func (sm *ScooterStateMachine) scootersLocked(ids []string) []Scooter {
+	scooters := make([]Scooter, 0, len(ids))
+	seen := make(map[string]bool)
+	for _, id := range ids {
+		if seen[id] {
+			continue
+		}
+		seen[id] = true
+		if scooter, exists := sm.shardFor(id).scooters[id]; exists {
+			scooters = append(scooters, scooter.Public())
 		}
+	}
+	return scooters
+}
+
+func (sm *ScooterStateMachine) rLockAll() {
+	for _, shard := range sm.shards {
+		shard.mutex.RLock()
+	}
+}
 
-	case Reserve:
+func (sm *ScooterStateMachine) rUnlockAll() {
+	for _, shard := range sm.shards {
+		shard.mutex.RUnlock()
+	}
+}
 
-		scooter, exists := sm.scooters[cmd.ScooterID]
-		
-		if !exists {
-			return fmt.Errorf("Scooter %s does not exist", cmd.ScooterID)
+// allScooters merges the shards into one map. Callers hold every shard lock.
+func (sm *ScooterStateMachine) allScooters() map[string]*Scooter {
+	scooters := make(map[string]*Scooter)
+	for _, shard := range sm.shards {
+		for id, scooter := range shard.scooters {
+			scooters[id] = scooter
 		}
+	}
+	return scooters
+}
 
-		if !scooter.IsAvailable {
-			return fmt.Errorf("Scooter %s is not available", cmd.ScooterID)
+// allTombstones merges the shards' tombstones. Callers hold every shard lock.
+func (sm *ScooterStateMachine) allTombstones() map[string]int64 {
+	tombstones := make(map[string]int64)
+	for _, shard := range sm.shards {
+		for id, index := range shard.tombstones {
+			tombstones[id] = index
 		}
+	}
+	return tombstones
+}
 
-		scooter.IsAvailable = false
-		scooter.ReservationID = cmd.ReservationID
+// MatchesCreate reports whether the scooter is exactly what applying the
+// Create command would produce, i.e. it hasn't changed since it was created.
+func (s *Scooter) MatchesCreate(cmd ScooterCommand) bool {
+	return cmd.CommandType == Create &&
+		s.ID == cmd.ScooterID &&
+		s.IsAvailable &&
+		s.TotalDistance == 0 &&
+		s.ReservationID == "" &&
+		!s.OutOfService &&
+		s.Version == 1 &&
+		sameLocation(s.Location, cmd.Location)
+}
 
+func sameLocation(a, b *Location) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+	return *a == *b
+}
 
-	case Release:
+// clone copies s, Location included, so the copy can be read without the
+// shard lock while applies go on
+func (s *Scooter) clone() Scooter {
+	copied := *s
+	if s.Location != nil {
+		location := *s.Location
+		copied.Location = &location
+	}
+	return copied
+}
 
-		scooter, exists := sm.scooters[cmd.ScooterID]
+// Public is the scooter as clients may see it, without the token that
+// proves who holds the reservation
+func (s *Scooter) Public() Scooter {
+	public := *s
+	public.ReservationToken = ""
+	return public
+}
 
-		if !exists {
-			return fmt.Errorf("Scooter %s does not exist", cmd.ScooterID)
+// Redacted is cmd without the reservation tokens and signatures it carries,
+// including inside a transaction's operations and a SetState's scooter, so
+// it can be shown to anyone who can read the log
+func (cmd ScooterCommand) Redacted() ScooterCommand {
+	cmd.ReservationToken = ""
+	cmd.Signature = ""
+	if cmd.State != nil {
+		state := cmd.State.Public()
+		cmd.State = &state
+	}
+	if cmd.Operations != nil {
+		operations := make([]ScooterCommand, len(cmd.Operations))
+		for i, op := range cmd.Operations {
+			operations[i] = op.Redacted()
 		}
+		cmd.Operations = operations
+	}
+	return cmd
+}
 
-		if scooter.IsAvailable {
-			return fmt.Errorf("Scooter %s is already available", cmd.ScooterID)
+// HeldBy reports whether token may release the scooter. Reservations made
+// before tokens existed carry none and accept any release.
+func (s *Scooter) HeldBy(token string) bool {
+	return s.ReservationToken == "" || s.ReservationToken == token
+}
+
+// checkReserve returns why cmd can't reserve the scooter, if anything.
+// active is how many reservations cmd's client already holds.
+func checkReserve(scooter *Scooter, exists bool, cmd ScooterCommand, active int) error {
+	if !exists {
+		return reject("Scooter %s does not exist", cmd.ScooterID)
+	}
+
+	if !scooter.IsAvailable {
+		return reject("Scooter %s is not available", cmd.ScooterID)
+	}
+
+	if scooter.OutOfService {
+		return reject("Scooter %s is out of service", cmd.ScooterID)
+	}
+
+	if cmd.ExpectedVersion != nil && *cmd.ExpectedVersion != scooter.Version {
+		return reject("Scooter %s is at version %d, expected %d", cmd.ScooterID, scooter.Version, *cmd.ExpectedVersion)
+	}
+
+	if cmd.ClientID != "" && cmd.ReservationQuota > 0 && active >= cmd.ReservationQuota {
+		return reject("Client %s already has %d active reservations", cmd.ClientID, active)
+	}
+	return nil
+}
+
+// checkRelease returns why cmd can't release the scooter, if anything
+func checkRelease(scooter *Scooter, exists bool, cmd ScooterCommand) error {
+	if !exists {
+		return reject("Scooter %s does not exist", cmd.ScooterID)
+	}
+
+	if scooter.IsAvailable {
+		return reject("Scooter %s is already available", cmd.ScooterID)
+	}
+
+	if !scooter.HeldBy(cmd.ReservationToken) {
+		return reject("Reservation token does not match scooter %s", cmd.ScooterID)
+	}
+
+	if !scooter.PlausibleRelease(cmd.Distance, cmd.Timestamp, cmd.MaxSpeedKmh) {
+		return reject("Release of scooter %s implies more than %.0f km/h", cmd.ScooterID, cmd.MaxSpeedKmh)
+	}
+	return checkSplit(cmd)
+}
+
+func (s *Scooter) reserve(cmd ScooterCommand) {
+	s.IsAvailable = false
+	s.ReservationID = cmd.ReservationID
+	s.ReservedAt = cmd.Timestamp
+	s.ClientID = cmd.ClientID
+	s.ReservationToken = cmd.ReservationToken
+	s.Version++
+}
+
+// release returns the client that held the reservation
+func (s *Scooter) release(cmd ScooterCommand) string {
+	clientID := s.ClientID
+	s.IsAvailable = true
+	s.TotalDistance += float64(cmd.Distance)
+	s.ReservationID = ""
+	s.ReservedAt = 0
+	s.ReservationToken = ""
+	s.ClientID = ""
+	s.Version++
+	return clientID
+}
+
+// adjustReservations changes clientID's active reservation count by delta.
+// The caller holds sm.mutex.
+func (sm *ScooterStateMachine) adjustReservations(clientID string, delta int) {
+	if clientID == "" {
+		return
+	}
+	sm.clientReservations[clientID] += delta
+	if sm.clientReservations[clientID] <= 0 {
+		delete(sm.clientReservations, clientID)
+	}
+}
+
+// ImpliedSpeedKmh is the average speed of covering distance meters between
+// reservedAt and releasedAt (unix milliseconds). A non-positive duration with
+// any distance is infinitely fast.
+func ImpliedSpeedKmh(distance int64, reservedAt int64, releasedAt int64) float64 {
+	if distance <= 0 {
+		return 0
+	}
+	elapsed := releasedAt - reservedAt
+	if elapsed <= 0 {
+		return math.Inf(1)
+	}
+	return (float64(distance) / 1000) / (float64(elapsed) / float64(time.Hour/time.Millisecond))
+}
+
+// PlausibleRelease reports whether releasing with distance at releasedAt
+// stays within maxSpeedKmh. Without a limit or a recorded reservation time
+// there is nothing to check.
+func (s *Scooter) PlausibleRelease(distance int64, releasedAt int64, maxSpeedKmh float64) bool {
+	if maxSpeedKmh <= 0 || s.ReservedAt == 0 || releasedAt == 0 {
+		return true
+	}
+	return ImpliedSpeedKmh(distance, s.ReservedAt, releasedAt) <= maxSpeedKmh
+}
+
+// Apply runs the command at index and then applies the apply error policy
+// to the outcome. Rejections by the rules are ordinary results; anything
+// else means this replica could not apply what the others did.
+//
+// On success the result is a []Scooter holding, as of right after this
+// command, every scooter it named that still exists.
+func (sm *ScooterStateMachine) Apply(index int64, commandBytes []byte) (Result, error) {
+	if halted := sm.HaltError(); halted != nil {
+		return nil, halted
+	}
+
+	var result []Scooter
+	err := sm.apply(index, commandBytes, &result)
+	if err == nil {
+		return result, nil
+	}
+	if IsRejection(err) {
+		return nil, err
+	}
+
+	fmt.Printf("Failed to apply entry %d: %v\n", index, err)
+	if sm.ApplyErrorPolicy() == HaltOnApplyError {
+		sm.mutex.Lock()
+		if sm.halted == nil {
+			sm.halted = &ErrHalted{Index: index, Err: err}
+			fmt.Printf("Halting state machine: %v\n", sm.halted)
 		}
+		sm.mutex.Unlock()
+	}
+	return nil, err
+}
+
+// apply must be deterministic: every replica applies the same commands and
+// has to end up in the same state. Never read the clock or generate random
+// values here; anything like that belongs in the command.
+func (sm *ScooterStateMachine) apply(index int64, commandBytes []byte, result *[]Scooter) error {
+	var cmd ScooterCommand 
 
-		scooter.IsAvailable = true
-		scooter.TotalDistance += float64(cmd.Distance)
-		scooter.ReservationID = ""
+	sm.applyMutex.Lock()
+	defer sm.applyMutex.Unlock()
 
-	case Noop:
+	err := json.Unmarshal(commandBytes, &cmd)
 
+	var touched []string
+	if err == nil {
+		touched = cmd.scooterIDs()
 	}
+	defer sm.unlockShards(sm.lockShards(touched...))
+	// Runs before the shards are unlocked, so no later command shows through
+	defer func() { *result = sm.scootersLocked(touched) }()
 
-		return nil
+	// The entry at index has been processed even if it turns out to be
+	// malformed or rejected, so applied progress moves forward either way
+	sm.mutex.Lock()
+	sm.markAppliedLocked(index)
+	sm.mutex.Unlock()
+
+  	if err != nil{                            
+      return err                             
+  	}  
+
+	if cmd.Expired() {
+		return reject("Command created at %d expired before it was proposed at %d", cmd.CreatedAt, cmd.Timestamp)
+	}
+
+	sm.applying = index
+	return sm.dispatch(cmd)
+}
+
+// Skip records index as applied without applying anything, for an entry
+// that belongs to another state machine sharing the log
+func (sm *ScooterStateMachine) Skip(index int64) {
+	sm.applyMutex.Lock()
+	defer sm.applyMutex.Unlock()
+	sm.mutex.Lock()
+	defer sm.mutex.Unlock()
+	sm.markAppliedLocked(index)
+}
+
+// markAppliedLocked records index as applied. appliedIndex only moves when
+// index is the next one, then on through any indexes applied past the gap
+// it filled.
+func (sm *ScooterStateMachine) markAppliedLocked(index int64) {
+	if index <= sm.appliedIndex {
+		return
+	}
+	if index > sm.appliedIndex+1 {
+		sm.appliedAbove[index] = true
+		return
+	}
+	sm.raiseAppliedLocked(index)
 }
 
-func (sm *ScooterStateMachine) GetScooter(scooterID string) (*Scooter, bool) {
+// raiseAppliedLocked moves appliedIndex up to index and past any indexes
+// already applied right after it
+func (sm *ScooterStateMachine) raiseAppliedLocked(index int64) {
+	for above := range sm.appliedAbove {
+		if above <= index {
+			delete(sm.appliedAbove, above)
+		}
+	}
+	sm.appliedIndex = index
+	for sm.appliedAbove[sm.appliedIndex+1] {
+		delete(sm.appliedAbove, sm.appliedIndex+1)
+		sm.appliedIndex++
+	}
+}
 
+// IsApplied reports whether the entry at index has been applied or
+// skipped, whether or not everything before it has
+func (sm *ScooterStateMachine) IsApplied(index int64) bool {
 	sm.mutex.RLock()
 	defer sm.mutex.RUnlock()
+	return index <= sm.appliedIndex || sm.appliedAbove[index]
+}
+
+// scooterIDs are the scooters cmd may touch, whose shards apply locks
+func (cmd ScooterCommand) scooterIDs() []string {
+	if cmd.CommandType == Noop {
+		return nil
+	}
+	ids := []string{cmd.ScooterID}
+	if cmd.NewScooterID != "" {
+		ids = append(ids, cmd.NewScooterID)
+	}
+	if cmd.SourceScooterID != "" {
+		ids = append(ids, cmd.SourceScooterID)
+	}
+	for _, op := range cmd.Operations {
+		ids = append(ids, op.ScooterID)
+	}
+	return ids
+}
 
-	scooter, exists := sm.scooters[scooterID]
-	return scooter, exists
+// GetScooter returns a copy of the scooter, which later applies don't change
+func (sm *ScooterStateMachine) GetScooter(scooterID string) (Scooter, bool) {
+	shard := sm.shardFor(scooterID)
+	shard.mutex.RLock()
+	defer shard.mutex.RUnlock()
+
+	scooter, exists := shard.scooters[scooterID]
+	if !exists {
+		return Scooter{}, false
+	}
+	return scooter.clone(), true
 }
 
-func (sm *ScooterStateMachine) GetScooters() []*Scooter {
+func (sm *ScooterStateMachine) ActiveReservations(clientID string) int {
 	sm.mutex.RLock()
 	defer sm.mutex.RUnlock()
 
-	scooterList := make([]*Scooter, 0, len(sm.scooters))
+	return sm.clientReservations[clientID]
+}
+
+// GetScooters returns copies of every scooter, like GetScooter
+func (sm *ScooterStateMachine) GetScooters() []Scooter {
+	sm.rLockAll()
+	defer sm.rUnlockAll()
+
+	scooterList := make([]Scooter, 0)
 
-	for _, scooter := range sm.scooters {
-		scooterList = append(scooterList, scooter)
+	for _, shard := range sm.shards {
+		for _, scooter := range shard.scooters {
+			scooterList = append(scooterList, scooter.clone())
+		}
 	}
 
 	return scooterList
 }
 
-func (sm *ScooterStateMachine) TakeSnapshot(index int64) error {
-	sm.mutex.Lock()
-	defer sm.mutex.Unlock()
+type FleetStats struct {
+	Total         int     `json:"total"`
+	Available     int     `json:"available"`
+	Reserved      int     `json:"reserved"`
+	OutOfService  int     `json:"out_of_service"`
+	TotalDistance float64 `json:"total_distance"`
+}
+
+func (sm *ScooterStateMachine) GetStats() FleetStats {
+	sm.rLockAll()
+	defer sm.rUnlockAll()
+
+	var stats FleetStats
+	for _, scooter := range sm.allScooters() {
+		stats.Total++
+		if scooter.IsAvailable {
+			stats.Available++
+		} else {
+			stats.Reserved++
+		}
+		if scooter.OutOfService {
+			stats.OutOfService++
+		}
+		stats.TotalDistance += scooter.TotalDistance
+	}
+	return stats
+}
 
-	data, err := json.Marshal(sm.scooters)
+func (sm *ScooterStateMachine) TakeSnapshot(index int64) error {
+	sm.rLockAll()
+	sm.mutex.RLock()
+	data, err := encodeSnapshot(snapshotState{Scooters: sm.allScooters(), Tombstones: sm.allTombstones(), ClientDistances: sm.clientDistances})
+	sm.mutex.RUnlock()
+	sm.rUnlockAll()
 
 	if err != nil {
 		return err
 	}
 
+	sm.mutex.Lock()
+	defer sm.mutex.Unlock()
 	sm.snapshotData = data
 	sm.snapshotIndex = index
+	sm.retainSnapshotLocked(data, index)
 	return nil
 }
 
@@ -149,17 +664,63 @@ func (sm *ScooterStateMachine) GetSnapshot() ([]byte, int64) {
 }
 
 func (sm* ScooterStateMachine) LoadSnapshot(data []byte, index int64) error {
-	sm.mutex.Lock()
-	defer sm.mutex.Unlock()
-
-	var scooters map[string]*Scooter
+	return sm.loadSnapshot(data, index, false)
+}
 
-	if err := json.Unmarshal(data, &scooters); err != nil {
+// loadSnapshot replaces the state with data. Unless rewind is set the
+// applied index only ever moves forward. Decoding and building the new maps
+// happen before any lock is taken, so reads only wait for the swap.
+func (sm *ScooterStateMachine) loadSnapshot(data []byte, index int64, rewind bool) error {
+	state, err := decodeSnapshot(data)
+	if err != nil {
 		return err
 	}
 
-	sm.scooters = scooters
+	shardScooters := make([]map[string]*Scooter, shardCount)
+	shardTombstones := make([]map[string]int64, shardCount)
+	for i := range shardScooters {
+		shardScooters[i] = make(map[string]*Scooter)
+		shardTombstones[i] = make(map[string]int64)
+	}
+	clientReservations := make(map[string]int)
+	for id, scooter := range state.Scooters {
+		shardScooters[shardIndex(id)][id] = scooter
+		if !scooter.IsAvailable && scooter.ClientID != "" {
+			clientReservations[scooter.ClientID]++
+		}
+	}
+	for id, index := range state.Tombstones {
+		shardTombstones[shardIndex(id)][id] = index
+	}
+	clientDistances := make(map[string]int64, len(state.ClientDistances))
+	for clientID, distance := range state.ClientDistances {
+		clientDistances[clientID] = distance
+	}
+
+	sm.applyMutex.Lock()
+	defer sm.applyMutex.Unlock()
+	for i, shard := range sm.shards {
+		shard.mutex.Lock()
+		defer shard.mutex.Unlock()
+		shard.scooters = shardScooters[i]
+		shard.tombstones = shardTombstones[i]
+	}
+
+	sm.mutex.Lock()
+	defer sm.mutex.Unlock()
+	sm.clientReservations = clientReservations
+	sm.clientDistances = clientDistances
+	// Keep the data with its index, so a node that recovered from a
+	// snapshot can hand the same one on to the next node that needs it
+	sm.snapshotData = data
 	sm.snapshotIndex = index
+	// A rewound state has applied nothing past the snapshot
+	if rewind {
+		sm.appliedAbove = make(map[int64]bool)
+		sm.appliedIndex = index
+	} else if index > sm.appliedIndex {
+		sm.raiseAppliedLocked(index)
+	}
 	return nil
 }
 
@@ -168,4 +729,56 @@ func (sm *ScooterStateMachine) GetSnapshotIndex() int64 {
 	defer sm.mutex.RUnlock()
 
 	return sm.snapshotIndex
-}
\ No newline at end of file
+}
+
+// AppliedIndex is the highest index up to which every entry has been
+// applied, so state read after waiting for it reflects every commit up to
+// that index
+func (sm *ScooterStateMachine) AppliedIndex() int64 {
+	sm.mutex.RLock()
+	defer sm.mutex.RUnlock()
+
+	return sm.appliedIndex
+}
+
+// StateHash returns a SHA-256 over the applied index and every scooter in ID
+// order, along with the applied index it covers. Two replicas that applied
+// the same commands up to the same index produce the same hash.
+func (sm *ScooterStateMachine) StateHash() (string, int64, error) {
+	sm.rLockAll()
+	defer sm.rUnlockAll()
+	sm.mutex.RLock()
+	defer sm.mutex.RUnlock()
+
+	scooters := sm.allScooters()
+	ids := make([]string, 0, len(scooters))
+	for id := range scooters {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+
+	hash := sha256.New()
+	fmt.Fprintf(hash, "applied:%d\n", sm.appliedIndex)
+	for _, id := range ids {
+		data, err := json.Marshal(scooters[id])
+		if err != nil {
+			return "", 0, err
+		}
+		hash.Write(data)
+		hash.Write([]byte{'\n'})
+	}
+
+	tombstones := sm.allTombstones()
+	deleted := make([]string, 0, len(tombstones))
+	for id := range tombstones {
+		deleted = append(deleted, id)
+	}
+	sort.Strings(deleted)
+	for _, id := range deleted {
+		fmt.Fprintf(hash, "deleted:%s:%d\n", id, tombstones[id])
+	}
+	for _, clientID := range sm.sortedClientDistances() {
+		fmt.Fprintf(hash, "client:%s:%d\n", clientID, sm.clientDistances[clientID])
+	}
+	return hex.EncodeToString(hash.Sum(nil)), sm.appliedIndex, nil
+}
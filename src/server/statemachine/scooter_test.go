@@ -0,0 +1,338 @@
+package statemachine
+
+import (
+	"encoding/json"
+	"fmt"
+	"runtime"
+	"runtime/debug"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func encode(t testing.TB, cmd ScooterCommand) []byte {
+	t.Helper()
+	commandBytes, err := json.Marshal(cmd)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return commandBytes
+}
+
+// newFleet returns a state machine holding count scooters, created at
+// indexes 1 to count after a Noop at 0
+func newFleet(t testing.TB, count int) *ScooterStateMachine {
+	t.Helper()
+	sm := NewScooterStateMachine()
+	if _, err := sm.Apply(0, encode(t, ScooterCommand{CommandType: Noop})); err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < count; i++ {
+		command := encode(t, ScooterCommand{CommandType: Create, ScooterID: fmt.Sprintf("scooter-%d", i)})
+		if _, err := sm.Apply(int64(i+1), command); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return sm
+}
+
+// Run with -race: readers go through every field of the scooters they get
+// back while applies keep changing the same scooters
+func TestReadsDuringApplyDontRace(t *testing.T) {
+	const fleet = 64
+	sm := newFleet(t, fleet)
+
+	stop := make(chan struct{})
+	var readers sync.WaitGroup
+	for r := 0; r < 4; r++ {
+		readers.Add(1)
+		go func(r int) {
+			defer readers.Done()
+			for i := 0; ; i++ {
+				select {
+				case <-stop:
+					return
+				default:
+				}
+				if scooter, exists := sm.GetScooter(fmt.Sprintf("scooter-%d", (i+r)%fleet)); exists {
+					_ = scooter.OutOfService
+					_ = scooter.Version
+				}
+				for _, scooter := range sm.GetScooters() {
+					_ = scooter.OutOfService
+					_ = scooter.Version
+				}
+			}
+		}(r)
+	}
+
+	index := int64(fleet)
+	for round := 0; round < 20; round++ {
+		for i := 0; i < fleet; i++ {
+			index++
+			command := encode(t, ScooterCommand{
+				CommandType:  SetServiceState,
+				ScooterID:    fmt.Sprintf("scooter-%d", i),
+				OutOfService: round%2 == 0,
+			})
+			if _, err := sm.Apply(index, command); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+	close(stop)
+	readers.Wait()
+}
+
+func TestGetScooterReturnsCopy(t *testing.T) {
+	sm := newFleet(t, 1)
+	before, _ := sm.GetScooter("scooter-0")
+
+	command := encode(t, ScooterCommand{CommandType: SetServiceState, ScooterID: "scooter-0", OutOfService: true})
+	if _, err := sm.Apply(2, command); err != nil {
+		t.Fatal(err)
+	}
+	if before.OutOfService {
+		t.Fatal("a later apply changed the scooter GetScooter returned")
+	}
+	if after, _ := sm.GetScooter("scooter-0"); !after.OutOfService {
+		t.Fatal("expected the apply to show in a new GetScooter")
+	}
+}
+
+// BenchmarkGetScooterDuringApply reads random scooters in parallel while
+// one goroutine keeps applying to others. With sharded locks the reads only
+// wait when they land on the shard being applied to.
+func BenchmarkGetScooterDuringApply(b *testing.B) {
+	const fleet = 1024
+	sm := newFleet(b, fleet)
+
+	stop := make(chan struct{})
+	applied := make(chan struct{})
+	go func() {
+		defer close(applied)
+		index := int64(fleet)
+		for i := 0; ; i++ {
+			select {
+			case <-stop:
+				return
+			default:
+			}
+			index++
+			command, _ := json.Marshal(ScooterCommand{
+				CommandType:  SetServiceState,
+				ScooterID:    fmt.Sprintf("scooter-%d", i%fleet),
+				OutOfService: (i/fleet)%2 == 0,
+			})
+			sm.Apply(index, command)
+		}
+	}()
+
+	b.ResetTimer()
+	b.RunParallel(func(pb *testing.PB) {
+		i := 0
+		for pb.Next() {
+			sm.GetScooter(fmt.Sprintf("scooter-%d", i%fleet))
+			i += 7
+		}
+	})
+	b.StopTimer()
+	close(stop)
+	<-applied
+}
+
+func TestStateHashAgreesOnlyForSameState(t *testing.T) {
+	first, second, diverged := newFleet(t, 20), newFleet(t, 20), newFleet(t, 20)
+
+	// The diverged replica applied a different command at index 21
+	toggle := encode(t, ScooterCommand{CommandType: SetServiceState, ScooterID: "scooter-3", OutOfService: true})
+	for _, sm := range []*ScooterStateMachine{first, second} {
+		if _, err := sm.Apply(21, toggle); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, err := diverged.Apply(21, encode(t, ScooterCommand{CommandType: SetServiceState, ScooterID: "scooter-4", OutOfService: true})); err != nil {
+		t.Fatal(err)
+	}
+
+	firstHash, firstIndex, err := first.StateHash()
+	if err != nil {
+		t.Fatal(err)
+	}
+	secondHash, secondIndex, _ := second.StateHash()
+	divergedHash, divergedIndex, _ := diverged.StateHash()
+
+	if firstIndex != 21 || secondIndex != 21 || divergedIndex != 21 {
+		t.Fatalf("expected every replica at index 21, got %d, %d and %d", firstIndex, secondIndex, divergedIndex)
+	}
+	if firstHash != secondHash {
+		t.Fatal("identically applied replicas hash differently")
+	}
+	if divergedHash == firstHash {
+		t.Fatal("a diverged replica hashes the same as the others")
+	}
+}
+
+// Entries applied past a gap count as applied, but the applied index only
+// moves past them once the gap is filled
+func TestAppliedIndexStopsAtGaps(t *testing.T) {
+	sm := NewScooterStateMachine()
+	noop := encode(t, ScooterCommand{CommandType: Noop})
+	for _, index := range []int64{0, 2, 3} {
+		if _, err := sm.Apply(index, noop); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if applied := sm.AppliedIndex(); applied != 0 {
+		t.Fatalf("applied index %d with 1 missing, want 0", applied)
+	}
+	if !sm.IsApplied(2) || sm.IsApplied(1) {
+		t.Fatal("expected 2 applied and 1 not")
+	}
+
+	if _, err := sm.Apply(1, noop); err != nil {
+		t.Fatal(err)
+	}
+	if applied := sm.AppliedIndex(); applied != 3 {
+		t.Fatalf("applied index %d once 1 arrived, want 3", applied)
+	}
+
+	// A snapshot covers the gap below it, and the index moves on through
+	// what was applied just past it
+	if _, err := sm.Apply(7, noop); err != nil {
+		t.Fatal(err)
+	}
+	peer := newFleet(t, 5)
+	if err := peer.TakeSnapshot(5); err != nil {
+		t.Fatal(err)
+	}
+	snapshot, _ := peer.GetSnapshot()
+	if err := sm.LoadSnapshot(snapshot, 5); err != nil {
+		t.Fatal(err)
+	}
+	if applied := sm.AppliedIndex(); applied != 5 {
+		t.Fatalf("applied index %d after a snapshot at 5, want 5", applied)
+	}
+	if _, err := sm.Apply(6, noop); err != nil {
+		t.Fatal(err)
+	}
+	if applied := sm.AppliedIndex(); applied != 7 {
+		t.Fatalf("applied index %d once 6 arrived, want 7", applied)
+	}
+}
+
+// largeSnapshot encodes count scooters, every tenth one reserved, along with
+// a tombstone and a client distance for each reservation
+func largeSnapshot(t testing.TB, count int) []byte {
+	t.Helper()
+	state := snapshotState{
+		Scooters:        make(map[string]*Scooter, count),
+		Tombstones:      make(map[string]int64),
+		ClientDistances: make(map[string]int64),
+	}
+	for i := 0; i < count; i++ {
+		id := fmt.Sprintf("scooter-%d", i)
+		scooter := &Scooter{ID: id, IsAvailable: true, Version: 1, Location: &Location{Lat: 1, Lng: 2}}
+		if i%10 == 0 {
+			client := fmt.Sprintf("client-%d", i)
+			scooter.IsAvailable = false
+			scooter.ClientID = client
+			scooter.ReservationID = fmt.Sprintf("reservation-%d", i)
+			state.Tombstones[fmt.Sprintf("deleted-%d", i)] = int64(i)
+			state.ClientDistances[client] = int64(i)
+		}
+		state.Scooters[id] = scooter
+	}
+	data, err := encodeSnapshot(state)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return data
+}
+
+// parkedLoad starts loading data into sm while the caller holds
+// sm.applyMutex, and returns once the load is waiting for it, i.e. has done
+// everything it does before taking a lock. The channel yields the load's
+// error after the caller unlocks.
+func parkedLoad(t testing.TB, sm *ScooterStateMachine, data []byte, index int64) <-chan error {
+	t.Helper()
+	done := make(chan error, 1)
+	go func() {
+		done <- sm.LoadSnapshot(data, index)
+	}()
+
+	buf := make([]byte, 1<<20)
+	for deadline := time.Now().Add(time.Minute); time.Now().Before(deadline); time.Sleep(time.Millisecond) {
+		stacks := string(buf[:runtime.Stack(buf, true)])
+		for _, stack := range strings.Split(stacks, "\n\n") {
+			if strings.Contains(stack, "[sync.Mutex.Lock") && strings.Contains(stack, ").loadSnapshot(") {
+				return done
+			}
+		}
+	}
+	t.Fatal("snapshot load never reached the apply lock")
+	return nil
+}
+
+// swapTime unlocks sm.applyMutex under a parked load and returns how long
+// the load took from there, which is how long it holds the locks
+func swapTime(t testing.TB, sm *ScooterStateMachine, done <-chan error) time.Duration {
+	t.Helper()
+	start := time.Now()
+	sm.applyMutex.Unlock()
+	if err := <-done; err != nil {
+		t.Fatal(err)
+	}
+	return time.Since(start)
+}
+
+// A load decodes the snapshot and builds the new maps before it locks
+// anything, so reads carry on with the old state until the maps are swapped
+// in, and the swap doesn't grow with the fleet. GC is off so a collection
+// doesn't land in the timing.
+func TestReadsProceedDuringSnapshotLoad(t *testing.T) {
+	const fleet = 100000
+	data := largeSnapshot(t, fleet)
+	sm := newFleet(t, 1)
+	defer debug.SetGCPercent(debug.SetGCPercent(-1))
+
+	sm.applyMutex.Lock()
+	done := parkedLoad(t, sm, data, 1)
+	if _, exists := sm.GetScooter("scooter-0"); !exists {
+		t.Fatal("scooter-0 missing while the snapshot was loading")
+	}
+	if got := len(sm.GetScooters()); got != 1 {
+		t.Fatalf("%d scooters before the swap, want the old 1", got)
+	}
+	if stats := sm.GetStats(); stats.Total != 1 {
+		t.Fatalf("stats before the swap: %+v", stats)
+	}
+
+	if held := swapTime(t, sm, done); held > 5*time.Millisecond {
+		t.Fatalf("loading %d scooters held the locks for %v", fleet, held)
+	}
+	if got := len(sm.GetScooters()); got != fleet {
+		t.Fatalf("%d scooters after loading, want %d", got, fleet)
+	}
+	if got := sm.ActiveReservations("client-10"); got != 1 {
+		t.Fatalf("client-10 holds %d reservations after loading, want 1", got)
+	}
+}
+
+// BenchmarkLoadSnapshotLockHold reports how long each load holds the locks,
+// next to how long the whole load takes
+func BenchmarkLoadSnapshotLockHold(b *testing.B) {
+	data := largeSnapshot(b, 200000)
+	sm := newFleet(b, 1)
+
+	b.ResetTimer()
+	var held time.Duration
+	start := time.Now()
+	for i := 0; i < b.N; i++ {
+		sm.applyMutex.Lock()
+		held += swapTime(b, sm, parkedLoad(b, sm, data, int64(i+1)))
+	}
+	b.ReportMetric(float64(time.Since(start).Milliseconds())/float64(b.N), "ms/load")
+	b.ReportMetric(float64(held.Microseconds())/float64(b.N), "us-locked/load")
+}
@@ -0,0 +1,66 @@
+package statemachine
+
+import (
+	"sort"
+)
+
+// GeoBox is an inclusive latitude/longitude rectangle
+type GeoBox struct {
+	MinLat float64
+	MaxLat float64
+	MinLng float64
+	MaxLng float64
+}
+
+func (b GeoBox) Contains(location *Location) bool {
+	return location != nil &&
+		location.Lat >= b.MinLat && location.Lat <= b.MaxLat &&
+		location.Lng >= b.MinLng && location.Lng <= b.MaxLng
+}
+
+// ScooterFilter is a conjunction of predicates; nil fields don't filter.
+// MinDistance and MaxDistance bound TotalDistance inclusively, and a Box
+// only matches scooters created with a location.
+type ScooterFilter struct {
+	Available    *bool
+	OutOfService *bool
+	MinDistance  *float64
+	MaxDistance  *float64
+	Box          *GeoBox
+}
+
+func (f ScooterFilter) Matches(scooter *Scooter) bool {
+	switch {
+	case f.Available != nil && scooter.IsAvailable != *f.Available:
+		return false
+	case f.OutOfService != nil && scooter.OutOfService != *f.OutOfService:
+		return false
+	case f.MinDistance != nil && scooter.TotalDistance < *f.MinDistance:
+		return false
+	case f.MaxDistance != nil && scooter.TotalDistance > *f.MaxDistance:
+		return false
+	case f.Box != nil && !f.Box.Contains(scooter.Location):
+		return false
+	}
+	return true
+}
+
+// Search returns every scooter matching filter, ordered by ID, from one
+// pass over a consistent view of the fleet
+func (sm *ScooterStateMachine) Search(filter ScooterFilter) []Scooter {
+	sm.rLockAll()
+	defer sm.rUnlockAll()
+
+	matches := make([]Scooter, 0)
+	for _, shard := range sm.shards {
+		for _, scooter := range shard.scooters {
+			if filter.Matches(scooter) {
+				matches = append(matches, scooter.Public())
+			}
+		}
+	}
+	sort.Slice(matches, func(i, j int) bool {
+		return matches[i].ID < matches[j].ID
+	})
+	return matches
+}
@@ -0,0 +1,147 @@
+package statemachine
+
+import (
+	"crypto/ed25519"
+	"encoding/base64"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// DefaultSigningKey is the client ID under which ParseSigningKeys takes the
+// key for clients without one of their own
+const DefaultSigningKey = "*"
+
+// SigningKeys are the ed25519 public keys Reserve and Release signatures are
+// checked against. Apply checks them too, so every replica must be given
+// the same keys.
+type SigningKeys struct {
+	// Default verifies clients with no key in Clients
+	Default ed25519.PublicKey
+	Clients map[string]ed25519.PublicKey
+	// Required rejects Reserve and Release commands that aren't signed
+	Required bool
+}
+
+// ErrSignature is a Reserve or Release whose signature is missing or
+// doesn't verify
+type ErrSignature struct {
+	ClientID string
+	Reason   string
+}
+
+func (e *ErrSignature) Error() string {
+	return fmt.Sprintf("Signature for client %q %s", e.ClientID, e.Reason)
+}
+
+// ParseSigningKeys reads keys given as client=base64key,... where the
+// client * sets the default key
+func ParseSigningKeys(value string) (SigningKeys, error) {
+	keys := SigningKeys{Clients: make(map[string]ed25519.PublicKey)}
+	if value == "" {
+		return keys, nil
+	}
+	for _, pair := range strings.Split(value, ",") {
+		clientID, encoded, found := strings.Cut(pair, "=")
+		if !found || clientID == "" {
+			return keys, fmt.Errorf("signing key %q is not client=base64key", pair)
+		}
+		key, err := base64.StdEncoding.DecodeString(encoded)
+		if err != nil || len(key) != ed25519.PublicKeySize {
+			return keys, fmt.Errorf("signing key of %s is not a base64 ed25519 public key", clientID)
+		}
+		if clientID == DefaultSigningKey {
+			keys.Default = key
+		} else {
+			keys.Clients[clientID] = key
+		}
+	}
+	return keys, nil
+}
+
+func (keys SigningKeys) keyFor(clientID string) ed25519.PublicKey {
+	if key, exists := keys.Clients[clientID]; exists {
+		return key
+	}
+	return keys.Default
+}
+
+// SigningPayload is what a client signs for cmd: the command type and the
+// fields the client chose, one per line. What the proposing node fills in,
+// like timestamps and a Reserve's token, is left out.
+//
+//	RESERVE\n<scooter_id>\n<reservation_id>\n<client_id>
+//	RELEASE\n<scooter_id>\n<reservation_token>\n<distance>
+//
+// A Release's distance split follows as one <client_id>=<share> line per
+// co-rider, sorted by client ID. Other commands have no payload.
+func (cmd ScooterCommand) SigningPayload() []byte {
+	switch cmd.CommandType {
+	case Reserve:
+		return []byte(strings.Join([]string{Reserve, cmd.ScooterID, cmd.ReservationID, cmd.ClientID}, "\n"))
+	case Release:
+		lines := []string{Release, cmd.ScooterID, cmd.ReservationToken, fmt.Sprint(cmd.Distance)}
+		clientIDs := make([]string, 0, len(cmd.DistanceSplit))
+		for clientID := range cmd.DistanceSplit {
+			clientIDs = append(clientIDs, clientID)
+		}
+		sort.Strings(clientIDs)
+		for _, clientID := range clientIDs {
+			lines = append(lines, fmt.Sprintf("%s=%d", clientID, cmd.DistanceSplit[clientID]))
+		}
+		return []byte(strings.Join(lines, "\n"))
+	}
+	return nil
+}
+
+// Verify checks cmd's signature against signer's key. For a Reserve the
+// signer is the client reserving, for a Release the one holding the
+// reservation. Without a signature, or with no key to check it against,
+// cmd passes unless signatures are required.
+func (keys SigningKeys) Verify(cmd ScooterCommand, signer string) error {
+	if cmd.SigningPayload() == nil {
+		return nil
+	}
+	if cmd.Signature == "" {
+		if keys.Required {
+			return &ErrSignature{ClientID: signer, Reason: "is required"}
+		}
+		return nil
+	}
+	key := keys.keyFor(signer)
+	if key == nil {
+		if keys.Required {
+			return &ErrSignature{ClientID: signer, Reason: "can't be checked, the client has no key"}
+		}
+		return nil
+	}
+	signature, err := base64.StdEncoding.DecodeString(cmd.Signature)
+	if err != nil {
+		return &ErrSignature{ClientID: signer, Reason: "is not base64"}
+	}
+	if !ed25519.Verify(key, cmd.SigningPayload(), signature) {
+		return &ErrSignature{ClientID: signer, Reason: "does not match the command"}
+	}
+	return nil
+}
+
+// SetSigningKeys makes Reserve and Release verify signatures against keys
+func (sm *ScooterStateMachine) SetSigningKeys(keys SigningKeys) {
+	sm.mutex.Lock()
+	defer sm.mutex.Unlock()
+	sm.signingKeys = keys
+}
+
+func (sm *ScooterStateMachine) SigningKeys() SigningKeys {
+	sm.mutex.RLock()
+	defer sm.mutex.RUnlock()
+	return sm.signingKeys
+}
+
+// checkSignature is Verify as a rejection, for apply
+func checkSignature(keys SigningKeys, cmd ScooterCommand, signer string) error {
+	if err := keys.Verify(cmd, signer); err != nil {
+		return reject("%v", err)
+	}
+	return nil
+}
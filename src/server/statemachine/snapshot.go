@@ -0,0 +1,124 @@
+package statemachine
+
+import (
+	"encoding/json"
+	"fmt"
+)
+
+// SnapshotVersion is the format TakeSnapshot writes. Bump it whenever the
+// snapshotted state changes shape and register a migration from the
+// previous version in snapshotMigrations.
+//
+//	1: the bare scooters map, before snapshots had an envelope
+//	2: {version, data} envelope; scooters carry Version and ReservedAt
+//	3: data holds the scooters and the tombstones of deleted ones
+//	4: data also holds the per-client distance totals of split releases
+const SnapshotVersion = 4
+
+// snapshotState is the data of a current version snapshot
+type snapshotState struct {
+	Scooters   map[string]*Scooter `json:"scooters"`
+	Tombstones map[string]int64    `json:"tombstones"`
+	ClientDistances map[string]int64 `json:"client_distances"`
+}
+
+type snapshotEnvelope struct {
+	Version int             `json:"version"`
+	Data    json.RawMessage `json:"data"`
+}
+
+// snapshotMigrations[n] upgrades the data of a version n snapshot to n+1
+var snapshotMigrations = map[int]func(json.RawMessage) (json.RawMessage, error){
+	1: migrateSnapshotV1,
+	2: migrateSnapshotV2,
+	3: migrateSnapshotV3,
+}
+
+func encodeSnapshot(state snapshotState) ([]byte, error) {
+	data, err := json.Marshal(state)
+	if err != nil {
+		return nil, err
+	}
+	return json.Marshal(snapshotEnvelope{Version: SnapshotVersion, Data: data})
+}
+
+func decodeSnapshot(snapshot []byte) (snapshotState, error) {
+	var state snapshotState
+	version, data, err := unwrapSnapshot(snapshot)
+	if err != nil {
+		return state, err
+	}
+	if version > SnapshotVersion {
+		return state, fmt.Errorf("snapshot version %d is newer than supported version %d", version, SnapshotVersion)
+	}
+
+	for ; version < SnapshotVersion; version++ {
+		migrate, exists := snapshotMigrations[version]
+		if !exists {
+			return state, fmt.Errorf("no migration from snapshot version %d", version)
+		}
+		if data, err = migrate(data); err != nil {
+			return state, fmt.Errorf("migrating snapshot from version %d: %w", version, err)
+		}
+	}
+
+	if err := json.Unmarshal(data, &state); err != nil {
+		return state, err
+	}
+	return state, nil
+}
+
+// unwrapSnapshot tells an enveloped snapshot apart from a version 1 bare
+// map by looking for exactly the envelope's two keys.
+func unwrapSnapshot(snapshot []byte) (int, json.RawMessage, error) {
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(snapshot, &fields); err != nil {
+		return 0, nil, err
+	}
+
+	_, hasVersion := fields["version"]
+	_, hasData := fields["data"]
+	if len(fields) == 2 && hasVersion && hasData {
+		var envelope snapshotEnvelope
+		if err := json.Unmarshal(snapshot, &envelope); err == nil {
+			return envelope.Version, envelope.Data, nil
+		}
+	}
+	return 1, snapshot, nil
+}
+
+// Version 1 scooters predate optimistic versioning; start them at 1 like a
+// freshly created scooter so expected-version reservations work.
+func migrateSnapshotV1(data json.RawMessage) (json.RawMessage, error) {
+	var scooters map[string]*Scooter
+	if err := json.Unmarshal(data, &scooters); err != nil {
+		return nil, err
+	}
+	for _, scooter := range scooters {
+		if scooter.Version == 0 {
+			scooter.Version = 1
+		}
+	}
+	return json.Marshal(scooters)
+}
+
+// Version 2 snapshots were the bare scooters map and had no deletes to
+// remember.
+func migrateSnapshotV2(data json.RawMessage) (json.RawMessage, error) {
+	var scooters map[string]*Scooter
+	if err := json.Unmarshal(data, &scooters); err != nil {
+		return nil, err
+	}
+	return json.Marshal(snapshotState{Scooters: scooters, Tombstones: map[string]int64{}})
+}
+
+// Version 3 snapshots predate split releases, so no client has a distance
+// attributed yet
+func migrateSnapshotV3(data json.RawMessage) (json.RawMessage, error) {
+	var state snapshotState
+	if err := json.Unmarshal(data, &state); err != nil {
+		return nil, err
+	}
+	state.ClientDistances = map[string]int64{}
+	return json.Marshal(state)
+}
@@ -0,0 +1,83 @@
+package statemachine
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestLoadVersion1Snapshot(t *testing.T) {
+	// What TakeSnapshot wrote before snapshots had an envelope
+	v1 := []byte(`{"s1":{"id":"s1","is_available":true,"total_distance":12},"s2":{"id":"s2","is_available":false,"current_reservation_id":"r1"}}`)
+
+	sm := NewScooterStateMachine()
+	if err := sm.LoadSnapshot(v1, 7); err != nil {
+		t.Fatal(err)
+	}
+	s1, exists := sm.GetScooter("s1")
+	if !exists || s1.TotalDistance != 12 || !s1.IsAvailable {
+		t.Fatalf("expected s1 as snapshotted, got %+v", s1)
+	}
+	if s1.Version != 1 {
+		t.Fatalf("expected the migration to start s1 at version 1, got %d", s1.Version)
+	}
+	if s2, _ := sm.GetScooter("s2"); s2.ReservationID != "r1" || s2.Version != 1 {
+		t.Fatalf("expected s2 reserved under r1 at version 1, got %+v", s2)
+	}
+	if applied := sm.AppliedIndex(); applied != 7 {
+		t.Fatalf("expected applied index 7, got %d", applied)
+	}
+}
+
+func TestVersion1ScootersNamedLikeTheEnvelope(t *testing.T) {
+	// A bare map whose only scooters are called version and data is still
+	// a version 1 snapshot, not an envelope
+	v1 := []byte(`{"version":{"id":"version","is_available":true},"data":{"id":"data","is_available":true}}`)
+
+	state, err := decodeSnapshot(v1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(state.Scooters) != 2 || state.Scooters["version"] == nil || state.Scooters["data"] == nil {
+		t.Fatalf("expected scooters version and data, got %+v", state.Scooters)
+	}
+}
+
+func TestLoadVersion2Envelope(t *testing.T) {
+	v2 := []byte(`{"version":2,"data":{"s1":{"id":"s1","is_available":true,"version":4}}}`)
+
+	state, err := decodeSnapshot(v2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if state.Scooters["s1"] == nil || state.Scooters["s1"].Version != 4 {
+		t.Fatalf("expected s1 at version 4, got %+v", state.Scooters)
+	}
+	if state.Tombstones == nil || state.ClientDistances == nil {
+		t.Fatal("expected migrations to fill in tombstones and client distances")
+	}
+}
+
+func TestRejectNewerSnapshotVersion(t *testing.T) {
+	newer := []byte(`{"version":99,"data":{}}`)
+	if _, err := decodeSnapshot(newer); err == nil || !strings.Contains(err.Error(), "newer") {
+		t.Fatalf("expected a newer snapshot to be refused, got %v", err)
+	}
+}
+
+func TestSnapshotRoundTrip(t *testing.T) {
+	sm := newFleet(t, 5)
+	if err := sm.TakeSnapshot(5); err != nil {
+		t.Fatal(err)
+	}
+	data, index := sm.GetSnapshot()
+
+	loaded := NewScooterStateMachine()
+	if err := loaded.LoadSnapshot(data, index); err != nil {
+		t.Fatal(err)
+	}
+	want, _, _ := sm.StateHash()
+	got, _, _ := loaded.StateHash()
+	if got != want {
+		t.Fatal("a loaded snapshot doesn't hash like the state it was taken from")
+	}
+}
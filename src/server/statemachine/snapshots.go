@@ -0,0 +1,111 @@
+package statemachine
+
+import (
+	"fmt"
+)
+
+// DefaultSnapshotRetention keeps only the latest snapshot
+const DefaultSnapshotRetention = 1
+
+// RetainedSnapshot describes one snapshot kept by TakeSnapshot
+type RetainedSnapshot struct {
+	Index int64 `json:"index"`
+	Size  int   `json:"size_bytes"`
+	data  []byte
+}
+
+// ErrNoSnapshot is returned for a snapshot index that isn't retained
+type ErrNoSnapshot struct {
+	Index int64
+}
+
+func (e *ErrNoSnapshot) Error() string {
+	return fmt.Sprintf("no retained snapshot at index %d", e.Index)
+}
+
+// SetSnapshotRetention sets how many snapshots TakeSnapshot keeps, newest
+// included, so an older one can be restored if the newest turns out bad.
+// Anything under 1 keeps one. Snapshots live in memory like the rest of
+// the state.
+func (sm *ScooterStateMachine) SetSnapshotRetention(count int) {
+	sm.mutex.Lock()
+	defer sm.mutex.Unlock()
+	sm.snapshotRetention = max(count, 1)
+	sm.pruneSnapshotsLocked()
+}
+
+func (sm *ScooterStateMachine) SnapshotRetention() int {
+	sm.mutex.RLock()
+	defer sm.mutex.RUnlock()
+	return sm.snapshotRetention
+}
+
+// Snapshots lists the retained snapshots, oldest first
+func (sm *ScooterStateMachine) Snapshots() []RetainedSnapshot {
+	sm.mutex.RLock()
+	defer sm.mutex.RUnlock()
+	snapshots := make([]RetainedSnapshot, 0, len(sm.snapshots))
+	for _, snapshot := range sm.snapshots {
+		snapshots = append(snapshots, RetainedSnapshot{Index: snapshot.Index, Size: snapshot.Size})
+	}
+	return snapshots
+}
+
+// OldestSnapshotIndex is the index of the oldest retained snapshot, or -1.
+// The log must not be compacted past it or restoring it loses entries.
+func (sm *ScooterStateMachine) OldestSnapshotIndex() int64 {
+	sm.mutex.RLock()
+	defer sm.mutex.RUnlock()
+	if len(sm.snapshots) == 0 {
+		return -1
+	}
+	return sm.snapshots[0].Index
+}
+
+// retainSnapshotLocked records a snapshot just taken. Taking one again at
+// the same index replaces it.
+func (sm *ScooterStateMachine) retainSnapshotLocked(data []byte, index int64) {
+	snapshot := RetainedSnapshot{Index: index, Size: len(data), data: data}
+	if last := len(sm.snapshots) - 1; last >= 0 && sm.snapshots[last].Index == index {
+		sm.snapshots[last] = snapshot
+		return
+	}
+	sm.snapshots = append(sm.snapshots, snapshot)
+	sm.pruneSnapshotsLocked()
+}
+
+func (sm *ScooterStateMachine) pruneSnapshotsLocked() {
+	if excess := len(sm.snapshots) - sm.snapshotRetention; excess > 0 {
+		sm.snapshots = sm.snapshots[excess:]
+	}
+}
+
+// LoadRetainedSnapshot rewinds the state machine to the retained snapshot
+// at index, including the applied index, and forgets every newer snapshot.
+// The caller replays the log after index; nothing may be applied meanwhile.
+func (sm *ScooterStateMachine) LoadRetainedSnapshot(index int64) error {
+	sm.mutex.RLock()
+	position := -1
+	for i, snapshot := range sm.snapshots {
+		if snapshot.Index == index {
+			position = i
+		}
+	}
+	var data []byte
+	if position >= 0 {
+		data = sm.snapshots[position].data
+	}
+	sm.mutex.RUnlock()
+
+	if position < 0 {
+		return &ErrNoSnapshot{Index: index}
+	}
+	if err := sm.loadSnapshot(data, index, true); err != nil {
+		return err
+	}
+
+	sm.mutex.Lock()
+	defer sm.mutex.Unlock()
+	sm.snapshots = sm.snapshots[:position+1]
+	return nil
+}
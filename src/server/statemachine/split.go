@@ -0,0 +1,55 @@
+package statemachine
+
+import (
+	"sort"
+)
+
+// checkSplit returns why a release's DistanceSplit can't be used, if
+// anything. No split is always fine.
+func checkSplit(cmd ScooterCommand) error {
+	if len(cmd.DistanceSplit) == 0 {
+		return nil
+	}
+
+	var sum int64
+	for clientID, share := range cmd.DistanceSplit {
+		if clientID == "" {
+			return reject("Distance split of scooter %s has a share without a client ID", cmd.ScooterID)
+		}
+		if share < 0 {
+			return reject("Distance split of scooter %s gives client %s a negative share", cmd.ScooterID, clientID)
+		}
+		sum += share
+	}
+	if sum != cmd.Distance {
+		return reject("Distance split of scooter %s sums to %d, the release distance is %d", cmd.ScooterID, sum, cmd.Distance)
+	}
+	return nil
+}
+
+// addClientDistances credits each client its share. The caller holds
+// sm.mutex.
+func (sm *ScooterStateMachine) addClientDistances(split map[string]int64) {
+	for clientID, share := range split {
+		sm.clientDistances[clientID] += share
+	}
+}
+
+// ClientDistance is the distance split releases have attributed to
+// clientID. Releases without a split attribute nothing.
+func (sm *ScooterStateMachine) ClientDistance(clientID string) int64 {
+	sm.mutex.RLock()
+	defer sm.mutex.RUnlock()
+	return sm.clientDistances[clientID]
+}
+
+// sortedClientDistances lists the per-client totals in client ID order, for
+// the state hash. The caller holds sm.mutex.
+func (sm *ScooterStateMachine) sortedClientDistances() []string {
+	clientIDs := make([]string, 0, len(sm.clientDistances))
+	for clientID := range sm.clientDistances {
+		clientIDs = append(clientIDs, clientID)
+	}
+	sort.Strings(clientIDs)
+	return clientIDs
+}
@@ -0,0 +1,60 @@
+package statemachine
+
+import (
+	"container/heap"
+	"sort"
+)
+
+// byDistance orders scooters by TotalDistance, highest first, breaking ties
+// by ID so the order is the same on every replica
+func byDistance(a, b *Scooter) bool {
+	if a.TotalDistance != b.TotalDistance {
+		return a.TotalDistance > b.TotalDistance
+	}
+	return a.ID < b.ID
+}
+
+// topHeap keeps the best n scooters seen so far with the worst at the root,
+// so a better scooter replaces it in O(log n)
+type topHeap []*Scooter
+
+func (h topHeap) Len() int           { return len(h) }
+func (h topHeap) Less(i, j int) bool { return byDistance(h[j], h[i]) }
+func (h topHeap) Swap(i, j int)      { h[i], h[j] = h[j], h[i] }
+func (h *topHeap) Push(x any)        { *h = append(*h, x.(*Scooter)) }
+func (h *topHeap) Pop() any {
+	old := *h
+	last := old[len(old)-1]
+	*h = old[:len(old)-1]
+	return last
+}
+
+// TopByDistance returns the n scooters with the highest TotalDistance,
+// highest first and ties by ID, from one pass over a consistent view of the
+// fleet. Only n scooters are kept and sorted, not the whole fleet.
+func (sm *ScooterStateMachine) TopByDistance(n int) []Scooter {
+	if n <= 0 {
+		return []Scooter{}
+	}
+	sm.rLockAll()
+	defer sm.rUnlockAll()
+
+	top := make(topHeap, 0, n)
+	for _, shard := range sm.shards {
+		for _, scooter := range shard.scooters {
+			if len(top) < n {
+				heap.Push(&top, scooter)
+			} else if byDistance(scooter, top[0]) {
+				top[0] = scooter
+				heap.Fix(&top, 0)
+			}
+		}
+	}
+
+	sort.Slice(top, func(i, j int) bool { return byDistance(top[i], top[j]) })
+	scooters := make([]Scooter, len(top))
+	for i, scooter := range top {
+		scooters[i] = scooter.Public()
+	}
+	return scooters
+}
@@ -0,0 +1,74 @@
+package statemachine
+
+import (
+	"fmt"
+)
+
+// applyTransaction applies ops all together or not at all. Every operation
+// runs against staged copies of the scooters it touches, so later operations
+// see the effect of earlier ones; only if all of them pass are the copies
+// swapped in. The caller holds the touched shards' locks.
+func (sm *ScooterStateMachine) applyTransaction(ops []ScooterCommand) error {
+	if len(ops) == 0 {
+		return fmt.Errorf("Transaction has no operations")
+	}
+
+	sm.mutex.Lock()
+	defer sm.mutex.Unlock()
+
+	staged := make(map[string]*Scooter)
+	reservations := make(map[string]int)
+	distances := make(map[string]int64)
+
+	for i, op := range ops {
+		scooter, exists := staged[op.ScooterID]
+		if !exists {
+			if current, found := sm.shardFor(op.ScooterID).scooters[op.ScooterID]; found {
+				copied := *current
+				scooter, exists = &copied, true
+				staged[op.ScooterID] = scooter
+			}
+		}
+
+		switch op.CommandType {
+		case Reserve:
+			active := sm.clientReservations[op.ClientID] + reservations[op.ClientID]
+			if err := checkReserve(scooter, exists, op, active); err != nil {
+				return fmt.Errorf("Operation %d: %w", i, err)
+			}
+			if err := checkSignature(sm.signingKeys, op, op.ClientID); err != nil {
+				return fmt.Errorf("Operation %d: %w", i, err)
+			}
+			scooter.reserve(op)
+			if op.ClientID != "" {
+				reservations[op.ClientID]++
+			}
+
+		case Release:
+			if err := checkRelease(scooter, exists, op); err != nil {
+				return fmt.Errorf("Operation %d: %w", i, err)
+			}
+			if err := checkSignature(sm.signingKeys, op, scooter.ClientID); err != nil {
+				return fmt.Errorf("Operation %d: %w", i, err)
+			}
+			if clientID := scooter.release(op); clientID != "" {
+				reservations[clientID]--
+			}
+			for clientID, share := range op.DistanceSplit {
+				distances[clientID] += share
+			}
+
+		default:
+			return fmt.Errorf("Operation %d: %s is not allowed in a transaction", i, op.CommandType)
+		}
+	}
+
+	for id, scooter := range staged {
+		sm.shardFor(id).scooters[id] = scooter
+	}
+	for clientID, delta := range reservations {
+		sm.adjustReservations(clientID, delta)
+	}
+	sm.addClientDistances(distances)
+	return nil
+}
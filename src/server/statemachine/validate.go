@@ -0,0 +1,66 @@
+package statemachine
+
+import "fmt"
+
+// MaxScooterIDLength is the longest scooter ID, in bytes, a command may carry
+const MaxScooterIDLength = 4096
+
+// ErrInvalidScooterID is returned for a scooter ID that is empty, too long
+// or uses characters outside the allowed set
+type ErrInvalidScooterID struct {
+	ID     string
+	Reason string
+}
+
+func (e *ErrInvalidScooterID) Error() string {
+	return fmt.Sprintf("invalid scooter id: %s", e.Reason)
+}
+
+// ValidateScooterID checks that id is non-empty, at most MaxScooterIDLength
+// bytes and made only of ASCII letters, digits and . _ - :
+func ValidateScooterID(id string) error {
+	if id == "" {
+		return &ErrInvalidScooterID{ID: id, Reason: "id is empty"}
+	}
+	if len(id) > MaxScooterIDLength {
+		return &ErrInvalidScooterID{ID: id, Reason: fmt.Sprintf("id is %d bytes, the maximum is %d", len(id), MaxScooterIDLength)}
+	}
+	for i := 0; i < len(id); i++ {
+		if !scooterIDChar(id[i]) {
+			return &ErrInvalidScooterID{ID: id, Reason: fmt.Sprintf("character %q at position %d is not allowed", id[i], i)}
+		}
+	}
+	return nil
+}
+
+func scooterIDChar(c byte) bool {
+	switch {
+	case c >= 'a' && c <= 'z', c >= 'A' && c <= 'Z', c >= '0' && c <= '9':
+		return true
+	case c == '.', c == '_', c == '-', c == ':':
+		return true
+	}
+	return false
+}
+
+// Validate checks the scooter IDs cmd carries, so a malformed one is turned
+// away before it is proposed. Noops and commands registered outside this
+// package carry no scooter ID and always pass.
+func (cmd ScooterCommand) Validate() error {
+	switch cmd.CommandType {
+	case Create, Reserve, Release, SetServiceState, Delete, CancelReservation, SetState:
+		return ValidateScooterID(cmd.ScooterID)
+	case Relabel:
+		if err := ValidateScooterID(cmd.ScooterID); err != nil {
+			return err
+		}
+		return ValidateScooterID(cmd.NewScooterID)
+	case Transaction:
+		for _, op := range cmd.Operations {
+			if err := op.Validate(); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
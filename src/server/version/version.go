@@ -0,0 +1,13 @@
+package version
+
+// Build info, set at build time with
+// -ldflags "-X ds_project/src/server/version.Version=..."
+var (
+	Version   = "dev"
+	Commit    = "unknown"
+	BuildTime = "unknown"
+)
+
+// ProtocolVersion is the Paxos RPC and command format this build speaks.
+// Bump it on any change a node running the previous version can't handle.
+const ProtocolVersion = 15
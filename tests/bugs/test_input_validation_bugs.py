@@ -101,12 +101,11 @@ class TestEmptyInputValidation:
         response = requests.put(f"{api_url}/scooters/", timeout=10)
         assert response.status_code in [400, 404, 405]
 
-    @pytest.mark.xfail(reason="Assignment: 'Assume the syntax is correct; fancy parsers unnecessary'")
     def test_whitespace_scooter_id(self, api_url):
         """
         Scooter ID with only whitespace.
 
-        Assignment doesn't require this validation.
+        IDs are validated, so this is rejected.
         """
         response = requests.put(f"{api_url}/scooters/%20%20%20", timeout=10)
         assert response.status_code == 400
@@ -161,11 +160,10 @@ class TestMalformedJsonValidation:
     """
     Tests for malformed JSON input.
 
-    The assignment says "Assume the syntax is correct" - so these tests
-    are marked xfail. However, the system should not crash on bad input.
+    The assignment says "Assume the syntax is correct", but handlers check
+    bind errors so a bad body is a 400 instead of a zero-value command.
     """
 
-    @pytest.mark.xfail(reason="Assignment: 'Assume the syntax is correct; fancy parsers unnecessary'")
     def test_malformed_json_reserve(self, api_url, unique_scooter_id):
         """
         Malformed JSON in reserve request.
@@ -182,7 +180,6 @@ class TestMalformedJsonValidation:
         # Should be 400, not 500 (crash)
         assert response.status_code == 400
 
-    @pytest.mark.xfail(reason="Assignment: 'Assume the syntax is correct; fancy parsers unnecessary'")
     def test_malformed_json_release(self, api_url, unique_scooter_id, unique_reservation_id):
         """
         Malformed JSON in release request.
@@ -199,7 +196,6 @@ class TestMalformedJsonValidation:
         )
         assert response.status_code == 400
 
-    @pytest.mark.xfail(reason="Assignment: 'Assume the syntax is correct; fancy parsers unnecessary'")
     def test_wrong_type_distance(self, api_url, unique_scooter_id, unique_reservation_id):
         """
         Wrong type for distance field.
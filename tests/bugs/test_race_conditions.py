@@ -409,3 +409,106 @@ class TestDoubleApplyRace:
 
         assert actual == expected, \
             f"BUG: Distance inconsistency! Expected {expected}, got {actual}"
+
+
+class TestVersionedReservation:
+    """
+    Reservations may carry the scooter version the client last saw. Only a
+    reservation whose version still matches at apply time may succeed, so two
+    clients racing on the same version can't both be told they won.
+    """
+
+    def test_concurrent_reservations_same_version(self, api_url, unique_scooter_id):
+        """Two reservations at the same version: exactly one succeeds."""
+        create_scooter(api_url, unique_scooter_id)
+        version = get_scooter(api_url, unique_scooter_id).json()["version"]
+
+        def reserve(reservation_id):
+            return requests.post(
+                f"{api_url}/scooters/{unique_scooter_id}/reservations",
+                json={"reservation_id": reservation_id, "version": version},
+                timeout=60
+            )
+
+        with ThreadPoolExecutor(max_workers=2) as executor:
+            futures = [executor.submit(reserve, f"cas-{i}") for i in range(2)]
+            statuses = sorted(f.result().status_code for f in as_completed(futures))
+
+        assert statuses == [200, 409], f"Expected one 200 and one 409, got {statuses}"
+
+    def test_stale_version_rejected(self, api_url, unique_scooter_id):
+        """A reservation with an outdated version returns 409."""
+        create_scooter(api_url, unique_scooter_id)
+        version = get_scooter(api_url, unique_scooter_id).json()["version"]
+
+        reserve_scooter(api_url, unique_scooter_id, "first")
+        release_scooter(api_url, unique_scooter_id, 1)
+
+        response = requests.post(
+            f"{api_url}/scooters/{unique_scooter_id}/reservations",
+            json={"reservation_id": "stale", "version": version},
+            timeout=60
+        )
+
+        assert response.status_code == 409
+
+
+class TestPerScooterWriteOrdering:
+    """
+    A node serializes the writes it takes for one scooter, so the checks a
+    handler makes and the command it proposes can't be split by another write
+    to that scooter. The loser of a race is turned away by the checks.
+    """
+
+    def test_concurrent_reserves_one_wins(self, api_url, unique_scooter_id):
+        """Two reserves at once on one node: one 200, one 409 from the checks."""
+        create_scooter(api_url, unique_scooter_id)
+
+        def reserve(reservation_id):
+            return requests.post(
+                f"{api_url}/scooters/{unique_scooter_id}/reservations",
+                json={"reservation_id": reservation_id},
+                timeout=60
+            )
+
+        with ThreadPoolExecutor(max_workers=2) as executor:
+            futures = [executor.submit(reserve, f"ordered-{i}") for i in range(2)]
+            responses = [f.result() for f in as_completed(futures)]
+
+        statuses = sorted(r.status_code for r in responses)
+        assert statuses == [200, 409], f"Expected one 200 and one 409, got {statuses}"
+
+        loser = next(r for r in responses if r.status_code == 409)
+        # The handler's own check, not a rejection at apply time
+        assert loser.json()["error"] == "Scooter is not available"
+
+
+class TestLinearizableReadsUnderWrites:
+    """
+    Linearizable reads confirm a read index with the same acceptors writes
+    use, falling back to a Noop round when that stalls. Hammering both
+    together must neither deadlock nor starve either side.
+    """
+
+    def test_reads_and_writes_hammered_together(self, api_url, unique_scooter_id):
+        """Every concurrent read and write gets an answer within the timeout."""
+        ids = [f"{unique_scooter_id}-{i}" for i in range(10)]
+
+        def write(sid):
+            response = create_scooter(api_url, sid)
+            return ("write", response.status_code)
+
+        def read(_):
+            response = requests.get(f"{api_url}/scooters", params={"linearizable": "true"}, timeout=30)
+            return ("read", response.status_code)
+
+        with ThreadPoolExecutor(max_workers=20) as executor:
+            futures = [executor.submit(write, sid) for sid in ids]
+            futures += [executor.submit(read, i) for i in range(30)]
+            results = [f.result(timeout=60) for f in as_completed(futures, timeout=90)]
+
+        assert len(results) == 40
+        writes_ok = [code for kind, code in results if kind == "write" and code == 200]
+        reads_ok = [code for kind, code in results if kind == "read" and code == 200]
+        assert writes_ok, "No write succeeded while reads were running"
+        assert reads_ok, "No read succeeded while writes were running"
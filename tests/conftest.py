@@ -10,6 +10,7 @@ import requests
 import time
 import subprocess
 import os
+import base64
 
 
 # ============================================================================
@@ -29,6 +30,12 @@ def server_urls():
     return [f"http://localhost:{base_port + i}" for i in range(5)]
 
 
+@pytest.fixture
+def readonly_url():
+    """URL of the read-only replica."""
+    return os.environ.get("READONLY_URL", "http://localhost:8086")
+
+
 @pytest.fixture
 def etcd_url():
     """URL for the etcd server."""
@@ -67,6 +74,20 @@ def create_scooter(url, scooter_id):
     return requests.put(f"{url}/scooters/{scooter_id}", timeout=60)
 
 
+def delete_scooter(url, scooter_id):
+    """
+    Delete an available scooter.
+
+    Args:
+        url: Base API URL
+        scooter_id: ID of scooter to delete
+
+    Returns:
+        requests.Response object
+    """
+    return requests.delete(f"{url}/scooters/{scooter_id}", timeout=60)
+
+
 def get_scooter(url, scooter_id):
     """
     Get a scooter by ID.
@@ -94,6 +115,11 @@ def get_all_scooters(url):
     return requests.get(f"{url}/scooters", timeout=60)
 
 
+# Reservation tokens from successful reserve_scooter calls, by scooter ID,
+# so release_scooter can present them like the rider would
+reservation_tokens = {}
+
+
 def reserve_scooter(url, scooter_id, reservation_id):
     """
     Reserve a scooter.
@@ -106,14 +132,17 @@ def reserve_scooter(url, scooter_id, reservation_id):
     Returns:
         requests.Response object
     """
-    return requests.post(
+    response = requests.post(
         f"{url}/scooters/{scooter_id}/reservations",
         json={"reservation_id": reservation_id},
         timeout=60
     )
+    if response.status_code == 200:
+        reservation_tokens[scooter_id] = response.json().get("reservation_token")
+    return response
 
 
-def release_scooter(url, scooter_id, distance):
+def release_scooter(url, scooter_id, distance, reservation_token=None):
     """
     Release a scooter and record distance traveled.
 
@@ -121,13 +150,17 @@ def release_scooter(url, scooter_id, distance):
         url: Base API URL
         scooter_id: ID of scooter to release
         distance: Distance traveled during rental
+        reservation_token: Token from the reservation; defaults to the one
+            the last successful reserve_scooter got for this scooter
 
     Returns:
         requests.Response object
     """
+    if reservation_token is None:
+        reservation_token = reservation_tokens.get(scooter_id)
     return requests.post(
         f"{url}/scooters/{scooter_id}/releases",
-        json={"distance": distance},
+        json={"distance": distance, "reservation_token": reservation_token},
         timeout=60
     )
 
@@ -158,6 +191,26 @@ def get_servers(url):
     return requests.get(f"{url}/servers", timeout=60)
 
 
+def put_cluster_config(etcd_url, key, value):
+    """
+    Set a cluster-wide setting under config/ in etcd.
+
+    Args:
+        etcd_url: Base etcd URL
+        key: Setting name, without the config/ prefix
+        value: Setting value as a string
+
+    Returns:
+        requests.Response object
+    """
+    encode = lambda s: base64.b64encode(s.encode()).decode()
+    return requests.post(
+        f"{etcd_url}/v3/kv/put",
+        json={"key": encode(f"config/{key}"), "value": encode(value)},
+        timeout=10
+    )
+
+
 # ============================================================================
 # WAIT HELPERS - For waiting on async operations
 # ============================================================================
@@ -215,6 +268,31 @@ def wait_for_replication(server_urls, scooter_id, timeout=10):
     return False
 
 
+def wait_for_config(url, field, expected, timeout=10):
+    """
+    Wait for a server to report a setting from GET /admin/config.
+
+    Args:
+        url: Base API URL
+        field: Field in the /admin/config response
+        expected: Value to wait for
+        timeout: Maximum seconds to wait
+
+    Returns:
+        True if the server reported the value, False if timeout
+    """
+    start = time.time()
+    while time.time() - start < timeout:
+        try:
+            response = requests.get(f"{url}/admin/config", timeout=10)
+            if response.status_code == 200 and response.json()[field] == expected:
+                return True
+        except requests.exceptions.RequestException:
+            pass
+        time.sleep(0.2)
+    return False
+
+
 def wait_for_leader(server_urls, timeout=30):
     """
     Wait for a leader to be elected.
@@ -270,6 +348,15 @@ class DockerComposeManager:
             capture_output=True
         )
 
+    def up_service(self, service_name):
+        """Create and start a service, including one behind a profile."""
+        subprocess.run(
+            ["docker-compose", "up", "-d", service_name],
+            cwd=self.compose_dir,
+            check=True,
+            capture_output=True
+        )
+
     def stop_service(self, service_name):
         """Stop a specific service."""
         subprocess.run(
@@ -279,6 +366,24 @@ class DockerComposeManager:
             capture_output=True
         )
 
+    def pause_service(self, service_name):
+        """Freeze a service's processes without stopping what depends on it."""
+        subprocess.run(
+            ["docker-compose", "pause", service_name],
+            cwd=self.compose_dir,
+            check=True,
+            capture_output=True
+        )
+
+    def unpause_service(self, service_name):
+        """Resume a paused service."""
+        subprocess.run(
+            ["docker-compose", "unpause", service_name],
+            cwd=self.compose_dir,
+            check=True,
+            capture_output=True
+        )
+
     def start_service(self, service_name):
         """Start a specific service."""
         subprocess.run(
@@ -297,6 +402,28 @@ class DockerComposeManager:
             capture_output=True
         )
 
+    def exec(self, service_name, *command):
+        """Run a command inside a running service and return its output."""
+        result = subprocess.run(
+            ["docker-compose", "exec", "-T", service_name, *command],
+            cwd=self.compose_dir,
+            check=True,
+            capture_output=True,
+            text=True
+        )
+        return result.stdout
+
+    def logs(self, service_name):
+        """Return a service's log output so far."""
+        result = subprocess.run(
+            ["docker-compose", "logs", "--no-color", service_name],
+            cwd=self.compose_dir,
+            check=True,
+            capture_output=True,
+            text=True
+        )
+        return result.stdout
+
 
 @pytest.fixture
 def docker_compose():
@@ -325,8 +452,8 @@ def cleanup_scooters(api_url):
     """
     Fixture that tracks created scooters and could clean them up.
 
-    Note: Since we use unique IDs per test and the system doesn't have
-    a delete endpoint, we just track what was created for debugging.
+    Note: Since we use unique IDs per test, we just track what was created
+    for debugging rather than deleting it.
     """
     created = []
 
@@ -336,7 +463,5 @@ def cleanup_scooters(api_url):
 
     yield track
 
-    # In a real system with delete, we'd clean up here
-    # For now, just log what was created
     if created:
         print(f"\nTest created scooters: {created}")
@@ -17,8 +17,8 @@ import os
 
 sys.path.insert(0, os.path.dirname(os.path.dirname(os.path.abspath(__file__))))
 from conftest import (
-    create_scooter, get_scooter, get_all_scooters,
-    reserve_scooter, release_scooter,
+    create_scooter, get_scooter, get_all_scooters, delete_scooter,
+    reserve_scooter, release_scooter, take_snapshot,
     wait_for_server,
     DockerComposeManager
 )
@@ -158,6 +158,432 @@ class TestRecoveryAfterFailure:
                 print(f"Server {i} unavailable: {e}")
 
 
+    def test_deletes_survive_recovery(self, server_urls, docker_compose, unique_scooter_id):
+        """
+        A restarted node rebuilds from server 1's snapshot plus the log after
+        it. A scooter deleted before the snapshot and one deleted after it
+        must both stay deleted there.
+        """
+        kept = f"{unique_scooter_id}-kept"
+        before = f"{unique_scooter_id}-before"
+        after = f"{unique_scooter_id}-after"
+        for scooter_id in (kept, before, after):
+            assert create_scooter(server_urls[0], scooter_id).status_code == 200
+
+        assert delete_scooter(server_urls[0], before).status_code == 200
+        time.sleep(1)
+        assert take_snapshot(server_urls[0]).status_code == 200
+        assert delete_scooter(server_urls[0], after).status_code == 200
+        time.sleep(1)
+
+        restarted = server_urls[4]
+        docker_compose.restart_service("scooter-server-5")
+        assert wait_for_server(restarted), "Server 5 did not come back"
+
+        deadline = time.time() + 15
+        while time.time() < deadline:
+            if get_scooter(restarted, kept).status_code == 200:
+                break
+            time.sleep(0.5)
+        assert get_scooter(restarted, kept).status_code == 200, "Server 5 did not recover"
+
+        for url in (server_urls[0], restarted):
+            assert get_scooter(url, before).status_code == 404, f"{before} came back on {url}"
+            assert get_scooter(url, after).status_code == 404, f"{after} came back on {url}"
+
+
+    def test_restart_below_compacted_log_installs_snapshot(self, server_urls, docker_compose, unique_scooter_id, unique_reservation_id):
+        """
+        Server 5 restarts empty and asks server 1, its only seed, for the log
+        from index 0. Server 1 has compacted that away, so recovery has to
+        come through its snapshot and then the entries after it, leaving no
+        gap: server 5 ends up with the same state as everyone else.
+        """
+        import requests
+
+        before = f"{unique_scooter_id}-before"
+        after = f"{unique_scooter_id}-after"
+        assert create_scooter(server_urls[0], before).status_code == 200
+        assert reserve_scooter(server_urls[0], before, unique_reservation_id).status_code == 200
+        assert release_scooter(server_urls[0], before, 7).status_code == 200
+        time.sleep(1)
+
+        compacted_to = take_snapshot(server_urls[0]).json()["compacted_to"]
+        if compacted_to < 0:
+            pytest.skip("Server 1 could not compact past another node's progress")
+        entry = requests.get(f"{server_urls[0]}/log", params={"from": 0, "to": 0}, timeout=10).json()["entries"][0]
+        assert entry.get("compacted") == True
+        assert create_scooter(server_urls[0], after).status_code == 200
+        time.sleep(1)
+
+        restarted = server_urls[4]
+        docker_compose.restart_service("scooter-server-5")
+        assert wait_for_server(restarted), "Server 5 did not come back"
+
+        deadline = time.time() + 15
+        while time.time() < deadline and get_scooter(restarted, after).status_code != 200:
+            time.sleep(0.5)
+        assert get_scooter(restarted, after).status_code == 200, "Server 5 missed the entries after the snapshot"
+        assert get_scooter(restarted, before).json()["total_distance"] == 7
+
+        report = None
+        while time.time() < deadline + 15:
+            report = requests.get(f"{restarted}/admin/state-hash", timeout=10).json()
+            if report["common_applied_index"] >= 0:
+                break
+            time.sleep(0.5)
+        assert report["consistent"] == True, report
+
+
+class TestLeaderFlag:
+    """Tests for the leader flag main keeps from membership's callback."""
+
+    def wait_for_leader_flag(self, url, expected, timeout=30):
+        import requests
+
+        deadline = time.time() + timeout
+        while time.time() < deadline:
+            try:
+                heartbeat = requests.get(f"{url}/admin/heartbeat", timeout=5).json()
+                if heartbeat["is_leader"] == expected:
+                    return True
+            except requests.exceptions.RequestException:
+                pass
+            time.sleep(0.5)
+        return False
+
+    def test_flag_follows_leader_changes(self, server_urls, docker_compose):
+        """
+        When the leader's lease expires the callback fires on server 2 with
+        its own ID, and the flag flips. When server 1 rejoins it flips back.
+        """
+        leader, successor = server_urls[0], server_urls[1]
+        assert self.wait_for_leader_flag(leader, True)
+        assert self.wait_for_leader_flag(successor, False)
+
+        try:
+            docker_compose.stop_service("scooter-server-1")
+            assert self.wait_for_leader_flag(successor, True), "server 2 never took over"
+        finally:
+            docker_compose.start_service("scooter-server-1")
+            wait_for_server(leader)
+
+        assert self.wait_for_leader_flag(leader, True)
+        assert self.wait_for_leader_flag(successor, False), "server 2 kept the flag"
+
+
+class TestWitnessQuorum:
+    """Tests for the weighted two-datacenter layout in the witness profile."""
+
+    SERVICES = ["etcd-witness", "witness-full-1", "witness-full-2", "witness-witness"]
+
+    def write_until(self, url, scooter_id, timeout=20):
+        deadline = time.time() + timeout
+        response = None
+        while time.time() < deadline:
+            response = create_scooter(url, scooter_id)
+            if response.status_code == 200:
+                break
+            time.sleep(0.5)
+        return response
+
+    def test_witness_and_one_full_node_form_quorum(self, docker_compose, unique_scooter_id):
+        """
+        Full nodes weigh 2 and the witness 1. With one full node down the
+        other plus the witness still hold 3 of 5; without the witness too,
+        the remaining full node's 2 is not enough.
+        """
+        import requests
+
+        full, witness = "http://localhost:8091", "http://localhost:8093"
+        try:
+            for service in self.SERVICES:
+                docker_compose.up_service(service)
+            assert wait_for_server(full), "witness-full-1 did not start"
+
+            response = self.write_until(full, f"{unique_scooter_id}-all")
+            assert response.status_code == 200, response.text
+
+            docker_compose.stop_service("witness-full-2")
+            response = self.write_until(full, f"{unique_scooter_id}-witness")
+            assert response.status_code == 200, response.text
+
+            # The witness voted but kept nothing
+            assert requests.get(f"{witness}/health", timeout=10).status_code == 200
+            assert requests.get(f"{witness}/scooters", timeout=10).status_code == 404
+
+            docker_compose.stop_service("witness-witness")
+            response = create_scooter(full, f"{unique_scooter_id}-alone")
+            assert response.status_code == 503, response.text
+        finally:
+            for service in reversed(self.SERVICES):
+                docker_compose.stop_service(service)
+
+
+class TestCommitMajority:
+    """Tests for -waitcommitmajority in the commitquorum profile."""
+
+    SERVICES = ["etcd-commit", "commit-1", "commit-2", "commit-3"]
+
+    def test_commit_majority_required(self, docker_compose, unique_scooter_id):
+        """
+        commit-2 and commit-3 refuse gRPC messages over 4KB. Accepts carry
+        no command so they still reach a majority, but a large command's
+        commit only lands on commit-1, and the write has to fail.
+        """
+        url = "http://localhost:8094"
+        try:
+            for service in self.SERVICES:
+                docker_compose.up_service(service)
+            assert wait_for_server(url), "commit-1 did not start"
+
+            deadline = time.time() + 20
+            while True:
+                response = create_scooter(url, f"{unique_scooter_id}-small")
+                if response.status_code == 200 or time.time() > deadline:
+                    break
+                time.sleep(0.5)
+            assert response.status_code == 200, response.text
+
+            # As long as an ID may be, which with the rest of the command
+            # is over the 4KB limit
+            large_id = f"{unique_scooter_id}-" + "x" * (4095 - len(unique_scooter_id))
+            response = create_scooter(url, large_id)
+            assert response.status_code == 503, response.text
+            assert "acknowledged its commit" in response.json()["error"]
+        finally:
+            for service in reversed(self.SERVICES):
+                docker_compose.stop_service(service)
+
+
+class TestEtcdHealthGauges:
+    """Tests for the etcd gauges, on the commitquorum profile's own etcd."""
+
+    SERVICES = ["etcd-commit", "commit-1"]
+
+    def etcd_up(self, url):
+        import requests
+
+        for line in requests.get(f"{url}/metrics", timeout=10).text.splitlines():
+            if line.startswith("scooter_etcd_up "):
+                return float(line.split()[1])
+        return None
+
+    def test_connectivity_gauge_drops_with_keepalive(self, docker_compose):
+        """
+        With etcd unresponsive the keepalive channel closes once the
+        lease's TTL passes unrenewed, and scooter_etcd_up goes to 0.
+        """
+        url = "http://localhost:8094"
+        paused = False
+        try:
+            for service in self.SERVICES:
+                docker_compose.up_service(service)
+            assert wait_for_server(url), "commit-1 did not start"
+            assert self.etcd_up(url) == 1
+
+            # Paused rather than stopped, so commit-1 keeps running
+            docker_compose.pause_service("etcd-commit")
+            paused = True
+            deadline = time.time() + 30
+            while self.etcd_up(url) != 0 and time.time() < deadline:
+                time.sleep(1)
+            assert self.etcd_up(url) == 0
+        finally:
+            if paused:
+                docker_compose.unpause_service("etcd-commit")
+            for service in reversed(self.SERVICES):
+                docker_compose.stop_service(service)
+
+
+class TestEtcdAuth:
+    """Tests for ETCD_USERNAME and ETCD_PASSWORD, in the etcdauth profile."""
+
+    SERVICES = ["etcd-auth", "etcd-auth-user", "etcd-auth-role", "etcd-auth-enable", "auth-1", "auth-bad"]
+
+    def test_credentials_reach_etcd(self, docker_compose, unique_scooter_id):
+        """
+        auth-1 has the right password and registers; auth-bad has the wrong
+        one and fails to create its membership service.
+        """
+        import requests
+
+        url = "http://localhost:8097"
+        try:
+            for service in self.SERVICES:
+                docker_compose.up_service(service)
+            assert wait_for_server(url), "auth-1 did not start"
+
+            config = requests.get(f"{url}/admin/config", timeout=10).json()
+            assert config["etcd_username"] == "root"
+            assert config["etcd_tls"] is False
+            assert "etcd_password" not in config
+
+            deadline = time.time() + 20
+            while True:
+                response = create_scooter(url, unique_scooter_id)
+                if response.status_code == 200 or time.time() > deadline:
+                    break
+                time.sleep(0.5)
+            assert response.status_code == 200, response.text
+
+            deadline = time.time() + 20
+            while "Failed to create membership service" not in docker_compose.logs("auth-bad"):
+                assert time.time() < deadline, "auth-bad connected with the wrong password"
+                time.sleep(1)
+        finally:
+            for service in reversed(self.SERVICES):
+                docker_compose.stop_service(service)
+
+
+class TestDuplicateMemberID:
+    """Tests for refusing a second node with an ID already registered, in the duplicateid profile."""
+
+    def test_same_id_different_address_rejected(self, docker_compose, server_urls):
+        """duplicate-2 claims server 2's ID; it fails to start and server 2 keeps its registration."""
+        try:
+            docker_compose.up_service("duplicate-2")
+
+            deadline = time.time() + 20
+            while "is already registered by scooter-server-2:50051" not in docker_compose.logs("duplicate-2"):
+                assert time.time() < deadline, "duplicate-2 started with server 2's ID"
+                time.sleep(1)
+            assert "Failed to start membership service" in docker_compose.logs("duplicate-2")
+
+            output = docker_compose.exec("etcd", "etcdctl", "get", "members/2", "--print-value-only")
+            assert output.strip() == "scooter-server-2:50051"
+            assert wait_for_server(server_urls[1])
+        finally:
+            docker_compose.stop_service("duplicate-2")
+
+
+class TestCommandSigning:
+    """
+    Tests for -requiresignatures, in the signing profile. signing-1 knows
+    rider-1's public key; RIDER_SEED is its private key.
+    """
+
+    SERVICES = ["etcd-signing", "signing-1"]
+    URL = "http://localhost:8098"
+    RIDER_SEED = b"scooter-signing-test-rider-1-key"
+
+    def sign(self, seed, *lines):
+        import base64
+        from cryptography.hazmat.primitives.asymmetric.ed25519 import Ed25519PrivateKey
+
+        key = Ed25519PrivateKey.from_private_bytes(seed)
+        return base64.b64encode(key.sign("\n".join(lines).encode())).decode()
+
+    def test_signed_commands_accepted_forged_rejected(self, docker_compose, unique_scooter_id, unique_reservation_id):
+        """Only rider-1's own signature reserves and releases; unsigned and forged ones get 403."""
+        import requests
+
+        forger_seed = b"someone-else-entirely-signing-it"
+        try:
+            for service in self.SERVICES:
+                docker_compose.up_service(service)
+            assert wait_for_server(self.URL), "signing-1 did not start"
+
+            deadline = time.time() + 20
+            while True:
+                response = create_scooter(self.URL, unique_scooter_id)
+                if response.status_code == 200 or time.time() > deadline:
+                    break
+                time.sleep(0.5)
+            assert response.status_code == 200, response.text
+
+            reserve_url = f"{self.URL}/scooters/{unique_scooter_id}/reservations"
+            reserve = {"reservation_id": unique_reservation_id, "client_id": "rider-1"}
+            payload = ("RESERVE", unique_scooter_id, unique_reservation_id, "rider-1")
+
+            assert requests.post(reserve_url, json=reserve, timeout=30).status_code == 403
+            forged = dict(reserve, signature=self.sign(forger_seed, *payload))
+            assert requests.post(reserve_url, json=forged, timeout=30).status_code == 403
+            assert get_scooter(self.URL, unique_scooter_id).json()["is_available"] == True
+
+            signed = dict(reserve, signature=self.sign(self.RIDER_SEED, *payload))
+            response = requests.post(reserve_url, json=signed, timeout=30)
+            assert response.status_code == 200, response.text
+            token = response.json()["reservation_token"]
+
+            release_url = f"{self.URL}/scooters/{unique_scooter_id}/releases"
+            release = {"distance": 10, "reservation_token": token}
+            payload = ("RELEASE", unique_scooter_id, token, "10")
+
+            forged = dict(release, signature=self.sign(forger_seed, *payload))
+            assert requests.post(release_url, json=forged, timeout=30).status_code == 403
+            assert get_scooter(self.URL, unique_scooter_id).json()["is_available"] == False
+
+            signed = dict(release, signature=self.sign(self.RIDER_SEED, *payload))
+            response = requests.post(release_url, json=signed, timeout=30)
+            assert response.status_code == 200, response.text
+            assert get_scooter(self.URL, unique_scooter_id).json()["total_distance"] == 10
+        finally:
+            for service in reversed(self.SERVICES):
+                docker_compose.stop_service(service)
+
+
+class TestLeaseRenewal:
+    """
+    Tests for -leaserenewinterval, set to 1s with 200ms of jitter on
+    scooter-server-4.
+    """
+
+    URL = "http://localhost:8084"
+
+    def metrics(self):
+        import requests
+
+        response = requests.get(f"{self.URL}/metrics", timeout=10)
+        assert response.status_code == 200
+        metrics = {}
+        for line in response.text.splitlines():
+            if line and not line.startswith("#"):
+                name, value = line.split(" ", 1)
+                metrics[name] = float(value)
+        return metrics
+
+    def lease(self, docker_compose):
+        """The lease server 4 is registered under, or None if it isn't."""
+        import json
+
+        output = docker_compose.exec("etcd", "etcdctl", "get", "members/4", "-w", "json")
+        kvs = json.loads(output).get("kvs", [])
+        return kvs[0]["lease"] if kvs else None
+
+    def test_renewal_interval_honored(self, docker_compose):
+        """Over 10 seconds a 1s interval renews about ten times, never letting the lease run low."""
+        before = self.metrics()["scooter_etcd_lease_renewals_total"]
+        lowest = 5.0
+        deadline = time.time() + 10
+        while time.time() < deadline:
+            lowest = min(lowest, self.metrics()["scooter_etcd_lease_remaining_seconds"])
+            time.sleep(0.25)
+        renewals = self.metrics()["scooter_etcd_lease_renewals_total"] - before
+
+        # 10s at 0.8s to 1.2s apart, plus the round trips
+        assert 7 <= renewals <= 13, f"{renewals} renewals in 10s"
+        assert lowest >= 3, f"lease fell to {lowest}s"
+
+    def test_failed_renewal_grants_new_lease(self, docker_compose):
+        """Revoking server 4's lease makes its next renewal fail; it grants a new lease and registers again."""
+        old_lease = self.lease(docker_compose)
+        assert old_lease is not None, "server 4 is not registered"
+        regrants = self.metrics()["scooter_etcd_lease_regrants_total"]
+
+        docker_compose.exec("etcd", "etcdctl", "lease", "revoke", format(old_lease, "x"))
+
+        deadline = time.time() + 15
+        while self.metrics()["scooter_etcd_lease_regrants_total"] == regrants:
+            assert time.time() < deadline, "no new lease after the old one was revoked"
+            time.sleep(0.5)
+
+        new_lease = self.lease(docker_compose)
+        assert new_lease is not None and new_lease != old_lease
+        assert self.metrics()["scooter_etcd_up"] == 1
+        assert "granting a new lease" in docker_compose.logs("scooter-server-4")
+
+
 class TestNetworkPartition:
     """Tests for network partition scenarios (simulated)."""
 
@@ -259,3 +685,503 @@ class TestGracefulDegradation:
         # Get non-existent scooter
         response = get_scooter(api_url, "nonexistent-scooter-xyz")
         assert response.status_code == 404
+
+
+class TestDraining:
+    """Tests for draining a node before shutdown."""
+
+    def test_drained_node_rejects_writes_but_serves_reads(self, server_urls, docker_compose, unique_scooter_id):
+        """
+        After POST /admin/drain a node answers new writes with 503 and a
+        Retry-After header, while reads keep working.
+        """
+        import requests
+
+        healthy, drained = server_urls[0], server_urls[4]
+        create_scooter(healthy, unique_scooter_id)
+
+        try:
+            response = requests.post(f"{drained}/admin/drain", timeout=10)
+            assert response.status_code == 200
+
+            response = reserve_scooter(drained, unique_scooter_id, "res-drain")
+            assert response.status_code == 503
+            assert "Retry-After" in response.headers
+
+            response = get_all_scooters(drained)
+            assert response.status_code == 200
+        finally:
+            docker_compose.restart_service("scooter-server-5")
+            wait_for_server(drained)
+
+
+class TestGrpcHealth:
+    """Tests for the gRPC health and reflection services."""
+
+    GRPC_ADDRESS = "localhost:50055"
+
+    def status(self):
+        import grpc
+        from grpc_health.v1 import health_pb2, health_pb2_grpc
+
+        with grpc.insecure_channel(self.GRPC_ADDRESS) as channel:
+            stub = health_pb2_grpc.HealthStub(channel)
+            response = stub.Check(health_pb2.HealthCheckRequest(service=""), timeout=5)
+            return health_pb2.HealthCheckResponse.ServingStatus.Name(response.status)
+
+    def test_reflection_lists_services(self, server_urls):
+        """grpcurl-style tooling can discover the Paxos services."""
+        import grpc
+        from grpc_reflection.v1alpha import reflection_pb2, reflection_pb2_grpc
+
+        with grpc.insecure_channel(self.GRPC_ADDRESS) as channel:
+            stub = reflection_pb2_grpc.ServerReflectionStub(channel)
+            request = reflection_pb2.ServerReflectionRequest(list_services="")
+            response = next(stub.ServerReflectionInfo(iter([request]), timeout=5))
+
+        services = {service.name for service in response.list_services_response.service}
+        assert {"paxos.Paxos", "paxos.LogRecovery", "grpc.health.v1.Health"} <= services
+
+    def test_health_follows_readiness_and_drain(self, server_urls, docker_compose):
+        """
+        A ready node reports SERVING; once drained it reports NOT_SERVING,
+        and it is SERVING again after a restart.
+        """
+        import requests
+
+        drained = server_urls[4]
+        assert self.status() == "SERVING"
+
+        try:
+            response = requests.post(f"{drained}/admin/drain", timeout=10)
+            assert response.status_code == 200
+            assert self.status() == "NOT_SERVING"
+        finally:
+            docker_compose.restart_service("scooter-server-5")
+            wait_for_server(drained)
+
+        deadline = time.time() + 20
+        while True:
+            try:
+                status = self.status()
+            except Exception:
+                status = None
+            if status == "SERVING" or time.time() > deadline:
+                break
+            time.sleep(0.5)
+        assert status == "SERVING"
+
+
+class TestInstanceAllocation:
+    """Tests that failed proposals don't run the instance space ahead."""
+
+    def test_failed_writes_leave_no_gap(self, server_urls, docker_compose, unique_scooter_id):
+        """
+        With a majority down every write fails, but the indices those writes
+        took are given back, so the node resumes at the commit index once
+        quorum returns.
+        """
+        import requests
+
+        survivor = server_urls[0]
+        stopped = ["scooter-server-3", "scooter-server-4", "scooter-server-5"]
+
+        try:
+            for service in stopped:
+                docker_compose.stop_service(service)
+            time.sleep(5)
+
+            for i in range(20):
+                response = create_scooter(survivor, f"{unique_scooter_id}-{i}")
+                assert response.status_code == 503
+
+            lag = requests.get(f"{survivor}/lag", timeout=10).json()
+            assert lag["next_index"] - lag["commit_index"] <= 1
+        finally:
+            for service in stopped:
+                docker_compose.start_service(service)
+            for url in server_urls[2:]:
+                wait_for_server(url)
+
+        response = create_scooter(survivor, unique_scooter_id)
+        assert response.status_code == 200
+
+
+class TestProposalDeadline:
+    """Tests that a write without quorum fails fast instead of hanging."""
+
+    # Servers run with the default -proposetimeout of 5s
+    PROPOSE_TIMEOUT = 5
+
+    def test_write_without_quorum_returns_503(self, server_urls, docker_compose, unique_scooter_id):
+        """The write is answered with 503 and Retry-After within the deadline."""
+        survivor = server_urls[0]
+        stopped = ["scooter-server-3", "scooter-server-4", "scooter-server-5"]
+
+        try:
+            for service in stopped:
+                docker_compose.stop_service(service)
+
+            start = time.time()
+            response = create_scooter(survivor, unique_scooter_id)
+            elapsed = time.time() - start
+
+            assert response.status_code == 503
+            assert "Retry-After" in response.headers
+            assert elapsed < self.PROPOSE_TIMEOUT + 2, f"Took {elapsed:.1f}s to fail"
+        finally:
+            for service in stopped:
+                docker_compose.start_service(service)
+            for url in server_urls[2:]:
+                wait_for_server(url)
+
+
+class TestInstanceInProgress:
+    """Tests for GET /paxos/instances/:id on an instance that never got a quorum."""
+
+    def test_prepared_but_undecided(self, server_urls, docker_compose, unique_scooter_id):
+        """
+        With a majority paused the write fails after server 1 promised its own
+        round, so the instance shows that round but isn't decided. The paused
+        nodes stay in membership for a few seconds, so the proposal is tried.
+        """
+        import requests
+
+        survivor = server_urls[0]
+        paused = ["scooter-server-3", "scooter-server-4", "scooter-server-5"]
+        instance = requests.get(f"{survivor}/lag", timeout=10).json()["next_index"]
+
+        try:
+            for service in paused:
+                docker_compose.pause_service(service)
+
+            response = create_scooter(survivor, unique_scooter_id)
+            assert response.status_code == 503
+
+            response = requests.get(f"{survivor}/paxos/instances/{instance}", timeout=10)
+            assert response.status_code == 200, response.text
+            data = response.json()
+            assert data["decided"] is False
+            assert data["last_round"] == data["proposer_round"]
+            assert data["last_good_round"] == [0, 0]
+        finally:
+            for service in paused:
+                docker_compose.unpause_service(service)
+            for url in server_urls[2:]:
+                wait_for_server(url)
+
+
+class TestCompactionWatermark:
+    """Tests that a lagging peer's published progress holds log compaction back."""
+
+    # Servers publish their applied index every 2s and lease for 5s
+    PUBLISH_INTERVAL = 2
+
+    def applied_index(self, url):
+        import requests
+
+        return requests.get(f"{url}/lag", timeout=10).json()["applied_index"]
+
+    def wait_for_applied(self, url, index, timeout=30):
+        deadline = time.time() + timeout
+        while time.time() < deadline:
+            if self.applied_index(url) >= index:
+                return True
+            time.sleep(0.5)
+        return False
+
+    def test_lagging_peer_holds_compaction(self, server_urls, docker_compose, unique_scooter_id):
+        """
+        Server 4 is paused, so the progress it last published stays behind
+        while server 1 commits and snapshots. Compaction on server 1 stops at
+        that progress, and moves past it once server 4 catches up.
+        """
+        leader, lagging = server_urls[0], server_urls[3]
+
+        assert create_scooter(leader, f"{unique_scooter_id}-base").status_code == 200
+        assert self.wait_for_applied(lagging, self.applied_index(leader))
+        time.sleep(self.PUBLISH_INTERVAL + 1)
+        progress = self.applied_index(lagging)
+
+        try:
+            docker_compose.pause_service("scooter-server-4")
+
+            # Three snapshots past the lagging progress, so the retained
+            # snapshots don't hold compaction back further than the peer
+            for i in range(3):
+                assert create_scooter(leader, f"{unique_scooter_id}-{i}").status_code == 200
+                response = take_snapshot(leader)
+                assert response.status_code == 200, response.text
+            held = response.json()
+            assert held["index"] > progress
+            assert held["compacted_to"] <= progress
+        finally:
+            docker_compose.unpause_service("scooter-server-4")
+
+        assert wait_for_server(lagging)
+        assert self.wait_for_applied(lagging, held["index"])
+        time.sleep(self.PUBLISH_INTERVAL + 1)
+
+        response = take_snapshot(leader)
+        assert response.status_code == 200, response.text
+        released = response.json()
+        assert released["compacted_to"] > progress
+        assert released["stored_index"] > progress
+
+
+def varint(value):
+    """Protobuf base-128 varint encoding of a non-negative int."""
+    out = bytearray()
+    while True:
+        byte = value & 0x7F
+        value >>= 7
+        if value:
+            out.append(byte | 0x80)
+        else:
+            out.append(byte)
+            return bytes(out)
+
+
+def encode_round(round_parts):
+    """A packed repeated int64 round as field 1."""
+    packed = b"".join(varint(part) for part in round_parts)
+    return b"\x0a" + varint(len(packed)) + packed
+
+
+class TestAcceptedButUncommitted:
+    """Tests that an instance accepted on a minority shows its round and value until it is committed."""
+
+    # Only scooter-server-5 publishes its gRPC port to the host
+    GRPC_ADDRESS = "localhost:50055"
+    ROUND = [7, 99]
+    VALUE = 424242
+
+    def test_accepted_instance_shows_round_and_value(self, server_urls, docker_compose):
+        """
+        With servers 1 to 3 paused no proposer can reach a majority, so an
+        instance server 5 accepts stays uncommitted. Its round and value
+        show in GET /paxos/instances/:id and GET /admin/instances/pending.
+        """
+        import grpc
+        import requests
+
+        url = server_urls[4]
+        paused = ["scooter-server-1", "scooter-server-2", "scooter-server-3"]
+        # Far past anything the tests write, so no real proposal lands on it
+        instance = requests.get(f"{url}/lag", timeout=10).json()["next_index"] + 100_000
+
+        try:
+            for service in paused:
+                docker_compose.pause_service(service)
+
+            with grpc.insecure_channel(self.GRPC_ADDRESS) as channel:
+                def call(method):
+                    return channel.unary_unary(
+                        f"/paxos.Paxos/{method}",
+                        request_serializer=lambda data: data,
+                        response_deserializer=lambda data: data,
+                    )
+
+                call("Prepare")(encode_round(self.ROUND) + b"\x10" + varint(instance), timeout=5)
+                call("Accept")(
+                    encode_round(self.ROUND) + b"\x10" + varint(self.VALUE) + b"\x18" + varint(instance),
+                    timeout=5,
+                )
+
+            response = requests.get(f"{url}/paxos/instances/{instance}", timeout=10)
+            assert response.status_code == 200, response.text
+            data = response.json()
+            assert data["decided"] is False
+            assert data["last_round"] == self.ROUND
+            assert data["last_good_round"] == self.ROUND
+            assert data["value"] == self.VALUE
+
+            response = requests.get(f"{url}/admin/instances/pending", timeout=10)
+            assert response.status_code == 200
+            pending = {i["instance_id"]: i for i in response.json()["instances"]}
+            assert instance in pending
+            assert pending[instance]["last_good_round"] == self.ROUND
+            assert pending[instance]["value"] == self.VALUE
+        finally:
+            for service in paused:
+                docker_compose.unpause_service(service)
+            for url in server_urls[:3]:
+                wait_for_server(url)
+
+
+class TestPeerCircuitBreaker:
+    """Tests that the proposer stops waiting on a dead peer and takes it back."""
+
+    # Servers run with the default -breakercooldown of 5s
+    BREAKER_COOLDOWN = 5
+    PEER = "scooter-server-5:50051"
+
+    def breaker_states(self, urls):
+        import requests
+
+        states = []
+        for url in urls:
+            try:
+                peers = requests.get(f"{url}/admin/breakers", timeout=10).json()["peers"]
+                states += [p["state"] for p in peers if p["peer"] == self.PEER]
+            except requests.exceptions.RequestException:
+                pass
+        return states
+
+    def write_until(self, urls, scooter_id, predicate, timeout):
+        start, i = time.time(), 0
+        while time.time() - start < timeout:
+            create_scooter(urls[0], f"{scooter_id}-{i}")
+            i += 1
+            if predicate(self.breaker_states(urls)):
+                return True
+            time.sleep(0.2)
+        return False
+
+    def test_failing_peer_is_skipped_then_readmitted(self, server_urls, docker_compose, unique_scooter_id):
+        """A stopped peer trips open, writes stay fast, and it closes again once back."""
+        survivors = server_urls[:4]
+
+        try:
+            docker_compose.stop_service("scooter-server-5")
+
+            assert self.write_until(survivors, unique_scooter_id, lambda s: "open" in s, timeout=30), \
+                "Breaker for the stopped peer never opened"
+
+            start = time.time()
+            response = create_scooter(survivors[0], f"{unique_scooter_id}-fast")
+            assert response.status_code == 200
+            assert time.time() - start < 2, "Write still waited on the open peer"
+        finally:
+            docker_compose.start_service("scooter-server-5")
+            wait_for_server(server_urls[4])
+
+        assert self.write_until(
+            survivors, f"{unique_scooter_id}-back",
+            lambda s: s and all(state == "closed" for state in s),
+            timeout=self.BREAKER_COOLDOWN + 20
+        ), "Breaker for the restarted peer never closed"
+
+
+class TestRecoveryWithoutServers:
+    """Tests for starting a node with no -servers in a cluster that has members, in the noservers profile."""
+
+    def test_warns_when_membership_has_peers(self, docker_compose, server_urls):
+        """lonely-7 has no servers to recover from; it says so, naming the members it could have used."""
+        assert wait_for_server(server_urls[0])
+        try:
+            docker_compose.up_service("lonely-7")
+
+            deadline = time.time() + 20
+            while "WARNING: recovery has no servers" not in docker_compose.logs("lonely-7"):
+                assert time.time() < deadline, "lonely-7 did not warn about its empty server list"
+                time.sleep(1)
+            warning = docker_compose.logs("lonely-7").split("WARNING")[1].split("\n")[0]
+            assert "scooter-server-1:50051" in warning
+            assert "lonely-7:50051" not in warning
+        finally:
+            docker_compose.stop_service("lonely-7")
+
+
+class TestRecoveryStrategy:
+    """Tests for -recoverystrategy freshest, in the recoverystrategy profile."""
+
+    URL = "http://localhost:8099"
+
+    def test_recovers_from_highest_commit_index(self, docker_compose, api_url, unique_scooter_id):
+        """picky-9 lists the stale laggard-8 first but recovers from server 1, which has more committed."""
+        try:
+            for service in ["etcd-laggard", "laggard-8"]:
+                docker_compose.up_service(service)
+            deadline = time.time() + 30
+            while "listening on port" not in docker_compose.logs("laggard-8"):
+                assert time.time() < deadline, "laggard-8 did not start"
+                time.sleep(1)
+            # Let its one startup recovery finish before the cluster moves on
+            time.sleep(3)
+
+            response = create_scooter(api_url, unique_scooter_id)
+            assert response.status_code == 200, response.text
+
+            docker_compose.up_service("picky-9")
+            assert wait_for_server(self.URL), "picky-9 did not start"
+            deadline = time.time() + 30
+            while "Recovery picked scooter-server-1:50051" not in docker_compose.logs("picky-9"):
+                assert time.time() < deadline, "picky-9 did not pick server 1"
+                time.sleep(1)
+
+            response = get_scooter(self.URL, unique_scooter_id)
+            assert response.status_code == 200, response.text
+        finally:
+            for service in ["picky-9", "laggard-8", "etcd-laggard"]:
+                docker_compose.stop_service(service)
+
+
+class TestInstanceCap:
+    """Tests for -maxinstances, in the instancecap profile. capped-1 keeps at most 50 instances."""
+
+    SERVICES = ["etcd-capped", "capped-1"]
+    URL = "http://localhost:8100"
+    GRPC_ADDRESS = "localhost:50061"
+    LIMIT = 50
+
+    def prepare_request(self, instance_id):
+        """A PrepareRequest for round (1, 99), encoded by hand since the tests have no Paxos stubs."""
+        return encode_round([1, 99]) + b"\x10" + varint(instance_id)
+
+    def instance_counts(self):
+        import requests
+
+        response = requests.get(f"{self.URL}/metrics", timeout=10)
+        assert response.status_code == 200
+        metrics = {}
+        for line in response.text.splitlines():
+            if line and not line.startswith("#"):
+                name, value = line.split(" ", 1)
+                metrics[name] = float(value)
+        return metrics["scooter_paxos_instances"], metrics["scooter_paxos_undecided_instances"]
+
+    def test_prepare_flood_stays_bounded(self, docker_compose, unique_scooter_id):
+        """
+        200 Prepares for far-off instances fill the cap and the rest are
+        refused. Writes still commit, and once a snapshot compacts them the
+        map is back to the flood's 50 plus the latest write.
+        """
+        import grpc
+
+        try:
+            for service in self.SERVICES:
+                docker_compose.up_service(service)
+            assert wait_for_server(self.URL), "capped-1 did not start"
+
+            refused = 0
+            with grpc.insecure_channel(self.GRPC_ADDRESS) as channel:
+                prepare = channel.unary_unary(
+                    "/paxos.Paxos/Prepare",
+                    request_serializer=lambda data: data,
+                    response_deserializer=lambda data: data,
+                )
+                for i in range(200):
+                    try:
+                        prepare(self.prepare_request(1_000_000 + i), timeout=5)
+                    except grpc.RpcError:
+                        refused += 1
+            assert refused >= 200 - self.LIMIT
+
+            held, undecided = self.instance_counts()
+            assert undecided <= self.LIMIT
+            assert held <= self.LIMIT
+
+            for i in range(20):
+                response = create_scooter(self.URL, f"{unique_scooter_id}-{i}")
+                assert response.status_code == 200, response.text
+            assert take_snapshot(self.URL).status_code == 200
+
+            response = create_scooter(self.URL, unique_scooter_id)
+            assert response.status_code == 200, response.text
+            held, undecided = self.instance_counts()
+            assert undecided <= self.LIMIT
+            assert held <= self.LIMIT + 1
+        finally:
+            for service in self.SERVICES:
+                docker_compose.stop_service(service)
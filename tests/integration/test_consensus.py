@@ -181,3 +181,94 @@ class TestConsensusEdgeCases:
         assert scooter["is_available"] == True
 
 
+
+
+class TestProposerStats:
+    """Tests for GET /proposer/stats."""
+
+    def total(self, server_urls, field):
+        return sum(requests.get(f"{url}/proposer/stats", timeout=10).json()[field] for url in server_urls)
+
+    def test_stats_shape(self, api_url):
+        """The endpoint reports counters, rates and the current round."""
+        stats = requests.get(f"{api_url}/proposer/stats", timeout=10).json()
+
+        for field in ("proposals", "chosen", "prepare_nacks", "accept_nacks", "conflicts", "retries"):
+            assert stats[field] >= 0
+        assert 0 <= stats["conflict_rate"] <= 1
+        assert len(stats["round"]) == 2
+
+    def test_concurrent_reads_do_not_duel(self, server_urls):
+        """
+        Linearizable reads on every node at once confirm a read index rather
+        than each proposing a Noop for the same next instance, so they cause
+        no NACKs.
+        """
+        before = self.total(server_urls, "prepare_nacks") + self.total(server_urls, "accept_nacks")
+
+        def read(url):
+            return requests.get(f"{url}/scooters/stats", params={"consistency": "linearizable"}, timeout=60)
+
+        with ThreadPoolExecutor(max_workers=len(server_urls) * 4) as executor:
+            responses = list(executor.map(read, server_urls * 4))
+        assert all(r.status_code == 200 for r in responses)
+
+        after = self.total(server_urls, "prepare_nacks") + self.total(server_urls, "accept_nacks")
+        assert after == before, f"{after - before} NACKs from reads that shouldn't propose"
+
+    def test_writes_progress_under_read_load(self, server_urls, unique_scooter_id):
+        """
+        Server 1 runs with -proposalslots, so proposals beyond the cap queue
+        per class. Writes keep completing while every node serves a steady
+        stream of linearizable reads.
+        """
+        import threading
+
+        leader = server_urls[0]
+        stop = threading.Event()
+
+        def reader(url):
+            while not stop.is_set():
+                requests.get(f"{url}/scooters/stats", params={"consistency": "linearizable"}, timeout=60)
+
+        readers = [threading.Thread(target=reader, args=(url,)) for url in server_urls * 4]
+        for thread in readers:
+            thread.start()
+        try:
+            started = time.time()
+            with ThreadPoolExecutor(max_workers=10) as executor:
+                responses = list(executor.map(
+                    lambda i: create_scooter(leader, f"{unique_scooter_id}-{i}"), range(20)))
+            elapsed = time.time() - started
+        finally:
+            stop.set()
+            for thread in readers:
+                thread.join()
+
+        assert all(r.status_code == 200 for r in responses), [r.text for r in responses if r.status_code != 200]
+        assert elapsed < 30, f"20 writes took {elapsed:.1f}s under read load"
+
+        stats = requests.get(f"{leader}/proposer/stats", timeout=10).json()
+        assert stats["queued_writes"] >= 0 and stats["queued_reads"] >= 0
+        metrics = requests.get(f"{leader}/metrics", timeout=10).text
+        assert "scooter_proposal_queue_writes " in metrics
+        assert "scooter_proposal_queue_reads " in metrics
+
+    def test_burst_batches_accepts(self, server_urls, unique_scooter_id):
+        """
+        Server 1 runs with -acceptbatchwindow, so concurrent writes share
+        accept RPCs: it sends fewer of them than the accepts they carry.
+        """
+        leader = server_urls[0]
+        before = requests.get(f"{leader}/proposer/stats", timeout=10).json()
+
+        with ThreadPoolExecutor(max_workers=20) as executor:
+            responses = list(executor.map(
+                lambda i: create_scooter(leader, f"{unique_scooter_id}-{i}"), range(40)))
+        assert all(r.status_code == 200 for r in responses)
+
+        after = requests.get(f"{leader}/proposer/stats", timeout=10).json()
+        rpcs = after["accept_rpcs"] - before["accept_rpcs"]
+        accepts = after["accepts_sent"] - before["accepts_sent"]
+        assert accepts > 0
+        assert rpcs < accepts, f"{rpcs} accept RPCs for {accepts} accepts"
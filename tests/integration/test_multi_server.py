@@ -10,7 +10,9 @@ Run with: pytest tests/integration/test_multi_server.py -v
 """
 
 import pytest
+import requests
 import time
+import base64
 import sys
 import os
 
@@ -18,7 +20,8 @@ sys.path.insert(0, os.path.dirname(os.path.dirname(os.path.abspath(__file__))))
 from conftest import (
     create_scooter, get_scooter, get_all_scooters,
     reserve_scooter, release_scooter,
-    wait_for_server, wait_for_replication
+    wait_for_server, wait_for_replication,
+    put_cluster_config, wait_for_config
 )
 
 
@@ -261,3 +264,479 @@ class TestReplicationTiming:
             time.sleep(0.2)
 
         pytest.fail("Read consistency not achieved within 10 seconds")
+
+
+class TestDeterministicApply:
+    """Tests that replicas apply commands to byte-identical state."""
+
+    def test_committed_at_identical_on_all_servers(self, server_urls, unique_scooter_id):
+        """Every replica records the commit time chosen by the proposer."""
+        create_scooter(server_urls[0], unique_scooter_id)
+        index = requests.get(f"{server_urls[0]}/lag", timeout=10).json()["commit_index"]
+        time.sleep(2)
+
+        times = set()
+        for url in server_urls:
+            response = requests.get(f"{url}/log/{index}", timeout=10)
+            if response.status_code == 200:
+                times.add(response.json()["committed_at"])
+
+        assert len(times) == 1
+        assert times.pop() > 0
+
+    def test_reserved_at_identical_on_all_servers(self, server_urls, unique_scooter_id, unique_reservation_id):
+        """The reservation time comes from the command, not each replica's clock."""
+        create_scooter(server_urls[0], unique_scooter_id)
+        reserve_scooter(server_urls[0], unique_scooter_id, unique_reservation_id)
+        time.sleep(3)
+
+        states = []
+        for url in server_urls:
+            response = get_scooter(url, unique_scooter_id)
+            if response.status_code == 200:
+                states.append(response.json())
+
+        assert len(states) > 1
+        assert states[0]["reserved_at"] > 0
+        for state in states[1:]:
+            assert state == states[0], f"Replica state differs: {state} vs {states[0]}"
+
+
+class TestLeaderForwarding:
+    """Tests that writes sent to a follower are forwarded to the leader."""
+
+    def test_write_on_follower_succeeds(self, server_urls, unique_scooter_id):
+        """A follower hands the write to the leader and answers as if it did the work."""
+        # Server 1 has the lowest ID, so the last server is a follower
+        follower = server_urls[-1]
+        assert wait_for_server(follower), "Follower not available"
+
+        response = create_scooter(follower, unique_scooter_id)
+        assert response.status_code == 200
+
+        # The follower waits for the forwarded write to apply locally
+        assert get_scooter(follower, unique_scooter_id).status_code == 200
+        assert wait_for_replication(server_urls, unique_scooter_id)
+
+    def test_follower_reports_leader_conflict(self, server_urls, unique_scooter_id, unique_reservation_id):
+        """A write the leader rejects keeps the leader's status on the follower."""
+        follower = server_urls[-1]
+        create_scooter(follower, unique_scooter_id)
+        assert reserve_scooter(follower, unique_scooter_id, unique_reservation_id).status_code == 200
+
+        response = reserve_scooter(follower, unique_scooter_id, "second")
+
+        assert response.status_code == 409
+
+
+class TestRequestID:
+    """Tests that X-Request-ID follows a write from the client to the acceptors."""
+
+    def test_request_id_reaches_acceptor_logs(self, server_urls, docker_compose, unique_scooter_id):
+        """The client's request ID is echoed and logged by acceptors serving the proposal."""
+        request_id = f"req-{unique_scooter_id}"
+
+        response = requests.put(
+            f"{server_urls[0]}/scooters/{unique_scooter_id}",
+            headers={"X-Request-ID": request_id},
+            timeout=60
+        )
+
+        assert response.status_code == 200
+        assert response.headers.get("X-Request-ID") == request_id
+
+        accept_logged = False
+        for i in range(1, len(server_urls) + 1):
+            for line in docker_compose.logs(f"scooter-server-{i}").splitlines():
+                if "/paxos.Paxos/Accept" in line and f"request_id={request_id}" in line:
+                    accept_logged = True
+        assert accept_logged, "No acceptor logged an Accept carrying the request ID"
+
+    def test_request_id_generated_when_missing(self, api_url):
+        """Requests without an ID get one in the response."""
+        response = requests.get(f"{api_url}/scooters", timeout=10)
+
+        assert response.headers.get("X-Request-ID")
+
+
+class TestLeaderlessWindow:
+    """Tests that writes are refused while membership has no leader."""
+
+    def etcd(self, etcd_url, call, body):
+        return requests.post(f"{etcd_url}/v3/kv/{call}", json=body, timeout=10)
+
+    def test_writes_return_503_until_leader_elected(self, server_urls, etcd_url, unique_scooter_id):
+        """With every member key gone writes get 503; restoring them brings writes back."""
+        encode = lambda s: base64.b64encode(s.encode()).decode()
+        members = {"key": encode("members/"), "range_end": encode("members0")}
+
+        kvs = self.etcd(etcd_url, "range", members).json().get("kvs", [])
+        assert kvs, "No members registered"
+
+        try:
+            self.etcd(etcd_url, "deleterange", members)
+
+            response = None
+            deadline = time.time() + 10
+            while time.time() < deadline:
+                response = create_scooter(server_urls[0], f"{unique_scooter_id}-{time.time()}")
+                if response.status_code == 503:
+                    break
+                time.sleep(0.2)
+
+            assert response.status_code == 503
+            assert "no leader" in response.json()["error"]
+            assert "Retry-After" in response.headers
+        finally:
+            # Put the keys back under the nodes' own leases so they keep
+            # expiring with the nodes that own them
+            for kv in kvs:
+                self.etcd(etcd_url, "put", {"key": kv["key"], "value": kv["value"], "lease": kv.get("lease", "0")})
+
+        deadline = time.time() + 10
+        while time.time() < deadline:
+            response = create_scooter(server_urls[0], unique_scooter_id)
+            if response.status_code == 200:
+                break
+            time.sleep(0.2)
+        assert response.status_code == 200
+
+
+class TestClusterConfig:
+    """Tests for settings shared through etcd."""
+
+    def test_proposer_timeout_updates_on_every_node(self, server_urls, etcd_url):
+        """Changing config/proposer_timeout changes each proposer's timeout."""
+        try:
+            assert put_cluster_config(etcd_url, "proposer_timeout", "750ms").status_code == 200
+
+            for url in server_urls:
+                assert wait_for_config(url, "proposer_timeout_ms", 750), \
+                    f"{url} did not pick up the new proposer timeout"
+        finally:
+            put_cluster_config(etcd_url, "proposer_timeout", "2s")
+
+    def test_invalid_value_is_ignored(self, server_urls, etcd_url):
+        """A value that doesn't parse leaves the previous setting in place."""
+        url = server_urls[0]
+        before = requests.get(f"{url}/admin/config", timeout=10).json()["proposer_timeout_ms"]
+
+        put_cluster_config(etcd_url, "proposer_timeout", "soon")
+        time.sleep(1)
+
+        assert requests.get(f"{url}/admin/config", timeout=10).json()["proposer_timeout_ms"] == before
+
+
+class TestApplyErrorPolicy:
+    """Tests for the apply error policy and /health."""
+
+    def test_nodes_start_healthy_with_skip(self, server_urls):
+        """The cluster runs with the skip policy and reports healthy."""
+        for url in server_urls:
+            response = requests.get(f"{url}/health", timeout=10)
+            assert response.status_code == 200
+            assert response.json()["status"] == "ok"
+            assert response.json()["apply_error_policy"] == "skip"
+
+    def test_rejection_does_not_halt(self, server_urls, etcd_url, unique_scooter_id, unique_reservation_id):
+        """Under halt, a command refused by the rules is a 409, not a failure."""
+        try:
+            assert put_cluster_config(etcd_url, "apply_error_policy", "halt").status_code == 200
+            for url in server_urls:
+                assert wait_for_config(url, "apply_error_policy", "halt"), \
+                    f"{url} did not pick up the halt policy"
+
+            create_scooter(server_urls[0], unique_scooter_id)
+            assert reserve_scooter(server_urls[0], unique_scooter_id, unique_reservation_id).status_code == 200
+            response = reserve_scooter(server_urls[0], unique_scooter_id, f"{unique_reservation_id}-again")
+            assert response.status_code == 409
+
+            time.sleep(1)
+            for url in server_urls:
+                response = requests.get(f"{url}/health", timeout=10)
+                assert response.status_code == 200, f"{url} halted on a rejection: {response.text}"
+        finally:
+            put_cluster_config(etcd_url, "apply_error_policy", "skip")
+            for url in server_urls:
+                wait_for_config(url, "apply_error_policy", "skip")
+
+    def test_unknown_policy_is_ignored(self, server_urls, etcd_url):
+        """A policy other than skip or halt leaves the current one in place."""
+        url = server_urls[0]
+        try:
+            put_cluster_config(etcd_url, "apply_error_policy", "panic")
+            time.sleep(1)
+
+            assert requests.get(f"{url}/admin/config", timeout=10).json()["apply_error_policy"] == "skip"
+        finally:
+            put_cluster_config(etcd_url, "apply_error_policy", "skip")
+
+
+class TestProposerGeneratedIDs:
+    """Tests that IDs minted before proposing are the same on every replica."""
+
+    def test_reservation_token_matches_on_other_replica(self, server_urls, unique_scooter_id, unique_reservation_id):
+        """A token handed out by one node is accepted by another."""
+        create_scooter(server_urls[0], unique_scooter_id)
+        response = reserve_scooter(server_urls[0], unique_scooter_id, unique_reservation_id)
+        assert response.status_code == 200
+        token = response.json()["reservation_token"]
+
+        other = server_urls[2]
+        deadline = time.time() + 10
+        while time.time() < deadline:
+            scooter = get_scooter(other, unique_scooter_id)
+            if scooter.status_code == 200 and not scooter.json()["is_available"]:
+                break
+            time.sleep(0.2)
+
+        wrong = release_scooter(other, unique_scooter_id, 10, reservation_token="not-the-token")
+        assert wrong.status_code == 403
+
+        response = release_scooter(other, unique_scooter_id, 10, reservation_token=token)
+        assert response.status_code == 200, response.text
+
+
+class TestReadOnlyReplica:
+    """Tests for the read-only replica started with -readonly."""
+
+    def test_writes_rejected(self, readonly_url, unique_scooter_id):
+        """Every write route answers 405 on a read-only replica."""
+        assert create_scooter(readonly_url, unique_scooter_id).status_code == 405
+        assert reserve_scooter(readonly_url, unique_scooter_id, "res-1").status_code == 405
+        assert release_scooter(readonly_url, unique_scooter_id, 10).status_code == 405
+        assert get_scooter(readonly_url, unique_scooter_id).status_code == 404
+
+    def test_reads_follow_the_log(self, server_urls, readonly_url, unique_scooter_id):
+        """A scooter created through a voting node shows up on the replica."""
+        assert create_scooter(server_urls[0], unique_scooter_id).status_code == 200
+
+        deadline = time.time() + 10
+        response = None
+        while time.time() < deadline:
+            response = get_scooter(readonly_url, unique_scooter_id)
+            if response.status_code == 200:
+                break
+            time.sleep(0.2)
+        assert response.status_code == 200
+        assert response.json()["id"] == unique_scooter_id
+
+    def test_never_leader(self, server_urls, readonly_url):
+        """The replica reports itself read-only and is never the leader."""
+        health = requests.get(f"{readonly_url}/health", timeout=10).json()
+        assert health["read_only"] == True
+
+        heartbeat = requests.get(f"{readonly_url}/admin/heartbeat", timeout=10).json()
+        assert heartbeat["is_leader"] == False
+
+
+class TestStateHash:
+    """Tests for comparing applied state across replicas."""
+
+    def wait_for_common_index(self, url, timeout=15):
+        start = time.time()
+        while time.time() - start < timeout:
+            report = requests.get(f"{url}/admin/state-hash", timeout=10).json()
+            if report["common_applied_index"] >= 0:
+                return report
+            time.sleep(0.5)
+        return None
+
+    def test_replicas_at_same_index_agree(self, server_urls, unique_scooter_id, unique_reservation_id):
+        """Replicas that applied the same commands report the same hash."""
+        create_scooter(server_urls[0], unique_scooter_id)
+        reserve_scooter(server_urls[0], unique_scooter_id, unique_reservation_id)
+
+        report = self.wait_for_common_index(server_urls[0])
+
+        assert report is not None, "Replicas never settled on a common applied index"
+        assert report["consistent"] == True
+        hashes = {node["hash"] for node in report["nodes"] if not node.get("error")}
+        assert len(hashes) == 1
+
+    def test_hash_changes_with_state(self, server_urls, unique_scooter_id):
+        """A write moves every replica to a new hash."""
+        before = self.wait_for_common_index(server_urls[0])
+        assert before is not None
+
+        create_scooter(server_urls[0], unique_scooter_id)
+        after = self.wait_for_common_index(server_urls[0])
+
+        assert after is not None
+        assert after["common_applied_index"] > before["common_applied_index"]
+        assert after["nodes"][0]["hash"] != before["nodes"][0]["hash"]
+
+
+class TestLeaderHeartbeat:
+    """Tests for the leader's periodic Noop proposals."""
+
+    # Servers run with -heartbeatinterval 2s in docker-compose
+    HEARTBEAT_INTERVAL = 2
+
+    def heartbeats(self, server_urls):
+        return {url: requests.get(f"{url}/admin/heartbeat", timeout=10).json() for url in server_urls}
+
+    def test_only_leader_heartbeats(self, server_urls):
+        """An idle leader keeps proposing Noops while followers send none."""
+        before = self.heartbeats(server_urls)
+        time.sleep(self.HEARTBEAT_INTERVAL * 3)
+        after = self.heartbeats(server_urls)
+
+        leaders = [url for url in server_urls if after[url]["is_leader"]]
+        assert len(leaders) == 1
+        for url in server_urls:
+            sent = after[url]["sent"] - before[url]["sent"]
+            if url in leaders:
+                assert sent >= 2, f"Leader sent only {sent} heartbeats"
+            elif before[url]["is_leader"] == False:
+                assert sent == 0, f"Follower {url} sent {sent} heartbeats"
+
+    def test_heartbeats_advance_commit_index(self, server_urls):
+        """Followers' commit index moves while nothing else is written."""
+        follower = server_urls[-1]
+        before = requests.get(f"{follower}/lag", timeout=10).json()["commit_index"]
+        time.sleep(self.HEARTBEAT_INTERVAL * 3)
+        after = requests.get(f"{follower}/lag", timeout=10).json()["commit_index"]
+
+        assert after > before
+
+    def test_noops_leave_no_lag(self, server_urls):
+        """
+        Noops, from heartbeats or a read falling back to one, change no state
+        but still count as applied, so every node's applied index catches
+        up with its commit index instead of lagging forever.
+        """
+        before = {url: requests.get(f"{url}/lag", timeout=10).json() for url in server_urls}
+        response = requests.get(f"{server_urls[0]}/scooters", params={"linearizable": "true"}, timeout=10)
+        assert response.status_code == 200
+        time.sleep(self.HEARTBEAT_INTERVAL * 2)
+
+        for url in server_urls:
+            deadline = time.time() + 10
+            while True:
+                lag = requests.get(f"{url}/lag", timeout=10).json()
+                if lag["lag"] == 0 or time.time() > deadline:
+                    break
+                time.sleep(0.5)
+            assert lag["lag"] == 0, f"{url} is stuck {lag['lag']} behind"
+            assert lag["applied_index"] > before[url]["commit_index"], f"{url} applied nothing after the Noops"
+
+
+class TestPeersFromMembership:
+    """Tests for scooter-server-5, which is seeded with only scooter-server-1
+    and takes the rest of its proposer peers from etcd membership."""
+
+    SELF = "scooter-server-5:50051"
+
+    def test_peers_match_live_members(self, server_urls):
+        """After membership syncs, the proposer sends to every other member."""
+        url = server_urls[4]
+        deadline = time.time() + 15
+        while True:
+            report = requests.get(f"{url}/admin/peers", timeout=10).json()
+            members = set(report["members"]) - {self.SELF}
+            peers = set(report["peers"]) - {self.SELF}
+            if peers == members or time.time() > deadline:
+                break
+            time.sleep(0.5)
+
+        assert len(members) == len(server_urls) - 1
+        assert peers == members
+
+    def test_derived_peers_replicate_writes(self, server_urls, unique_scooter_id):
+        """Writes through the node with derived peers reach every replica."""
+        response = create_scooter(server_urls[4], unique_scooter_id)
+        assert response.status_code == 200
+
+        assert wait_for_replication(server_urls, unique_scooter_id)
+
+
+class TestMembershipSweep:
+    """Tests for dropping members whose etcd key is gone."""
+
+    def test_expired_member_is_reaped(self, server_urls, etcd_url):
+        """
+        A member registered with a short lease that is never kept alive
+        disappears from every node's view once the lease expires, whether
+        the watch or the periodic sweep notices first. It reuses a real
+        address and a high ID so it never becomes leader or a new peer.
+        """
+        encode = lambda s: base64.b64encode(s.encode()).decode()
+        lease = requests.post(f"{etcd_url}/v3/lease/grant", json={"TTL": 2}, timeout=10).json()["ID"]
+        response = requests.post(
+            f"{etcd_url}/v3/kv/put",
+            json={"key": encode("members/900"), "value": encode("scooter-server-1:50051"), "lease": lease},
+            timeout=10
+        )
+        assert response.status_code == 200
+
+        def member_counts():
+            return [len(requests.get(f"{url}/admin/peers", timeout=10).json()["members"]) for url in server_urls]
+
+        deadline = time.time() + 30
+        counts = member_counts()
+        while any(count != len(server_urls) for count in counts) and time.time() < deadline:
+            time.sleep(1)
+            counts = member_counts()
+
+        assert counts == [len(server_urls)] * len(server_urls), f"Stale member still listed: {counts}"
+
+
+class TestSetScooterState:
+    """Tests for PUT /admin/scooters/:id/state, enabled only on scooter-server-1."""
+
+    def set_state(self, url, scooter_id, state):
+        return requests.put(f"{url}/admin/scooters/{scooter_id}/state", json=state, timeout=60)
+
+    def wait_for_state(self, server_urls, scooter_id, predicate, timeout=10):
+        deadline = time.time() + timeout
+        while time.time() < deadline:
+            responses = [get_scooter(url, scooter_id) for url in server_urls]
+            if all(r.status_code == 200 and predicate(r.json()) for r in responses):
+                return True
+            time.sleep(0.5)
+        return False
+
+    def test_forced_state_replicates(self, server_urls, unique_scooter_id, unique_reservation_id):
+        """Every replica reads the forced state, and its token releases it."""
+        assert create_scooter(server_urls[0], unique_scooter_id).status_code == 200
+
+        response = self.set_state(server_urls[0], unique_scooter_id, {
+            "is_available": False,
+            "reservation_id": unique_reservation_id,
+            "client_id": "qa-client",
+            "total_distance": 1234,
+        })
+        assert response.status_code == 200, response.text
+        token = response.json()["reservation_token"]
+        assert response.json()["scooter"]["version"] == 2
+
+        def forced(scooter):
+            return (scooter["is_available"] == False
+                    and scooter["current_reservation_id"] == unique_reservation_id
+                    and scooter["total_distance"] == 1234)
+        assert self.wait_for_state(server_urls, unique_scooter_id, forced), "Forced state did not replicate"
+
+        response = release_scooter(server_urls[0], unique_scooter_id, 6, token)
+        assert response.status_code == 200, response.text
+        assert self.wait_for_state(server_urls, unique_scooter_id,
+                                   lambda s: s["is_available"] and s["total_distance"] == 1240)
+
+    def test_creates_missing_scooter(self, server_urls, unique_scooter_id):
+        """A scooter that doesn't exist yet is created in the given state."""
+        response = self.set_state(server_urls[0], unique_scooter_id, {"is_available": True, "total_distance": 50})
+        assert response.status_code == 200, response.text
+        assert wait_for_replication(server_urls, unique_scooter_id)
+        assert get_scooter(server_urls[1], unique_scooter_id).json()["total_distance"] == 50
+
+    def test_inconsistent_state_rejected(self, server_urls, unique_scooter_id):
+        """Reserved needs a reservation ID, available can't have one."""
+        assert self.set_state(server_urls[0], unique_scooter_id, {"is_available": False}).status_code == 400
+        response = self.set_state(server_urls[0], unique_scooter_id, {"is_available": True, "reservation_id": "r"})
+        assert response.status_code == 400
+
+    def test_disabled_without_flag(self, server_urls, unique_scooter_id):
+        """Nodes started without -allowsetstate refuse it."""
+        response = self.set_state(server_urls[1], unique_scooter_id, {"is_available": True})
+        assert response.status_code == 403
+        assert get_scooter(server_urls[1], unique_scooter_id).status_code == 404
@@ -278,3 +278,164 @@ class TestPartialRecovery:
         all_ids = [s["id"] for s in response.json()]
         for sid in scooter_ids:
             assert sid in all_ids
+
+
+class TestManualRecovery:
+    """Tests for POST /admin/recover."""
+
+    def test_recover_from_peer_reaches_peer_commit_index(self, server_urls, unique_scooter_id):
+        """Recovering from a peer brings this node's commit index up to the peer's."""
+        import requests
+
+        create_scooter(server_urls[0], unique_scooter_id)
+        peer_commit = requests.get(f"{server_urls[0]}/lag", timeout=10).json()["commit_index"]
+
+        response = requests.post(
+            f"{server_urls[4]}/admin/recover",
+            json={"peer": "scooter-server-1:50051"},
+            timeout=60
+        )
+
+        assert response.status_code == 200
+        result = response.json()
+        assert result["entries_applied"] >= 0
+        assert result["commit_index"] >= peer_commit
+        assert get_scooter(server_urls[4], unique_scooter_id).status_code == 200
+
+    def test_recovery_preserves_committed_at(self, server_urls, unique_scooter_id):
+        """Entries fetched during recovery keep the proposer's commit time."""
+        import requests
+
+        create_scooter(server_urls[0], unique_scooter_id)
+        index = requests.get(f"{server_urls[0]}/lag", timeout=10).json()["commit_index"]
+        original = requests.get(f"{server_urls[0]}/log/{index}", timeout=10).json()
+
+        response = requests.post(
+            f"{server_urls[4]}/admin/recover",
+            json={"peer": "scooter-server-1:50051"},
+            timeout=60
+        )
+        assert response.status_code == 200
+
+        recovered = requests.get(f"{server_urls[4]}/log/{index}", timeout=10)
+        assert recovered.status_code == 200
+        assert original["committed_at"] > 0
+        assert recovered.json()["committed_at"] == original["committed_at"]
+
+    def test_write_after_recovery_does_not_overwrite(self, server_urls, unique_scooter_id):
+        """A proposal racing recovery moves past instances recovery filled."""
+        import requests
+        from concurrent.futures import ThreadPoolExecutor
+
+        first, second = f"{unique_scooter_id}-a", f"{unique_scooter_id}-b"
+        create_scooter(server_urls[1], first)
+
+        with ThreadPoolExecutor(max_workers=2) as executor:
+            recovery = executor.submit(
+                requests.post, f"{server_urls[0]}/admin/recover",
+                json={"peer": "scooter-server-2:50051"}, timeout=60
+            )
+            write = executor.submit(create_scooter, server_urls[0], second)
+            assert recovery.result().status_code == 200
+            assert write.result().status_code == 200
+
+        assert wait_for_replication(server_urls, first)
+        assert wait_for_replication(server_urls, second)
+
+    @pytest.mark.timeout(600)
+    def test_recovery_larger_than_default_grpc_limit(self, server_urls, unique_scooter_id):
+        """
+        A recovery response over gRPC's 4MB default goes through, since
+        servers raise the limit with -grpcmaxmsgsize.
+        """
+        import requests
+
+        # Long IDs make each entry ~4KB, so ~1200 writes pass 4MB of log
+        padding = "x" * 4000
+        for i in range(1200):
+            response = create_scooter(server_urls[0], f"{unique_scooter_id}-{i}-{padding}")
+            assert response.status_code == 200
+
+        response = requests.post(
+            f"{server_urls[4]}/admin/recover",
+            json={"peer": "scooter-server-1:50051"},
+            timeout=120
+        )
+
+        assert response.status_code == 200, response.text
+        assert get_scooter(server_urls[4], f"{unique_scooter_id}-1199-{padding}").status_code == 200
+
+    def test_older_snapshot_does_not_regress(self, server_urls, unique_scooter_id):
+        """
+        Recovering from a peer whose snapshot is older than what this node
+        has applied installs nothing that would move it backwards.
+        """
+        import requests
+
+        before_snapshot, after_snapshot = f"{unique_scooter_id}-old", f"{unique_scooter_id}-new"
+        create_scooter(server_urls[0], before_snapshot)
+        assert wait_for_replication(server_urls, before_snapshot)
+        assert take_snapshot(server_urls[1]).status_code == 200
+
+        create_scooter(server_urls[0], after_snapshot)
+        assert wait_for_replication(server_urls, after_snapshot)
+        before = requests.get(f"{server_urls[4]}/lag", timeout=10).json()
+
+        response = requests.post(
+            f"{server_urls[4]}/admin/recover",
+            json={"peer": "scooter-server-2:50051"},
+            timeout=60
+        )
+        assert response.status_code == 200, response.text
+
+        after = requests.get(f"{server_urls[4]}/lag", timeout=10).json()
+        assert after["applied_index"] >= before["applied_index"]
+        assert after["commit_index"] >= before["commit_index"]
+        assert get_scooter(server_urls[4], after_snapshot).status_code == 200
+        assert get_scooter(server_urls[4], before_snapshot).status_code == 200
+
+    def test_recover_requires_peer(self, api_url):
+        """A request without a peer address is rejected."""
+        import requests
+
+        response = requests.post(f"{api_url}/admin/recover", json={}, timeout=10)
+
+        assert response.status_code == 400
+
+    def test_rejected_entry_recovers_as_rejected(self, server_urls, unique_scooter_id):
+        """A command every replica rejected is recorded as such and doesn't fail recovery."""
+        import requests
+        from concurrent.futures import ThreadPoolExecutor
+
+        create_scooter(server_urls[0], unique_scooter_id)
+        wait_for_replication(server_urls, unique_scooter_id)
+        start = requests.get(f"{server_urls[0]}/lag", timeout=10).json()["commit_index"]
+
+        # Racing reservations from every node pass their local checks, so all
+        # but one reach the log and are rejected when applied
+        with ThreadPoolExecutor(max_workers=len(server_urls)) as executor:
+            responses = list(executor.map(
+                lambda i: reserve_scooter(server_urls[i], unique_scooter_id, f"race-{i}"),
+                range(len(server_urls))
+            ))
+        assert sum(1 for r in responses if r.status_code == 200) == 1
+
+        end = requests.get(f"{server_urls[0]}/lag", timeout=10).json()["commit_index"]
+        rejected = []
+        for index in range(start + 1, end + 1):
+            entry = requests.get(f"{server_urls[0]}/log/{index}", timeout=10)
+            if entry.status_code == 200 and "apply_error" in entry.json():
+                rejected.append((index, entry.json()["apply_error"]))
+        if not rejected:
+            pytest.skip("Every losing reservation was caught before reaching the log")
+
+        response = requests.post(
+            f"{server_urls[4]}/admin/recover",
+            json={"peer": "scooter-server-1:50051"},
+            timeout=60
+        )
+        assert response.status_code == 200, response.text
+
+        for index, apply_error in rejected:
+            entry = requests.get(f"{server_urls[4]}/log/{index}", timeout=10).json()
+            assert entry.get("apply_error") == apply_error
@@ -258,7 +258,7 @@ class TestEdgeConditions:
                 if response.status_code == 200:
                     requests.post(
                         f"{api_url}/scooters/{unique_scooter_id}/releases",
-                        json={"distance": 1},
+                        json={"distance": 1, "reservation_token": response.json()["reservation_token"]},
                         timeout=5
                     )
             except requests.exceptions.Timeout:
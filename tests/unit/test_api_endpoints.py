@@ -10,15 +10,18 @@ These tests verify that the REST API works correctly for:
 Run with: pytest tests/unit/test_api_endpoints.py -v
 """
 
+import base64
+import json
 import pytest
 import requests
 import sys
+import time
 import os
 
 # Add parent directory to path so we can import from conftest
 sys.path.insert(0, os.path.dirname(os.path.dirname(os.path.abspath(__file__))))
 from conftest import (
-    create_scooter, get_scooter, get_all_scooters,
+    create_scooter, get_scooter, get_all_scooters, delete_scooter,
     reserve_scooter, release_scooter, take_snapshot
 )
 
@@ -43,12 +46,25 @@ class TestScooterCRUD:
         scooter = get_response.json()
         assert scooter["id"] == unique_scooter_id
 
-    def test_create_scooter_already_exists(self, api_url, unique_scooter_id):
-        """Creating a duplicate scooter should return an error."""
+    def test_create_scooter_retry_is_idempotent(self, api_url, unique_scooter_id):
+        """Re-creating an untouched scooter succeeds (a retried create)."""
         # Create scooter first time
         response1 = create_scooter(api_url, unique_scooter_id)
         assert response1.status_code in [200, 201]
 
+        # Retry the same create
+        response2 = create_scooter(api_url, unique_scooter_id)
+
+        assert response2.status_code == 200, \
+            f"Expected 200 for retried create, got {response2.status_code}"
+
+    def test_create_scooter_already_exists(self, api_url, unique_scooter_id, unique_reservation_id):
+        """Creating a scooter that has since changed is a conflict."""
+        # Create scooter first time and change it
+        response1 = create_scooter(api_url, unique_scooter_id)
+        assert response1.status_code in [200, 201]
+        reserve_scooter(api_url, unique_scooter_id, unique_reservation_id)
+
         # Try to create same scooter again
         response2 = create_scooter(api_url, unique_scooter_id)
 
@@ -106,6 +122,54 @@ class TestScooterCRUD:
         for scooter_id in scooter_ids:
             assert scooter_id in returned_ids, f"Scooter {scooter_id} not in response"
 
+    def test_get_scooters_by_ids(self, api_url, unique_scooter_id):
+        """GET /scooters?ids= returns the listed scooters and reports missing ones."""
+        existing = [f"{unique_scooter_id}-{i}" for i in range(2)]
+        missing = f"{unique_scooter_id}-missing"
+        for scooter_id in existing:
+            create_scooter(api_url, scooter_id)
+
+        response = requests.get(
+            f"{api_url}/scooters",
+            params={"ids": ",".join(existing + [missing]), "consistency": "linearizable"},
+            timeout=60
+        )
+
+        assert response.status_code == 200
+        result = response.json()
+        assert sorted(s["id"] for s in result["scooters"]) == sorted(existing)
+        assert result["not_found"] == [missing]
+
+    def test_delete_scooter(self, api_url, unique_scooter_id):
+        """DELETE /scooters/:id removes an available scooter."""
+        create_scooter(api_url, unique_scooter_id)
+
+        response = delete_scooter(api_url, unique_scooter_id)
+
+        assert response.status_code == 200
+        assert get_scooter(api_url, unique_scooter_id).status_code == 404
+        assert delete_scooter(api_url, unique_scooter_id).status_code == 404
+
+    def test_delete_reserved_scooter(self, api_url, unique_scooter_id, unique_reservation_id):
+        """A reserved scooter can't be deleted until it is released."""
+        create_scooter(api_url, unique_scooter_id)
+        reserve_scooter(api_url, unique_scooter_id, unique_reservation_id)
+
+        assert delete_scooter(api_url, unique_scooter_id).status_code == 409
+
+        release_scooter(api_url, unique_scooter_id, 10)
+        assert delete_scooter(api_url, unique_scooter_id).status_code == 200
+
+    def test_recreate_deleted_scooter(self, api_url, unique_scooter_id):
+        """A deleted ID can be created again, starting fresh."""
+        create_scooter(api_url, unique_scooter_id)
+        delete_scooter(api_url, unique_scooter_id)
+
+        assert create_scooter(api_url, unique_scooter_id).status_code == 200
+        scooter = get_scooter(api_url, unique_scooter_id).json()
+        assert scooter["is_available"] == True
+        assert scooter["total_distance"] == 0
+
 
 # ============================================================================
 # RESERVATION TESTS
@@ -161,6 +225,66 @@ class TestReservations:
 
         assert scooter["current_reservation_id"] == unique_reservation_id
 
+    def test_reserve_returns_updated_scooter(self, server_urls, unique_scooter_id, unique_reservation_id):
+        """The reserve response carries the scooter as the reserve left it."""
+        for url in [server_urls[0], server_urls[2]]:
+            scooter_id = f"{unique_scooter_id}-{url[-4:]}"
+            create_scooter(url, scooter_id)
+
+            response = reserve_scooter(url, scooter_id, unique_reservation_id)
+
+            assert response.status_code == 200
+            scooter = response.json()["scooter"]
+            assert scooter["id"] == scooter_id
+            assert scooter["is_available"] == False
+            assert scooter["current_reservation_id"] == unique_reservation_id
+
+    def test_reserve_malformed_body(self, api_url, unique_scooter_id):
+        """A body that doesn't decode returns 400 and reserves nothing."""
+        create_scooter(api_url, unique_scooter_id)
+
+        response = requests.post(
+            f"{api_url}/scooters/{unique_scooter_id}/reservations",
+            json={"reservation_id": "res", "version": "latest"},
+            timeout=10
+        )
+
+        assert response.status_code == 400
+        assert "error" in response.json()
+        assert get_scooter(api_url, unique_scooter_id).json()["is_available"] == True
+
+    def test_list_active_reservations(self, api_url, unique_scooter_id, unique_reservation_id):
+        """GET /reservations lists held scooters and drops released ones."""
+        held, released = f"{unique_scooter_id}-held", f"{unique_scooter_id}-released"
+        for scooter_id in (held, released):
+            create_scooter(api_url, scooter_id)
+            reserve_scooter(api_url, scooter_id, f"{unique_reservation_id}-{scooter_id}")
+        release_scooter(api_url, released, 10)
+
+        response = requests.get(f"{api_url}/reservations", params={"consistency": "linearizable"}, timeout=60)
+
+        assert response.status_code == 200
+        reservations = {r["scooter_id"]: r for r in response.json()["reservations"]}
+        assert released not in reservations
+        assert reservations[held]["reservation_id"] == f"{unique_reservation_id}-{held}"
+        assert reservations[held]["reserved_at"] > 0
+
+    def test_cancel_reservation_by_id(self, api_url, unique_scooter_id, unique_reservation_id):
+        """DELETE /reservations/:id frees the scooter without the rider's token."""
+        create_scooter(api_url, unique_scooter_id)
+        reserve_scooter(api_url, unique_scooter_id, unique_reservation_id)
+
+        response = requests.delete(f"{api_url}/reservations/{unique_reservation_id}", timeout=60)
+
+        assert response.status_code == 200
+        assert response.json()["scooter_id"] == unique_scooter_id
+        scooter = get_scooter(api_url, unique_scooter_id).json()
+        assert scooter["is_available"] == True
+        assert scooter["total_distance"] == 0
+
+        again = requests.delete(f"{api_url}/reservations/{unique_reservation_id}", timeout=60)
+        assert again.status_code == 404
+
 
 # ============================================================================
 # RELEASE TESTS
@@ -231,6 +355,69 @@ class TestSnapshots:
         # Should succeed
         assert response.status_code == 200
 
+    def test_snapshot_compaction_held_to_watermark(self, api_url):
+        """Compaction never goes past the snapshot index (or a lagging peer)."""
+        response = take_snapshot(api_url)
+
+        assert response.status_code == 200
+        result = response.json()
+        assert result["compacted_to"] <= result["index"]
+
+    def test_repeat_at_same_commit_index_is_noop(self, server_urls, unique_scooter_id):
+        """A retry before anything new commits returns the same snapshot and compacts nothing more."""
+        url = server_urls[0]
+        create_scooter(url, unique_scooter_id)
+
+        # Heartbeats commit every 2s, so retry until both calls land between two
+        for _ in range(5):
+            first = take_snapshot(url).json()
+            snapshots = requests.get(f"{url}/admin/snapshots", timeout=10).json()["snapshots"]
+            second = take_snapshot(url).json()
+            if second["index"] == first["index"]:
+                break
+        assert second["index"] == first["index"], "a commit landed between every pair of snapshots"
+
+        assert second["status"] == "Snapshot already taken"
+        assert second["compacted_to"] == first["compacted_to"]
+        assert second["stored_index"] == first["stored_index"]
+        assert requests.get(f"{url}/admin/snapshots", timeout=10).json()["snapshots"] == snapshots
+
+    def test_retention_prunes_oldest(self, server_urls, unique_scooter_id):
+        """Taking one snapshot more than the retention drops the oldest."""
+        url = server_urls[0]
+        retention = requests.get(f"{url}/admin/snapshots", timeout=10).json()["retention"]
+        assert retention > 1, "scooter-server-1 should run with -snapshotretention"
+
+        indices = []
+        for i in range(retention + 1):
+            create_scooter(url, f"{unique_scooter_id}-{i}")
+            indices.append(take_snapshot(url).json()["index"])
+
+        snapshots = requests.get(f"{url}/admin/snapshots", timeout=10).json()["snapshots"]
+        assert [snapshot["index"] for snapshot in snapshots] == indices[1:]
+
+    def test_restore_older_snapshot_replays_log(self, server_urls, unique_scooter_id):
+        """Restoring a retained snapshot keeps writes made after it."""
+        url = server_urls[0]
+        create_scooter(url, f"{unique_scooter_id}-before")
+        older = take_snapshot(url).json()["index"]
+        create_scooter(url, f"{unique_scooter_id}-after")
+        take_snapshot(url)
+
+        response = requests.post(f"{url}/admin/snapshots/{older}/restore", timeout=30)
+
+        assert response.status_code == 200
+        assert response.json()["reapplied"] >= 1
+        assert get_scooter(url, f"{unique_scooter_id}-before").status_code == 200
+        assert get_scooter(url, f"{unique_scooter_id}-after").status_code == 200
+        snapshots = requests.get(f"{url}/admin/snapshots", timeout=10).json()["snapshots"]
+        assert snapshots[-1]["index"] == older
+
+    def test_restore_unknown_snapshot(self, api_url):
+        """Restoring an index that isn't retained is a 404."""
+        response = requests.post(f"{api_url}/admin/snapshots/999999999/restore", timeout=10)
+        assert response.status_code == 404
+
 
 # ============================================================================
 # EDGE CASES
@@ -274,3 +461,529 @@ class TestEdgeCases:
         # This might succeed or fail depending on validation rules
         # Just check we get a reasonable response
         assert response.status_code in [200, 400]
+
+
+class TestScooterIDValidation:
+    """Scooter IDs must be non-empty, at most 4096 bytes and [A-Za-z0-9._:-]."""
+
+    MAX_LENGTH = 4096
+
+    def test_blank_id_rejected_at_create(self, api_url):
+        """An ID of only whitespace is rejected before it is proposed."""
+        response = requests.put(f"{api_url}/scooters/%20%20", timeout=10)
+        assert response.status_code == 400
+        assert "invalid scooter id" in response.json()["error"]
+
+    def test_overly_long_id_rejected_at_create(self, api_url, unique_scooter_id):
+        """One byte over the limit is rejected, the limit itself is fine."""
+        at_limit = unique_scooter_id + "-" + "x" * (self.MAX_LENGTH - len(unique_scooter_id) - 1)
+
+        response = create_scooter(api_url, at_limit + "x")
+        assert response.status_code == 400
+        assert get_scooter(api_url, at_limit + "x").status_code == 404
+
+        response = create_scooter(api_url, at_limit)
+        assert response.status_code == 200
+
+    def test_disallowed_characters_rejected(self, api_url, unique_scooter_id):
+        """Characters outside the set are rejected on create and on reserve."""
+        bad_id = f"{unique_scooter_id}!"
+
+        assert create_scooter(api_url, bad_id).status_code == 400
+        response = reserve_scooter(api_url, bad_id, "res-bad-id")
+        assert response.status_code == 400
+        assert "invalid scooter id" in response.json()["error"]
+
+
+# ============================================================================
+# LAG TESTS
+# ============================================================================
+
+class TestLag:
+    """Tests for the commit/applied lag endpoint."""
+
+    def test_lag_reports_indices(self, api_url, unique_scooter_id):
+        """GET /lag reports commit and applied index and their gap."""
+        create_scooter(api_url, unique_scooter_id)
+
+        response = requests.get(f"{api_url}/lag", timeout=10)
+
+        assert response.status_code == 200
+        lag = response.json()
+        assert lag["applied_index"] >= 0
+        assert lag["lag"] == max(0, lag["commit_index"] - lag["applied_index"])
+
+    def test_lag_closes_after_write(self, api_url, unique_scooter_id):
+        """After a local write commits, nothing is left unapplied."""
+        create_scooter(api_url, unique_scooter_id)
+
+        lag = requests.get(f"{api_url}/lag", timeout=10).json()
+
+        assert lag["lag"] == 0
+
+
+# ============================================================================
+# LOG INSPECTION TESTS
+# ============================================================================
+
+class TestLogInspection:
+    """Tests for reading raw log entries by index."""
+
+    def test_get_log_entry(self, api_url, unique_scooter_id):
+        """GET /log/:index returns the decoded command and raw bytes."""
+        create_scooter(api_url, unique_scooter_id)
+        commit_index = requests.get(f"{api_url}/lag", timeout=10).json()["commit_index"]
+
+        # Leader heartbeats may have committed Noops after the create
+        entry = None
+        for index in range(commit_index, max(-1, commit_index - 20), -1):
+            response = requests.get(f"{api_url}/log/{index}", timeout=10)
+            if response.status_code != 200:
+                continue
+            candidate = response.json()
+            if candidate.get("command", {}).get("scooter_id") == unique_scooter_id:
+                entry = candidate
+                break
+
+        assert entry is not None, "CREATE entry not found near the commit index"
+        assert entry["index"] == index
+        assert entry["command"]["command_type"] == "CREATE"
+        assert len(entry["raw_sha256"]) == 64
+        raw = json.loads(base64.b64decode(entry["raw"]))
+        assert raw["scooter_id"] == unique_scooter_id
+
+    def test_log_hides_reservation_token(self, api_url, unique_scooter_id, unique_reservation_id):
+        """A reserve's token and signature never show in GET /log/:index or GET /log."""
+        create_scooter(api_url, unique_scooter_id)
+        response = reserve_scooter(api_url, unique_scooter_id, unique_reservation_id)
+        assert response.status_code == 200
+        token = response.json()["reservation_token"]
+        commit_index = requests.get(f"{api_url}/lag", timeout=10).json()["commit_index"]
+
+        entry = None
+        for index in range(commit_index, max(-1, commit_index - 20), -1):
+            response = requests.get(f"{api_url}/log/{index}", timeout=10)
+            if response.status_code != 200:
+                continue
+            candidate = response.json()
+            if candidate.get("command", {}).get("reservation_id") == unique_reservation_id:
+                entry = response
+                break
+
+        assert entry is not None, "RESERVE entry not found near the commit index"
+        assert entry.json()["command"]["command_type"] == "RESERVE"
+        assert "reservation_token" not in entry.json()["command"]
+        assert "signature" not in entry.json()["command"]
+        assert token not in entry.text
+
+        listing = requests.get(f"{api_url}/log", params={"from": index, "to": index}, timeout=10)
+        assert listing.status_code == 200
+        assert token not in listing.text
+
+    def test_get_log_entry_missing(self, api_url):
+        """An index that was never written returns 404."""
+        response = requests.get(f"{api_url}/log/999999999", timeout=10)
+
+        assert response.status_code == 404
+
+    def test_get_log_entry_invalid_index(self, api_url):
+        """A non-numeric index returns 400."""
+        response = requests.get(f"{api_url}/log/abc", timeout=10)
+
+        assert response.status_code == 400
+
+    def test_log_range_across_compaction(self, server_urls, unique_scooter_id):
+        """GET /log marks compacted instances and decodes the ones after."""
+        url = server_urls[1]
+        create_scooter(url, f"{unique_scooter_id}-1")
+        compacted_to = take_snapshot(url).json()["compacted_to"]
+        if compacted_to < 1:
+            pytest.skip("A lagging peer held compaction back")
+        create_scooter(url, f"{unique_scooter_id}-2")
+        commit_index = requests.get(f"{url}/lag", timeout=10).json()["commit_index"]
+
+        response = requests.get(f"{url}/log", params={"from": compacted_to - 1, "to": commit_index}, timeout=10)
+
+        assert response.status_code == 200
+        entries = response.json()["entries"]
+        assert [entry["index"] for entry in entries] == list(range(compacted_to - 1, commit_index + 1))
+        for entry in entries:
+            if entry["index"] <= compacted_to:
+                assert entry.get("compacted") == True
+        later = [entry for entry in entries if entry["index"] > compacted_to and "command" in entry]
+        assert any(entry["command"].get("scooter_id") == f"{unique_scooter_id}-2" for entry in later)
+
+    def test_log_range_span_limited(self, api_url):
+        """A range wider than the maximum span is refused."""
+        response = requests.get(f"{api_url}/log", params={"from": 0, "to": 1000000}, timeout=10)
+
+        assert response.status_code == 400
+
+
+class TestPendingInstances:
+    """Tests for listing accepted-but-uncommitted instances."""
+
+    def test_pending_instances_shape(self, api_url):
+        """The endpoint returns a count and a list of instances."""
+        response = requests.get(f"{api_url}/admin/instances/pending", timeout=10)
+
+        assert response.status_code == 200
+        data = response.json()
+        assert data["count"] == len(data["instances"])
+        for instance in data["instances"]:
+            assert "instance_id" in instance
+            assert "last_good_round" in instance
+            assert any(part != 0 for part in instance["last_good_round"])
+
+    def test_committed_write_not_pending(self, api_url, unique_scooter_id):
+        """An instance that has been committed is not listed."""
+        create_scooter(api_url, unique_scooter_id)
+        commit_index = requests.get(f"{api_url}/lag", timeout=10).json()["commit_index"]
+
+        response = requests.get(f"{api_url}/admin/instances/pending", timeout=10)
+
+        assert response.status_code == 200
+        ids = [i["instance_id"] for i in response.json()["instances"]]
+        assert commit_index not in ids
+
+
+class TestInstanceState:
+    """Tests for GET /paxos/instances/:id."""
+
+    def test_decided_instance(self, api_url, unique_scooter_id):
+        """A committed write's instance is decided here and a round ran for it."""
+        create_scooter(api_url, unique_scooter_id)
+        commit_index = requests.get(f"{api_url}/lag", timeout=10).json()["commit_index"]
+
+        response = requests.get(f"{api_url}/paxos/instances/{commit_index}", timeout=10)
+
+        assert response.status_code == 200
+        data = response.json()
+        assert data["instance_id"] == commit_index
+        assert data["decided"] is True
+        assert len(data["proposer_round"]) == 2
+        assert len(data["last_round"]) == 2
+
+    def test_unknown_instance_404(self, api_url):
+        """An instance nobody has proposed yet is unknown."""
+        next_index = requests.get(f"{api_url}/lag", timeout=10).json()["next_index"]
+
+        response = requests.get(f"{api_url}/paxos/instances/{next_index + 100000}", timeout=10)
+
+        assert response.status_code == 404
+
+    def test_non_integer_id_400(self, api_url):
+        """The instance ID must be a number."""
+        response = requests.get(f"{api_url}/paxos/instances/latest", timeout=10)
+
+        assert response.status_code == 400
+
+
+class TestVersion:
+    """Tests for the build and protocol version endpoint."""
+
+    def test_version_fields(self, api_url):
+        """GET /version reports build info and every format version."""
+        response = requests.get(f"{api_url}/version", timeout=10)
+
+        assert response.status_code == 200
+        data = response.json()
+        assert data["version"]
+        assert data["protocol_version"] >= 1
+        assert data["command_version"] >= 1
+        assert data["snapshot_version"] >= 2
+
+    def test_all_servers_speak_same_protocol(self, server_urls):
+        """Every node in the cluster reports the same protocol version."""
+        versions = {requests.get(f"{url}/version", timeout=10).json()["protocol_version"] for url in server_urls}
+
+        assert len(versions) == 1
+
+
+# ============================================================================
+# READ CONSISTENCY TESTS
+# ============================================================================
+
+class TestReadConsistency:
+    """Tests for the consistency query parameter on reads."""
+
+    @pytest.mark.parametrize("mode", ["linearizable", "bounded", "eventual"])
+    def test_get_scooter_with_mode(self, api_url, unique_scooter_id, mode):
+        """Each consistency mode serves a freshly created scooter."""
+        create_scooter(api_url, unique_scooter_id)
+
+        response = requests.get(
+            f"{api_url}/scooters/{unique_scooter_id}",
+            params={"consistency": mode},
+            timeout=60
+        )
+
+        assert response.status_code == 200
+        assert response.json()["id"] == unique_scooter_id
+
+    @pytest.mark.parametrize("mode", ["linearizable", "bounded", "eventual"])
+    def test_get_scooters_with_mode(self, api_url, mode):
+        """Each consistency mode works on the list endpoint."""
+        response = requests.get(f"{api_url}/scooters", params={"consistency": mode}, timeout=60)
+
+        assert response.status_code == 200
+        assert isinstance(response.json(), list)
+
+    def test_linearizable_reads_take_no_instance(self, api_url, server_urls):
+        """
+        Linearizable reads confirm a read index with a majority instead of
+        proposing, so 100 of them leave next_index where heartbeats put it.
+        """
+        def heartbeats():
+            total = 0
+            for url in server_urls:
+                stats = requests.get(f"{url}/admin/heartbeat", timeout=10).json()
+                total += stats["sent"] + stats["failed"]
+            return total
+
+        before_heartbeats = heartbeats()
+        before = requests.get(f"{api_url}/lag", timeout=10).json()["next_index"]
+
+        for _ in range(100):
+            response = requests.get(f"{api_url}/scooters/stats", params={"consistency": "linearizable"}, timeout=60)
+            assert response.status_code == 200
+
+        after = requests.get(f"{api_url}/lag", timeout=10).json()["next_index"]
+        # The leader's heartbeat Noops are the only instances still being used
+        assert after - before <= heartbeats() - before_heartbeats
+
+    def test_unknown_mode_rejected(self, api_url):
+        """An unknown consistency mode returns 400."""
+        response = requests.get(f"{api_url}/scooters", params={"consistency": "strong"}, timeout=10)
+
+        assert response.status_code == 400
+
+
+# ============================================================================
+# FLEET STATS TESTS
+# ============================================================================
+
+class TestFleetStats:
+    """Tests for the aggregate /scooters/stats endpoint."""
+
+    def test_stats_track_operations(self, api_url, unique_scooter_id):
+        """Counts move as scooters are created, reserved and released."""
+        before = requests.get(f"{api_url}/scooters/stats", params={"linearizable": "true"}, timeout=60).json()
+
+        ids = [f"{unique_scooter_id}-{i}" for i in range(3)]
+        for sid in ids:
+            create_scooter(api_url, sid)
+        reserve_scooter(api_url, ids[0], "stats-0")
+        reserve_scooter(api_url, ids[1], "stats-1")
+        release_scooter(api_url, ids[1], 40)
+
+        response = requests.get(f"{api_url}/scooters/stats", params={"linearizable": "true"}, timeout=60)
+
+        assert response.status_code == 200
+        after = response.json()
+        assert after["total"] - before["total"] == 3
+        assert after["available"] - before["available"] == 2
+        assert after["reserved"] - before["reserved"] == 1
+        assert after["total_distance"] - before["total_distance"] == 40
+        assert after["total"] == after["available"] + after["reserved"]
+
+    def test_stats_does_not_shadow_scooter_lookup(self, api_url, unique_scooter_id):
+        """GET /scooters/:id still works next to /scooters/stats."""
+        create_scooter(api_url, unique_scooter_id)
+
+        response = get_scooter(api_url, unique_scooter_id)
+
+        assert response.status_code == 200
+
+
+# ============================================================================
+# RESERVATION QUOTA TESTS
+# ============================================================================
+
+RESERVATION_QUOTA = int(os.environ.get("RESERVATION_QUOTA", "3"))
+
+
+class TestReservationQuota:
+    """Tests for the per-client active reservation quota."""
+
+    def reserve_as(self, api_url, scooter_id, client_id):
+        return requests.post(
+            f"{api_url}/scooters/{scooter_id}/reservations",
+            json={"reservation_id": f"res-{scooter_id}", "client_id": client_id},
+            timeout=60
+        )
+
+    def test_quota_plus_one_rejected(self, api_url, unique_scooter_id):
+        """A client can't hold more than the quota at once."""
+        client_id = f"client-{unique_scooter_id}"
+        ids = [f"{unique_scooter_id}-{i}" for i in range(RESERVATION_QUOTA + 1)]
+        for sid in ids:
+            create_scooter(api_url, sid)
+
+        for sid in ids[:-1]:
+            assert self.reserve_as(api_url, sid, client_id).status_code == 200
+
+        response = self.reserve_as(api_url, ids[-1], client_id)
+        assert response.status_code in [409, 429]
+
+    def test_release_frees_slot(self, api_url, unique_scooter_id):
+        """Releasing one reservation lets the client reserve again."""
+        client_id = f"client-{unique_scooter_id}"
+        ids = [f"{unique_scooter_id}-{i}" for i in range(RESERVATION_QUOTA + 1)]
+        for sid in ids:
+            create_scooter(api_url, sid)
+        for sid in ids[:-1]:
+            self.reserve_as(api_url, sid, client_id)
+
+        release_scooter(api_url, ids[0], 10)
+
+        response = self.reserve_as(api_url, ids[-1], client_id)
+        assert response.status_code == 200
+
+
+# ============================================================================
+# COMMAND TTL TESTS
+# ============================================================================
+
+class TestCommandTTL:
+    """Tests for refusing writes older than their TTL."""
+
+    def create_created_at(self, api_url, scooter_id, created_at):
+        return requests.put(
+            f"{api_url}/scooters/{scooter_id}",
+            headers={"X-Created-At": str(created_at)},
+            timeout=60
+        )
+
+    def test_fresh_command_accepted(self, api_url, unique_scooter_id):
+        """A write created just now goes through."""
+        response = self.create_created_at(api_url, unique_scooter_id, int(time.time() * 1000))
+        assert response.status_code == 200
+        assert get_scooter(api_url, unique_scooter_id).status_code == 200
+
+    def test_command_older_than_ttl_rejected(self, api_url, unique_scooter_id):
+        """A write created longer ago than the TTL is refused and never applied."""
+        ttl_ms = requests.get(f"{api_url}/admin/config", timeout=10).json()["command_ttl_ms"]
+        assert ttl_ms > 0
+
+        created_at = int(time.time() * 1000) - ttl_ms - 5000
+        response = self.create_created_at(api_url, unique_scooter_id, created_at)
+        assert response.status_code == 409
+        assert "TTL" in response.json()["error"]
+        assert get_scooter(api_url, unique_scooter_id).status_code == 404
+
+    def test_invalid_created_at_rejected(self, api_url, unique_scooter_id):
+        """X-Created-At has to be unix milliseconds."""
+        response = self.create_created_at(api_url, unique_scooter_id, "yesterday")
+        assert response.status_code == 400
+
+
+# ============================================================================
+# PROFILING TESTS
+# ============================================================================
+
+class TestProfiling:
+    """Tests for the pprof endpoints, enabled only on scooter-server-1."""
+
+    def test_profile_endpoint_when_enabled(self, server_urls):
+        """A node started with -pprof serves heap profiles."""
+        response = requests.get(f"{server_urls[0]}/debug/pprof/heap", timeout=10)
+        assert response.status_code == 200
+        assert len(response.content) > 0
+
+    def test_profile_endpoint_absent_by_default(self, server_urls):
+        """Nodes started without -pprof do not expose it."""
+        response = requests.get(f"{server_urls[1]}/debug/pprof/heap", timeout=10)
+        assert response.status_code == 404
+
+
+# ============================================================================
+# METRICS TESTS
+# ============================================================================
+
+def parse_metrics(text):
+    """Sample lines of the Prometheus text format as {name: value}."""
+    metrics = {}
+    for line in text.splitlines():
+        if line and not line.startswith("#"):
+            name, value = line.split(" ", 1)
+            metrics[name] = float(value)
+    return metrics
+
+
+class TestMetrics:
+    """Tests for the etcd health gauges on GET /metrics."""
+
+    def test_etcd_gauges_on_healthy_node(self, api_url):
+        """A node with a live lease reports etcd up and sees the cluster."""
+        response = requests.get(f"{api_url}/metrics", timeout=10)
+        assert response.status_code == 200
+        assert response.headers["Content-Type"].startswith("text/plain")
+
+        metrics = parse_metrics(response.text)
+        assert metrics["scooter_etcd_up"] == 1
+        assert 0 < metrics["scooter_etcd_lease_remaining_seconds"] <= 5
+        assert metrics["scooter_membership_members"] >= 3
+        assert metrics["scooter_membership_watch_restarts_total"] >= 0
+
+
+    def test_reserve_records_labeled_observation(self, api_url, unique_scooter_id, unique_reservation_id):
+        """A reserve is counted under its route template, never the scooter's own path."""
+        counter = 'scooter_http_requests_total{method="POST",route="/scooters/:id/reservations",status="200"}'
+        histogram = 'scooter_http_request_duration_seconds_count{method="POST",route="/scooters/:id/reservations"}'
+        create_scooter(api_url, unique_scooter_id)
+        before = parse_metrics(requests.get(f"{api_url}/metrics", timeout=10).text)
+
+        assert reserve_scooter(api_url, unique_scooter_id, unique_reservation_id).status_code == 200
+
+        response = requests.get(f"{api_url}/metrics", timeout=10)
+        after = parse_metrics(response.text)
+        assert after[counter] == before.get(counter, 0) + 1
+        assert after[histogram] == before.get(histogram, 0) + 1
+        assert after[histogram.replace("_count{", '_bucket{').replace("}", ',le="+Inf"}')] == after[histogram]
+        assert unique_scooter_id not in response.text
+
+
+# ============================================================================
+# DRY RUN TESTS
+# ============================================================================
+
+class TestDryRun:
+    """Tests for POST /debug/dryrun, which applies a command to a copy of the state."""
+
+    def test_dry_run_reserve_leaves_scooter_untouched(self, api_url, unique_scooter_id, unique_reservation_id):
+        """A dry-run reserve shows the reserved scooter but nothing is proposed."""
+        create_scooter(api_url, unique_scooter_id)
+
+        response = requests.post(f"{api_url}/debug/dryrun", json={
+            "scooter_id": unique_scooter_id,
+            "command": {"command_type": "RESERVE", "reservation_id": unique_reservation_id},
+        }, timeout=10)
+
+        assert response.status_code == 200
+        data = response.json()
+        assert data["applied"] == True
+        assert data["scooter"]["is_available"] == False
+        assert data["scooter"]["current_reservation_id"] == unique_reservation_id
+
+        scooter = get_scooter(api_url, unique_scooter_id).json()
+        assert scooter["is_available"] == True
+        assert scooter["version"] == 1
+
+    def test_dry_run_reports_rejection(self, api_url, unique_scooter_id):
+        """Releasing an available scooter would be rejected, and the dry run says why."""
+        create_scooter(api_url, unique_scooter_id)
+
+        response = requests.post(f"{api_url}/debug/dryrun", json={
+            "scooter_id": unique_scooter_id,
+            "command": {"command_type": "RELEASE", "distance": 5},
+        }, timeout=10)
+
+        assert response.status_code == 200
+        assert response.json()["applied"] == False
+        assert "already available" in response.json()["error"]
+
+    def test_dry_run_requires_command(self, api_url, unique_scooter_id):
+        """A body without a command is rejected."""
+        response = requests.post(f"{api_url}/debug/dryrun", json={"scooter_id": unique_scooter_id}, timeout=10)
+        assert response.status_code == 400
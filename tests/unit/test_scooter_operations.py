@@ -6,18 +6,22 @@ These tests verify the business logic of scooter operations:
 - State changes on reserve/release
 - Distance accumulation
 - Reservation ID tracking
+- Distance splits across co-riders
 
 Run with: pytest tests/unit/test_scooter_operations.py -v
 """
 
 import pytest
+import requests
+import time
 import sys
 import os
 
 sys.path.insert(0, os.path.dirname(os.path.dirname(os.path.abspath(__file__))))
 from conftest import (
     create_scooter, get_scooter,
-    reserve_scooter, release_scooter
+    reserve_scooter, release_scooter,
+    put_cluster_config, wait_for_config
 )
 
 
@@ -79,6 +83,43 @@ class TestReleaseChangesState:
         assert scooter["is_available"] == True
 
 
+class TestReleaseSpeedCheck:
+    """Tests for rejecting releases that imply an impossible speed."""
+
+    MAX_SPEED_KMH = 60
+
+    @pytest.fixture(autouse=True)
+    def speed_limit(self, api_url, etcd_url):
+        assert put_cluster_config(etcd_url, "max_speed_kmh", str(self.MAX_SPEED_KMH)).status_code == 200
+        assert wait_for_config(api_url, "max_speed_kmh", self.MAX_SPEED_KMH)
+        yield
+        put_cluster_config(etcd_url, "max_speed_kmh", "0")
+        wait_for_config(api_url, "max_speed_kmh", 0)
+
+    def test_plausible_release_accepted(self, api_url, unique_scooter_id, unique_reservation_id):
+        """10 meters in over a second is well under the limit."""
+        create_scooter(api_url, unique_scooter_id)
+        reserve_scooter(api_url, unique_scooter_id, unique_reservation_id)
+        time.sleep(1.5)
+
+        response = release_scooter(api_url, unique_scooter_id, 10)
+
+        assert response.status_code == 200
+        assert get_scooter(api_url, unique_scooter_id).json()["total_distance"] == 10
+
+    def test_implausible_release_rejected(self, api_url, unique_scooter_id, unique_reservation_id):
+        """100 km within a few seconds is rejected and the scooter stays reserved."""
+        create_scooter(api_url, unique_scooter_id)
+        reserve_scooter(api_url, unique_scooter_id, unique_reservation_id)
+
+        response = release_scooter(api_url, unique_scooter_id, 100000)
+
+        assert response.status_code == 400
+        scooter = get_scooter(api_url, unique_scooter_id).json()
+        assert scooter["is_available"] == False
+        assert scooter["total_distance"] == 0
+
+
 class TestDistanceAccumulation:
     """Tests for distance tracking."""
 
@@ -222,3 +263,422 @@ class TestFullLifecycle:
         # Check final distance: 10+20+30+40+50 = 150
         response = get_scooter(api_url, unique_scooter_id)
         assert response.json()["total_distance"] == 150
+
+
+class TestRelabel:
+    """Tests for changing a scooter's external ID."""
+
+    def relabel(self, api_url, scooter_id, new_id):
+        return requests.post(
+            f"{api_url}/scooters/{scooter_id}/relabel",
+            json={"new_id": new_id},
+            timeout=60
+        )
+
+    def test_relabel_preserves_distance(self, api_url, unique_scooter_id):
+        """The scooter moves to the new ID with its distance intact."""
+        new_id = f"{unique_scooter_id}-new"
+        create_scooter(api_url, unique_scooter_id)
+        reserve_scooter(api_url, unique_scooter_id, "res-relabel")
+        release_scooter(api_url, unique_scooter_id, 42)
+
+        response = self.relabel(api_url, unique_scooter_id, new_id)
+
+        assert response.status_code == 200
+        assert get_scooter(api_url, unique_scooter_id).status_code == 404
+        scooter = get_scooter(api_url, new_id).json()
+        assert scooter["id"] == new_id
+        assert scooter["total_distance"] == 42
+
+    def test_relabel_to_existing_id_conflicts(self, api_url, unique_scooter_id):
+        """Relabeling onto an ID that's taken returns 409."""
+        other_id = f"{unique_scooter_id}-other"
+        create_scooter(api_url, unique_scooter_id)
+        create_scooter(api_url, other_id)
+
+        response = self.relabel(api_url, unique_scooter_id, other_id)
+
+        assert response.status_code == 409
+        assert get_scooter(api_url, unique_scooter_id).status_code == 200
+
+
+class TestMerge:
+    """Tests for merging one scooter's record into another after a hardware swap."""
+
+    def merge(self, api_url, scooter_id, source_id):
+        return requests.post(
+            f"{api_url}/scooters/{scooter_id}/merge",
+            json={"source_id": source_id},
+            timeout=60
+        )
+
+    def test_merge_sums_distance_and_deletes_source(self, api_url, unique_scooter_id):
+        """The target gains the source's distance and the source is gone."""
+        source_id = f"{unique_scooter_id}-old"
+        create_scooter(api_url, unique_scooter_id)
+        create_scooter(api_url, source_id)
+        reserve_scooter(api_url, unique_scooter_id, "res-merge-target")
+        release_scooter(api_url, unique_scooter_id, 30)
+        reserve_scooter(api_url, source_id, "res-merge-source")
+        release_scooter(api_url, source_id, 12)
+        version = get_scooter(api_url, unique_scooter_id).json()["version"]
+
+        response = self.merge(api_url, unique_scooter_id, source_id)
+
+        assert response.status_code == 200, response.text
+        assert response.json()["scooter"]["total_distance"] == 42
+        assert get_scooter(api_url, source_id).status_code == 404
+        scooter = get_scooter(api_url, unique_scooter_id).json()
+        assert scooter["total_distance"] == 42
+        assert scooter["version"] == version + 1
+
+    def test_merge_reserved_source_conflicts(self, api_url, unique_scooter_id):
+        """A reserved source can't be merged; both scooters are left as they were."""
+        source_id = f"{unique_scooter_id}-old"
+        create_scooter(api_url, unique_scooter_id)
+        create_scooter(api_url, source_id)
+        reserve_scooter(api_url, source_id, "res-merge-reserved")
+
+        response = self.merge(api_url, unique_scooter_id, source_id)
+
+        assert response.status_code == 409
+        assert get_scooter(api_url, source_id).json()["is_available"] is False
+        assert get_scooter(api_url, unique_scooter_id).status_code == 200
+
+    def test_merge_into_itself_rejected(self, api_url, unique_scooter_id):
+        """Source and target must differ."""
+        create_scooter(api_url, unique_scooter_id)
+
+        response = self.merge(api_url, unique_scooter_id, unique_scooter_id)
+
+        assert response.status_code == 400
+
+
+class TestServiceState:
+    """Tests for taking scooters out of service."""
+
+    def set_service(self, api_url, scooter_id, out_of_service):
+        return requests.post(
+            f"{api_url}/scooters/{scooter_id}/service",
+            json={"out_of_service": out_of_service},
+            timeout=60
+        )
+
+    def test_out_of_service_cannot_be_reserved(self, api_url, unique_scooter_id, unique_reservation_id):
+        """An out-of-service scooter is listed as such and can't be reserved."""
+        create_scooter(api_url, unique_scooter_id)
+
+        assert self.set_service(api_url, unique_scooter_id, True).status_code == 200
+        scooter = get_scooter(api_url, unique_scooter_id).json()
+        assert scooter["out_of_service"] == True
+
+        response = reserve_scooter(api_url, unique_scooter_id, unique_reservation_id)
+        assert response.status_code == 409
+        assert get_scooter(api_url, unique_scooter_id).json()["is_available"] == True
+
+    def test_return_to_service_allows_reservation(self, api_url, unique_scooter_id, unique_reservation_id):
+        """Returning a scooter to service makes it reservable again, history intact."""
+        create_scooter(api_url, unique_scooter_id)
+        reserve_scooter(api_url, unique_scooter_id, "before-repair")
+        release_scooter(api_url, unique_scooter_id, 30)
+        self.set_service(api_url, unique_scooter_id, True)
+
+        assert self.set_service(api_url, unique_scooter_id, False).status_code == 200
+
+        response = reserve_scooter(api_url, unique_scooter_id, unique_reservation_id)
+        assert response.status_code == 200
+        assert get_scooter(api_url, unique_scooter_id).json()["total_distance"] == 30
+
+    def test_service_requires_state(self, api_url, unique_scooter_id):
+        """A body without out_of_service is rejected."""
+        create_scooter(api_url, unique_scooter_id)
+
+        response = requests.post(f"{api_url}/scooters/{unique_scooter_id}/service", json={}, timeout=10)
+
+        assert response.status_code == 400
+
+
+class TestReservationToken:
+    """A reservation hands out a token that the release must present."""
+
+    def test_reserve_returns_token(self, api_url, unique_scooter_id, unique_reservation_id):
+        """The token comes back on reserve but never on reads."""
+        create_scooter(api_url, unique_scooter_id)
+
+        response = reserve_scooter(api_url, unique_scooter_id, unique_reservation_id)
+
+        assert response.status_code == 200
+        assert response.json()["reservation_token"]
+        assert "reservation_token" not in get_scooter(api_url, unique_scooter_id).json()
+
+    def test_release_requires_token(self, api_url, unique_scooter_id, unique_reservation_id):
+        """Releasing with a missing or wrong token is forbidden; the right one works."""
+        create_scooter(api_url, unique_scooter_id)
+        token = reserve_scooter(api_url, unique_scooter_id, unique_reservation_id).json()["reservation_token"]
+
+        assert release_scooter(api_url, unique_scooter_id, 10, reservation_token="").status_code == 403
+        assert release_scooter(api_url, unique_scooter_id, 10, reservation_token="not-the-token").status_code == 403
+        assert get_scooter(api_url, unique_scooter_id).json()["is_available"] == False
+
+        response = release_scooter(api_url, unique_scooter_id, 10, reservation_token=token)
+        assert response.status_code == 200
+        assert get_scooter(api_url, unique_scooter_id).json()["total_distance"] == 10
+
+    def test_token_is_per_reservation(self, api_url, unique_scooter_id, unique_reservation_id):
+        """A token from an earlier reservation can't release a later one."""
+        create_scooter(api_url, unique_scooter_id)
+        old_token = reserve_scooter(api_url, unique_scooter_id, "first").json()["reservation_token"]
+        release_scooter(api_url, unique_scooter_id, 1, reservation_token=old_token)
+        new_token = reserve_scooter(api_url, unique_scooter_id, unique_reservation_id).json()["reservation_token"]
+
+        assert new_token != old_token
+        assert release_scooter(api_url, unique_scooter_id, 1, reservation_token=old_token).status_code == 403
+
+
+class TestDistanceSplit:
+    """A release can split its distance across co-riders for billing."""
+
+    def release_split(self, api_url, scooter_id, distance, split):
+        token = reserve_scooter(api_url, scooter_id, f"{scooter_id}-ride").json()["reservation_token"]
+        return requests.post(
+            f"{api_url}/scooters/{scooter_id}/releases",
+            json={"distance": distance, "reservation_token": token, "distance_split": split},
+            timeout=60
+        )
+
+    def client_distance(self, api_url, client_id):
+        response = requests.get(f"{api_url}/clients/{client_id}/distance", timeout=10)
+        assert response.status_code == 200
+        return response.json()["distance"]
+
+    def test_split_release_credits_each_client(self, api_url, unique_scooter_id):
+        """Each co-rider is credited their share, and shares add up across rides."""
+        alice, bob = f"{unique_scooter_id}-alice", f"{unique_scooter_id}-bob"
+        create_scooter(api_url, unique_scooter_id)
+
+        response = self.release_split(api_url, unique_scooter_id, 100, {alice: 60, bob: 40})
+        assert response.status_code == 200
+        response = self.release_split(api_url, unique_scooter_id, 30, {alice: 30})
+        assert response.status_code == 200
+
+        assert self.client_distance(api_url, alice) == 90
+        assert self.client_distance(api_url, bob) == 40
+        assert get_scooter(api_url, unique_scooter_id).json()["total_distance"] == 130
+
+    def test_split_sum_mismatch_rejected(self, api_url, unique_scooter_id):
+        """Shares that don't add up to the distance are rejected and the ride stays open."""
+        alice, bob = f"{unique_scooter_id}-alice", f"{unique_scooter_id}-bob"
+        create_scooter(api_url, unique_scooter_id)
+
+        response = self.release_split(api_url, unique_scooter_id, 100, {alice: 60, bob: 30})
+
+        assert response.status_code == 400
+        scooter = get_scooter(api_url, unique_scooter_id).json()
+        assert scooter["is_available"] == False
+        assert scooter["total_distance"] == 0
+        assert self.client_distance(api_url, alice) == 0
+
+
+class TestTransactions:
+    """POST /transactions applies several operations all or nothing."""
+
+    def transact(self, api_url, operations):
+        return requests.post(f"{api_url}/transactions", json={"operations": operations}, timeout=60)
+
+    def test_valid_transaction_reserves_all(self, api_url, unique_scooter_id):
+        """Every scooter in a fully valid transaction is reserved."""
+        ids = [f"{unique_scooter_id}-{i}" for i in range(3)]
+        for scooter_id in ids:
+            create_scooter(api_url, scooter_id)
+
+        response = self.transact(api_url, [
+            {"type": "reserve", "scooter_id": scooter_id, "reservation_id": f"fleet-{scooter_id}"}
+            for scooter_id in ids
+        ])
+
+        assert response.status_code == 200, response.text
+        assert sorted(r["scooter_id"] for r in response.json()["reservations"]) == sorted(ids)
+        for scooter_id in ids:
+            assert get_scooter(api_url, scooter_id).json()["is_available"] == False
+
+    def test_one_unavailable_scooter_reserves_none(self, api_url, unique_scooter_id):
+        """If one scooter is taken the whole transaction is rejected and nothing changes."""
+        ids = [f"{unique_scooter_id}-{i}" for i in range(3)]
+        for scooter_id in ids:
+            create_scooter(api_url, scooter_id)
+        reserve_scooter(api_url, ids[1], "already-taken")
+        versions = {sid: get_scooter(api_url, sid).json()["version"] for sid in ids}
+
+        response = self.transact(api_url, [
+            {"type": "reserve", "scooter_id": scooter_id, "reservation_id": f"fleet-{scooter_id}"}
+            for scooter_id in ids
+        ])
+
+        assert response.status_code == 409
+        for scooter_id in (ids[0], ids[2]):
+            scooter = get_scooter(api_url, scooter_id).json()
+            assert scooter["is_available"] == True
+            assert scooter["version"] == versions[scooter_id]
+
+    def test_reserve_and_release_together(self, api_url, unique_scooter_id):
+        """A release and a reserve in one transaction both take effect."""
+        returning, outgoing = f"{unique_scooter_id}-in", f"{unique_scooter_id}-out"
+        create_scooter(api_url, returning)
+        create_scooter(api_url, outgoing)
+        token = reserve_scooter(api_url, returning, "trip").json()["reservation_token"]
+
+        response = self.transact(api_url, [
+            {"type": "release", "scooter_id": returning, "distance": 5, "reservation_token": token},
+            {"type": "reserve", "scooter_id": outgoing, "reservation_id": "next-trip"},
+        ])
+
+        assert response.status_code == 200, response.text
+        assert get_scooter(api_url, returning).json()["is_available"] == True
+        assert get_scooter(api_url, outgoing).json()["is_available"] == False
+
+    def test_unknown_operation_rejected(self, api_url, unique_scooter_id):
+        """Only reserve and release are accepted."""
+        create_scooter(api_url, unique_scooter_id)
+
+        response = self.transact(api_url, [{"type": "relabel", "scooter_id": unique_scooter_id}])
+
+        assert response.status_code == 400
+
+
+class TestScooterImport:
+    """POST /scooters/import creates scooters from CSV rows."""
+
+    def test_import_mixed_rows(self, api_url, unique_scooter_id):
+        """New rows are created; existing and malformed rows are reported, not fatal."""
+        existing = f"{unique_scooter_id}-old"
+        new_ids = [f"{unique_scooter_id}-new-{i}" for i in range(2)]
+        create_scooter(api_url, existing)
+
+        csv_body = "\n".join([
+            "id,lat,lng",
+            f"{new_ids[0]},52.52,13.40",
+            f"{existing},52.50,13.41",
+            f"{unique_scooter_id}-bad,north,13.42",
+            f"{new_ids[1]},,",
+        ]) + "\n"
+
+        response = requests.post(
+            f"{api_url}/scooters/import",
+            data=csv_body,
+            headers={"Content-Type": "text/csv"},
+            timeout=60
+        )
+
+        assert response.status_code == 200
+        result = response.json()
+        statuses = {r["id"]: r["status"] for r in result["results"]}
+        assert statuses[new_ids[0]] == "created"
+        assert statuses[new_ids[1]] == "created"
+        assert statuses[existing] == "exists"
+        assert statuses[f"{unique_scooter_id}-bad"] == "invalid"
+        assert result["created"] == 2
+        assert result["failed"] == 2
+
+        located = get_scooter(api_url, new_ids[0]).json()
+        assert located["location"] == {"lat": 52.52, "lng": 13.40}
+        assert "location" not in get_scooter(api_url, new_ids[1]).json()
+
+
+class TestScooterSearch:
+    """GET /scooters/search combines filters in one pass."""
+
+    # A box no other test places scooters in
+    BOX = {"min_lat": 12.3450, "max_lat": 12.3460, "min_lng": 45.6780, "max_lng": 45.6790}
+
+    def setup_fleet(self, api_url, prefix, reservation_id):
+        """Three scooters in the box (idle, reserved, ridden) and one outside."""
+        ids = {name: f"{prefix}-{name}" for name in ["idle", "reserved", "ridden", "outside"]}
+        csv_body = "\n".join([
+            f"{ids['idle']},12.3451,45.6781",
+            f"{ids['reserved']},12.3452,45.6782",
+            f"{ids['ridden']},12.3453,45.6783",
+            f"{ids['outside']},12.3500,45.6783",
+        ]) + "\n"
+        response = requests.post(f"{api_url}/scooters/import", data=csv_body, timeout=60)
+        assert response.json()["created"] == 4
+
+        reserve_scooter(api_url, ids["reserved"], reservation_id)
+        token = reserve_scooter(api_url, ids["ridden"], f"{reservation_id}-ride").json()["reservation_token"]
+        assert release_scooter(api_url, ids["ridden"], 5, token).status_code == 200
+        return ids
+
+    def search(self, api_url, **params):
+        response = requests.get(f"{api_url}/scooters/search", params=params, timeout=10)
+        assert response.status_code == 200, response.text
+        return {scooter["id"] for scooter in response.json()}
+
+    def test_filter_combinations(self, api_url, unique_scooter_id, unique_reservation_id):
+        """Each added filter narrows the matches."""
+        ids = self.setup_fleet(api_url, unique_scooter_id, unique_reservation_id)
+        in_box = {ids["idle"], ids["reserved"], ids["ridden"]}
+
+        assert self.search(api_url, **self.BOX) >= in_box
+        assert ids["outside"] not in self.search(api_url, **self.BOX)
+        assert self.search(api_url, available="false", **self.BOX) == {ids["reserved"]}
+        assert self.search(api_url, available="true", min_distance=1, **self.BOX) == {ids["ridden"]}
+        assert self.search(api_url, available="true", max_distance=0, **self.BOX) == {ids["idle"]}
+
+    def test_search_linearizable(self, api_url, unique_scooter_id, unique_reservation_id):
+        """The linearizable flag is honoured like on GET /scooters."""
+        ids = self.setup_fleet(api_url, unique_scooter_id, unique_reservation_id)
+
+        matches = self.search(api_url, linearizable="true", out_of_service="false", **self.BOX)
+
+        assert {ids["idle"], ids["reserved"], ids["ridden"]} <= matches
+
+    def test_invalid_filters(self, api_url):
+        """Malformed values and partial boxes are rejected."""
+        for params in [{"available": "maybe"}, {"min_distance": "far"}, {"min_lat": 1},
+                       {"min_distance": 10, "max_distance": 1}]:
+            response = requests.get(f"{api_url}/scooters/search", params=params, timeout=10)
+            assert response.status_code == 400, params
+
+
+class TestDistanceLeaderboard:
+    """GET /scooters/top ranks scooters by total distance."""
+
+    def top(self, api_url, **params):
+        response = requests.get(f"{api_url}/scooters/top", params=params, timeout=10)
+        assert response.status_code == 200, response.text
+        return response.json()
+
+    def ride(self, api_url, scooter_id, distance):
+        create_scooter(api_url, scooter_id)
+        reserve_scooter(api_url, scooter_id, f"{scooter_id}-ride")
+        assert release_scooter(api_url, scooter_id, distance).status_code == 200
+
+    def test_top_n_in_descending_order_with_ties_by_id(self, api_url, unique_scooter_id):
+        """Three scooters ridden past everyone else come back highest first, a tie ordered by ID."""
+        leader = self.top(api_url, n=1)
+        base = int(leader[0]["total_distance"]) + 1000 if leader else 1000
+        ids = {name: f"{unique_scooter_id}-{name}" for name in ["a", "b", "c"]}
+        self.ride(api_url, ids["a"], base)
+        self.ride(api_url, ids["b"], base + 500)
+        self.ride(api_url, ids["c"], base + 500)
+
+        top = self.top(api_url, n=3, linearizable="true")
+
+        assert [scooter["id"] for scooter in top] == [ids["b"], ids["c"], ids["a"]]
+        assert [scooter["total_distance"] for scooter in top] == [base + 500, base + 500, base]
+        assert [scooter["id"] for scooter in self.top(api_url, n=2)] == [ids["b"], ids["c"]]
+
+    def test_whole_list_is_ordered(self, api_url, unique_scooter_id):
+        """Every ranking is by distance descending, then ID."""
+        create_scooter(api_url, unique_scooter_id)
+
+        top = self.top(api_url, n=1000)
+
+        keys = [(-scooter["total_distance"], scooter["id"]) for scooter in top]
+        assert keys == sorted(keys)
+        assert "reservation_token" not in str(top)
+
+    def test_invalid_n(self, api_url):
+        """n must be a whole number from 1 to 1000."""
+        for n in ["0", "-3", "ten", "1001"]:
+            response = requests.get(f"{api_url}/scooters/top", params={"n": n}, timeout=10)
+            assert response.status_code == 400, n